@@ -0,0 +1,68 @@
+package okex
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_AccountLock(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handle(GET, ACCOUNT_ONHOLD, `[{"currency":"btc","size":"1.5"}]`)
+	s.handle(POST, ACCOUNT_LOCK, `{"result":true,"currency":"btc","size":"1.5"}`)
+	s.handle(POST, ACCOUNT_UNLOCK, `{"result":true,"currency":"btc","size":"0.5"}`)
+	c := s.client()
+
+	holds, err := c.GetAccountOnHold("btc")
+	require.True(t, err == nil, err)
+	assert.Equal(t, []AccountOnHold{{Currency: "btc", Size: "1.5"}}, *holds)
+	assert.Equal(t, "currency=btc", s.lastRequest().RawQuery)
+
+	_, err = c.GetAccountOnHold("")
+	require.True(t, err == nil, err)
+	assert.Equal(t, "", s.lastRequest().RawQuery)
+
+	r, err := c.PostAccountLock("btc", "1.5")
+	require.True(t, err == nil, err)
+	assert.True(t, r.Result)
+	assert.Equal(t, `{"currency":"btc","size":"1.5"}`, s.lastRequest().Body)
+
+	r, err = c.PostAccountUnlock("btc", "0.5")
+	require.True(t, err == nil, err)
+	assert.Equal(t, "0.5", r.Size)
+	assert.Equal(t, ACCOUNT_UNLOCK, s.lastRequest().Path)
+}
+
+func TestClient_AccountSubAccounts(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handle(GET, ACCOUNT_SUB_ACCOUNT_LIST, `[{"sub_account":"sub01","uid":"101","label":"mm"},{"sub_account":"sub02","uid":"102"}]`)
+	s.handle(GET, ACCOUNT_SUB_ACCOUNT, `{"data":{"uid":"101","sub_account":"sub01","asset_valuation":"1.2",
+		"account_type:wallet":[{"currency":"BTC","balance":"1","hold":"0","available":"1"}],
+		"account_type:spot":[{"currency":"USDT","balance":"100","hold":"10","available":"90"}],
+		"account_type:futures":[{"currency":"BTC","underlying":"BTC-USD","balance":"0.2","equity":"0.21","max_withdraw":"0.1"}],
+		"account_type:swap":[]}}`)
+	c := s.client()
+
+	subs, err := c.GetAccountSubAccounts()
+	require.True(t, err == nil, err)
+	require.Equal(t, 2, len(*subs))
+	assert.Equal(t, "sub02", (*subs)[1].SubAccount)
+
+	balances, err := c.GetAccountSubAccountBalances("sub01")
+	require.True(t, err == nil, err)
+	assert.Equal(t, "sub-account=sub01", s.lastRequest().RawQuery)
+	assert.Equal(t, "1.2", balances.AssetValuation)
+	assert.Equal(t, "0.21", balances.Futures[0].Equity)
+	assert.Equal(t, 0, len(balances.Swap))
+
+	wallet, err := c.GetAccountSubAccountWallet("sub01")
+	require.True(t, err == nil, err)
+	assert.Equal(t, "1", (*wallet)[0].Available)
+
+	spot, err := c.GetAccountSubAccountSpot("sub01")
+	require.True(t, err == nil, err)
+	assert.Equal(t, "10", (*spot)[0].Hold)
+}
@@ -0,0 +1,168 @@
+package okex
+
+import (
+	"errors"
+	"strings"
+)
+
+/*
+ OKEX account api request params
+*/
+
+/*
+Account types of a transfer, the values are the codes of the api but the sub-account: its code 0
+is the zero value, which is left invalid so that an account type not set is rejected.
+*/
+type AccountType int
+
+const (
+	ACCOUNT_TYPE_SUB_ACCOUNT AccountType = -1
+	ACCOUNT_TYPE_SPOT        AccountType = 1
+	ACCOUNT_TYPE_FUTURES     AccountType = 3
+	ACCOUNT_TYPE_C2C         AccountType = 4
+	ACCOUNT_TYPE_MARGIN      AccountType = 5
+	ACCOUNT_TYPE_WALLET      AccountType = 6
+	ACCOUNT_TYPE_ETT         AccountType = 7
+	ACCOUNT_TYPE_SWAP        AccountType = 9
+)
+
+var accountTypeNames = map[AccountType]string{
+	ACCOUNT_TYPE_SUB_ACCOUNT: "sub-account",
+	ACCOUNT_TYPE_SPOT:        "spot",
+	ACCOUNT_TYPE_FUTURES:     "futures",
+	ACCOUNT_TYPE_C2C:         "c2c",
+	ACCOUNT_TYPE_MARGIN:      "margin",
+	ACCOUNT_TYPE_WALLET:      "wallet",
+	ACCOUNT_TYPE_ETT:         "ett",
+	ACCOUNT_TYPE_SWAP:        "swap",
+}
+
+func (t AccountType) String() string {
+	if name, ok := accountTypeNames[t]; ok {
+		return name
+	}
+	return "unknown(" + Int2String(int(t)) + ")"
+}
+
+/*
+Account type of a name returned by String, eg: "wallet".
+*/
+func ParseAccountType(name string) (AccountType, bool) {
+	for t, n := range accountTypeNames {
+		if strings.EqualFold(n, name) {
+			return t, true
+		}
+	}
+	return 0, false
+}
+
+func (t AccountType) Valid() bool {
+	_, ok := accountTypeNames[t]
+	return ok
+}
+
+/*
+Code of the account type in the requests.
+*/
+func (t AccountType) code() string {
+	if t == ACCOUNT_TYPE_SUB_ACCOUNT {
+		return "0"
+	}
+	return Int2String(int(t))
+}
+
+var (
+	ERR_TRANSFER_ACCOUNT_TYPE       = errors.New(`transfer: unknown from or to account type`)
+	ERR_TRANSFER_SAME_ACCOUNT       = errors.New(`transfer: from and to are the same account`)
+	ERR_TRANSFER_CURRENCY           = errors.New(`transfer: currency is required`)
+	ERR_TRANSFER_AMOUNT             = errors.New(`transfer: amount must be greater than 0`)
+	ERR_TRANSFER_SUB_ACCOUNT        = errors.New(`transfer: sub_account is required for a sub-account transfer`)
+	ERR_TRANSFER_INSTRUMENT_ID      = errors.New(`transfer: instrument_id is required when transferring from a margin account`)
+	ERR_TRANSFER_TO_INSTRUMENT_ID   = errors.New(`transfer: to_instrument_id is required when transferring to a margin account`)
+	ERR_TRANSFER_SUB_ACCOUNT_WALLET = errors.New(`transfer: a sub-account can only transfer from or to the wallet`)
+)
+
+/*
+Funds transfer between the accounts of the same user or a sub-account.
+SubAccount: name of the sub-account, required when From or To is ACCOUNT_TYPE_SUB_ACCOUNT
+InstrumentId: margin pair transferred from, required when From is ACCOUNT_TYPE_MARGIN
+ToInstrumentId: margin pair transferred to, required when To is ACCOUNT_TYPE_MARGIN
+
+	eg: NewTransfer("usdt", "100", ACCOUNT_TYPE_WALLET, ACCOUNT_TYPE_MARGIN).WithToInstrumentId("BTC-USDT")
+*/
+type Transfer struct {
+	Currency       string
+	Amount         string
+	From           AccountType
+	To             AccountType
+	SubAccount     string
+	InstrumentId   string
+	ToInstrumentId string
+}
+
+func NewTransfer(currency, amount string, from, to AccountType) *Transfer {
+	return &Transfer{Currency: currency, Amount: amount, From: from, To: to}
+}
+
+func (t *Transfer) WithSubAccount(subAccount string) *Transfer {
+	t.SubAccount = subAccount
+	return t
+}
+
+func (t *Transfer) WithInstrumentId(instrumentId string) *Transfer {
+	t.InstrumentId = instrumentId
+	return t
+}
+
+func (t *Transfer) WithToInstrumentId(toInstrumentId string) *Transfer {
+	t.ToInstrumentId = toInstrumentId
+	return t
+}
+
+func (t *Transfer) Validate() error {
+	if !t.From.Valid() || !t.To.Valid() {
+		return ERR_TRANSFER_ACCOUNT_TYPE
+	}
+	if t.Currency == "" {
+		return ERR_TRANSFER_CURRENCY
+	}
+	if toFloat(t.Amount) <= 0 {
+		return ERR_TRANSFER_AMOUNT
+	}
+	if t.From == ACCOUNT_TYPE_SUB_ACCOUNT || t.To == ACCOUNT_TYPE_SUB_ACCOUNT {
+		if t.SubAccount == "" {
+			return ERR_TRANSFER_SUB_ACCOUNT
+		}
+		if t.From != ACCOUNT_TYPE_WALLET && t.To != ACCOUNT_TYPE_WALLET {
+			return ERR_TRANSFER_SUB_ACCOUNT_WALLET
+		}
+	}
+	if t.From == ACCOUNT_TYPE_MARGIN && t.InstrumentId == "" {
+		return ERR_TRANSFER_INSTRUMENT_ID
+	}
+	if t.To == ACCOUNT_TYPE_MARGIN && t.ToInstrumentId == "" {
+		return ERR_TRANSFER_TO_INSTRUMENT_ID
+	}
+	if t.From == t.To && (t.From != ACCOUNT_TYPE_MARGIN || t.InstrumentId == t.ToInstrumentId) {
+		return ERR_TRANSFER_SAME_ACCOUNT
+	}
+	return nil
+}
+
+func (t *Transfer) params() map[string]string {
+	params := NewParams()
+	params["currency"] = t.Currency
+	params["amount"] = t.Amount
+	params["from"] = t.From.code()
+	params["to"] = t.To.code()
+	if t.SubAccount != "" {
+		params["sub_account"] = t.SubAccount
+	}
+	if t.InstrumentId != "" {
+		params["instrument_id"] = t.InstrumentId
+	}
+	if t.ToInstrumentId != "" {
+		params["to_instrument_id"] = t.ToInstrumentId
+	}
+	return params
+}
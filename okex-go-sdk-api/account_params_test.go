@@ -0,0 +1,61 @@
+package okex
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransfer_Validate(t *testing.T) {
+	cases := []struct {
+		transfer *Transfer
+		err      error
+	}{
+		{NewTransfer("btc", "1", ACCOUNT_TYPE_WALLET, ACCOUNT_TYPE_SPOT), nil},
+		{NewTransfer("btc", "1", AccountType(2), ACCOUNT_TYPE_SPOT), ERR_TRANSFER_ACCOUNT_TYPE},
+		{&Transfer{Currency: "btc", Amount: "1", From: ACCOUNT_TYPE_WALLET, SubAccount: "sub1"}, ERR_TRANSFER_ACCOUNT_TYPE},
+		{NewTransfer("", "1", ACCOUNT_TYPE_WALLET, ACCOUNT_TYPE_SPOT), ERR_TRANSFER_CURRENCY},
+		{NewTransfer("btc", "0", ACCOUNT_TYPE_WALLET, ACCOUNT_TYPE_SPOT), ERR_TRANSFER_AMOUNT},
+		{NewTransfer("btc", "1", ACCOUNT_TYPE_SPOT, ACCOUNT_TYPE_SPOT), ERR_TRANSFER_SAME_ACCOUNT},
+		{NewTransfer("btc", "1", ACCOUNT_TYPE_WALLET, ACCOUNT_TYPE_SUB_ACCOUNT), ERR_TRANSFER_SUB_ACCOUNT},
+		{NewTransfer("btc", "1", ACCOUNT_TYPE_SPOT, ACCOUNT_TYPE_SUB_ACCOUNT).WithSubAccount("sub1"), ERR_TRANSFER_SUB_ACCOUNT_WALLET},
+		{NewTransfer("btc", "1", ACCOUNT_TYPE_SUB_ACCOUNT, ACCOUNT_TYPE_WALLET).WithSubAccount("sub1"), nil},
+		{NewTransfer("usdt", "1", ACCOUNT_TYPE_MARGIN, ACCOUNT_TYPE_SPOT), ERR_TRANSFER_INSTRUMENT_ID},
+		{NewTransfer("usdt", "1", ACCOUNT_TYPE_SPOT, ACCOUNT_TYPE_MARGIN), ERR_TRANSFER_TO_INSTRUMENT_ID},
+		{NewTransfer("usdt", "1", ACCOUNT_TYPE_MARGIN, ACCOUNT_TYPE_MARGIN).WithInstrumentId("BTC-USDT").WithToInstrumentId("BTC-USDT"), ERR_TRANSFER_SAME_ACCOUNT},
+		{NewTransfer("usdt", "1", ACCOUNT_TYPE_MARGIN, ACCOUNT_TYPE_MARGIN).WithInstrumentId("BTC-USDT").WithToInstrumentId("ETH-USDT"), nil},
+	}
+	for i, c := range cases {
+		assert.Equal(t, c.err, c.transfer.Validate(), "case %d", i)
+	}
+	assert.Equal(t, "wallet", ACCOUNT_TYPE_WALLET.String())
+	assert.Equal(t, "unknown(2)", AccountType(2).String())
+	assert.Equal(t, "unknown(0)", AccountType(0).String())
+	accountType, ok := ParseAccountType("Margin")
+	assert.True(t, ok)
+	assert.Equal(t, ACCOUNT_TYPE_MARGIN, accountType)
+	_, ok = ParseAccountType("unknown(2)")
+	assert.False(t, ok)
+}
+
+func TestClient_PostAccountTransferBy(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handle(POST, ACCOUNT_TRANSFER, `{"transfer_id":"754147","currency":"USDT","from":"6","amount":"0.1","to":"5","result":true}`)
+	client := s.client()
+
+	_, err := client.PostAccountTransferBy(NewTransfer("usdt", "0.1", ACCOUNT_TYPE_WALLET, ACCOUNT_TYPE_MARGIN))
+	assert.Equal(t, ERR_TRANSFER_TO_INSTRUMENT_ID, err)
+	assert.Equal(t, 0, len(s.requestsTo(POST, ACCOUNT_TRANSFER)))
+
+	r, err := client.PostAccountTransferBy(NewTransfer("usdt", "0.1", ACCOUNT_TYPE_WALLET, ACCOUNT_TYPE_MARGIN).WithToInstrumentId("BTC-USDT"))
+	require.True(t, err == nil, err)
+	assert.True(t, r.Result)
+	assert.Equal(t, "754147", r.TransferId)
+	assert.JSONEq(t, `{"currency":"usdt","amount":"0.1","from":"6","to":"5","to_instrument_id":"BTC-USDT"}`, s.lastRequest().Body)
+
+	_, err = client.PostAccountTransferBy(NewTransfer("usdt", "0.1", ACCOUNT_TYPE_SUB_ACCOUNT, ACCOUNT_TYPE_WALLET).WithSubAccount("sub1"))
+	require.True(t, err == nil, err)
+	assert.JSONEq(t, `{"currency":"usdt","amount":"0.1","from":"0","to":"6","sub_account":"sub1"}`, s.lastRequest().Body)
+}
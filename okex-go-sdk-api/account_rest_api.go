@@ -246,3 +246,151 @@ func (client *Client) PostAccountTransfer(
 
 	return &r, nil
 }
+
+/*
+资金划转
+使用Transfer划转，按转出和转入账户类型校验必填字段。
+
+	eg: client.PostAccountTransferBy(NewTransfer("btc", "0.1", ACCOUNT_TYPE_WALLET, ACCOUNT_TYPE_SPOT))
+
+HTTP请求
+POST /api/account/v3/transfer
+*/
+func (client *Client) PostAccountTransferBy(transfer *Transfer) (*TransferResult, error) {
+	if transfer == nil {
+		return nil, ERR_TRANSFER_ACCOUNT_TYPE
+	}
+	if err := transfer.Validate(); err != nil {
+		return nil, err
+	}
+	r := TransferResult{}
+	if _, err := client.Request(POST, ACCOUNT_TRANSFER, transfer.params(), &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+/*
+锁定资金查询
+查询钱包账户被锁定的资金，currency为空时返回所有币种。
+
+HTTP请求
+GET /api/account/v3/onhold
+
+请求示例
+GET /api/account/v3/onhold?currency=btc
+*/
+func (client *Client) GetAccountOnHold(currency string) (*[]AccountOnHold, error) {
+	r := []AccountOnHold{}
+
+	uri := ACCOUNT_ONHOLD
+	if currency != "" {
+		params := NewParams()
+		params["currency"] = currency
+		uri = BuildParams(uri, params)
+	}
+
+	if _, err := client.Request(GET, uri, nil, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+/*
+锁定资金
+锁定钱包账户单个币种的资金，锁定后的资金不可用于交易或提币。
+
+HTTP请求
+POST /api/account/v3/lock
+*/
+func (client *Client) PostAccountLock(currency, size string) (*AccountLockResult, error) {
+	return client.postAccountLockOrUnlock(ACCOUNT_LOCK, currency, size)
+}
+
+/*
+解锁资金
+解锁通过PostAccountLock锁定的资金。
+
+HTTP请求
+POST /api/account/v3/unlock
+*/
+func (client *Client) PostAccountUnlock(currency, size string) (*AccountLockResult, error) {
+	return client.postAccountLockOrUnlock(ACCOUNT_UNLOCK, currency, size)
+}
+
+func (client *Client) postAccountLockOrUnlock(uri, currency, size string) (*AccountLockResult, error) {
+	r := AccountLockResult{}
+
+	lockInfo := map[string]string{}
+	lockInfo["currency"] = currency
+	lockInfo["size"] = size
+
+	if _, err := client.Request(POST, uri, lockInfo, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+/*
+子账户列表
+获取母账户下所有子账户。
+
+HTTP请求
+GET /api/account/v3/sub-account/list
+*/
+func (client *Client) GetAccountSubAccounts() (*[]SubAccount, error) {
+	r := []SubAccount{}
+
+	if _, err := client.Request(GET, ACCOUNT_SUB_ACCOUNT_LIST, nil, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+/*
+子账户资金
+获取单个子账户在钱包、币币、杠杆、交割和永续账户中的余额。
+
+HTTP请求
+GET /api/account/v3/sub-account
+
+请求示例
+GET /api/account/v3/sub-account?sub-account=subaccount01
+*/
+func (client *Client) GetAccountSubAccountBalances(subAccount string) (*SubAccountBalances, error) {
+	r := SubAccountBalancesResult{}
+
+	params := NewParams()
+	params["sub-account"] = subAccount
+	uri := BuildParams(ACCOUNT_SUB_ACCOUNT, params)
+
+	if _, err := client.Request(GET, uri, nil, &r); err != nil {
+		return nil, err
+	}
+	if r.Data.SubAccount == "" {
+		r.Data.SubAccount = subAccount
+	}
+	return &r.Data, nil
+}
+
+/*
+子账户钱包账户余额
+*/
+func (client *Client) GetAccountSubAccountWallet(subAccount string) (*[]SubAccountBalance, error) {
+	balances, err := client.GetAccountSubAccountBalances(subAccount)
+	if err != nil {
+		return nil, err
+	}
+	return &balances.Wallet, nil
+}
+
+/*
+子账户币币账户余额
+*/
+func (client *Client) GetAccountSubAccountSpot(subAccount string) (*[]SubAccountBalance, error) {
+	balances, err := client.GetAccountSubAccountBalances(subAccount)
+	if err != nil {
+		return nil, err
+	}
+	return &balances.Spot, nil
+}
@@ -0,0 +1,65 @@
+package okex
+
+/*
+ OKEX account api result definition
+*/
+
+type AccountOnHold struct {
+	Currency string `json:"currency"`
+	Size     string `json:"size"` // 锁定数量
+}
+
+type AccountLockResult struct {
+	BizWarmTips
+	Result   bool   `json:"result"`
+	Currency string `json:"currency"`
+	Size     string `json:"size"`
+}
+
+type SubAccount struct {
+	SubAccount string `json:"sub_account"` // 子账户名称
+	Uid        string `json:"uid"`
+	Label      string `json:"label"`
+	CreatedAt  string `json:"created_at"`
+}
+
+/*
+子账户在各业务线的余额，不同业务线只返回各自相关的字段:
+钱包/币币/杠杆: balance, hold, available; 交割/永续: balance, equity, max_withdraw, underlying
+*/
+type SubAccountBalance struct {
+	Currency     string `json:"currency"`
+	InstrumentId string `json:"instrument_id,omitempty"`
+	Underlying   string `json:"underlying,omitempty"`
+	Balance      string `json:"balance"`
+	Hold         string `json:"hold,omitempty"`
+	Available    string `json:"available,omitempty"`
+	Equity       string `json:"equity,omitempty"`
+	MaxWithdraw  string `json:"max_withdraw,omitempty"`
+}
+
+type SubAccountBalances struct {
+	Uid            string              `json:"uid"`
+	SubAccount     string              `json:"sub_account"`
+	AssetValuation string              `json:"asset_valuation"` // 子账户总资产估值(btc)
+	Wallet         []SubAccountBalance `json:"account_type:wallet"`
+	Spot           []SubAccountBalance `json:"account_type:spot"`
+	Margin         []SubAccountBalance `json:"account_type:margin"`
+	Futures        []SubAccountBalance `json:"account_type:futures"`
+	Swap           []SubAccountBalance `json:"account_type:swap"`
+}
+
+type SubAccountBalancesResult struct {
+	BizWarmTips
+	Data SubAccountBalances `json:"data"`
+}
+
+type TransferResult struct {
+	BizWarmTips
+	TransferId string `json:"transfer_id"`
+	Currency   string `json:"currency"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Amount     string `json:"amount"`
+	Result     bool   `json:"result"`
+}
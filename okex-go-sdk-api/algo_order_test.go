@@ -0,0 +1,96 @@
+package okex
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlgoOrderParams_Validate(t *testing.T) {
+	assert.True(t, NewTriggerAlgoOrder("BTC-USD-SWAP", CLOSE_LONG, "1", "9000", "", ALGO_TYPE_MARKET).Validate() == nil)
+	assert.True(t, NewTriggerAlgoOrder("BTC-USD-SWAP", CLOSE_LONG, "1", "9000", "", ALGO_TYPE_LIMIT).Validate() != nil)
+	assert.True(t, NewTrailAlgoOrder("BTC-USD-SWAP", CLOSE_SHORT, "1", "0.01", "9000").Validate() == nil)
+	assert.True(t, NewTrailAlgoOrder("BTC-USD-SWAP", CLOSE_SHORT, "1", "", "9000").Validate() != nil)
+	assert.True(t, NewIcebergAlgoOrder("BTC-USD-SWAP", OPEN_LONG, "100", "0.001", "10", "9000").Validate() == nil)
+	assert.True(t, NewTwapAlgoOrder("BTC-USD-SWAP", OPEN_LONG, "100", "0.001", "0.5", "10", "9000", "10").Validate() == nil)
+	assert.True(t, NewTwapAlgoOrder("BTC-USD-SWAP", OPEN_LONG, "100", "0.001", "0.5", "10", "9000", "").Validate() != nil)
+
+	var p *AlgoOrderParams
+	assert.True(t, p.Validate() != nil)
+}
+
+func TestClient_FuturesAlgoOrders(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handle(POST, FUTURES_ORDER_ALGO, `{"result":true,"error_message":"","error_code":"","algo_id":"1345","instrument_id":"BTC-USD-190628","order_type":"1"}`)
+	s.handle(POST, FUTURES_CANCEL_ALGOS, `{"result":true,"algo_ids":["1345"],"instrument_id":"BTC-USD-190628"}`)
+	s.handle(GET, "/api/futures/v3/order_algo/BTC-USD-190628", `{"orderStrategyVOS":[{"algo_id":"1345","instrument_id":"BTC-USD-190628","order_type":"1","status":"1","trigger_price":"9000","size":"1"}]}`)
+	c := s.client()
+
+	r, err := c.PostFuturesAlgoOrder(NewTriggerAlgoOrder("BTC-USD-190628", CLOSE_LONG, "1", "9000", "9001", ALGO_TYPE_LIMIT))
+	require.True(t, err == nil, err)
+	assert.Equal(t, "1345", r.AlgoId)
+	assert.True(t, r.Result.Result)
+	assert.Equal(t, `{"instrument_id":"BTC-USD-190628","type":"3","order_type":"1","size":"1","trigger_price":"9000","algo_price":"9001","algo_type":"1"}`, s.lastRequest().Body)
+
+	cr, err := c.CancelFuturesAlgoOrders("BTC-USD-190628", ALGO_ORDER_TRIGGER, []string{"1345"})
+	require.True(t, err == nil, err)
+	assert.Equal(t, []string{"1345"}, cr.AlgoIds)
+	assert.Equal(t, `{"instrument_id":"BTC-USD-190628","algo_ids":["1345"],"order_type":"1"}`, s.lastRequest().Body)
+
+	_, err = c.GetFuturesAlgoOrders("BTC-USD-190628", ALGO_ORDER_TRIGGER, nil)
+	assert.True(t, err != nil)
+
+	params := NewParams()
+	params["status"] = Int2String(ALGO_STATUS_PENDING)
+	lr, err := c.GetFuturesAlgoOrders("BTC-USD-190628", ALGO_ORDER_TRIGGER, params)
+	require.True(t, err == nil, err)
+	require.Equal(t, 1, len(lr.Orders))
+	assert.Equal(t, "9000", lr.Orders[0].TriggerPrice)
+	assert.Equal(t, "order_type=1&status=1", s.lastRequest().RawQuery)
+}
+
+func TestClient_SwapAlgoOrders(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handle(POST, SWAP_ORDER_ALGO, `{"code":"0","data":{"algo_id":"177","instrument_id":"BTC-USD-SWAP","order_type":"2","result":"success"},"detailMsg":"","msg":""}`)
+	s.handle(POST, SWAP_CANCEL_ALGOS, `{"code":"0","data":{"algo_ids":"177","instrument_id":"BTC-USD-SWAP","result":"success"},"detailMsg":"","msg":""}`)
+	s.handle(GET, "/api/swap/v3/order_algo/BTC-USD-SWAP", `{"orderStrategyVOS":[{"algo_id":"177","instrument_id":"BTC-USD-SWAP","order_type":"2","status":"2","callback_rate":"0.01"}]}`)
+	c := s.client()
+
+	r, err := c.PostSwapAlgoOrder(NewTrailAlgoOrder("BTC-USD-SWAP", CLOSE_SHORT, "2", "0.01", "9000"))
+	require.True(t, err == nil, err)
+	assert.Equal(t, "177", r.Data.AlgoId)
+	assert.Equal(t, `{"instrument_id":"BTC-USD-SWAP","type":"4","order_type":"2","size":"2","trigger_price":"9000","callback_rate":"0.01"}`, s.lastRequest().Body)
+
+	_, err = c.PostSwapAlgoOrder(NewTrailAlgoOrder("BTC-USD-SWAP", CLOSE_SHORT, "2", "", "9000"))
+	assert.True(t, err != nil)
+
+	cr, err := c.PostSwapCancelAlgoOrders("BTC-USD-SWAP", ALGO_ORDER_TRAIL, []string{"177"})
+	require.True(t, err == nil, err)
+	assert.Equal(t, "success", cr.Data.Result)
+
+	params := NewParams()
+	params["algo_id"] = "177"
+	lr, err := c.GetSwapAlgoOrders("BTC-USD-SWAP", ALGO_ORDER_TRAIL, params)
+	require.True(t, err == nil, err)
+	require.Equal(t, 1, len(lr.Orders))
+	assert.Equal(t, "0.01", lr.Orders[0].CallbackRate)
+}
+
+func TestNewAlgoOrderCallback(t *testing.T) {
+	rsp, err := loadResponse([]byte(`{"table":"swap/order_algo","data":[{"algo_id":"177","instrument_id":"BTC-USD-SWAP","order_type":"1","status":"2","trigger_price":"9000"}]}`))
+	require.True(t, err == nil, err)
+
+	var received []AlgoOrderInfo
+	cb := NewAlgoOrderCallback(func(table string, orders []AlgoOrderInfo) error {
+		assert.Equal(t, CHNL_SWAP_ORDER_ALGO, table)
+		received = orders
+		return nil
+	})
+	require.True(t, cb(rsp) == nil)
+	require.Equal(t, 1, len(received))
+	assert.Equal(t, "177", received[0].AlgoId)
+	assert.Equal(t, Int2String(ALGO_STATUS_EFFECTIVE), received[0].Status)
+}
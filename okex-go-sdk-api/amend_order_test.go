@@ -0,0 +1,97 @@
+package okex
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAmendOrderParams_prepare(t *testing.T) {
+	assert.True(t, NewAmendOrderById("2510789768709120").prepare() != nil)
+	assert.True(t, NewAmendOrderById("").WithPrice("9000").prepare() != nil)
+	assert.True(t, (&AmendOrderParams{OrderId: "1", ClientOid: "a1", NewSize: "1"}).prepare() != nil)
+	assert.True(t, NewAmendOrderByClientOid("a1").WithSize("2").WithCancelOnFail(true).prepare() == nil)
+
+	p := NewAmendOrderById("2510789768709120").WithPrice("9000")
+	require.True(t, p.prepare() == nil)
+	requestId := p.RequestId
+	assert.True(t, requestId != "")
+	require.True(t, p.prepare() == nil)
+	assert.Equal(t, requestId, p.RequestId)
+	assert.NotEqual(t, NewRequestId(), NewRequestId())
+}
+
+func TestClient_PostAmendOrder(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handle(POST, "/api/futures/v3/amend_order/BTC-USD-190628", `{"result":true,"order_id":"2510789768709120","client_oid":"","request_id":"r1","error_code":"0","error_message":""}`)
+	s.handle(POST, "/api/swap/v3/amend_order/BTC-USD-SWAP", `{"result":"true","order_id":"64-2a-26132f931-3","client_oid":"a1","request_id":"r2","error_code":"0","error_message":""}`)
+	s.handle(POST, "/api/spot/v3/amend_order/BTC-USDT", `{"result":true,"order_id":"2510789768709121","client_oid":"","request_id":"r3","error_code":"0","error_message":""}`)
+	c := s.client()
+
+	r, err := c.PostFuturesAmendOrder("BTC-USD-190628", NewAmendOrderById("2510789768709120").WithSize("2").WithRequestId("r1"))
+	require.True(t, err == nil, err)
+	assert.True(t, r.Result)
+	assert.Equal(t, `{"order_id":"2510789768709120","new_size":"2","request_id":"r1"}`, s.lastRequest().Body)
+
+	sr, err := c.PostSwapAmendOrder("BTC-USD-SWAP", NewAmendOrderByClientOid("a1").WithPrice("9000").WithCancelOnFail(false).WithRequestId("r2"))
+	require.True(t, err == nil, err)
+	assert.True(t, sr.Result)
+	assert.Equal(t, `{"client_oid":"a1","new_price":"9000","cancel_on_fail":"0","request_id":"r2"}`, s.lastRequest().Body)
+
+	p := NewAmendOrderById("2510789768709121").WithPrice("9000").WithCancelOnFail(true)
+	p.InstrumentId = "BTC-USDT"
+	_, err = c.PostSpotAmendOrder("BTC-USDT", p)
+	require.True(t, err == nil, err)
+	body := map[string]string{}
+	JsonString2Struct(s.lastRequest().Body, &body)
+	assert.Equal(t, p.RequestId, body["request_id"])
+	assert.Equal(t, "", body["instrument_id"])
+
+	_, err = c.PostSpotAmendOrder("BTC-USDT", p)
+	require.True(t, err == nil, err)
+	assert.Equal(t, s.requestsTo(POST, "/api/spot/v3/amend_order/BTC-USDT")[0].Body, s.lastRequest().Body)
+}
+
+func TestClient_PostAmendBatchOrders(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handle(POST, "/api/futures/v3/amend_batch_orders/BTC-USD-190628", `{"result":true,"amend_info":[{"order_id":"1","request_id":"r1","result":true},{"order_id":"2","request_id":"r2","result":false,"error_code":"32015"}]}`)
+	s.handle(POST, "/api/swap/v3/amend_batch_orders/BTC-USD-SWAP", `{"amend_info":[{"order_id":"1","request_id":"r1","result":"true"}]}`)
+	s.handle(POST, SPOT_AMEND_BATCH_ORDERS, `{"btc-usdt":[{"order_id":"1","request_id":"r1","result":true}]}`)
+	c := s.client()
+
+	orders := []*AmendOrderParams{
+		NewAmendOrderById("1").WithPrice("9000").WithRequestId("r1"),
+		NewAmendOrderById("2").WithSize("3").WithRequestId("r2"),
+	}
+	r, err := c.PostFuturesAmendBatchOrders("BTC-USD-190628", orders)
+	require.True(t, err == nil, err)
+	require.Equal(t, 2, len(r.AmendInfo))
+	assert.Equal(t, "32015", r.AmendInfo[1].ErrorCode)
+	assert.True(t, r.Result)
+	assert.True(t, r.AmendInfo[0].Result)
+	assert.False(t, r.AmendInfo[1].Result)
+	assert.Equal(t, `{"amend_data":[{"order_id":"1","new_price":"9000","request_id":"r1"},{"order_id":"2","new_size":"3","request_id":"r2"}]}`, s.lastRequest().Body)
+
+	sr, err := c.PostSwapAmendBatchOrders("BTC-USD-SWAP", orders[:1])
+	require.True(t, err == nil, err)
+	require.Equal(t, 1, len(sr.AmendInfo))
+	assert.True(t, sr.AmendInfo[0].Result)
+
+	var tooMany []*AmendOrderParams
+	for i := 0; i < 11; i++ {
+		tooMany = append(tooMany, NewAmendOrderById(Int2String(i)).WithPrice("1"))
+	}
+	_, err = c.PostSwapAmendBatchOrders("BTC-USD-SWAP", tooMany)
+	assert.True(t, err != nil)
+
+	_, err = c.PostSpotAmendBatchOrders(orders)
+	assert.True(t, err != nil)
+	orders[0].InstrumentId = "BTC-USDT"
+	spotR, err := c.PostSpotAmendBatchOrders(orders[:1])
+	require.True(t, err == nil, err)
+	assert.Equal(t, "r1", spotR["btc-usdt"][0].RequestId)
+	assert.Equal(t, `[{"instrument_id":"BTC-USDT","order_id":"1","new_price":"9000","request_id":"r1"}]`, s.lastRequest().Body)
+}
@@ -0,0 +1,490 @@
+package okex
+
+/*
+ Backtest replays recorded market data through the callbacks a strategy registers on OKWSAgent.
+ Frames are websocket pushes stamped with the time they were received, as written by
+ NewFrameRecorder, or candles converted by CandleFrames. The replay drives a simulated clock, the
+ order books of the depth channels and a PaperTrader which matches the strategy orders, charges
+ the fees and settles the swap funding. The result is a BacktestReport with the equity curve, the
+ drawdown, the fills and the funding payments.
+
+ For every frame the clock moves to the frame time, the funding due and the orders and cancels
+ which reached the simulated exchange are settled, the frame updates the books and is matched
+ against the resting orders, then it is passed to the strategy callbacks. Candles are matched as
+ a sell trade at their low and a buy trade at their high, of their volume.
+
+	bt := NewBacktest()
+	bt.Trader.Deposit(MARKET_SWAP, "BTC", 1)
+	bt.Trader.SetContractVal("BTC-USD-SWAP", 100)
+	strategy.Start(bt, bt.Trader) // Subscribe on a WSSubscriber, orders on a SwapOrderApi
+	frames, _ := ReadFrames(file)
+	report, err := bt.Run(frames)
+*/
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ERR_BACKTEST_FRAMES = errors.New(`backtest: no frames to replay`)
+
+/*
+Where strategies register their callbacks, OKWSAgent live and Backtest in a replay.
+*/
+type WSSubscriber interface {
+	Subscribe(channel, filter string, cb ReceivedDataCallback) error
+}
+
+var (
+	_ WSSubscriber = (*OKWSAgent)(nil)
+	_ WSSubscriber = (*Backtest)(nil)
+	_ BookSource   = (*Backtest)(nil)
+)
+
+/*
+A websocket push and the time it was received.
+*/
+type Frame struct {
+	Time    time.Time       `json:"time"`
+	Message json.RawMessage `json:"message"`
+}
+
+/*
+Callback writing the pushes it receives to w as JSON lines of Frame, for ReadFrames.
+
+	agent.Subscribe(CHNL_SWAP_DEPTH, "BTC-USD-SWAP", NewFrameRecorder(file))
+*/
+func NewFrameRecorder(w io.Writer) ReceivedDataCallback {
+	var lock sync.Mutex
+	return func(obj interface{}) error {
+		message, err := json.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		line, err := json.Marshal(Frame{Time: time.Now().UTC(), Message: message})
+		if err != nil {
+			return err
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		_, err = w.Write(append(line, '\n'))
+		return err
+	}
+}
+
+/*
+Read the JSON lines of Frame written by NewFrameRecorder.
+*/
+func ReadFrames(r io.Reader) ([]Frame, error) {
+	frames := []Frame{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		f := Frame{}
+		if err := json.Unmarshal([]byte(text), &f); err != nil {
+			return nil, fmt.Errorf("backtest: line %d: %v", line, err)
+		}
+		frames = append(frames, f)
+	}
+	return frames, scanner.Err()
+}
+
+/*
+Candle pushes of an instrument, market is MARKET_SPOT or MARKET_SWAP and granularity in seconds.
+A candle is replayed at its close time so that a strategy never sees a bar before it ended.
+*/
+func CandleFrames(market, instrumentId string, granularity int, candles []Candle) ([]Frame, error) {
+	table := fmt.Sprintf("%s/candle%ds", market, granularity)
+	frames := make([]Frame, 0, len(candles))
+	for _, c := range candles {
+		row := []string{candleTime(c.Time), c.Open.String(), c.High.String(), c.Low.String(), c.Close.String(), c.Volume.String()}
+		if c.CurrencyVolume != "" {
+			row = append(row, c.CurrencyVolume.String())
+		}
+		message, err := json.Marshal(map[string]interface{}{"table": table,
+			"data": []interface{}{map[string]interface{}{"instrument_id": instrumentId, "candle": row}}})
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, Frame{Time: c.Time.Add(time.Duration(granularity) * time.Second), Message: message})
+	}
+	return frames, nil
+}
+
+type EquityPoint struct {
+	Time   time.Time
+	Equity float64
+}
+
+/*
+Result of a replay, the equity is valued in Currency at the last prices of the replay.
+*/
+type BacktestReport struct {
+	Start          time.Time
+	End            time.Time
+	Frames         int
+	Currency       string
+	Equity         []EquityPoint
+	StartEquity    float64
+	EndEquity      float64
+	Pnl            float64
+	MaxDrawdown    float64 // largest fall from a peak of the equity, in Currency
+	MaxDrawdownPct float64 // the same as a fraction of the peak
+	Fills          []PaperFill
+	Fees           map[string]float64 // by fee currency
+	Funding        []FundingPayment
+}
+
+type backtestSub struct {
+	filter string
+	cb     ReceivedDataCallback
+}
+
+/*
+A replay is driven by Run, the backtest is not safe for concurrent use.
+*/
+type Backtest struct {
+	// Matching, fees and balances, its clock is the replay clock.
+	Trader *PaperTrader
+	// Currency of the report, USDT by default.
+	Currency string
+	// Simulated time between two points of the equity curve, one minute by default.
+	SampleInterval time.Duration
+
+	now        time.Time
+	depths     map[string]*WSHotDepths
+	subs       map[string][]backtestSub
+	funding    map[string]map[time.Time]float64 // instrument -> funding time -> rate
+	payments   []FundingPayment
+	equity     []EquityPoint
+	lastSample time.Time
+}
+
+func NewBacktest() *Backtest {
+	b := &Backtest{
+		Currency:       "USDT",
+		SampleInterval: time.Minute,
+		depths:         map[string]*WSHotDepths{},
+		subs:           map[string][]backtestSub{},
+		funding:        map[string]map[time.Time]float64{},
+	}
+	b.Trader = NewPaperTrader(b)
+	b.Trader.Now = b.Now
+	return b
+}
+
+/*
+The replay clock, the time of the current frame.
+*/
+func (b *Backtest) Now() time.Time {
+	return b.now
+}
+
+/*
+Register a callback as on OKWSAgent, filter is an instrument id or empty for all instruments.
+*/
+func (b *Backtest) Subscribe(channel, filter string, cb ReceivedDataCallback) error {
+	b.subs[channel] = append(b.subs[channel], backtestSub{filter: filter, cb: cb})
+	return nil
+}
+
+/*
+The book of the replay, as OKWSAgent.GetOrderBook.
+*/
+func (b *Backtest) GetOrderBook(channel, instrumentID string) *WSDepthItem {
+	depths := b.depths[channel]
+	if depths == nil {
+		return nil
+	}
+	depths.lock.RLock()
+	defer depths.lock.RUnlock()
+	d := depths.DepthMap[instrumentID]
+	if d == nil {
+		return nil
+	}
+	copied := *d
+	copied.Asks = append([][4]interface{}{}, d.Asks...)
+	copied.Bids = append([][4]interface{}{}, d.Bids...)
+	return &copied
+}
+
+/*
+Schedule funding payments from the historical rates, eg. of GetSwapHistoricalFundingRateByInstrument.
+The swap/funding_rate frames schedule the payment of the next funding time too.
+*/
+func (b *Backtest) AddFundingRates(rates ...BaseHistoricalFundingRate) error {
+	for _, r := range rates {
+		at, err := time.Parse(time.RFC3339Nano, r.FundingTime)
+		if err != nil {
+			return fmt.Errorf("backtest: funding_time %q: %v", r.FundingTime, err)
+		}
+		rate := r.FundingRate
+		if r.RealizedRate != "" {
+			rate = r.RealizedRate
+		}
+		b.scheduleFunding(r.InstrumentId, at, toFloat(rate))
+	}
+	return nil
+}
+
+func (b *Backtest) scheduleFunding(instrumentId string, at time.Time, rate float64) {
+	if b.funding[instrumentId] == nil {
+		b.funding[instrumentId] = map[time.Time]float64{}
+	}
+	b.funding[instrumentId][at.UTC()] = rate
+}
+
+/*
+Replay frames in time order, frames of the same time keep their order.
+*/
+func (b *Backtest) Run(frames []Frame) (*BacktestReport, error) {
+	if len(frames) == 0 {
+		return nil, ERR_BACKTEST_FRAMES
+	}
+	frames = append([]Frame{}, frames...)
+	sort.SliceStable(frames, func(i, j int) bool { return frames[i].Time.Before(frames[j].Time) })
+
+	for i, f := range frames {
+		b.advance(f.Time)
+		rsp, err := loadResponse(f.Message)
+		if err != nil {
+			return nil, fmt.Errorf("backtest: frame %d: %v", i, err)
+		}
+		if err := b.replay(rsp); err != nil {
+			return nil, fmt.Errorf("backtest: frame %d: %v", i, err)
+		}
+		b.sample(false)
+	}
+	b.sample(true)
+	return b.report(frames[0].Time, frames[len(frames)-1].Time, len(frames)), nil
+}
+
+// move the clock: funding due, then the orders and cancels which reached the exchange
+func (b *Backtest) advance(now time.Time) {
+	if now.After(b.now) {
+		b.now = now
+	}
+	type due struct {
+		instrumentId string
+		at           time.Time
+		rate         float64
+	}
+	dues := []due{}
+	for instrumentId, rates := range b.funding {
+		for at, rate := range rates {
+			if !at.After(b.now) {
+				dues = append(dues, due{instrumentId, at, rate})
+				delete(rates, at)
+			}
+		}
+	}
+	sort.Slice(dues, func(i, j int) bool {
+		if !dues[i].at.Equal(dues[j].at) {
+			return dues[i].at.Before(dues[j].at)
+		}
+		return dues[i].instrumentId < dues[j].instrumentId
+	})
+	for _, d := range dues {
+		b.payments = append(b.payments, b.Trader.fund(d.instrumentId, d.rate, d.at)...)
+	}
+	b.Trader.Advance(b.now)
+}
+
+type fundingPush struct {
+	InstrumentId string `json:"instrument_id"`
+	FundingRate  string `json:"funding_rate"`
+	FundingTime  string `json:"funding_time"`
+}
+
+type candlePush struct {
+	InstrumentId string   `json:"instrument_id"`
+	Candle       []string `json:"candle"`
+}
+
+func (b *Backtest) replay(rsp interface{}) error {
+	var table string
+	var instruments []string
+	switch r := rsp.(type) {
+	case *WSDepthTableResponse:
+		table = r.Table
+		depths := b.depths[r.Table]
+		if depths == nil {
+			depths = NewWSHotDepths(r.Table)
+			b.depths[r.Table] = depths
+		}
+		if err := depths.loadWSDepthTableResponse(r); err != nil {
+			r.Action = "corrupt"
+		}
+		for _, d := range r.Data {
+			instruments = append(instruments, d.InstrumentId)
+		}
+		if err := b.Trader.OnPush(r); err != nil {
+			return err
+		}
+	case *WSTableResponse:
+		table = r.Table
+		items := []struct {
+			InstrumentId string `json:"instrument_id"`
+		}{}
+		if err := decodeTableData(r.Data, &items); err != nil {
+			return err
+		}
+		for _, item := range items {
+			instruments = append(instruments, item.InstrumentId)
+		}
+		if err := b.match(r); err != nil {
+			return err
+		}
+	default:
+		// events and errors of the recording are not replayed
+		return nil
+	}
+
+	for _, sub := range b.subs[table] {
+		if sub.filter != "" && !containsString(instruments, sub.filter) {
+			continue
+		}
+		if err := sub.cb(rsp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// the trades, candles and funding rates of a push
+func (b *Backtest) match(r *WSTableResponse) error {
+	switch {
+	case r.Table == CHNL_SWAP_FUNDING_RATE:
+		pushes := []fundingPush{}
+		if err := decodeTableData(r.Data, &pushes); err != nil {
+			return err
+		}
+		for _, p := range pushes {
+			if at, err := time.Parse(time.RFC3339Nano, p.FundingTime); err == nil && at.After(b.now) {
+				b.scheduleFunding(p.InstrumentId, at, toFloat(p.FundingRate))
+			}
+		}
+	case strings.Contains(r.Table, "/candle"):
+		market := strings.Split(r.Table, "/")[0]
+		if market != MARKET_SPOT && market != MARKET_SWAP {
+			return nil
+		}
+		pushes := []candlePush{}
+		if err := decodeTableData(r.Data, &pushes); err != nil {
+			return err
+		}
+		trades := []Trade{}
+		for _, p := range pushes {
+			if len(p.Candle) < 6 {
+				continue
+			}
+			trade := func(side, price, size string) Trade {
+				return Trade{Market: market, InstrumentId: p.InstrumentId, Side: side, Price: toFloat(price), Size: toFloat(size), Time: b.now}
+			}
+			volume := p.Candle[5]
+			trades = append(trades, trade(SPOT_SIDE_BUY, p.Candle[1], "0"),
+				trade(SPOT_SIDE_SELL, p.Candle[3], volume), trade(SPOT_SIDE_BUY, p.Candle[2], volume),
+				trade(SPOT_SIDE_BUY, p.Candle[4], "0"))
+		}
+		b.Trader.AddTrades(trades...)
+	default:
+		return b.Trader.OnPush(r)
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// price of a currency in the report currency, from the last prices of the replay
+func (b *Backtest) price(currency string) (float64, bool) {
+	if currency == b.Currency {
+		return 1, true
+	}
+	candidates := []string{currency + "-" + b.Currency, currency + "-" + b.Currency + "-SWAP"}
+	if b.Currency == "USDT" || b.Currency == "USD" {
+		candidates = append(candidates, currency+"-USD-SWAP")
+	}
+	for _, instrumentId := range candidates {
+		if p, ok := b.Trader.lastPrice(instrumentId); ok && p > 0 {
+			return p, true
+		}
+	}
+	return 0, false
+}
+
+/*
+A point of the equity curve every SampleInterval, skipped while a currency held has no price yet.
+*/
+func (b *Backtest) sample(force bool) {
+	if !force && !b.lastSample.IsZero() && b.now.Sub(b.lastSample) < b.SampleInterval {
+		return
+	}
+	equity := 0.0
+	for currency, amount := range b.Trader.equities() {
+		if math.Abs(amount) <= paperEpsilon {
+			continue
+		}
+		p, ok := b.price(currency)
+		if !ok {
+			return
+		}
+		equity += amount * p
+	}
+	if n := len(b.equity); n > 0 && b.equity[n-1].Time.Equal(b.now) {
+		b.equity[n-1].Equity = equity
+	} else {
+		b.equity = append(b.equity, EquityPoint{Time: b.now, Equity: equity})
+	}
+	b.lastSample = b.now
+}
+
+func (b *Backtest) report(start, end time.Time, frames int) *BacktestReport {
+	r := &BacktestReport{
+		Start:    start,
+		End:      end,
+		Frames:   frames,
+		Currency: b.Currency,
+		Equity:   append([]EquityPoint{}, b.equity...),
+		Fills:    b.Trader.Fills(),
+		Fees:     map[string]float64{},
+		Funding:  append([]FundingPayment{}, b.payments...),
+	}
+	for _, f := range r.Fills {
+		r.Fees[f.FeeCurrency] += f.Fee
+	}
+	if len(r.Equity) > 0 {
+		r.StartEquity = r.Equity[0].Equity
+		r.EndEquity = r.Equity[len(r.Equity)-1].Equity
+		r.Pnl = r.EndEquity - r.StartEquity
+	}
+	peak := math.Inf(-1)
+	for _, p := range r.Equity {
+		peak = math.Max(peak, p.Equity)
+		if drawdown := peak - p.Equity; drawdown > r.MaxDrawdown {
+			r.MaxDrawdown = drawdown
+			if peak > 0 {
+				r.MaxDrawdownPct = drawdown / peak
+			}
+		}
+	}
+	return r
+}
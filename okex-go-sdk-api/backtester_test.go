@@ -0,0 +1,148 @@
+package okex
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func frameOf(t *testing.T, at time.Time, push interface{}) Frame {
+	message, err := json.Marshal(push)
+	require.True(t, err == nil, err)
+	return Frame{Time: at, Message: message}
+}
+
+func partialDepth(instrumentId string, asks, bids [][2]string) *WSDepthTableResponse {
+	d := depthOf(instrumentId, asks, bids)
+	_, d.Checksum = calCrc32(&d.Asks, &d.Bids)
+	return &WSDepthTableResponse{Table: CHNL_SWAP_DEPTH, Action: "partial", Data: []WSDepthItem{*d}}
+}
+
+func TestBacktest_SwapReplay(t *testing.T) {
+	t0 := time.Date(2019, 4, 16, 7, 59, 0, 0, time.UTC)
+	frames := []Frame{
+		// out of order on purpose, Run sorts by time
+		frameOf(t, t0.Add(61*time.Second), tradePushTable(CHNL_SWAP_TRADE, swapTradePush("3", "9900", "20", "2019-04-16T08:00:01.000Z"))),
+		frameOf(t, t0, partialDepth("BTC-USD-SWAP", [][2]string{{"9000", "100"}, {"9010", "100"}}, [][2]string{{"8990", "100"}})),
+		frameOf(t, t0.Add(time.Second), tradePushTable(CHNL_SWAP_FUNDING_RATE, map[string]interface{}{
+			"instrument_id": "BTC-USD-SWAP", "funding_rate": "0.001", "funding_time": "2019-04-16T08:00:00.000Z"})),
+		frameOf(t, t0.Add(2*time.Second), tradePushTable(CHNL_SWAP_TRADE, swapTradePush("1", "9000", "1", "2019-04-16T07:59:02.000Z"))),
+		frameOf(t, t0.Add(30*time.Second), tradePushTable(CHNL_SWAP_TRADE, swapTradePush("2", "8800", "1", "2019-04-16T07:59:30.000Z"))),
+	}
+
+	bt := NewBacktest()
+	bt.SampleInterval = time.Second
+	require.True(t, bt.Trader.Deposit(MARKET_SWAP, "BTC", 1) == nil)
+	bt.Trader.SetContractVal("BTC-USD-SWAP", 100)
+
+	// the strategy buys on the first trade and sells at 9900
+	var api SwapOrderApi = bt.Trader
+	var subscriber WSSubscriber = bt
+	trades, others := 0, 0
+	require.True(t, subscriber.Subscribe(CHNL_SWAP_TRADE, "BTC-USD-SWAP", func(obj interface{}) error {
+		trades++
+		if trades > 1 {
+			return nil
+		}
+		assert.True(t, bt.Now().Equal(t0.Add(2*time.Second)))
+		if _, err := api.PostSwapOrder("BTC-USD-SWAP", &BasePlaceOrderInfo{Type: "1", Size: "10", MatchPrice: "1"}); err != nil {
+			return err
+		}
+		_, err := api.PostSwapOrder("BTC-USD-SWAP", &BasePlaceOrderInfo{Type: "3", Size: "10", Price: "9900"})
+		return err
+	}) == nil)
+	require.True(t, subscriber.Subscribe(CHNL_SWAP_TRADE, "ETH-USD-SWAP", func(obj interface{}) error {
+		others++
+		return nil
+	}) == nil)
+
+	report, err := bt.Run(frames)
+	require.True(t, err == nil, err)
+	assert.Equal(t, 3, trades)
+	assert.Equal(t, 0, others)
+	assert.Equal(t, 5, report.Frames)
+	assert.True(t, report.Start.Equal(t0))
+
+	require.Equal(t, 2, len(report.Fills))
+	assert.Equal(t, PAPER_LIQUIDITY_TAKER, report.Fills[0].Liquidity)
+	assert.Equal(t, 9000.0, report.Fills[0].Price)
+	assert.Equal(t, PAPER_LIQUIDITY_MAKER, report.Fills[1].Liquidity)
+	assert.Equal(t, 9900.0, report.Fills[1].Price)
+
+	require.Equal(t, 1, len(report.Funding))
+	funding := -0.001 * 1000 / 8800
+	near(t, funding, report.Funding[0].Amount)
+	assert.Equal(t, DIRECTION_LONG, report.Funding[0].Direction)
+
+	openFee, closeFee := 1000.0/9000*0.0005, 1000.0/9900*0.0002
+	near(t, openFee+closeFee, report.Fees["BTC"])
+	require.Equal(t, 3, len(report.Equity))
+	start := (1 - openFee) * 9000
+	low := (1 - openFee + 1000*(1/9000.0-1/8800.0)) * 8800
+	end := (1 - openFee + funding + 1000*(1/9000.0-1/9900.0) - closeFee) * 9900
+	assert.InDelta(t, start, report.StartEquity, 1e-6)
+	assert.InDelta(t, low, report.Equity[1].Equity, 1e-6)
+	assert.InDelta(t, end, report.EndEquity, 1e-6)
+	assert.InDelta(t, end-start, report.Pnl, 1e-6)
+	assert.InDelta(t, start-low, report.MaxDrawdown, 1e-6)
+	assert.InDelta(t, (start-low)/start, report.MaxDrawdownPct, 1e-9)
+}
+
+func TestBacktest_CandlesAndRecorder(t *testing.T) {
+	start := time.Date(2019, 4, 16, 10, 0, 0, 0, time.UTC)
+	candles := []Candle{
+		{Time: start, Open: "100", High: "101", Low: "99", Close: "100", Volume: "5"},
+		{Time: start.Add(time.Minute), Open: "100", High: "100", Low: "94", Close: "96", Volume: "5"},
+	}
+	frames, err := CandleFrames(MARKET_SPOT, "BTC-USDT", CANDLES_1MIN, candles)
+	require.True(t, err == nil, err)
+	require.Equal(t, 2, len(frames))
+	assert.True(t, frames[0].Time.Equal(start.Add(time.Minute)))
+
+	// the frames survive a recording
+	buf := &bytes.Buffer{}
+	record := NewFrameRecorder(buf)
+	for _, f := range frames {
+		rsp, err := loadResponse(f.Message)
+		require.True(t, err == nil, err)
+		require.True(t, record(rsp) == nil)
+	}
+	recorded, err := ReadFrames(buf)
+	require.True(t, err == nil, err)
+	require.Equal(t, 2, len(recorded))
+	for i := range recorded {
+		recorded[i].Time = frames[i].Time
+	}
+
+	bt := NewBacktest()
+	require.True(t, bt.Trader.Deposit(MARKET_SPOT, "USDT", 1000) == nil)
+	closes := []string{}
+	require.True(t, bt.Subscribe("spot/candle60s", "", func(obj interface{}) error {
+		push := []candlePush{}
+		if err := decodeTableData(obj.(*WSTableResponse).Data, &push); err != nil {
+			return err
+		}
+		closes = append(closes, push[0].Candle[4])
+		if len(closes) == 1 {
+			_, err := bt.Trader.PostSpotOrder(NewSpotLimitOrder("BTC-USDT", SPOT_SIDE_BUY, "95", "2"))
+			return err
+		}
+		return nil
+	}) == nil)
+
+	report, err := bt.Run(recorded)
+	require.True(t, err == nil, err)
+	assert.Equal(t, []string{"100", "96"}, closes)
+	require.Equal(t, 1, len(report.Fills))
+	assert.Equal(t, 95.0, report.Fills[0].Price)
+	near(t, 2*0.0008, report.Fees["BTC"])
+	assert.InDelta(t, 1000, report.StartEquity, 1e-9)
+	assert.InDelta(t, 1000-190+(2-0.0016)*96, report.EndEquity, 1e-9)
+
+	_, err = NewBacktest().Run(nil)
+	assert.Equal(t, ERR_BACKTEST_FRAMES, err)
+}
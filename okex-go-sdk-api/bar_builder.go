@@ -0,0 +1,530 @@
+package okex
+
+/*
+ BarBuilder aggregates the spot/trade, futures/trade and swap/trade pushes into custom bars:
+ time bars of any interval, tick bars, volume bars and notional bars. The bars of an instrument
+ are seeded from the REST trade history, trades already seen are dropped by trade_id.
+
+ Time bars stay open until the newest trade is Lateness past their end, so trades arriving out of
+ order are still counted. A trade older than a time bar already emitted is late, it is dropped
+ from the time bars and passed to the OnLate callbacks. Tick, volume and notional bars follow the
+ order of arrival. Time bars of a quiet instrument are closed by Advance.
+
+	builder := NewBarBuilder(client)
+	builder.Track(MARKET_SWAP, "BTC-USD-SWAP", TimeBars(10*time.Second), VolumeBars(1000))
+	builder.OnBar(func(bar Bar) { ... })
+	builder.Seed(MARKET_SWAP, "BTC-USD-SWAP")
+	agent.Subscribe(CHNL_SWAP_TRADE, "BTC-USD-SWAP", builder.OnPush)
+*/
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	BAR_TIME     = "time"
+	BAR_TICK     = "tick"
+	BAR_VOLUME   = "volume"
+	BAR_NOTIONAL = "notional"
+)
+
+var (
+	ERR_BAR_SPEC     = errors.New(`bar builder: a bar needs a positive interval or threshold`)
+	ERR_BAR_MARKET   = errors.New(`bar builder: market must be MARKET_SPOT, MARKET_MARGIN, MARKET_FUTURES or MARKET_SWAP`)
+	ERR_BAR_CONTRACT = errors.New(`bar builder: unknown contract value, the trades of the instrument were skipped`)
+)
+
+/*
+Interval is used by time bars, Threshold by the others: trades per tick bar, size per volume
+bar and quote currency per notional bar.
+*/
+type BarSpec struct {
+	Kind      string
+	Interval  time.Duration
+	Threshold float64
+}
+
+func TimeBars(interval time.Duration) BarSpec {
+	return BarSpec{Kind: BAR_TIME, Interval: interval}
+}
+
+func TickBars(trades int) BarSpec {
+	return BarSpec{Kind: BAR_TICK, Threshold: float64(trades)}
+}
+
+func VolumeBars(size float64) BarSpec {
+	return BarSpec{Kind: BAR_VOLUME, Threshold: size}
+}
+
+func NotionalBars(notional float64) BarSpec {
+	return BarSpec{Kind: BAR_NOTIONAL, Threshold: notional}
+}
+
+func (s BarSpec) String() string {
+	if s.Kind == BAR_TIME {
+		return s.Kind + ":" + s.Interval.String()
+	}
+	return s.Kind + ":" + strconv.FormatFloat(s.Threshold, 'f', -1, 64)
+}
+
+func (s BarSpec) valid() bool {
+	if s.Kind == BAR_TIME {
+		return s.Interval > 0
+	}
+	return (s.Kind == BAR_TICK || s.Kind == BAR_VOLUME || s.Kind == BAR_NOTIONAL) && s.Threshold > 0
+}
+
+/*
+A trade of the REST history or of a trade push. Size is in contracts for futures and swap.
+*/
+type Trade struct {
+	Market       string
+	InstrumentId string
+	TradeId      string
+	Side         string
+	Price        float64
+	Size         float64
+	Time         time.Time
+}
+
+/*
+Start and End are the interval of a time bar, the times of the first and last trade otherwise.
+Notional is in the quote currency, USD for the coin margined contracts.
+*/
+type Bar struct {
+	InstrumentId string
+	Spec         BarSpec
+	Start        time.Time
+	End          time.Time
+	Open         float64
+	High         float64
+	Low          float64
+	Close        float64
+	Volume       float64
+	Notional     float64
+	Trades       int
+	first        time.Time
+	last         time.Time
+}
+
+func (b *Bar) add(t Trade, notional float64) {
+	if b.Trades == 0 {
+		b.Open, b.High, b.Low, b.Close = t.Price, t.Price, t.Price, t.Price
+		b.first, b.last = t.Time, t.Time
+	}
+	// trades may arrive out of order, open and close follow the trade times
+	if t.Time.Before(b.first) {
+		b.Open, b.first = t.Price, t.Time
+	}
+	if !t.Time.Before(b.last) {
+		b.Close, b.last = t.Price, t.Time
+	}
+	if t.Price > b.High {
+		b.High = t.Price
+	}
+	if t.Price < b.Low {
+		b.Low = t.Price
+	}
+	b.Volume += t.Size
+	b.Notional += notional
+	b.Trades++
+}
+
+type barSeries struct {
+	spec BarSpec
+	open []*Bar // open bars, time bars by start
+	// end of the last emitted time bar, trades before it are late
+	emitted time.Time
+}
+
+type barInstrument struct {
+	market    string
+	series    []*barSeries
+	watermark time.Time // newest trade time
+	seen      map[string]bool
+	seenOrder []string
+}
+
+type BarBuilder struct {
+	client *Client
+	// How long time bars wait for trades arriving out of order after their end.
+	Lateness time.Duration
+	// Number of trade_ids remembered per instrument to drop duplicated trades.
+	SeenTrades int
+
+	lock         sync.Mutex
+	instruments  map[string]*barInstrument
+	contractVals map[string]float64
+	barCbs       []func(Bar)
+	lateCbs      []func(Trade)
+}
+
+func NewBarBuilder(client *Client) *BarBuilder {
+	return &BarBuilder{
+		client:       client,
+		Lateness:     2 * time.Second,
+		SeenTrades:   1000,
+		instruments:  map[string]*barInstrument{},
+		contractVals: map[string]float64{},
+	}
+}
+
+/*
+Build the bars of specs for an instrument of MARKET_SPOT, MARKET_FUTURES or MARKET_SWAP.
+*/
+func (b *BarBuilder) Track(market, instrumentId string, specs ...BarSpec) error {
+	switch market {
+	case MARKET_SPOT, MARKET_MARGIN, MARKET_FUTURES, MARKET_SWAP:
+	default:
+		return ERR_BAR_MARKET
+	}
+	for _, spec := range specs {
+		if !spec.valid() {
+			return ERR_BAR_SPEC
+		}
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	inst, ok := b.instruments[instrumentId]
+	if !ok {
+		inst = &barInstrument{market: market, seen: map[string]bool{}}
+		b.instruments[instrumentId] = inst
+	}
+	for _, spec := range specs {
+		inst.series = append(inst.series, &barSeries{spec: spec})
+	}
+	return nil
+}
+
+/*
+Contract value of a futures or swap instrument, used by the notional of its trades.
+Seed loads it from the instruments when not set.
+*/
+func (b *BarBuilder) SetContractVal(instrumentId string, contractVal float64) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.contractVals[instrumentId] = contractVal
+}
+
+func (b *BarBuilder) OnBar(cb func(Bar)) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.barCbs = append(b.barCbs, cb)
+}
+
+func (b *BarBuilder) OnLate(cb func(Trade)) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.lateCbs = append(b.lateCbs, cb)
+}
+
+/*
+Feed the recent trades of the REST history, oldest first. Call it before subscribing the trade
+channel, the pushes overlapping the history are dropped by trade_id.
+*/
+func (b *BarBuilder) Seed(market, instrumentId string) error {
+	var trades []Trade
+	switch market {
+	case MARKET_SPOT, MARKET_MARGIN:
+		r, err := b.client.GetSpotInstrumentTrade(instrumentId, nil)
+		if err != nil {
+			return err
+		}
+		for _, m := range *r {
+			trades = append(trades, tradeOf(market, instrumentId, anyToString(m["trade_id"]), anyToString(m["side"]),
+				anyToFloat(m["price"]), anyToFloat(m["size"]), anyToString(m["timestamp"])))
+		}
+	case MARKET_FUTURES:
+		if err := b.loadContractVal(market, instrumentId); err != nil {
+			return err
+		}
+		r, err := b.client.GetFuturesInstrumentTrades(instrumentId, nil)
+		if err != nil {
+			return err
+		}
+		for _, v := range r {
+			m, _ := v.(map[string]interface{})
+			trades = append(trades, tradeOf(market, instrumentId, anyToString(m["trade_id"]), anyToString(m["side"]),
+				anyToFloat(m["price"]), anyToFloat(m["qty"]), anyToString(m["timestamp"])))
+		}
+	case MARKET_SWAP:
+		if err := b.loadContractVal(market, instrumentId); err != nil {
+			return err
+		}
+		r, err := b.client.GetSwapTradesByInstrument(instrumentId, nil)
+		if err != nil {
+			return err
+		}
+		for _, t := range *r {
+			trades = append(trades, tradeOf(market, instrumentId, t.TradeId, t.Side, toFloat(t.Price), toFloat(t.Size), t.Timestamp))
+		}
+	default:
+		return ERR_BAR_MARKET
+	}
+	sort.SliceStable(trades, func(i, j int) bool {
+		return trades[i].Time.Before(trades[j].Time)
+	})
+	return b.Add(trades...)
+}
+
+func tradeOf(market, instrumentId, tradeId, side string, price, size float64, timestamp string) Trade {
+	t := Trade{Market: market, InstrumentId: instrumentId, TradeId: tradeId, Side: side, Price: price, Size: size}
+	// IsoToTime reads the milliseconds as nanoseconds
+	t.Time, _ = time.Parse(time.RFC3339Nano, timestamp)
+	return t
+}
+
+func (b *BarBuilder) loadContractVal(market, instrumentId string) error {
+	b.lock.Lock()
+	_, ok := b.contractVals[instrumentId]
+	b.lock.Unlock()
+	if ok {
+		return nil
+	}
+
+	contractVals, err := loadContractVals(b.client, market)
+	if err != nil {
+		return err
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	mergeContractVals(b.contractVals, contractVals)
+	return nil
+}
+
+type tradePush struct {
+	InstrumentId string `json:"instrument_id"`
+	TradeId      string `json:"trade_id"`
+	Side         string `json:"side"`
+	Price        string `json:"price"`
+	Size         string `json:"size"`
+	Qty          string `json:"qty"` // futures/trade
+	Timestamp    string `json:"timestamp"`
+}
+
+/*
+Callback of the spot/trade, futures/trade and swap/trade channels.
+*/
+func (b *BarBuilder) OnPush(obj interface{}) error {
+	tb, ok := obj.(*WSTableResponse)
+	if !ok {
+		return nil
+	}
+	var market string
+	switch tb.Table {
+	case CHNL_SPOT_TRADE:
+		market = MARKET_SPOT
+	case CHNL_FUTURES_TRADE:
+		market = MARKET_FUTURES
+	case CHNL_SWAP_TRADE:
+		market = MARKET_SWAP
+	default:
+		return nil
+	}
+
+	pushes := []tradePush{}
+	if err := decodeTableData(tb.Data, &pushes); err != nil {
+		return err
+	}
+	trades := make([]Trade, 0, len(pushes))
+	for _, p := range pushes {
+		size := p.Size
+		if size == "" {
+			size = p.Qty
+		}
+		trades = append(trades, tradeOf(market, p.InstrumentId, p.TradeId, p.Side, toFloat(p.Price), toFloat(size), p.Timestamp))
+	}
+	return b.Add(trades...)
+}
+
+/*
+Add trades to the bars of their instrument, trades of untracked instruments are ignored.
+The futures and swap trades are skipped until the contract value of their instrument is set or
+loaded by Seed, ERR_BAR_CONTRACT is returned once the other trades are added.
+*/
+func (b *BarBuilder) Add(trades ...Trade) error {
+	var skipped error
+	var bars []Bar
+	var late []Trade
+
+	b.lock.Lock()
+	for _, t := range trades {
+		inst, ok := b.instruments[t.InstrumentId]
+		if !ok {
+			continue
+		}
+		notional, ok := b.notional(inst.market, t)
+		if !ok {
+			skipped = ERR_BAR_CONTRACT
+			continue
+		}
+		if inst.duplicate(t.TradeId, b.SeenTrades) {
+			continue
+		}
+		isLate := false
+		for _, s := range inst.series {
+			if !t.Time.Before(s.emitted) {
+				s.add(t, notional)
+			} else {
+				isLate = true
+			}
+		}
+		if isLate {
+			late = append(late, t)
+		}
+		if t.Time.After(inst.watermark) {
+			inst.watermark = t.Time
+		}
+		for _, s := range inst.series {
+			bars = append(bars, s.close(t.InstrumentId, inst.watermark.Add(-b.Lateness))...)
+		}
+	}
+	barCbs, lateCbs := b.barCbs, b.lateCbs
+	b.lock.Unlock()
+
+	for _, t := range late {
+		for _, cb := range lateCbs {
+			cb(t)
+		}
+	}
+	for _, bar := range bars {
+		for _, cb := range barCbs {
+			cb(bar)
+		}
+	}
+	return skipped
+}
+
+/*
+Close the time bars which ended Lateness before now, for instruments without recent trades.
+*/
+func (b *BarBuilder) Advance(now time.Time) {
+	var bars []Bar
+	b.lock.Lock()
+	for instrumentId, inst := range b.instruments {
+		for _, s := range inst.series {
+			if s.spec.Kind == BAR_TIME {
+				bars = append(bars, s.close(instrumentId, now.Add(-b.Lateness))...)
+			}
+		}
+	}
+	barCbs := b.barCbs
+	b.lock.Unlock()
+
+	for _, bar := range bars {
+		for _, cb := range barCbs {
+			cb(bar)
+		}
+	}
+}
+
+/*
+Bars still open for an instrument, oldest first.
+*/
+func (b *BarBuilder) Open(instrumentId string) []Bar {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	bars := []Bar{}
+	if inst, ok := b.instruments[instrumentId]; ok {
+		for _, s := range inst.series {
+			for _, bar := range s.open {
+				bars = append(bars, *bar)
+			}
+		}
+	}
+	return bars
+}
+
+func (inst *barInstrument) duplicate(tradeId string, limit int) bool {
+	if tradeId == "" {
+		return false
+	}
+	if inst.seen[tradeId] {
+		return true
+	}
+	inst.seen[tradeId] = true
+	inst.seenOrder = append(inst.seenOrder, tradeId)
+	if limit > 0 && len(inst.seenOrder) > limit {
+		delete(inst.seen, inst.seenOrder[0])
+		inst.seenOrder = inst.seenOrder[1:]
+	}
+	return false
+}
+
+/*
+Notional of a trade in the quote currency, false for a contract of unknown value.
+*/
+func (b *BarBuilder) notional(market string, t Trade) (float64, bool) {
+	if market != MARKET_FUTURES && market != MARKET_SWAP {
+		return t.Size * t.Price, true
+	}
+	contractVal := b.contractVals[t.InstrumentId]
+	if contractVal <= 0 {
+		return 0, false
+	}
+	return contractNotional(t.InstrumentId, t.Size, contractVal, t.Price), true
+}
+
+func (s *barSeries) add(t Trade, notional float64) {
+	if s.spec.Kind == BAR_TIME {
+		start := t.Time.Truncate(s.spec.Interval)
+		i := sort.Search(len(s.open), func(i int) bool {
+			return !s.open[i].Start.Before(start)
+		})
+		if i == len(s.open) || !s.open[i].Start.Equal(start) {
+			bar := &Bar{Spec: s.spec, Start: start, End: start.Add(s.spec.Interval)}
+			s.open = append(s.open, nil)
+			copy(s.open[i+1:], s.open[i:])
+			s.open[i] = bar
+		}
+		s.open[i].add(t, notional)
+		return
+	}
+
+	if len(s.open) == 0 {
+		s.open = []*Bar{{Spec: s.spec}}
+	}
+	s.open[0].add(t, notional)
+}
+
+/*
+Emit the time bars ended before watermark, or the threshold bar when full.
+*/
+func (s *barSeries) close(instrumentId string, watermark time.Time) []Bar {
+	bars := []Bar{}
+	if s.spec.Kind == BAR_TIME {
+		for len(s.open) > 0 && !s.open[0].End.After(watermark) {
+			bar := *s.open[0]
+			bar.InstrumentId = instrumentId
+			bars = append(bars, bar)
+			s.emitted = bar.End
+			s.open = s.open[1:]
+		}
+		return bars
+	}
+
+	if len(s.open) == 0 {
+		return bars
+	}
+	bar := *s.open[0]
+	var size float64
+	switch s.spec.Kind {
+	case BAR_TICK:
+		size = float64(bar.Trades)
+	case BAR_VOLUME:
+		size = bar.Volume
+	case BAR_NOTIONAL:
+		size = bar.Notional
+	}
+	if size < s.spec.Threshold {
+		return bars
+	}
+	bar.InstrumentId = instrumentId
+	bar.Start, bar.End = bar.first, bar.last
+	s.open = nil
+	return append(bars, bar)
+}
@@ -0,0 +1,128 @@
+package okex
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tradePushTable(table string, data ...map[string]interface{}) *WSTableResponse {
+	tb := &WSTableResponse{Table: table}
+	for _, d := range data {
+		tb.Data = append(tb.Data, d)
+	}
+	return tb
+}
+
+func swapTradePush(id, price, size, timestamp string) map[string]interface{} {
+	return map[string]interface{}{"instrument_id": "BTC-USD-SWAP", "trade_id": id, "side": "buy",
+		"price": price, "size": size, "timestamp": timestamp}
+}
+
+func TestBarBuilder_SeedAndPushes(t *testing.T) {
+	s := newFakePositionServer()
+	defer s.Close()
+	// newest first, as returned by the exchange
+	s.handle(GET, "/api/swap/v3/instruments/BTC-USD-SWAP/trades", `[
+		{"trade_id":"3","side":"sell","price":"9020","size":"5","timestamp":"2019-04-16T10:00:08.000Z"},
+		{"trade_id":"2","side":"buy","price":"9050","size":"3","timestamp":"2019-04-16T10:00:05.000Z"},
+		{"trade_id":"1","side":"buy","price":"9000","size":"2","timestamp":"2019-04-16T10:00:01.000Z"}]`)
+
+	b := NewBarBuilder(s.client())
+	b.Lateness = time.Second
+	require.True(t, b.Track(MARKET_SWAP, "BTC-USD-SWAP", TimeBars(10*time.Second), TickBars(2), NotionalBars(1500)) == nil)
+	bars := []Bar{}
+	b.OnBar(func(bar Bar) { bars = append(bars, bar) })
+	late := []Trade{}
+	b.OnLate(func(trade Trade) { late = append(late, trade) })
+
+	require.True(t, b.Seed(MARKET_SWAP, "BTC-USD-SWAP") == nil)
+	require.Equal(t, 1, len(bars))
+	tick := bars[0]
+	assert.Equal(t, BAR_TICK, tick.Spec.Kind)
+	assert.Equal(t, 9000.0, tick.Open)
+	assert.Equal(t, 9050.0, tick.Close)
+	assert.Equal(t, 500.0, tick.Notional)
+
+	// trade 3 is pushed again, trade 5 arrives before 4 within the lateness
+	require.True(t, b.OnPush(tradePushTable(CHNL_SWAP_TRADE,
+		swapTradePush("3", "9020", "5", "2019-04-16T10:00:08.000Z"),
+		swapTradePush("5", "9100", "4", "2019-04-16T10:00:10.500Z"),
+		swapTradePush("4", "8990", "1", "2019-04-16T10:00:09.500Z"))) == nil)
+	require.Equal(t, 3, len(bars))
+	assert.Equal(t, BAR_TICK, bars[1].Spec.Kind)
+	assert.Equal(t, 9100.0, bars[1].Close)
+	assert.Equal(t, BAR_NOTIONAL, bars[2].Spec.Kind)
+	assert.Equal(t, 1500.0, bars[2].Notional)
+	assert.True(t, bars[2].End.Equal(time.Date(2019, 4, 16, 10, 0, 10, 500000000, time.UTC)))
+
+	require.True(t, b.OnPush(tradePushTable(CHNL_SWAP_TRADE,
+		swapTradePush("6", "9200", "1", "2019-04-16T10:00:11.000Z"))) == nil)
+	require.Equal(t, 5, len(bars))
+	ten := bars[3]
+	assert.Equal(t, BAR_TIME, ten.Spec.Kind)
+	assert.True(t, ten.Start.Equal(time.Date(2019, 4, 16, 10, 0, 0, 0, time.UTC)))
+	assert.Equal(t, 4, ten.Trades)
+	assert.Equal(t, 8990.0, ten.Close)
+	assert.Equal(t, 9050.0, ten.High)
+	assert.True(t, math.Abs(ten.Volume-11) < 1e-9)
+	assert.Equal(t, BAR_TICK, bars[4].Spec.Kind)
+
+	// the first time bar was emitted, the tick and notional bars still take the trade
+	require.True(t, b.OnPush(tradePushTable(CHNL_SWAP_TRADE,
+		swapTradePush("7", "9000", "1", "2019-04-16T10:00:09.900Z"))) == nil)
+	require.Equal(t, 1, len(late))
+	assert.Equal(t, "7", late[0].TradeId)
+
+	open := b.Open("BTC-USD-SWAP")
+	require.Equal(t, 3, len(open))
+	assert.Equal(t, 2, open[0].Trades)
+	assert.Equal(t, 1, open[1].Trades)
+	assert.Equal(t, 200.0, open[2].Notional)
+
+	b.Advance(time.Date(2019, 4, 16, 10, 0, 21, 0, time.UTC))
+	require.Equal(t, 6, len(bars))
+	assert.Equal(t, 9200.0, bars[5].Close)
+}
+
+func TestBarBuilder_SpotVolumeBars(t *testing.T) {
+	b := NewBarBuilder(nil)
+	assert.Equal(t, ERR_BAR_SPEC, b.Track(MARKET_SPOT, "BTC-USDT", VolumeBars(0)))
+	assert.Equal(t, ERR_BAR_MARKET, b.Track("option", "BTC-USD-190628", VolumeBars(1)))
+	assert.Equal(t, ERR_BAR_MARKET, b.Seed("option", "BTC-USD-190628"))
+	require.True(t, b.Track(MARKET_SPOT, "BTC-USDT", VolumeBars(1)) == nil)
+	bars := []Bar{}
+	b.OnBar(func(bar Bar) { bars = append(bars, bar) })
+
+	push := func(id, price, size string) map[string]interface{} {
+		return map[string]interface{}{"instrument_id": "BTC-USDT", "trade_id": id, "side": "buy",
+			"price": price, "size": size, "timestamp": "2019-04-16T10:00:00.000Z"}
+	}
+	require.True(t, b.OnPush(tradePushTable(CHNL_SPOT_TRADE, push("1", "100", "0.4"), push("2", "110", "0.7"), push("3", "90", "0.1"))) == nil)
+	require.True(t, b.OnPush(tradePushTable(CHNL_SPOT_TRADE, map[string]interface{}{"instrument_id": "ETH-USDT",
+		"trade_id": "1", "price": "1", "size": "5", "timestamp": "2019-04-16T10:00:00.000Z"})) == nil)
+	require.Equal(t, 1, len(bars))
+	assert.True(t, math.Abs(bars[0].Volume-1.1) < 1e-9)
+	assert.True(t, math.Abs(bars[0].Notional-117) < 1e-9)
+	assert.Equal(t, "volume:1", bars[0].Spec.String())
+}
+
+func TestBarBuilder_UnknownContractVal(t *testing.T) {
+	b := NewBarBuilder(nil)
+	require.True(t, b.Track(MARKET_SWAP, "BTC-USD-SWAP", TickBars(1)) == nil)
+	bars := []Bar{}
+	b.OnBar(func(bar Bar) { bars = append(bars, bar) })
+
+	push := tradePushTable(CHNL_SWAP_TRADE, swapTradePush("1", "9000", "2", "2019-04-16T10:00:01.000Z"))
+	assert.Equal(t, ERR_BAR_CONTRACT, b.OnPush(push))
+	assert.Equal(t, 0, len(bars))
+
+	// the skipped trade is not taken for a duplicate
+	b.SetContractVal("BTC-USD-SWAP", 100)
+	require.True(t, b.OnPush(push) == nil)
+	require.Equal(t, 1, len(bars))
+	assert.Equal(t, 200.0, bars[0].Notional)
+}
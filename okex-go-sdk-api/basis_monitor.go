@@ -0,0 +1,467 @@
+package okex
+
+/*
+ BasisMonitor computes the basis of the futures against their index and the calendar spreads
+ between the contracts of an underlying, from the futures/ticker, index/ticker and
+ futures/estimated_price channels. The contracts, their alias and delivery date are loaded by
+ Refresh from GetFuturesInstruments, the first push after the delivery of a contract refreshes them.
+
+ The basis is annualized over the time left to the delivery, a spread over the time between the
+ deliveries of its legs.
+
+	monitor := NewBasisMonitor(client)
+	monitor.Refresh()
+	monitor.OnBasis(func(basis FuturesBasis) { ... })
+	monitor.OnSpread(func(spread CalendarSpread) { ... })
+	agent.Subscribe(CHNL_FUTURES_TICKER, "BTC-USD-190628", monitor.OnPush)
+	agent.Subscribe(CHNL_INDEX_TICKER, "BTC-USD", monitor.OnPush)
+*/
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// futures are delivered at 16:00 Hong Kong time
+const FUTURES_DELIVERY_HOUR = 8 * time.Hour
+
+const basisYear = 365 * 24 * time.Hour
+
+var ERR_BASIS_NO_CONTRACTS = errors.New(`basis monitor: no futures contracts`)
+
+var futuresAliases = []string{
+	FUTURES_ALIAS_THIS_WEEK,
+	FUTURES_ALIAS_NEXT_WEEK,
+	FUTURES_ALIAS_QUARTER,
+	FUTURES_ALIAS_BI_QUARTER,
+}
+
+/*
+A futures contract, Underlying is the instrument id of its index, eg: BTC-USD.
+*/
+type FuturesContract struct {
+	InstrumentId string
+	Underlying   string
+	Alias        string
+	Delivery     time.Time
+	ContractVal  float64
+}
+
+/*
+Basis of a contract: Basis = Price - Index and BasisRate = Basis / Index, annualized over the time
+left to the delivery. EstimatedPrice is the estimated delivery price, pushed the last hour before
+the delivery.
+*/
+type FuturesBasis struct {
+	FuturesContract
+	Price           float64
+	Index           float64
+	EstimatedPrice  float64
+	Basis           float64
+	BasisRate       float64
+	AnnualizedBasis float64
+	TimeToDelivery  time.Duration
+	UpdatedAt       time.Time
+}
+
+/*
+Spread between two contracts of an underlying, Spread = Far.Price - Near.Price and SpreadRate =
+Spread / Near.Price, annualized over the time between the deliveries.
+*/
+type CalendarSpread struct {
+	Underlying       string
+	Near             FuturesContract
+	Far              FuturesContract
+	NearPrice        float64
+	FarPrice         float64
+	Spread           float64
+	SpreadRate       float64
+	AnnualizedSpread float64
+	UpdatedAt        time.Time
+}
+
+type BasisMonitor struct {
+	// Delay before the contracts are refreshed again by a push when a refresh after a delivery failed.
+	RefreshBackoff time.Duration
+	// Clock, time.Now by default.
+	Now func() time.Time
+
+	client *Client
+
+	lock      sync.Mutex
+	refreshed time.Time
+	attempted time.Time
+	contracts map[string]FuturesContract // instrument id ->
+	prices    map[string]float64         // instrument id -> last price
+	estimated map[string]float64         // instrument id -> estimated delivery price
+	indexes   map[string]float64         // underlying -> index
+	updated   map[string]time.Time       // instrument id or underlying -> last push
+	basisCbs  []func(FuturesBasis)
+	spreadCbs []func(CalendarSpread)
+}
+
+func NewBasisMonitor(client *Client) *BasisMonitor {
+	return &BasisMonitor{
+		RefreshBackoff: time.Minute,
+		Now:            time.Now,
+		client:         client,
+		contracts:      map[string]FuturesContract{},
+		prices:         map[string]float64{},
+		estimated:      map[string]float64{},
+		indexes:        map[string]float64{},
+		updated:        map[string]time.Time{},
+	}
+}
+
+/*
+Delivery time of a contract from the delivery date of GetFuturesInstruments.
+*/
+func futuresDelivery(s string) time.Time {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t.Add(FUTURES_DELIVERY_HOUR)
+}
+
+/*
+Contracts of the instruments by instrument id. An instrument listed without alias gets the alias of
+its rank by delivery among the contracts of its underlying.
+*/
+func futuresContracts(instruments []FuturesInstrumentsResult) map[string]FuturesContract {
+	byUnderlying := map[string][]FuturesContract{}
+	for _, i := range instruments {
+		underlying := i.UnderlyingIndex + "-" + i.QuoteCurrency
+		if n := strings.LastIndex(i.InstrumentId, "-"); n > 0 {
+			underlying = i.InstrumentId[:n]
+		}
+		byUnderlying[underlying] = append(byUnderlying[underlying], FuturesContract{
+			InstrumentId: i.InstrumentId,
+			Underlying:   underlying,
+			Alias:        i.Alias,
+			Delivery:     futuresDelivery(i.Delivery),
+			ContractVal:  i.ContractVal,
+		})
+	}
+
+	contracts := map[string]FuturesContract{}
+	for _, cs := range byUnderlying {
+		sort.Slice(cs, func(i, j int) bool { return cs[i].Delivery.Before(cs[j].Delivery) })
+		for n, c := range cs {
+			if c.Alias == "" && n < len(futuresAliases) {
+				c.Alias = futuresAliases[n]
+			}
+			contracts[c.InstrumentId] = c
+		}
+	}
+	return contracts
+}
+
+/*
+Load the futures contracts, replacing the delivered ones.
+*/
+func (m *BasisMonitor) Refresh() error {
+	m.lock.Lock()
+	m.attempted = m.Now()
+	m.lock.Unlock()
+
+	instruments, err := m.client.GetFuturesInstruments()
+	if err != nil {
+		return err
+	}
+	if len(instruments) == 0 {
+		return ERR_BASIS_NO_CONTRACTS
+	}
+	contracts := futuresContracts(instruments)
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.refreshed = m.Now()
+	m.contracts = contracts
+	for id := range m.prices {
+		if _, ok := contracts[id]; !ok {
+			delete(m.prices, id)
+			delete(m.estimated, id)
+			delete(m.updated, id)
+		}
+	}
+	return nil
+}
+
+/*
+Whether a contract was delivered since the last Refresh, and no refresh was tried within
+RefreshBackoff.
+*/
+func (m *BasisMonitor) delivered() bool {
+	now := m.Now()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if now.Sub(m.attempted) < m.RefreshBackoff {
+		return false
+	}
+	for _, c := range m.contracts {
+		if c.Delivery.After(m.refreshed) && !c.Delivery.After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Register a callback for the basis of a contract, called when its price or its index is pushed.
+Callbacks run outside the monitor lock.
+*/
+func (m *BasisMonitor) OnBasis(cb func(FuturesBasis)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.basisCbs = append(m.basisCbs, cb)
+}
+
+/*
+Register a callback for the calendar spreads, called when the price of one of their legs is pushed.
+*/
+func (m *BasisMonitor) OnSpread(cb func(CalendarSpread)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.spreadCbs = append(m.spreadCbs, cb)
+}
+
+/*
+The contract of an underlying by alias, eg: Contract("BTC-USD", FUTURES_ALIAS_QUARTER).
+*/
+func (m *BasisMonitor) Contract(underlying, alias string) (FuturesContract, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.contractOf(underlying, alias)
+}
+
+func (m *BasisMonitor) contractOf(underlying, alias string) (FuturesContract, bool) {
+	for _, c := range m.contracts {
+		if c.Underlying == underlying && c.Alias == alias {
+			return c, true
+		}
+	}
+	return FuturesContract{}, false
+}
+
+/*
+Basis of a contract, false until both its price and its index are known.
+*/
+func (m *BasisMonitor) Basis(instrumentId string) (FuturesBasis, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.basisOf(instrumentId)
+}
+
+func (m *BasisMonitor) basisOf(instrumentId string) (FuturesBasis, bool) {
+	c, ok := m.contracts[instrumentId]
+	price, index := m.prices[instrumentId], m.indexes[c.Underlying]
+	if !ok || price <= 0 || index <= 0 {
+		return FuturesBasis{}, false
+	}
+	b := FuturesBasis{
+		FuturesContract: c,
+		Price:           price,
+		Index:           index,
+		EstimatedPrice:  m.estimated[instrumentId],
+		Basis:           price - index,
+		BasisRate:       (price - index) / index,
+		TimeToDelivery:  c.Delivery.Sub(m.Now()),
+		UpdatedAt:       m.updated[instrumentId],
+	}
+	if t := m.updated[c.Underlying]; t.After(b.UpdatedAt) {
+		b.UpdatedAt = t
+	}
+	if b.TimeToDelivery > 0 {
+		b.AnnualizedBasis = b.BasisRate * float64(basisYear) / float64(b.TimeToDelivery)
+	}
+	return b, true
+}
+
+/*
+Basis of every contract of an underlying with a known price, by delivery.
+*/
+func (m *BasisMonitor) Bases(underlying string) []FuturesBasis {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	bases := []FuturesBasis{}
+	for id, c := range m.contracts {
+		if c.Underlying != underlying {
+			continue
+		}
+		if b, ok := m.basisOf(id); ok {
+			bases = append(bases, b)
+		}
+	}
+	sort.Slice(bases, func(i, j int) bool { return bases[i].Delivery.Before(bases[j].Delivery) })
+	return bases
+}
+
+/*
+Spread between the contracts of an underlying by alias, eg: Spread("BTC-USD", FUTURES_ALIAS_THIS_WEEK,
+FUTURES_ALIAS_QUARTER). false until both prices are known.
+*/
+func (m *BasisMonitor) Spread(underlying, near, far string) (CalendarSpread, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	n, ok := m.contractOf(underlying, near)
+	if !ok {
+		return CalendarSpread{}, false
+	}
+	f, ok := m.contractOf(underlying, far)
+	if !ok {
+		return CalendarSpread{}, false
+	}
+	return m.spreadOf(n, f)
+}
+
+func (m *BasisMonitor) spreadOf(near, far FuturesContract) (CalendarSpread, bool) {
+	np, fp := m.prices[near.InstrumentId], m.prices[far.InstrumentId]
+	if np <= 0 || fp <= 0 {
+		return CalendarSpread{}, false
+	}
+	s := CalendarSpread{
+		Underlying: near.Underlying,
+		Near:       near,
+		Far:        far,
+		NearPrice:  np,
+		FarPrice:   fp,
+		Spread:     fp - np,
+		SpreadRate: (fp - np) / np,
+		UpdatedAt:  m.updated[near.InstrumentId],
+	}
+	if t := m.updated[far.InstrumentId]; t.After(s.UpdatedAt) {
+		s.UpdatedAt = t
+	}
+	if d := far.Delivery.Sub(near.Delivery); d > 0 {
+		s.AnnualizedSpread = s.SpreadRate * float64(basisYear) / float64(d)
+	}
+	return s, true
+}
+
+/*
+Spreads between every two contracts of an underlying with known prices, the nearest legs first:
+this_week/next_week, this_week/quarter, ..., quarter/bi_quarter.
+*/
+func (m *BasisMonitor) Spreads(underlying string) []CalendarSpread {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.spreadsOf(underlying, "")
+}
+
+/*
+Spreads of an underlying, only those with instrumentId as a leg when it is not empty.
+*/
+func (m *BasisMonitor) spreadsOf(underlying, instrumentId string) []CalendarSpread {
+	cs := []FuturesContract{}
+	for _, c := range m.contracts {
+		if c.Underlying == underlying {
+			cs = append(cs, c)
+		}
+	}
+	sort.Slice(cs, func(i, j int) bool { return cs[i].Delivery.Before(cs[j].Delivery) })
+
+	spreads := []CalendarSpread{}
+	for i := range cs {
+		for j := i + 1; j < len(cs); j++ {
+			if instrumentId != "" && cs[i].InstrumentId != instrumentId && cs[j].InstrumentId != instrumentId {
+				continue
+			}
+			if s, ok := m.spreadOf(cs[i], cs[j]); ok {
+				spreads = append(spreads, s)
+			}
+		}
+	}
+	return spreads
+}
+
+type basisPush struct {
+	InstrumentId    string `json:"instrument_id"`
+	Last            string `json:"last"`
+	SettlementPrice string `json:"settlement_price"`
+	Timestamp       string `json:"timestamp"`
+}
+
+/*
+Callback of the futures/ticker, index/ticker and futures/estimated_price channels. The contracts
+are refreshed first when one was delivered; a failed refresh is tried again by the pushes after
+RefreshBackoff.
+*/
+func (m *BasisMonitor) OnPush(obj interface{}) error {
+	tb, ok := obj.(*WSTableResponse)
+	if !ok {
+		return nil
+	}
+	if tb.Table != CHNL_FUTURES_TICKER && tb.Table != CHNL_INDEX_TICKER && tb.Table != CHNL_FUTURES_ESTIMATED_PRICE {
+		return nil
+	}
+	if m.delivered() {
+		if err := m.Refresh(); err != nil {
+			return err
+		}
+	}
+	pushes := []basisPush{}
+	if err := decodeTableData(tb.Data, &pushes); err != nil {
+		return err
+	}
+
+	var bases []FuturesBasis
+	var spreads []CalendarSpread
+	m.lock.Lock()
+	for _, p := range pushes {
+		at, err := time.Parse(time.RFC3339Nano, p.Timestamp)
+		if err != nil {
+			at = m.Now()
+		}
+		switch tb.Table {
+		case CHNL_INDEX_TICKER:
+			if price := toFloat(p.Last); price > 0 {
+				m.indexes[p.InstrumentId] = price
+				m.updated[p.InstrumentId] = at
+				for id, c := range m.contracts {
+					if c.Underlying != p.InstrumentId {
+						continue
+					}
+					if b, ok := m.basisOf(id); ok {
+						bases = append(bases, b)
+					}
+				}
+			}
+		case CHNL_FUTURES_ESTIMATED_PRICE:
+			m.estimated[p.InstrumentId] = toFloat(p.SettlementPrice)
+		case CHNL_FUTURES_TICKER:
+			c, ok := m.contracts[p.InstrumentId]
+			price := toFloat(p.Last)
+			if !ok || price <= 0 {
+				continue
+			}
+			m.prices[p.InstrumentId] = price
+			m.updated[p.InstrumentId] = at
+			if b, ok := m.basisOf(p.InstrumentId); ok {
+				bases = append(bases, b)
+			}
+			spreads = append(spreads, m.spreadsOf(c.Underlying, p.InstrumentId)...)
+		}
+	}
+	basisCbs, spreadCbs := m.basisCbs, m.spreadCbs
+	m.lock.Unlock()
+
+	sort.Slice(bases, func(i, j int) bool { return bases[i].Delivery.Before(bases[j].Delivery) })
+	for _, b := range bases {
+		for _, cb := range basisCbs {
+			cb(b)
+		}
+	}
+	for _, s := range spreads {
+		for _, cb := range spreadCbs {
+			cb(s)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package okex
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func futuresTickerPush(instrumentId, last, timestamp string) *WSTableResponse {
+	return tradePushTable(CHNL_FUTURES_TICKER, map[string]interface{}{"instrument_id": instrumentId,
+		"last": last, "best_bid": last, "best_ask": last, "timestamp": timestamp})
+}
+
+func TestBasisMonitor_BasisAndSpreads(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handle(GET, FUTURES_INSTRUMENTS, `[
+		{"instrument_id":"BTC-USD-190419","underlying_index":"BTC","quote_currency":"USD","contract_val":"100","delivery":"2019-04-19","alias":"this_week"},
+		{"instrument_id":"BTC-USD-190628","underlying_index":"BTC","quote_currency":"USD","contract_val":"100","delivery":"2019-06-28","alias":"quarter"},
+		{"instrument_id":"BTC-USD-190426","underlying_index":"BTC","quote_currency":"USD","contract_val":"100","delivery":"2019-04-26","alias":"next_week"},
+		{"instrument_id":"ETH-USD-190426","underlying_index":"ETH","quote_currency":"USD","contract_val":"10","delivery":"2019-04-26"},
+		{"instrument_id":"ETH-USD-190419","underlying_index":"ETH","quote_currency":"USD","contract_val":"10","delivery":"2019-04-19"}]`)
+
+	m := NewBasisMonitor(s.client())
+	m.Now = func() time.Time { return time.Date(2019, 4, 16, 8, 0, 0, 0, time.UTC) }
+	require.True(t, m.Refresh() == nil)
+	bases := []FuturesBasis{}
+	m.OnBasis(func(b FuturesBasis) { bases = append(bases, b) })
+	spreads := []CalendarSpread{}
+	m.OnSpread(func(s CalendarSpread) { spreads = append(spreads, s) })
+
+	c, ok := m.Contract("BTC-USD", FUTURES_ALIAS_QUARTER)
+	require.True(t, ok)
+	assert.Equal(t, "BTC-USD-190628", c.InstrumentId)
+	assert.True(t, c.Delivery.Equal(time.Date(2019, 6, 28, 8, 0, 0, 0, time.UTC)))
+	c, ok = m.Contract("ETH-USD", FUTURES_ALIAS_NEXT_WEEK)
+	require.True(t, ok)
+	assert.Equal(t, "ETH-USD-190426", c.InstrumentId)
+
+	// no basis before the index, no spread with a single leg
+	require.True(t, m.OnPush(futuresTickerPush("BTC-USD-190419", "5010", "2019-04-16T08:00:00.000Z")) == nil)
+	assert.Equal(t, 0, len(bases))
+	assert.Equal(t, 0, len(spreads))
+
+	require.True(t, m.OnPush(tradePushTable(CHNL_INDEX_TICKER, map[string]interface{}{"instrument_id": "BTC-USD",
+		"last": "5000", "timestamp": "2019-04-16T08:00:01.000Z"})) == nil)
+	require.Equal(t, 1, len(bases))
+	b := bases[0]
+	assert.Equal(t, FUTURES_ALIAS_THIS_WEEK, b.Alias)
+	near(t, 10, b.Basis)
+	near(t, 0.002, b.BasisRate)
+	near(t, 0.002*365/3, b.AnnualizedBasis)
+	assert.Equal(t, 72*time.Hour, b.TimeToDelivery)
+	assert.True(t, b.UpdatedAt.Equal(time.Date(2019, 4, 16, 8, 0, 1, 0, time.UTC)))
+
+	require.True(t, m.OnPush(futuresTickerPush("BTC-USD-190628", "5200", "2019-04-16T08:00:02.000Z")) == nil)
+	require.Equal(t, 2, len(bases))
+	near(t, 0.04, bases[1].BasisRate)
+	require.Equal(t, 1, len(spreads))
+	assert.Equal(t, "BTC-USD-190419", spreads[0].Near.InstrumentId)
+	assert.Equal(t, "BTC-USD-190628", spreads[0].Far.InstrumentId)
+	near(t, 190, spreads[0].Spread)
+	near(t, 190.0/5010*365/70, spreads[0].AnnualizedSpread)
+
+	require.True(t, m.OnPush(futuresTickerPush("BTC-USD-190426", "5030", "2019-04-16T08:00:03.000Z")) == nil)
+	assert.Equal(t, 3, len(bases))
+	assert.Equal(t, 3, len(spreads))
+	all := m.Spreads("BTC-USD")
+	require.Equal(t, 3, len(all))
+	assert.Equal(t, []string{FUTURES_ALIAS_THIS_WEEK, FUTURES_ALIAS_NEXT_WEEK}, []string{all[0].Near.Alias, all[0].Far.Alias})
+	assert.Equal(t, []string{FUTURES_ALIAS_THIS_WEEK, FUTURES_ALIAS_QUARTER}, []string{all[1].Near.Alias, all[1].Far.Alias})
+	assert.Equal(t, []string{FUTURES_ALIAS_NEXT_WEEK, FUTURES_ALIAS_QUARTER}, []string{all[2].Near.Alias, all[2].Far.Alias})
+	sp, ok := m.Spread("BTC-USD", FUTURES_ALIAS_NEXT_WEEK, FUTURES_ALIAS_QUARTER)
+	require.True(t, ok)
+	near(t, 170, sp.Spread)
+	_, ok = m.Spread("ETH-USD", FUTURES_ALIAS_THIS_WEEK, FUTURES_ALIAS_NEXT_WEEK)
+	assert.False(t, ok)
+
+	require.True(t, m.OnPush(tradePushTable(CHNL_FUTURES_ESTIMATED_PRICE, map[string]interface{}{"instrument_id": "BTC-USD-190419",
+		"settlement_price": "5005", "timestamp": "2019-04-16T08:00:04.000Z"})) == nil)
+	b, ok = m.Basis("BTC-USD-190419")
+	require.True(t, ok)
+	near(t, 5005, b.EstimatedPrice)
+	assert.Equal(t, 3, len(m.Bases("BTC-USD")))
+
+	// after the delivery the first push refreshes the contracts, the weekly contract is gone and
+	// next week is this week
+	s.handle(GET, FUTURES_INSTRUMENTS, `[
+		{"instrument_id":"BTC-USD-190426","underlying_index":"BTC","quote_currency":"USD","contract_val":"100","delivery":"2019-04-26","alias":"this_week"},
+		{"instrument_id":"BTC-USD-190503","underlying_index":"BTC","quote_currency":"USD","contract_val":"100","delivery":"2019-05-03","alias":"next_week"},
+		{"instrument_id":"BTC-USD-190628","underlying_index":"BTC","quote_currency":"USD","contract_val":"100","delivery":"2019-06-28","alias":"quarter"}]`)
+	m.Now = func() time.Time { return time.Date(2019, 4, 19, 8, 0, 1, 0, time.UTC) }
+	require.Equal(t, 1, len(s.requestsTo(GET, FUTURES_INSTRUMENTS)))
+	require.True(t, m.OnPush(tradePushTable(CHNL_INDEX_TICKER, map[string]interface{}{"instrument_id": "BTC-USD",
+		"last": "5000", "timestamp": "2019-04-19T08:00:01.000Z"})) == nil)
+	require.True(t, m.OnPush(tradePushTable(CHNL_INDEX_TICKER, map[string]interface{}{"instrument_id": "BTC-USD",
+		"last": "5000", "timestamp": "2019-04-19T08:00:02.000Z"})) == nil)
+	assert.Equal(t, 2, len(s.requestsTo(GET, FUTURES_INSTRUMENTS)))
+	_, ok = m.Basis("BTC-USD-190419")
+	assert.False(t, ok)
+	sp, ok = m.Spread("BTC-USD", FUTURES_ALIAS_THIS_WEEK, FUTURES_ALIAS_QUARTER)
+	require.True(t, ok)
+	assert.Equal(t, "BTC-USD-190426", sp.Near.InstrumentId)
+	assert.Equal(t, 1, len(m.Spreads("BTC-USD")))
+}
+
+func TestBasisMonitor_RefreshBackoff(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	failing := false
+	s.handleFunc(GET, FUTURES_INSTRUMENTS, func(req fakeRequest) string {
+		if failing {
+			return `{"code":30000,"message":"system busy"}`
+		}
+		return `[
+		{"instrument_id":"BTC-USD-190419","underlying_index":"BTC","quote_currency":"USD","contract_val":"100","delivery":"2019-04-19","alias":"this_week"},
+		{"instrument_id":"BTC-USD-190628","underlying_index":"BTC","quote_currency":"USD","contract_val":"100","delivery":"2019-06-28","alias":"quarter"}]`
+	})
+	now := time.Date(2019, 4, 16, 8, 0, 0, 0, time.UTC)
+	m := NewBasisMonitor(s.client())
+	m.Now = func() time.Time { return now }
+	require.True(t, m.Refresh() == nil)
+	push := tradePushTable(CHNL_INDEX_TICKER, map[string]interface{}{"instrument_id": "BTC-USD",
+		"last": "5000", "timestamp": "2019-04-19T08:00:01.000Z"})
+
+	// the refresh after the delivery fails, the pushes within the backoff do not try it again
+	failing = true
+	now = time.Date(2019, 4, 19, 8, 0, 1, 0, time.UTC)
+	assert.True(t, m.OnPush(push) != nil)
+	now = now.Add(30 * time.Second)
+	require.True(t, m.OnPush(push) == nil)
+	require.True(t, m.OnPush(push) == nil)
+	assert.Equal(t, 2, len(s.requestsTo(GET, FUTURES_INSTRUMENTS)))
+
+	failing = false
+	now = now.Add(30 * time.Second)
+	require.True(t, m.OnPush(push) == nil)
+	require.True(t, m.OnPush(push) == nil)
+	assert.Equal(t, 3, len(s.requestsTo(GET, FUTURES_INSTRUMENTS)))
+}
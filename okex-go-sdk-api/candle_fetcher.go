@@ -0,0 +1,237 @@
+package okex
+
+/*
+ CandleFetcher downloads the candles of an arbitrary time range. The candle endpoints return one
+ page of at most 200 bars, the fetcher walks the range backwards page by page, de-duplicates the
+ overlapping bars and reports the bars the exchange did not return.
+
+	series, err := NewCandleFetcher(client, MARKET_SWAP).Fetch("BTC-USD-SWAP", CANDLES_1MIN, start, end)
+*/
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+var (
+	ERR_CANDLE_RANGE       = errors.New(`candle fetcher: start must be before end`)
+	ERR_CANDLE_GRANULARITY = errors.New(`candle fetcher: granularity must be one of the CANDLES_* constants`)
+	ERR_CANDLE_MARKET      = errors.New(`candle fetcher: market must be MARKET_SPOT, MARKET_MARGIN, MARKET_FUTURES or MARKET_SWAP`)
+)
+
+var candleGranularities = map[int]bool{
+	CANDLES_1MIN: true, CANDLES_3MIN: true, CANDLES_5MIN: true, CANDLES_15MIN: true, CANDLES_30MIN: true,
+	CANDLES_1HOUR: true, CANDLES_2HOUR: true, CANDLES_4HOUR: true, CANDLES_6HOUR: true, CANDLES_12HOUR: true,
+	CANDLES_1DAY: true, CANDLES_1WEEK: true,
+}
+
+/*
+A number kept exactly as the exchange sent it.
+*/
+type Decimal string
+
+func (d Decimal) Float64() float64 {
+	return toFloat(string(d))
+}
+
+func (d Decimal) String() string {
+	return string(d)
+}
+
+/*
+CurrencyVolume is only returned for futures and swap candles.
+*/
+type Candle struct {
+	Time           time.Time
+	Open           Decimal
+	High           Decimal
+	Low            Decimal
+	Close          Decimal
+	Volume         Decimal
+	CurrencyVolume Decimal
+}
+
+/*
+Bars missing between From and To, both included.
+*/
+type CandleGap struct {
+	From time.Time
+	To   time.Time
+	Bars int
+}
+
+type CandleSeries struct {
+	InstrumentId string
+	Granularity  int
+	Candles      []Candle // oldest first
+	Gaps         []CandleGap
+}
+
+type CandleFetcher struct {
+	client *Client
+	Market string // MARKET_SPOT, MARKET_FUTURES or MARKET_SWAP, margin pairs use the spot candles
+	// Bars requested per page, 200 by default.
+	PageSize int
+}
+
+func NewCandleFetcher(client *Client, market string) *CandleFetcher {
+	return &CandleFetcher{client: client, Market: market, PageSize: 200}
+}
+
+func candleTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+func candleOf(row []interface{}) (Candle, bool) {
+	if len(row) < 6 {
+		return Candle{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, anyToString(row[0]))
+	if err != nil {
+		return Candle{}, false
+	}
+	c := Candle{
+		Time:   t,
+		Open:   Decimal(anyToString(row[1])),
+		High:   Decimal(anyToString(row[2])),
+		Low:    Decimal(anyToString(row[3])),
+		Close:  Decimal(anyToString(row[4])),
+		Volume: Decimal(anyToString(row[5])),
+	}
+	if len(row) > 6 {
+		c.CurrencyVolume = Decimal(anyToString(row[6]))
+	}
+	return c, true
+}
+
+/*
+Fetch one page of raw candle rows of the market between start and end.
+*/
+func (f *CandleFetcher) page(instrumentId string, granularity int, start, end time.Time) ([][]interface{}, error) {
+	params := NewParams()
+	params["start"] = candleTime(start)
+	params["end"] = candleTime(end)
+	params["granularity"] = Int2String(granularity)
+
+	rows := [][]interface{}{}
+	switch f.Market {
+	case MARKET_SPOT, MARKET_MARGIN:
+		r, err := f.client.GetSpotInstrumentCandles(instrumentId, &params)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range *r {
+			if values, ok := row.([]interface{}); ok {
+				rows = append(rows, values)
+			}
+		}
+	case MARKET_FUTURES:
+		r, err := f.client.GetFuturesInstrumentCandles(instrumentId, params)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range r {
+			values := make([]interface{}, len(row))
+			for i, v := range row {
+				values[i] = v
+			}
+			rows = append(rows, values)
+		}
+	case MARKET_SWAP:
+		r, err := f.client.GetSwapCandlesByInstrument(instrumentId, params)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range *r {
+			rows = append(rows, row)
+		}
+	default:
+		return nil, ERR_CANDLE_MARKET
+	}
+	return rows, nil
+}
+
+/*
+Download the bars opening in [start, end), granularity in seconds.
+*/
+func (f *CandleFetcher) Fetch(instrumentId string, granularity int, start, end time.Time) (*CandleSeries, error) {
+	if !candleGranularities[granularity] {
+		return nil, ERR_CANDLE_GRANULARITY
+	}
+	if !start.Before(end) {
+		return nil, ERR_CANDLE_RANGE
+	}
+	pageSize := f.PageSize
+	if pageSize <= 0 {
+		pageSize = 200
+	}
+	step := time.Duration(granularity) * time.Second
+
+	bars := map[int64]Candle{}
+	for cursor := end; cursor.After(start); {
+		from := cursor.Add(-time.Duration(pageSize) * step)
+		if from.Before(start) {
+			from = start
+		}
+		rows, err := f.page(instrumentId, granularity, from, cursor)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			c, ok := candleOf(row)
+			if !ok || c.Time.Before(start) || !c.Time.Before(end) {
+				continue
+			}
+			bars[c.Time.Unix()] = c
+		}
+		cursor = from
+	}
+
+	series := &CandleSeries{InstrumentId: instrumentId, Granularity: granularity}
+	for _, c := range bars {
+		series.Candles = append(series.Candles, c)
+	}
+	sort.Slice(series.Candles, func(i, j int) bool {
+		return series.Candles[i].Time.Before(series.Candles[j].Time)
+	})
+	series.Gaps = candleGaps(series.Candles, step, start, end)
+	return series, nil
+}
+
+/*
+Missing bars from start to end on the grid of the granularity, the UTC time truncated to it.
+A bar off the grid fills the slot it opens in.
+*/
+func candleGaps(candles []Candle, step time.Duration, start, end time.Time) []CandleGap {
+	filled := map[int64]bool{}
+	for _, c := range candles {
+		filled[c.Time.Truncate(step).Unix()] = true
+	}
+	// first slot of the grid at or after start
+	first := start.Truncate(step)
+	if first.Before(start) {
+		first = first.Add(step)
+	}
+
+	gaps := []CandleGap{}
+	var gap *CandleGap
+	for t := first; t.Before(end); t = t.Add(step) {
+		if filled[t.Unix()] {
+			if gap != nil {
+				gaps = append(gaps, *gap)
+				gap = nil
+			}
+			continue
+		}
+		if gap == nil {
+			gap = &CandleGap{From: t}
+		}
+		gap.To = t
+		gap.Bars++
+	}
+	if gap != nil {
+		gaps = append(gaps, *gap)
+	}
+	return gaps
+}
@@ -0,0 +1,111 @@
+package okex
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+/*
+Serve 1 minute bars newest first between start and end (both included), skipping the bars in missing.
+*/
+func fakeCandles(missing map[int]bool, columns int) func(r fakeRequest) string {
+	return func(r fakeRequest) string {
+		q, _ := url.ParseQuery(r.RawQuery)
+		start, _ := time.Parse(time.RFC3339Nano, q.Get("start"))
+		end, _ := time.Parse(time.RFC3339Nano, q.Get("end"))
+		rows := [][]string{}
+		for t := end; !t.Before(start); t = t.Add(-time.Minute) {
+			if missing[t.Minute()] {
+				continue
+			}
+			row := []string{candleTime(t), "1.1", "1.5", "1.0", Int2String(t.Minute()), "10", "0.1"}
+			rows = append(rows, row[:columns])
+		}
+		b, _ := json.Marshal(rows)
+		return string(b)
+	}
+}
+
+func TestCandleFetcher_Fetch(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handleFunc(GET, "/api/swap/v3/instruments/BTC-USD-SWAP/candles", fakeCandles(map[int]bool{3: true, 4: true, 8: true}, 7))
+
+	start := time.Date(2019, 4, 16, 10, 0, 0, 0, time.UTC)
+	f := NewCandleFetcher(s.client(), MARKET_SWAP)
+	f.PageSize = 4
+	series, err := f.Fetch("BTC-USD-SWAP", CANDLES_1MIN, start, start.Add(10*time.Minute))
+	require.True(t, err == nil, err)
+
+	require.Equal(t, 7, len(series.Candles))
+	assert.True(t, series.Candles[0].Time.Equal(start))
+	assert.Equal(t, Decimal("9"), series.Candles[6].Close)
+	assert.Equal(t, 1.5, series.Candles[0].High.Float64())
+	assert.Equal(t, Decimal("0.1"), series.Candles[0].CurrencyVolume)
+	assert.Equal(t, 3, len(s.requestsTo(GET, "/api/swap/v3/instruments/BTC-USD-SWAP/candles")))
+
+	require.Equal(t, 2, len(series.Gaps))
+	assert.True(t, series.Gaps[0].From.Equal(start.Add(3*time.Minute)))
+	assert.True(t, series.Gaps[0].To.Equal(start.Add(4*time.Minute)))
+	assert.Equal(t, 2, series.Gaps[0].Bars)
+	assert.Equal(t, 1, series.Gaps[1].Bars)
+}
+
+func TestCandleFetcher_Markets(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handleFunc(GET, "/api/spot/v3/instruments/BTC-USDT/candles", fakeCandles(nil, 6))
+	s.handleFunc(GET, "/api/futures/v3/instruments/BTC-USD-190628/candles", fakeCandles(nil, 7))
+
+	start := time.Date(2019, 4, 16, 10, 0, 0, 0, time.UTC)
+	spot, err := NewCandleFetcher(s.client(), MARKET_SPOT).Fetch("BTC-USDT", CANDLES_1MIN, start, start.Add(5*time.Minute))
+	require.True(t, err == nil, err)
+	assert.Equal(t, 5, len(spot.Candles))
+	assert.Equal(t, Decimal(""), spot.Candles[0].CurrencyVolume)
+	assert.Equal(t, 0, len(spot.Gaps))
+
+	futures, err := NewCandleFetcher(s.client(), MARKET_FUTURES).Fetch("BTC-USD-190628", CANDLES_1MIN, start, start.Add(5*time.Minute))
+	require.True(t, err == nil, err)
+	assert.Equal(t, 5, len(futures.Candles))
+
+	_, err = NewCandleFetcher(s.client(), MARKET_SPOT).Fetch("BTC-USDT", 61, start, start.Add(time.Hour))
+	assert.Equal(t, ERR_CANDLE_GRANULARITY, err)
+	_, err = NewCandleFetcher(s.client(), MARKET_SPOT).Fetch("BTC-USDT", CANDLES_1MIN, start, start)
+	assert.Equal(t, ERR_CANDLE_RANGE, err)
+}
+
+func TestCandleFetcher_Gaps(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handle(GET, "/api/spot/v3/instruments/BTC-USDT/candles", `[]`)
+	s.handle(GET, "/api/spot/v3/instruments/ETH-USDT/candles", `[
+		["2019-04-16T10:03:00.000Z","1","1","1","1","1"],
+		["2019-04-16T10:01:30.000Z","1","1","1","1","1"]]`)
+	f := NewCandleFetcher(s.client(), MARKET_SPOT)
+
+	// no bar returned: the whole grid from the first slot after start is missing
+	start := time.Date(2019, 4, 16, 10, 0, 30, 0, time.UTC)
+	series, err := f.Fetch("BTC-USDT", CANDLES_1MIN, start, start.Add(5*time.Minute))
+	require.True(t, err == nil, err)
+	require.Equal(t, 1, len(series.Gaps))
+	assert.True(t, series.Gaps[0].From.Equal(start.Add(30*time.Second)))
+	assert.Equal(t, 5, series.Gaps[0].Bars)
+
+	// the bar off the grid fills the 10:01 slot
+	series, err = f.Fetch("ETH-USDT", CANDLES_1MIN, start, start.Add(5*time.Minute))
+	require.True(t, err == nil, err)
+	require.Equal(t, 2, len(series.Gaps))
+	assert.True(t, series.Gaps[0].From.Equal(start.Add(90*time.Second)))
+	assert.Equal(t, 1, series.Gaps[0].Bars)
+	assert.True(t, series.Gaps[1].From.Equal(start.Add(210*time.Second)))
+	assert.True(t, series.Gaps[1].To.Equal(start.Add(270*time.Second)))
+	assert.Equal(t, 2, series.Gaps[1].Bars)
+
+	_, err = NewCandleFetcher(s.client(), "option").Fetch("BTC-USD-190628", CANDLES_1MIN, start, start.Add(time.Hour))
+	assert.Equal(t, ERR_CANDLE_MARKET, err)
+}
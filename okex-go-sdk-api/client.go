@@ -22,6 +22,10 @@ import (
 type Client struct {
 	Config     Config
 	HttpClient *http.Client
+	// Optional pre-trade risk checks, @see file: risk_guard.go
+	Risk *RiskGuard
+	// Optional book recording every order posted, @see file: order_manager.go
+	Orders *OrderManager
 }
 
 type ApiMessage struct {
@@ -0,0 +1,114 @@
+package okex
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// orders 1000..1149 are unfinished, paged by after=order_id in descending order
+func fakeUnfinishedOrders(r fakeRequest, field string) string {
+	query, _ := url.ParseQuery(r.RawQuery)
+	upper := 1149
+	if after := query.Get("after"); after != "" {
+		upper = StringToInt(after) - 1
+	}
+	var orders []string
+	for id := upper; id >= 1000 && len(orders) < StringToInt(query.Get("limit")); id-- {
+		orders = append(orders, fmt.Sprintf(`{"order_id":"%d","state":"0"}`, id))
+	}
+	return `{"result":true,"` + field + `":[` + strings.Join(orders, ",") + `]}`
+}
+
+func TestClient_PostFuturesClosePositionsByUnderlying(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handle(GET, FUTURES_POSITION, `{"result":true,"holding":[[
+		{"instrument_id":"BTC-USD-190628","long_qty":"2","short_qty":"1","long_avail_qty":"2","short_avail_qty":"1"},
+		{"instrument_id":"BTC-USD-190927","long_qty":"0","short_qty":"3","long_avail_qty":"0","short_avail_qty":"3"},
+		{"instrument_id":"ETH-USD-190628","long_qty":"5","short_qty":"0","long_avail_qty":"5","short_avail_qty":"0"}]]}`)
+	s.handleFunc(POST, FUTURES_CLOSE_POSITION, func(r fakeRequest) string {
+		data := ClosePositionData{}
+		JsonString2Struct(r.Body, &data)
+		return `{"instrument_id":"` + data.InstrumentId + `","direction":"` + data.Direction + `","result":true,"error_code":"0","error_message":""}`
+	})
+	c := s.client()
+
+	r, err := c.PostFuturesClosePositionsByUnderlying("BTC-USD")
+	require.True(t, err == nil, err)
+	assert.True(t, r.Result.Result)
+	require.Equal(t, 3, len(r.ClosePositionInfo))
+	assert.Equal(t, ClosePositionInfo{InstrumentId: "BTC-USD-190927", Direction: DIRECTION_SHORT, Result: true}, r.ClosePositionInfo[2])
+
+	reqs := s.requestsTo(POST, FUTURES_CLOSE_POSITION)
+	require.Equal(t, 3, len(reqs))
+	assert.Equal(t, `{"instrument_id":"BTC-USD-190628","direction":"long"}`, reqs[0].Body)
+
+	_, err = c.PostFuturesClosePosition("BTC-USD-190628", "both")
+	assert.True(t, err != nil)
+
+	// a bad direction anywhere in the batch closes nothing
+	_, err = c.PostFuturesClosePositions(&FuturesClosePositionParams{ClosePositionData: []ClosePositionData{
+		{InstrumentId: "BTC-USD-190628", Direction: DIRECTION_LONG},
+		{InstrumentId: "BTC-USD-190927", Direction: "both"}}})
+	assert.True(t, err != nil)
+	assert.Equal(t, 3, len(s.requestsTo(POST, FUTURES_CLOSE_POSITION)))
+}
+
+func TestClient_CancelAllFuturesInstrumentOrders(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handleFunc(GET, "/api/futures/v3/orders/BTC-USD-190628", func(r fakeRequest) string {
+		return fakeUnfinishedOrders(r, "order_info")
+	})
+	s.handle(POST, "/api/futures/v3/cancel_batch_orders/BTC-USD-190628", `{"result":true,"instrument_id":"BTC-USD-190628"}`)
+	c := s.client()
+
+	results, err := c.CancelAllFuturesInstrumentOrders("BTC-USD-190628")
+	require.True(t, err == nil, err)
+	assert.Equal(t, 15, len(results))
+	assert.Equal(t, 2, len(s.requestsTo(GET, "/api/futures/v3/orders/BTC-USD-190628")))
+
+	reqs := s.requestsTo(POST, "/api/futures/v3/cancel_batch_orders/BTC-USD-190628")
+	require.Equal(t, 15, len(reqs))
+	assert.True(t, strings.Contains(reqs[14].Body, `\"1000\"`), reqs[14].Body)
+}
+
+func TestClient_SwapCloseAndCancelAll(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handle(GET, SWAP_POSITION, `[{"margin_mode":"crossed","holding":[
+		{"instrument_id":"BTC-USD-SWAP","position":"3","avail_position":"3","side":"long"},
+		{"instrument_id":"BTC-USD-SWAP","position":"0","avail_position":"0","side":"short"},
+		{"instrument_id":"ETH-USD-SWAP","position":"1","avail_position":"1","side":"short"}]}]`)
+	s.handle(POST, SWAP_CLOSE_POSITION, `{"instrument_id":"BTC-USD-SWAP","direction":"long","result":"true","error_code":"","error_message":""}`)
+	s.handleFunc(GET, "/api/swap/v3/orders/BTC-USD-SWAP", func(r fakeRequest) string {
+		return fakeUnfinishedOrders(r, "order_info")
+	})
+	s.handle(POST, "/api/swap/v3/cancel_batch_orders/BTC-USD-SWAP", `{"result":"true","order_id":""}`)
+	c := s.client()
+
+	r, err := c.PostSwapClosePositionsByUnderlying("BTC-USD")
+	require.True(t, err == nil, err)
+	require.Equal(t, 1, len(r))
+	assert.Equal(t, `{"instrument_id":"BTC-USD-SWAP","direction":"long"}`, s.lastRequest().Body)
+
+	// a position without a side closes nothing
+	s.handle(GET, SWAP_POSITION, `[{"margin_mode":"fixed","holding":[
+		{"instrument_id":"ETH-USD-SWAP","position":"1","avail_position":"1","side":"short"},
+		{"instrument_id":"ETH-USD-SWAP","position":"2","avail_position":"2","side":""}]}]`)
+	_, err = c.PostSwapClosePositionsByUnderlying("ETH-USD")
+	assert.True(t, err != nil)
+	assert.Equal(t, 1, len(s.requestsTo(POST, SWAP_CLOSE_POSITION)))
+
+	results, err := c.CancelAllSwapInstrumentOrders("BTC-USD-SWAP")
+	require.True(t, err == nil, err)
+	assert.Equal(t, 15, len(results))
+	reqs := s.requestsTo(POST, "/api/swap/v3/cancel_batch_orders/BTC-USD-SWAP")
+	require.Equal(t, 15, len(reqs))
+	assert.Equal(t, `{"ids":["1009","1008","1007","1006","1005","1004","1003","1002","1001","1000"]}`, reqs[14].Body)
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/okcoin-okex/open-api-v3-sdk/okex-go-sdk-api"
+)
+
+func init() {
+	register(&command{name: "time", usage: "server time", run: serverTime})
+	register(&command{name: "instruments", usage: "<market>", run: instruments})
+	register(&command{name: "ticker", usage: "<market> <instrument_id>", run: ticker})
+	register(&command{name: "book", usage: "[-size n] <market> <instrument_id>", run: book})
+	register(&command{name: "candles", usage: "[-granularity seconds] [-start time] [-end time] <market> <instrument_id>", run: candles})
+	register(&command{name: "balances", usage: "[wallet|spot|margin|futures|swap]", private: true, run: balances})
+	register(&command{name: "orders", usage: "<market> <instrument_id>, the open orders", private: true, run: orders})
+	register(&command{name: "place", usage: "[-price p] [-client-oid id] <market> <instrument_id> <side> <size>, a market order without -price", private: true, run: place})
+	register(&command{name: "cancel", usage: "<market> <instrument_id> <order_id|client_oid>", private: true, run: cancel})
+	register(&command{name: "transfer", usage: "[-sub-account name] [-instrument-id id] [-to-instrument-id id] <currency> <amount> <from> <to>", private: true, run: transfer})
+}
+
+func serverTime(env *env, args []string) error {
+	if _, err := parseArgs(flag.NewFlagSet("time", flag.ContinueOnError), args, 0, 0); err != nil {
+		return err
+	}
+	r, err := env.client.GetServerTime()
+	if err != nil {
+		return err
+	}
+	return env.print(r)
+}
+
+func instruments(env *env, args []string) error {
+	positional, err := parseArgs(flag.NewFlagSet("instruments", flag.ContinueOnError), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	m, err := market(positional[0])
+	if err != nil {
+		return err
+	}
+	var r interface{}
+	switch m {
+	case okex.MARKET_SPOT, okex.MARKET_MARGIN:
+		r, err = env.client.GetSpotInstruments()
+	case okex.MARKET_FUTURES:
+		r, err = env.client.GetFuturesInstruments()
+	case okex.MARKET_SWAP:
+		r, err = env.client.GetSwapInstruments()
+	}
+	if err != nil {
+		return err
+	}
+	return env.print(r)
+}
+
+func ticker(env *env, args []string) error {
+	positional, err := parseArgs(flag.NewFlagSet("ticker", flag.ContinueOnError), args, 2, 2)
+	if err != nil {
+		return err
+	}
+	m, err := market(positional[0])
+	if err != nil {
+		return err
+	}
+	var r interface{}
+	switch m {
+	case okex.MARKET_SPOT, okex.MARKET_MARGIN:
+		r, err = env.client.GetSpotInstrumentTicker(positional[1])
+	case okex.MARKET_FUTURES:
+		r, err = env.client.GetFuturesInstrumentTicker(positional[1])
+	case okex.MARKET_SWAP:
+		r, err = env.client.GetSwapTickerByInstrument(positional[1])
+	}
+	if err != nil {
+		return err
+	}
+	return env.print(r)
+}
+
+func book(env *env, args []string) error {
+	flags := flag.NewFlagSet("book", flag.ContinueOnError)
+	size := flags.Int("size", 20, "levels per side")
+	positional, err := parseArgs(flags, args, 2, 2)
+	if err != nil {
+		return err
+	}
+	m, err := market(positional[0])
+	if err != nil {
+		return err
+	}
+	params := okex.NewParams()
+	params["size"] = okex.Int2String(*size)
+	var r interface{}
+	switch m {
+	case okex.MARKET_SPOT, okex.MARKET_MARGIN:
+		r, err = env.client.GetSpotInstrumentBook(positional[1], &params)
+	case okex.MARKET_FUTURES:
+		r, err = env.client.GetFuturesInstrumentBook(positional[1], params)
+	case okex.MARKET_SWAP:
+		r, err = env.client.GetSwapDepthByInstrumentId(positional[1], params["size"])
+	}
+	if err != nil {
+		return err
+	}
+	return env.print(r)
+}
+
+func parseTime(s string, def time.Time) (time.Time, error) {
+	if s == "" {
+		return def, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
+
+/*
+Candles of any range through CandleFetcher, the last 200 bars by default.
+*/
+func candles(env *env, args []string) error {
+	flags := flag.NewFlagSet("candles", flag.ContinueOnError)
+	granularity := flags.Int("granularity", okex.CANDLES_1MIN, "bar seconds")
+	startFlag := flags.String("start", "", "RFC3339 time or date")
+	endFlag := flags.String("end", "", "RFC3339 time or date, now by default")
+	positional, err := parseArgs(flags, args, 2, 2)
+	if err != nil {
+		return err
+	}
+	m, err := market(positional[0])
+	if err != nil {
+		return err
+	}
+	end, err := parseTime(*endFlag, time.Now())
+	if err != nil {
+		return err
+	}
+	start, err := parseTime(*startFlag, end.Add(-200*time.Duration(*granularity)*time.Second))
+	if err != nil {
+		return err
+	}
+	series, err := okex.NewCandleFetcher(env.client, m).Fetch(positional[1], *granularity, start, end)
+	if err != nil {
+		return err
+	}
+	return env.print(series)
+}
+
+func balances(env *env, args []string) error {
+	positional, err := parseArgs(flag.NewFlagSet("balances", flag.ContinueOnError), args, 0, 1)
+	if err != nil {
+		return err
+	}
+	accounts := []string{"wallet", "spot", "margin", "futures", "swap"}
+	if len(positional) == 1 {
+		accounts = positional
+	}
+
+	result := map[string]interface{}{}
+	for _, account := range accounts {
+		var r interface{}
+		switch strings.ToLower(account) {
+		case "wallet":
+			r, err = env.client.GetAccountWallet()
+		case "spot":
+			r, err = env.client.GetSpotAccounts()
+		case "margin":
+			r, err = env.client.GetMarginAccounts()
+		case "futures":
+			r, err = env.client.GetFuturesAccounts()
+		case "swap":
+			r, err = env.client.GetSwapAccounts()
+		default:
+			return fmt.Errorf("okex: unknown account %q", account)
+		}
+		if err != nil {
+			return err
+		}
+		result[strings.ToLower(account)] = r
+	}
+	if len(positional) == 1 {
+		return env.print(result[strings.ToLower(positional[0])])
+	}
+	return env.print(result)
+}
+
+func orders(env *env, args []string) error {
+	positional, err := parseArgs(flag.NewFlagSet("orders", flag.ContinueOnError), args, 2, 2)
+	if err != nil {
+		return err
+	}
+	m, err := market(positional[0])
+	if err != nil {
+		return err
+	}
+	instrumentId := positional[1]
+	var r interface{}
+	switch m {
+	case okex.MARKET_SPOT:
+		params := okex.NewParams()
+		params["instrument_id"] = instrumentId
+		r, err = env.client.GetSpotOrdersPending(&params)
+	case okex.MARKET_MARGIN:
+		r, err = env.client.GetMarginOrdersPending(instrumentId, nil)
+	case okex.MARKET_FUTURES:
+		r, err = env.client.GetFuturesOrders(instrumentId, okex.Int2String(okex.ORDER_STATE_UNFINISHED), nil)
+	case okex.MARKET_SWAP:
+		params := okex.NewParams()
+		params["state"] = okex.Int2String(okex.ORDER_STATE_UNFINISHED)
+		r, err = env.client.GetSwapOrderByInstrumentId(instrumentId, params)
+	}
+	if err != nil {
+		return err
+	}
+	return env.print(r)
+}
+
+/*
+Order type of a futures or swap side: open_long, open_short, close_long or close_short.
+*/
+var contractSides = map[string]int{
+	"open_long":   okex.OPEN_LONG,
+	"open_short":  okex.OPEN_SHORT,
+	"close_long":  okex.CLOSE_LONG,
+	"close_short": okex.CLOSE_SHORT,
+}
+
+func place(env *env, args []string) error {
+	flags := flag.NewFlagSet("place", flag.ContinueOnError)
+	price := flags.String("price", "", "limit price, a market order without it")
+	clientOid := flags.String("client-oid", "", "client order id")
+	positional, err := parseArgs(flags, args, 4, 4)
+	if err != nil {
+		return err
+	}
+	m, err := market(positional[0])
+	if err != nil {
+		return err
+	}
+	instrumentId, side, size := positional[1], strings.ToLower(positional[2]), positional[3]
+
+	var r interface{}
+	switch m {
+	case okex.MARKET_SPOT, okex.MARKET_MARGIN:
+		var order okex.SpotOrderBuilder
+		switch {
+		case *price != "":
+			order = okex.NewSpotLimitOrder(instrumentId, side, *price, size).WithClientOid(*clientOid)
+		case side == okex.SPOT_SIDE_BUY:
+			// market buys spend size in the quote currency
+			order = okex.NewSpotMarketBuy(instrumentId, size).WithClientOid(*clientOid)
+		case side == okex.SPOT_SIDE_SELL:
+			order = okex.NewSpotMarketSell(instrumentId, size).WithClientOid(*clientOid)
+		default:
+			return okex.ERR_SPOT_ORDER_SIDE
+		}
+		if m == okex.MARKET_SPOT {
+			r, err = env.client.PostSpotOrder(order)
+		} else {
+			r, err = env.client.PostMarginOrder(okex.NewMarginOrder(order))
+		}
+	case okex.MARKET_FUTURES, okex.MARKET_SWAP:
+		oType, ok := contractSides[side]
+		if !ok {
+			return fmt.Errorf("okex: side of a %s order is open_long, open_short, close_long or close_short", m)
+		}
+		matchPrice := "0"
+		if *price == "" {
+			matchPrice = "1"
+		}
+		if m == okex.MARKET_FUTURES {
+			optional := okex.NewParams()
+			optional["match_price"] = matchPrice
+			if *clientOid != "" {
+				optional["client_oid"] = *clientOid
+			}
+			r, err = env.client.PostFuturesOrder(instrumentId, okex.Int2String(oType), *price, size, optional)
+		} else {
+			r, err = env.client.PostSwapOrder(instrumentId, &okex.BasePlaceOrderInfo{
+				ClientOid:  *clientOid,
+				Price:      *price,
+				MatchPrice: matchPrice,
+				Type:       okex.Int2String(oType),
+				Size:       size,
+			})
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return env.print(r)
+}
+
+func cancel(env *env, args []string) error {
+	positional, err := parseArgs(flag.NewFlagSet("cancel", flag.ContinueOnError), args, 3, 3)
+	if err != nil {
+		return err
+	}
+	m, err := market(positional[0])
+	if err != nil {
+		return err
+	}
+	instrumentId, orderId := positional[1], positional[2]
+	var r interface{}
+	switch m {
+	case okex.MARKET_SPOT:
+		r, err = env.client.PostSpotCancelOrders(instrumentId, orderId)
+	case okex.MARKET_MARGIN:
+		r, err = env.client.PostMarginCancelOrdersById(instrumentId, orderId)
+	case okex.MARKET_FUTURES:
+		r, err = env.client.CancelFuturesInstrumentOrder(instrumentId, orderId)
+	case okex.MARKET_SWAP:
+		r, err = env.client.PostSwapCancelOrder(instrumentId, orderId)
+	}
+	if err != nil {
+		return err
+	}
+	return env.print(r)
+}
+
+func transfer(env *env, args []string) error {
+	flags := flag.NewFlagSet("transfer", flag.ContinueOnError)
+	subAccount := flags.String("sub-account", "", "sub-account name")
+	instrumentId := flags.String("instrument-id", "", "margin pair transferred from")
+	toInstrumentId := flags.String("to-instrument-id", "", "margin pair transferred to")
+	positional, err := parseArgs(flags, args, 4, 4)
+	if err != nil {
+		return err
+	}
+	from, ok := okex.ParseAccountType(positional[2])
+	if !ok {
+		return fmt.Errorf("okex: unknown account %q", positional[2])
+	}
+	to, ok := okex.ParseAccountType(positional[3])
+	if !ok {
+		return fmt.Errorf("okex: unknown account %q", positional[3])
+	}
+	t := okex.NewTransfer(positional[0], positional[1], from, to).
+		WithSubAccount(*subAccount).
+		WithInstrumentId(*instrumentId).
+		WithToInstrumentId(*toInstrumentId)
+	r, err := env.client.PostAccountTransferBy(t)
+	if err != nil {
+		return err
+	}
+	return env.print(r)
+}
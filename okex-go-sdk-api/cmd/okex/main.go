@@ -0,0 +1,145 @@
+/*
+Command okex is a command line client of the OKEx v3 api built on Client and OKWSAgent.
+
+	okex [-config file] [-profile name] <command> [flags] [args]
+
+REST results are printed as JSON, watch streams every push as one JSON line until interrupted.
+Run "okex help" for the commands.
+*/
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/okcoin-okex/open-api-v3-sdk/okex-go-sdk-api"
+)
+
+var ERR_USAGE = errors.New(`okex: invalid arguments, run "okex help"`)
+
+type command struct {
+	name    string
+	usage   string
+	private bool // needs the credentials of the profile
+	run     func(env *env, args []string) error
+}
+
+/*
+State shared by the commands of one invocation.
+*/
+type env struct {
+	config *okex.Config
+	client *okex.Client
+	out    io.Writer
+}
+
+func (e *env) print(v interface{}) error {
+	encoder := json.NewEncoder(e.out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+var commands = map[string]*command{}
+
+func register(c *command) {
+	commands[c.name] = c
+}
+
+func usage(out io.Writer) {
+	fmt.Fprintln(out, "usage: okex [-config file] [-profile name] <command> [flags] [args]")
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "commands:")
+	names := []string{}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "  %-12s %s\n", name, commands[name].usage)
+	}
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "markets: spot, margin, futures, swap")
+}
+
+func run(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("okex", flag.ContinueOnError)
+	flags.SetOutput(out)
+	configPath := flags.String("config", defaultProfilesPath(), "profiles file")
+	profileName := flags.String("profile", envOr(okex.ENV_PROFILE, okex.DEFAULT_PROFILE), "profile name")
+	flags.Usage = func() { usage(out) }
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 || flags.Arg(0) == "help" {
+		usage(out)
+		return nil
+	}
+
+	c, ok := commands[flags.Arg(0)]
+	if !ok {
+		return fmt.Errorf("okex: unknown command %q, run \"okex help\"", flags.Arg(0))
+	}
+	config, err := loadProfile(*configPath, *profileName)
+	if err != nil {
+		return err
+	}
+	if c.private {
+		if err := config.Validate(false); err != nil {
+			return err
+		}
+	}
+	return c.run(&env{config: config, client: okex.NewClient(*config), out: out}, flags.Args()[1:])
+}
+
+func envOr(key, value string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return value
+}
+
+/*
+Parse the flags of a command, the positional arguments must number between min and max.
+*/
+func parseArgs(flags *flag.FlagSet, args []string, min, max int) ([]string, error) {
+	flags.SetOutput(ioutil.Discard)
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	rest := flags.Args()
+	// flags may follow the positional arguments too
+	positional := []string{}
+	for len(rest) > 0 {
+		positional = append(positional, rest[0])
+		if err := flags.Parse(rest[1:]); err != nil {
+			return nil, err
+		}
+		rest = flags.Args()
+	}
+	if len(positional) < min || len(positional) > max {
+		return nil, ERR_USAGE
+	}
+	return positional, nil
+}
+
+func market(name string) (string, error) {
+	switch strings.ToLower(name) {
+	case okex.MARKET_SPOT, okex.MARKET_MARGIN, okex.MARKET_FUTURES, okex.MARKET_SWAP:
+		return strings.ToLower(name), nil
+	}
+	return "", fmt.Errorf("okex: unknown market %q", name)
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
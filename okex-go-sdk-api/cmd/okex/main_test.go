@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/okcoin-okex/open-api-v3-sdk/okex-go-sdk-api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeApi struct {
+	*httptest.Server
+	lock   sync.Mutex
+	bodies map[string]string // request body by method and path
+}
+
+func newFakeApi(responses map[string]string) *fakeApi {
+	api := &fakeApi{bodies: map[string]string{}}
+	api.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		api.lock.Lock()
+		api.bodies[r.Method+" "+r.URL.Path] = string(body)
+		api.lock.Unlock()
+		response, ok := responses[r.Method+" "+r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			response = `{"code":30000,"message":"not found"}`
+		}
+		w.Write([]byte(response))
+	}))
+	return api
+}
+
+func writeProfiles(t *testing.T, endpoint string) string {
+	dir, err := ioutil.TempDir("", "okex")
+	require.True(t, err == nil, err)
+	path := filepath.Join(dir, "profiles.json")
+	profiles := `{"default":{"endpoint":"` + endpoint + `/"},
+		"trader":{"endpoint":"` + endpoint + `/","api_key":"key","secret_key":"secret","passphrase":"pass"}}`
+	require.True(t, ioutil.WriteFile(path, []byte(profiles), 0600) == nil)
+	return path
+}
+
+func TestRun_Commands(t *testing.T) {
+	api := newFakeApi(map[string]string{
+		"GET " + okex.OKEX_TIME_URI:     `{"iso":"2019-04-16T10:00:00.000Z","epoch":"1555408800.000"}`,
+		"POST " + okex.SWAP_ORDER:       `{"order_id":"66","client_oid":"","error_code":"0","error_message":"","result":"true"}`,
+		"POST " + okex.ACCOUNT_TRANSFER: `{"transfer_id":"754147","currency":"USDT","from":"6","amount":"0.1","to":"5","result":true}`,
+	})
+	defer api.Close()
+	path := writeProfiles(t, api.URL)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	var out bytes.Buffer
+	require.True(t, run([]string{"-config", path, "time"}, &out) == nil)
+	assert.True(t, strings.Contains(out.String(), `"iso": "2019-04-16T10:00:00.000Z"`), out.String())
+
+	out.Reset()
+	err := run([]string{"-config", path, "place", "swap", "BTC-USD-SWAP", "open_long", "1", "-price", "9000"}, &out)
+	configErr, ok := err.(*okex.ConfigError)
+	require.True(t, ok, err)
+	assert.Equal(t, []string{"ApiKey", "SecretKey", "Passphrase"}, configErr.Missing)
+	err = run([]string{"-config", path, "-profile", "trader", "place", "swap", "BTC-USD-SWAP", "open_long", "1", "-price", "9000"}, &out)
+	require.True(t, err == nil, err)
+	assert.JSONEq(t, `{"client_oid":"","order_type":"","price":"9000","match_price":"0","type":"1","size":"1","instrument_id":"BTC-USD-SWAP"}`,
+		api.bodies["POST "+okex.SWAP_ORDER])
+	assert.True(t, strings.Contains(out.String(), `"order_id": "66"`), out.String())
+
+	err = run([]string{"-config", path, "-profile", "trader", "transfer", "-to-instrument-id", "BTC-USDT", "usdt", "0.1", "wallet", "margin"}, &out)
+	require.True(t, err == nil, err)
+	assert.JSONEq(t, `{"currency":"usdt","amount":"0.1","from":"6","to":"5","to_instrument_id":"BTC-USDT"}`, api.bodies["POST "+okex.ACCOUNT_TRANSFER])
+
+	assert.Equal(t, ERR_USAGE, run([]string{"-config", path, "ticker", "swap"}, &out))
+	assert.NotNil(t, run([]string{"-config", path, "ticker", "options", "BTC-USD"}, &out))
+	assert.NotNil(t, run([]string{"-config", path, "-profile", "missing", "time"}, &out))
+	assert.NotNil(t, run([]string{"-config", path, "nope"}, &out))
+
+	out.Reset()
+	require.True(t, run([]string{"-config", path, "help"}, &out) == nil)
+	assert.True(t, strings.Contains(out.String(), "watch"))
+}
+
+func TestIsPrivate(t *testing.T) {
+	assert.False(t, isPrivate(okex.CHNL_SWAP_TICKER))
+	assert.False(t, isPrivate(okex.CHNL_FUTURES_CANDLE21600))
+	assert.False(t, isPrivate(okex.CHNL_SPOT_DEPTH5))
+	assert.True(t, isPrivate(okex.CHNL_SWAP_POSITION))
+	assert.True(t, isPrivate(okex.CHNL_SPOT_ACCOUNT))
+}
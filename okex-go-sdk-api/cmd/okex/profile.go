@@ -0,0 +1,38 @@
+package main
+
+/*
+ Profiles of the okex command, read by okex.LoadConfig. The profiles file is -config, $OKEX_CONFIG
+ or the first of ~/.okex/profiles.json, .yaml, .yml and .toml, the profile -profile, $OKEX_PROFILE
+ or "default". The OKEX_* environment variables override the profile.
+*/
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/okcoin-okex/open-api-v3-sdk/okex-go-sdk-api"
+)
+
+func defaultProfilesPath() string {
+	if path := os.Getenv(okex.ENV_CONFIG); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	for _, ext := range []string{".json", ".yaml", ".yml", ".toml"} {
+		path := filepath.Join(home, ".okex", "profiles"+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+/*
+Config of a profile, the credentials are checked by the private commands only.
+*/
+func loadProfile(path, name string) (*okex.Config, error) {
+	return okex.LoadConfig(okex.ConfigOptions{Path: path, Profile: name, Public: true})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+
+	"github.com/okcoin-okex/open-api-v3-sdk/okex-go-sdk-api"
+)
+
+func init() {
+	register(&command{name: "watch", usage: "[-login] <channel> <filter>..., eg: watch swap/ticker BTC-USD-SWAP", run: watch})
+}
+
+/*
+Private channels need a login, eg: swap/position or spot/account.
+*/
+var publicChannels = []string{"ticker", "candle", "trade", "funding_rate", "price_range", "estimated_price",
+	"depth", "depth5", "depth_l2_tbt", "mark_price", "index"}
+
+func isPrivate(channel string) bool {
+	name := channel[strings.Index(channel, "/")+1:]
+	for _, p := range publicChannels {
+		if name == p || (p == "candle" && strings.HasPrefix(name, p)) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Stream the pushes of a channel as JSON lines until interrupted. The agent re-subscribes after a reconnect.
+*/
+func watch(env *env, args []string) error {
+	flags := flag.NewFlagSet("watch", flag.ContinueOnError)
+	login := flags.Bool("login", false, "login before subscribing, implied by the private channels")
+	positional, err := parseArgs(flags, args, 2, 100)
+	if err != nil {
+		return err
+	}
+	channel, filters := positional[0], positional[1:]
+	if isPrivate(channel) {
+		*login = true
+	}
+	if *login {
+		if err := env.config.Validate(false); err != nil {
+			return err
+		}
+	}
+
+	var lock sync.Mutex
+	encoder := json.NewEncoder(env.out)
+	print := func(obj interface{}) error {
+		lock.Lock()
+		defer lock.Unlock()
+		return encoder.Encode(obj)
+	}
+
+	agent := &okex.OKWSAgent{}
+	err = agent.Start(env.config, func() error {
+		if *login {
+			if err := agent.Login(env.config.ApiKey, env.config.Passphrase); err != nil {
+				return err
+			}
+		}
+		return agent.SubscribeEx(channel, filters, print)
+	})
+	if err != nil {
+		return err
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	<-interrupt
+	signal.Stop(interrupt)
+	return agent.Stop()
+}
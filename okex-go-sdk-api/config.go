@@ -26,4 +26,18 @@ type Config struct {
 	IsPrint bool
 	// Internationalization @see file: constants.go
 	I18n string
+	// Trade in the demo environment: every REST request and the websocket handshake carry the
+	// simulated trading header. The REST host is the same, only the header selects the demo;
+	// the default websocket endpoint is replaced by the demo one.
+	Simulated bool
+}
+
+/*
+Websocket endpoint of the config, the demo endpoint when simulated and the default one is configured.
+*/
+func (config *Config) WebsocketEndpoint() string {
+	if config.Simulated && (config.WSEndpoint == "" || config.WSEndpoint == DEFAULT_WSENDPOINT) {
+		return SIMULATED_WSENDPOINT
+	}
+	return config.WSEndpoint
 }
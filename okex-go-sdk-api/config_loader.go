@@ -0,0 +1,421 @@
+package okex
+
+/*
+ Config loading from a profiles file, environment variables and a secret provider.
+
+ The profiles file holds named profiles, its format follows the extension: .json, .yaml/.yml or
+ .toml. Only one level of profiles with scalar values is read, nested maps and arrays are rejected
+ with the line they start on, eg. in YAML:
+
+	prod:
+	  endpoint: https://www.okex.com/
+	  api_key: ...
+	  secret_key: ...
+	  passphrase: ...
+	sub1:
+	  api_key: ...
+
+ The keys are endpoint, ws_endpoint, api_key, secret_key, passphrase, timeout_second, is_print,
+ i18n and simulated. The environment variables OKEX_ENDPOINT, OKEX_WS_ENDPOINT, OKEX_API_KEY,
+ OKEX_SECRET_KEY, OKEX_PASSPHRASE, OKEX_TIMEOUT_SECOND, OKEX_IS_PRINT, OKEX_I18N and
+ OKEX_SIMULATED override the profile, OKEX_CONFIG and OKEX_PROFILE choose the file and the profile.
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	DEFAULT_PROFILE    = "default"
+	DEFAULT_ENDPOINT   = "https://www.okex.com/"
+	DEFAULT_WSENDPOINT = "wss://real.okex.com:8443/ws/v3"
+
+	// demo trading, @see Config.Simulated
+	SIMULATED_WSENDPOINT = "wss://wspap.okex.com:8443/ws/v3"
+
+	ENV_CONFIG  = "OKEX_CONFIG"
+	ENV_PROFILE = "OKEX_PROFILE"
+)
+
+var (
+	ERR_CONFIG_PROFILE = errors.New(`config: profile not found`)
+	ERR_CONFIG_FORMAT  = errors.New(`config: the profiles file must be .json, .yaml, .yml or .toml`)
+)
+
+/*
+Fields of Config by profile key, the environment variable of a key is OKEX_ + the upper case key.
+*/
+var configKeys = []string{"endpoint", "ws_endpoint", "api_key", "secret_key", "passphrase", "timeout_second", "is_print", "i18n", "simulated"}
+
+/*
+Resolve a credential of a profile, key is api_key, secret_key or passphrase and value what the
+file and environment gave, eg. a reference into a vault. The returned value replaces it.
+*/
+type SecretProvider func(profile, key, value string) (string, error)
+
+type ConfigOptions struct {
+	// Profiles file, $OKEX_CONFIG when empty. Without a file the config comes from the environment.
+	Path string
+	// Profile name, $OKEX_PROFILE or DEFAULT_PROFILE when empty.
+	Profile string
+	// Optional hook resolving the credentials.
+	Secrets SecretProvider
+	// Allow a config without credentials, for the public endpoints only.
+	Public bool
+}
+
+/*
+Missing or invalid fields of a Config.
+*/
+type ConfigError struct {
+	Missing []string
+	Invalid []string
+}
+
+func (e *ConfigError) Error() string {
+	parts := []string{}
+	if len(e.Missing) > 0 {
+		parts = append(parts, "missing "+strings.Join(e.Missing, ", "))
+	}
+	if len(e.Invalid) > 0 {
+		parts = append(parts, "invalid "+strings.Join(e.Invalid, ", "))
+	}
+	return "config: " + strings.Join(parts, "; ")
+}
+
+/*
+Check the config before the first request: the endpoints must be urls and, unless public is set,
+ApiKey, SecretKey and Passphrase are required.
+*/
+func (config *Config) Validate(public bool) error {
+	e := &ConfigError{}
+	if config.Endpoint == "" {
+		e.Missing = append(e.Missing, "Endpoint")
+	} else if u, err := url.Parse(config.Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+		e.Invalid = append(e.Invalid, "Endpoint")
+	}
+	if config.WSEndpoint != "" {
+		if u, err := url.Parse(config.WSEndpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			e.Invalid = append(e.Invalid, "WSEndpoint")
+		}
+	}
+	if !public {
+		if config.ApiKey == "" {
+			e.Missing = append(e.Missing, "ApiKey")
+		}
+		if config.SecretKey == "" {
+			e.Missing = append(e.Missing, "SecretKey")
+		}
+		if config.Passphrase == "" {
+			e.Missing = append(e.Missing, "Passphrase")
+		}
+	}
+	if config.TimeoutSecond < 0 {
+		e.Invalid = append(e.Invalid, "TimeoutSecond")
+	}
+	if len(e.Missing) > 0 || len(e.Invalid) > 0 {
+		return e
+	}
+	return nil
+}
+
+/*
+Load and validate the config of a profile: defaults, then the profile of the file, then the
+environment variables, then the secret provider.
+
+	eg: config, err := LoadConfig(ConfigOptions{Path: "okex.yaml", Profile: "prod"})
+*/
+func LoadConfig(options ConfigOptions) (*Config, error) {
+	path := options.Path
+	if path == "" {
+		path = os.Getenv(ENV_CONFIG)
+	}
+	profile := options.Profile
+	if profile == "" {
+		profile = os.Getenv(ENV_PROFILE)
+	}
+	if profile == "" {
+		profile = DEFAULT_PROFILE
+	}
+
+	values := map[string]string{}
+	if path != "" {
+		profiles, err := ReadProfiles(path)
+		if err != nil {
+			return nil, err
+		}
+		p, ok := profiles[profile]
+		if !ok && profile != DEFAULT_PROFILE {
+			return nil, fmt.Errorf("%w: %q in %s", ERR_CONFIG_PROFILE, profile, path)
+		}
+		for k, v := range p {
+			values[k] = v
+		}
+	}
+	for _, k := range configKeys {
+		if v := os.Getenv("OKEX_" + strings.ToUpper(k)); v != "" {
+			values[k] = v
+		}
+	}
+	if options.Secrets != nil {
+		for _, k := range []string{"api_key", "secret_key", "passphrase"} {
+			v, err := options.Secrets(profile, k, values[k])
+			if err != nil {
+				return nil, err
+			}
+			values[k] = v
+		}
+	}
+
+	config, err := configOf(values)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.Validate(options.Public); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func configOf(values map[string]string) (*Config, error) {
+	config := &Config{
+		Endpoint:   DEFAULT_ENDPOINT,
+		WSEndpoint: DEFAULT_WSENDPOINT,
+		I18n:       ENGLISH,
+	}
+	for k, v := range values {
+		var err error
+		switch k {
+		case "endpoint":
+			config.Endpoint = v
+		case "ws_endpoint":
+			config.WSEndpoint = v
+		case "api_key":
+			config.ApiKey = v
+		case "secret_key":
+			config.SecretKey = v
+		case "passphrase":
+			config.Passphrase = v
+		case "timeout_second":
+			config.TimeoutSecond, err = strconv.Atoi(v)
+		case "is_print":
+			config.IsPrint, err = strconv.ParseBool(v)
+		case "i18n":
+			config.I18n = v
+		case "simulated":
+			config.Simulated, err = strconv.ParseBool(v)
+		default:
+			err = errors.New("unknown key")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("config: %s: %v", k, err)
+		}
+	}
+	return config, nil
+}
+
+/*
+Read the profiles of a .json, .yaml, .yml or .toml file, the values of every profile by key.
+*/
+func ReadProfiles(path string) (map[string]map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var profiles map[string]map[string]string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		profiles, err = parseJsonProfiles(data)
+	case ".yaml", ".yml":
+		profiles, err = parseYamlProfiles(data)
+	case ".toml":
+		profiles, err = parseTomlProfiles(data)
+	default:
+		return nil, ERR_CONFIG_FORMAT
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config: %s: %v", path, err)
+	}
+	return profiles, nil
+}
+
+func parseJsonProfiles(data []byte) (map[string]map[string]string, error) {
+	raw := map[string]map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+	profiles := map[string]map[string]string{}
+	for name, p := range raw {
+		profiles[name] = map[string]string{}
+		for k, v := range p {
+			switch v := v.(type) {
+			case string:
+				profiles[name][k] = v
+			case json.Number:
+				profiles[name][k] = v.String()
+			case bool:
+				profiles[name][k] = strconv.FormatBool(v)
+			default:
+				return nil, fmt.Errorf("%s.%s: not a scalar", name, k)
+			}
+		}
+	}
+	return profiles, nil
+}
+
+/*
+Scalar of a YAML or TOML value: quoted strings are unquoted, the comment after a bare value is dropped.
+*/
+func parseScalar(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.HasPrefix(s, `"`):
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\\' {
+				i++
+			} else if s[i] == '"' {
+				return strconv.Unquote(s[:i+1])
+			}
+		}
+		return "", errors.New("unterminated string")
+	case strings.HasPrefix(s, `'`):
+		end := strings.Index(s[1:], `'`)
+		if end < 0 {
+			return "", errors.New("unterminated string")
+		}
+		return s[1 : end+1], nil
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s), nil
+}
+
+/*
+Reject the start of an array or an inline map in place of a scalar, raw is the value as written.
+*/
+func checkScalar(raw string) error {
+	raw = strings.TrimSpace(raw)
+	if strings.HasPrefix(raw, "[") {
+		return errors.New("arrays are not supported")
+	}
+	if strings.HasPrefix(raw, "{") {
+		return errors.New("nested maps are not supported")
+	}
+	return nil
+}
+
+func parseYamlProfiles(data []byte) (map[string]map[string]string, error) {
+	profiles := map[string]map[string]string{}
+	var current map[string]string
+	indent := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), " \t\r")
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			continue
+		}
+		if trimmed == "-" || strings.HasPrefix(trimmed, "- ") {
+			return nil, fmt.Errorf("line %d: arrays are not supported", line)
+		}
+		i := strings.Index(trimmed, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("line %d: expected key: value", line)
+		}
+		key := strings.Trim(trimmed[:i], `"'`)
+		if err := checkScalar(trimmed[i+1:]); err != nil {
+			return nil, fmt.Errorf("line %d: %s: %v", line, key, err)
+		}
+		value, err := parseScalar(trimmed[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+
+		if text[0] != ' ' && text[0] != '\t' {
+			if value != "" {
+				return nil, fmt.Errorf("line %d: %s is not a profile", line, key)
+			}
+			current = map[string]string{}
+			profiles[key] = current
+			indent = ""
+			continue
+		}
+		if current == nil {
+			return nil, fmt.Errorf("line %d: key outside of a profile", line)
+		}
+		// the keys of a profile share one indentation, a deeper one belongs to a nested map
+		if prefix := text[:len(text)-len(strings.TrimLeft(text, " \t"))]; indent == "" {
+			indent = prefix
+		} else if prefix != indent {
+			return nil, fmt.Errorf("line %d: %s: nested maps are not supported", line, key)
+		}
+		if value == "" && strings.TrimSpace(trimmed[i+1:]) == "" {
+			return nil, fmt.Errorf("line %d: %s: nested maps are not supported", line, key)
+		}
+		current[key] = value
+	}
+	return profiles, scanner.Err()
+}
+
+func parseTomlProfiles(data []byte) (map[string]map[string]string, error) {
+	profiles := map[string]map[string]string{}
+	var current map[string]string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if strings.HasPrefix(text, "[[") {
+			return nil, fmt.Errorf("line %d: arrays of tables are not supported", line)
+		}
+		if strings.HasPrefix(text, "[") {
+			end := strings.Index(text, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated table", line)
+			}
+			name := strings.TrimSpace(text[1:end])
+			if !strings.HasPrefix(name, `"`) && !strings.HasPrefix(name, `'`) && strings.Contains(name, ".") {
+				return nil, fmt.Errorf("line %d: %s: nested tables are not supported", line, name)
+			}
+			name = strings.Trim(name, `"'`)
+			current = map[string]string{}
+			profiles[name] = current
+			continue
+		}
+		i := strings.Index(text, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("line %d: expected key = value", line)
+		}
+		if current == nil {
+			return nil, fmt.Errorf("line %d: key outside of a profile", line)
+		}
+		key := strings.TrimSpace(text[:i])
+		if !strings.HasPrefix(key, `"`) && !strings.HasPrefix(key, `'`) && strings.Contains(key, ".") {
+			return nil, fmt.Errorf("line %d: %s: dotted keys are not supported", line, key)
+		}
+		key = strings.Trim(key, `"'`)
+		if err := checkScalar(text[i+1:]); err != nil {
+			return nil, fmt.Errorf("line %d: %s: %v", line, key, err)
+		}
+		value, err := parseScalar(text[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		current[key] = value
+	}
+	return profiles, scanner.Err()
+}
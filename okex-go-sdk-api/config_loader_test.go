@@ -0,0 +1,136 @@
+package okex
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfigFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	require.True(t, ioutil.WriteFile(path, []byte(content), 0600) == nil)
+	return path
+}
+
+func TestLoadConfig_Formats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	require.True(t, err == nil, err)
+	defer os.RemoveAll(dir)
+
+	files := []string{
+		writeConfigFile(t, dir, "okex.yaml", `
+# production
+prod:
+  endpoint: https://www.okex.com/
+  api_key: "key # not a comment"
+  secret_key: 'secret'
+  passphrase: pass # comment
+  timeout_second: 10
+  is_print: true
+sub1:
+  api_key: sub
+`),
+		writeConfigFile(t, dir, "okex.toml", `
+[prod]
+endpoint = "https://www.okex.com/"
+api_key = "key # not a comment"
+secret_key = 'secret'
+passphrase = "pass" # comment
+timeout_second = 10
+is_print = true
+
+["sub1"]
+api_key = "sub"
+`),
+		writeConfigFile(t, dir, "okex.json", `{"prod":{"endpoint":"https://www.okex.com/","api_key":"key # not a comment",
+			"secret_key":"secret","passphrase":"pass","timeout_second":10,"is_print":true},"sub1":{"api_key":"sub"}}`),
+	}
+	for _, path := range files {
+		config, err := LoadConfig(ConfigOptions{Path: path, Profile: "prod"})
+		require.True(t, err == nil, path, err)
+		assert.Equal(t, Config{Endpoint: "https://www.okex.com/", WSEndpoint: DEFAULT_WSENDPOINT, ApiKey: "key # not a comment",
+			SecretKey: "secret", Passphrase: "pass", TimeoutSecond: 10, IsPrint: true, I18n: ENGLISH}, *config, path)
+
+		_, err = LoadConfig(ConfigOptions{Path: path, Profile: "sub1"})
+		require.NotNil(t, err, path)
+		assert.Equal(t, []string{"SecretKey", "Passphrase"}, err.(*ConfigError).Missing, path)
+		_, err = LoadConfig(ConfigOptions{Path: path, Profile: "sub2"})
+		assert.True(t, errors.Is(err, ERR_CONFIG_PROFILE), path)
+	}
+
+	_, err = ReadProfiles(writeConfigFile(t, dir, "okex.ini", ""))
+	assert.Equal(t, ERR_CONFIG_FORMAT, err)
+	_, err = ReadProfiles(writeConfigFile(t, dir, "bad.yaml", "api_key: x\n"))
+	assert.NotNil(t, err)
+	_, err = LoadConfig(ConfigOptions{Path: writeConfigFile(t, dir, "unknown.toml", "[default]\napi = \"x\"\n"), Public: true})
+	assert.NotNil(t, err)
+
+	// nested maps and arrays are rejected with their line instead of being flattened
+	rejected := map[string]string{
+		"nested.yaml": "prod:\n  api_key: x\n  keys:\n    secret_key: y\n",
+		"deeper.yaml": "prod:\n  api_key: x\n    secret_key: y\n",
+		"list.yaml":   "prod:\n  api_key: x\n  - y\n",
+		"flow.yaml":   "prod:\n  api_key: x\n  hosts: [a, b]\n",
+		"nested.toml": "[prod]\napi_key = \"x\"\n[prod.keys]\n",
+		"dotted.toml": "[prod]\napi_key = \"x\"\nkeys.secret = \"y\"\n",
+		"array.toml":  "[prod]\napi_key = \"x\"\nhosts = [\"a\"]\n",
+		"inline.toml": "[prod]\napi_key = \"x\"\nkeys = { secret = \"y\" }\n",
+		"tables.toml": "[prod]\napi_key = \"x\"\n[[hosts]]\n",
+	}
+	for name, content := range rejected {
+		_, err = ReadProfiles(writeConfigFile(t, dir, name, content))
+		require.NotNil(t, err, name)
+		assert.Contains(t, err.Error(), "line 3:", name)
+	}
+}
+
+func TestLoadConfig_EnvAndSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	require.True(t, err == nil, err)
+	defer os.RemoveAll(dir)
+	path := writeConfigFile(t, dir, "okex.yaml", "default:\n  api_key: file-key\n  secret_key: vault:okex/secret\n")
+
+	for k, v := range map[string]string{ENV_CONFIG: path, "OKEX_API_KEY": "env-key", "OKEX_PASSPHRASE": "env-pass", "OKEX_I18N": ""} {
+		old, ok := os.LookupEnv(k)
+		os.Setenv(k, v)
+		if ok {
+			defer os.Setenv(k, old)
+		} else {
+			defer os.Unsetenv(k)
+		}
+	}
+
+	resolved := []string{}
+	config, err := LoadConfig(ConfigOptions{Secrets: func(profile, key, value string) (string, error) {
+		resolved = append(resolved, profile+"."+key)
+		if value == "vault:okex/secret" {
+			return "from-vault", nil
+		}
+		return value, nil
+	}})
+	require.True(t, err == nil, err)
+	assert.Equal(t, "env-key", config.ApiKey)
+	assert.Equal(t, "from-vault", config.SecretKey)
+	assert.Equal(t, "env-pass", config.Passphrase)
+	assert.Equal(t, ENGLISH, config.I18n)
+	assert.Equal(t, []string{"default.api_key", "default.secret_key", "default.passphrase"}, resolved)
+
+	failure := errors.New("vault sealed")
+	_, err = LoadConfig(ConfigOptions{Secrets: func(profile, key, value string) (string, error) { return "", failure }})
+	assert.Equal(t, failure, err)
+}
+
+func TestConfig_Validate(t *testing.T) {
+	config := Config{Endpoint: "www.okex.com", WSEndpoint: "wss://real.okex.com:8443/ws/v3", TimeoutSecond: -1}
+	err := config.Validate(false)
+	require.NotNil(t, err)
+	assert.Equal(t, "config: missing ApiKey, SecretKey, Passphrase; invalid Endpoint, TimeoutSecond", err.Error())
+
+	config = Config{Endpoint: DEFAULT_ENDPOINT}
+	assert.Nil(t, config.Validate(true))
+}
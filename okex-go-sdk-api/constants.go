@@ -15,6 +15,8 @@ const (
 	OK_ACCESS_SIGN       = "OK-ACCESS-SIGN"
 	OK_ACCESS_TIMESTAMP  = "OK-ACCESS-TIMESTAMP"
 	OK_ACCESS_PASSPHRASE = "OK-ACCESS-PASSPHRASE"
+	// demo trading, @see Config.Simulated
+	OK_SIMULATED_TRADING = "x-simulated-trading"
 
 	/**
 	  paging params
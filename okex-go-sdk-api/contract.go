@@ -0,0 +1,103 @@
+package okex
+
+/*
+ Values of the futures and swap contracts. A USDT margined contract, eg: BTC-USDT-SWAP, is worth
+ contract_val coins and settled in USDT, a coin margined one, eg: BTC-USD-190628, is worth
+ contract_val USD and settled in coin.
+*/
+
+import "strings"
+
+/*
+Contract values of the futures or the swaps by instrument id, market is MARKET_FUTURES or
+MARKET_SWAP.
+*/
+func loadContractVals(client *Client, market string) (map[string]float64, error) {
+	contractVals := map[string]float64{}
+	if market == MARKET_SWAP {
+		instruments, err := client.GetSwapInstruments()
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range *instruments {
+			contractVals[i.InstrumentId] = toFloat(i.ContractVal)
+		}
+		return contractVals, nil
+	}
+	instruments, err := client.GetFuturesInstruments()
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range instruments {
+		contractVals[i.InstrumentId] = i.ContractVal
+	}
+	return contractVals, nil
+}
+
+// market of a futures or swap instrument id
+func contractMarket(instrumentId string) string {
+	if strings.HasSuffix(instrumentId, "-SWAP") {
+		return MARKET_SWAP
+	}
+	return MARKET_FUTURES
+}
+
+// add the values loaded to dst, the values already in dst, eg. set by hand, are kept
+func mergeContractVals(dst, loaded map[string]float64) {
+	for k, v := range loaded {
+		if _, ok := dst[k]; !ok {
+			dst[k] = v
+		}
+	}
+}
+
+func isLinearContract(instrumentId string) bool {
+	return strings.Contains(instrumentId, "-USDT-")
+}
+
+/*
+Notional of size contracts at price in the quote currency: size * contract_val * price USDT,
+or size * contract_val USD.
+*/
+func contractNotional(instrumentId string, size, contractVal, price float64) float64 {
+	if isLinearContract(instrumentId) {
+		return size * contractVal * price
+	}
+	return size * contractVal
+}
+
+/*
+Value of size contracts at price in the settlement currency.
+*/
+func contractValue(instrumentId string, size, contractVal, price float64) float64 {
+	if isLinearContract(instrumentId) {
+		return size * contractVal * price
+	}
+	if price == 0 {
+		return 0
+	}
+	return size * contractVal / price
+}
+
+/*
+PnL of a position of size contracts opened at avgCost, at price, in the settlement currency.
+
+	USDT margined: size * contract_val * (price - avg_cost)
+	coin margined: size * contract_val * (1/avg_cost - 1/price)
+	the sign is reversed for short positions
+*/
+func contractPnl(instrumentId, side string, size, contractVal, avgCost, price float64) float64 {
+	if avgCost == 0 || price == 0 {
+		return 0
+	}
+	var pnl float64
+	if isLinearContract(instrumentId) {
+		pnl = size * contractVal * (price - avgCost)
+	} else {
+		pnl = size * contractVal * (1/avgCost - 1/price)
+	}
+	if side == DIRECTION_SHORT {
+		pnl = -pnl
+	}
+	return pnl
+}
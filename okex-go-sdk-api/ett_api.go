@@ -0,0 +1,243 @@
+package okex
+
+/*
+ OKEX ett api
+*/
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	/*
+	 ett order type: 0: 组合申购 1: 用USDT申购 2: 赎回USDT 3: 立即赎回ett成分
+	*/
+	ETT_ORDER_TYPE_SUBSCRIBE_CONSTITUENTS = 0
+	ETT_ORDER_TYPE_SUBSCRIBE_USDT         = 1
+	ETT_ORDER_TYPE_REDEEM_USDT            = 2
+	ETT_ORDER_TYPE_REDEEM_CONSTITUENTS    = 3
+
+	/*
+	 ett order list status: 0: 所有状态 1: 等待成交 2: 已成交 3: 已撤销
+	*/
+	ETT_ORDER_STATUS_ALL      = 0
+	ETT_ORDER_STATUS_OPEN     = 1
+	ETT_ORDER_STATUS_FILLED   = 2
+	ETT_ORDER_STATUS_CANCELED = 3
+)
+
+var (
+	ERR_ETT_ORDER_ETT    = errors.New(`ett order: ett is required`)
+	ERR_ETT_ORDER_AMOUNT = errors.New(`ett order: amount is required to subscribe with usdt`)
+	ERR_ETT_ORDER_SIZE   = errors.New(`ett order: size is required to redeem or subscribe with constituents`)
+)
+
+/*
+ett申购/赎回下单参数
+amount: 用USDT申购时必填; size: 赎回和组合申购时必填
+*/
+type EttOrderParams struct {
+	ClientOid     string `json:"client_oid,omitempty"`
+	Type          int    `json:"type"`
+	QuoteCurrency string `json:"quote_currency,omitempty"`
+	Amount        string `json:"amount,omitempty"`
+	Size          string `json:"size,omitempty"`
+	Ett           string `json:"ett"`
+}
+
+func (p *EttOrderParams) Validate() error {
+	if p.Ett == "" {
+		return ERR_ETT_ORDER_ETT
+	}
+	if p.Type < ETT_ORDER_TYPE_SUBSCRIBE_CONSTITUENTS || p.Type > ETT_ORDER_TYPE_REDEEM_CONSTITUENTS {
+		return fmt.Errorf("ett order: illegal type %d", p.Type)
+	}
+	if p.Type == ETT_ORDER_TYPE_SUBSCRIBE_USDT {
+		if p.Amount == "" {
+			return ERR_ETT_ORDER_AMOUNT
+		}
+	} else if p.Size == "" {
+		return ERR_ETT_ORDER_SIZE
+	}
+	return nil
+}
+
+/*
+ett账户信息
+获取ett账户资产列表，查询各币种的余额、冻结和可用等信息。
+
+HTTP请求
+GET /api/ett/v3/accounts
+*/
+func (client *Client) GetEttAccounts() (*[]EttAccount, error) {
+	r := []EttAccount{}
+
+	if _, err := client.Request(GET, ETT_ACCOUNTS, nil, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+/*
+单一币种账户信息
+获取ett账户单个币种的余额、冻结和可用等信息。
+
+HTTP请求
+GET /api/ett/v3/accounts/<currency>
+*/
+func (client *Client) GetEttAccountsByCurrency(currency string) (*EttAccount, error) {
+	r := EttAccount{}
+
+	uri := GetCurrencyUri(ETT_ACCOUNTS_CURRENCY, currency)
+	if _, err := client.Request(GET, uri, nil, &r); err != nil {
+		return nil, err
+	}
+	if r.Currency == "" {
+		r.Currency = currency
+	}
+	return &r, nil
+}
+
+/*
+账单流水查询
+列出ett账户资产流水，流水会分页，请参阅分页部分以获取第一页之后的其他纪录。
+
+HTTP请求
+GET /api/ett/v3/accounts/<currency>/ledger
+
+请求示例
+GET /api/ett/v3/accounts/usdt/ledger?limit=3&from=2
+*/
+func (client *Client) GetEttAccountsLedgerByCurrency(currency string, optionalParams *map[string]string) (*[]EttLedger, error) {
+	r := []EttLedger{}
+
+	uri := GetCurrencyUri(ETT_ACCOUNTS_CURRENCY_LEDGER, currency)
+	if optionalParams != nil && len(*optionalParams) > 0 {
+		uri = BuildParams(uri, *optionalParams)
+	}
+	if _, err := client.Request(GET, uri, nil, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+/*
+下单
+ett申购或赎回。
+
+HTTP请求
+POST /api/ett/v3/orders
+*/
+func (client *Client) PostEttOrder(params *EttOrderParams) (*EttOrderResult, error) {
+	if params == nil {
+		return nil, ERR_ETT_ORDER_ETT
+	}
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+
+	r := EttOrderResult{}
+	if _, err := client.Request(POST, ETT_ORDERS, params, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+/*
+撤销指定订单
+
+HTTP请求
+DELETE /api/ett/v3/orders/<order_id>
+*/
+func (client *Client) CancelEttOrder(orderId string) (*EttCancelOrderResult, error) {
+	r := EttCancelOrderResult{}
+
+	uri := strings.Replace(ETT_ORDERS_BY_ID, "{order_id}", orderId, -1)
+	if _, err := client.Request(DELETE, uri, nil, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+/*
+获取订单列表
+列出指定ett的订单，orderType: 1: 申购 2: 赎回，status见ETT_ORDER_STATUS_*。
+optionalParams支持from, to, limit分页。
+
+HTTP请求
+GET /api/ett/v3/orders
+
+请求示例
+GET /api/ett/v3/orders?ett=OK06ETT&type=1&status=0&limit=2
+*/
+func (client *Client) GetEttOrders(ett string, orderType, status int, optionalParams *map[string]string) (*[]EttOrder, error) {
+	r := []EttOrder{}
+
+	fullOptions := NewParams()
+	if optionalParams != nil {
+		for k, v := range *optionalParams {
+			fullOptions[k] = v
+		}
+	}
+	fullOptions["ett"] = ett
+	fullOptions["type"] = Int2String(orderType)
+	fullOptions["status"] = Int2String(status)
+
+	uri := BuildParams(ETT_ORDERS, fullOptions)
+	if _, err := client.Request(GET, uri, nil, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+/*
+获取订单信息
+
+HTTP请求
+GET /api/ett/v3/orders/<order_id>
+*/
+func (client *Client) GetEttOrder(orderId string) (*EttOrder, error) {
+	r := EttOrder{}
+
+	uri := strings.Replace(ETT_ORDERS_BY_ID, "{order_id}", orderId, -1)
+	if _, err := client.Request(GET, uri, nil, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+/*
+获取组合成分
+公共接口，获取ett美元净值及每份ett包含的币种成分。
+
+HTTP请求
+GET /api/ett/v3/constituents/<ett>
+*/
+func (client *Client) GetEttConstituents(ett string) (*EttConstituents, error) {
+	r := EttConstituents{}
+
+	uri := strings.Replace(ETT_CONSTITUENTS, "{ett}", ett, -1)
+	if _, err := client.Request(GET, uri, nil, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+/*
+获取ETT清算历史定价
+公共接口，获取ett清算时间及清算时价格。
+
+HTTP请求
+GET /api/ett/v3/define-price/<ett>
+*/
+func (client *Client) GetEttDefinePrice(ett string) (*[]EttDefinePrice, error) {
+	r := []EttDefinePrice{}
+
+	uri := strings.Replace(ETT_DEFINE_PRICE, "{ett}", ett, -1)
+	if _, err := client.Request(GET, uri, nil, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
@@ -0,0 +1,98 @@
+package okex
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEttOrderParams_Validate(t *testing.T) {
+	assert.True(t, (&EttOrderParams{Ett: "OK06ETT", Type: ETT_ORDER_TYPE_SUBSCRIBE_USDT, Amount: "100"}).Validate() == nil)
+	assert.Equal(t, ERR_ETT_ORDER_AMOUNT, (&EttOrderParams{Ett: "OK06ETT", Type: ETT_ORDER_TYPE_SUBSCRIBE_USDT, Size: "1"}).Validate())
+	assert.Equal(t, ERR_ETT_ORDER_SIZE, (&EttOrderParams{Ett: "OK06ETT", Type: ETT_ORDER_TYPE_REDEEM_USDT}).Validate())
+	assert.Equal(t, ERR_ETT_ORDER_ETT, (&EttOrderParams{Type: ETT_ORDER_TYPE_REDEEM_USDT, Size: "1"}).Validate())
+	assert.True(t, (&EttOrderParams{Ett: "OK06ETT", Type: 9, Size: "1"}).Validate() != nil)
+}
+
+func TestClient_EttAccounts(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handle(GET, ETT_ACCOUNTS, `[{"currency":"OK06ETT","balance":"2.5","holds":"0.5","available":"2"},{"currency":"USDT","balance":"100","holds":"0","available":"100"}]`)
+	s.handle(GET, "/api/ett/v3/accounts/OK06ETT", `{"balance":"2.5","holds":"0.5","available":"2"}`)
+	s.handle(GET, "/api/ett/v3/accounts/USDT/ledger", `[{"ledger_id":"12","currency":"USDT","balance":"100","amount":"-10","type":"trade","created_at":"2019-03-19T06:20:39.000Z","details":{"order_id":"2366","ett":"OK06ETT"}}]`)
+	c := s.client()
+
+	accounts, err := c.GetEttAccounts()
+	require.True(t, err == nil, err)
+	require.Equal(t, 2, len(*accounts))
+	assert.Equal(t, EttAccount{Currency: "OK06ETT", Balance: "2.5", Holds: "0.5", Available: "2"}, (*accounts)[0])
+
+	account, err := c.GetEttAccountsByCurrency("OK06ETT")
+	require.True(t, err == nil, err)
+	assert.Equal(t, "OK06ETT", account.Currency)
+	assert.Equal(t, "2", account.Available)
+
+	params := NewParams()
+	params["limit"] = "1"
+	params["from"] = "2"
+	ledger, err := c.GetEttAccountsLedgerByCurrency("USDT", &params)
+	require.True(t, err == nil, err)
+	require.Equal(t, 1, len(*ledger))
+	assert.Equal(t, "-10", (*ledger)[0].Amount)
+	assert.Equal(t, "2366", (*ledger)[0].Details["order_id"])
+	assert.Equal(t, "from=2&limit=1", s.lastRequest().RawQuery)
+}
+
+func TestClient_EttOrders(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handle(POST, ETT_ORDERS, `{"order_id":"2366","client_oid":"ett1","result":true}`)
+	s.handle(DELETE, "/api/ett/v3/orders/2366", `{"order_id":"2366","result":true}`)
+	s.handle(GET, ETT_ORDERS, `[{"order_id":"2366","price":"0.9","type":1,"quote_currency":"usdt","amount":"100","size":"110","ett":"OK06ETT","created_at":"2019-03-19T06:20:39.000Z","status":"2"}]`)
+	s.handle(GET, "/api/ett/v3/orders/2366", `{"order_id":"2366","type":1,"ett":"OK06ETT","status":"3"}`)
+	c := s.client()
+
+	r, err := c.PostEttOrder(&EttOrderParams{ClientOid: "ett1", Type: ETT_ORDER_TYPE_SUBSCRIBE_USDT, QuoteCurrency: "usdt", Amount: "100", Ett: "OK06ETT"})
+	require.True(t, err == nil, err)
+	assert.True(t, r.Result)
+	assert.Equal(t, `{"client_oid":"ett1","type":1,"quote_currency":"usdt","amount":"100","ett":"OK06ETT"}`, s.lastRequest().Body)
+
+	_, err = c.PostEttOrder(&EttOrderParams{Type: ETT_ORDER_TYPE_REDEEM_USDT, Ett: "OK06ETT"})
+	assert.Equal(t, ERR_ETT_ORDER_SIZE, err)
+	assert.Equal(t, 1, len(s.requestsTo(POST, ETT_ORDERS)))
+
+	cr, err := c.CancelEttOrder("2366")
+	require.True(t, err == nil, err)
+	assert.True(t, cr.Result)
+
+	params := NewParams()
+	params["limit"] = "2"
+	orders, err := c.GetEttOrders("OK06ETT", ETT_ORDER_TYPE_SUBSCRIBE_USDT, ETT_ORDER_STATUS_ALL, &params)
+	require.True(t, err == nil, err)
+	require.Equal(t, 1, len(*orders))
+	assert.Equal(t, "110", (*orders)[0].Size)
+	assert.Equal(t, "ett=OK06ETT&limit=2&status=0&type=1", s.lastRequest().RawQuery)
+
+	order, err := c.GetEttOrder("2366")
+	require.True(t, err == nil, err)
+	assert.Equal(t, "3", order.Status)
+}
+
+func TestClient_EttProducts(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handle(GET, "/api/ett/v3/constituents/OK06ETT", `{"net_value":"0.9","ett":"OK06ETT","constituents":[{"amount":"0.0001","currency":"BTC"},{"amount":"0.002","currency":"ETH"}]}`)
+	s.handle(GET, "/api/ett/v3/define-price/OK06ETT", `[{"date":"2019-03-19T08:00:00.000Z","price":"0.91"}]`)
+	c := s.client()
+
+	constituents, err := c.GetEttConstituents("OK06ETT")
+	require.True(t, err == nil, err)
+	assert.Equal(t, "0.9", constituents.NetValue)
+	assert.Equal(t, []EttConstituent{{Amount: "0.0001", Currency: "BTC"}, {Amount: "0.002", Currency: "ETH"}}, constituents.Constituents)
+
+	prices, err := c.GetEttDefinePrice("OK06ETT")
+	require.True(t, err == nil, err)
+	require.Equal(t, 1, len(*prices))
+	assert.Equal(t, "0.91", (*prices)[0].Price)
+}
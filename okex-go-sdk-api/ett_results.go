@@ -0,0 +1,64 @@
+package okex
+
+/*
+ OKEX ett api result definition
+*/
+
+type EttAccount struct {
+	Currency  string `json:"currency"`  // 币种或ett名称
+	Balance   string `json:"balance"`   // 余额
+	Holds     string `json:"holds"`     // 冻结(不可用)
+	Available string `json:"available"` // 可用于交易或资金划转的数量
+}
+
+type EttLedger struct {
+	LedgerId  string                 `json:"ledger_id"`  // 账单ID
+	Currency  string                 `json:"currency"`   // 币种或ett名称
+	Balance   string                 `json:"balance"`    // 余额
+	Amount    string                 `json:"amount"`     // 变动数量
+	Type      string                 `json:"type"`       // 流水来源
+	CreatedAt string                 `json:"created_at"` // 账单创建时间
+	Details   map[string]interface{} `json:"details"`    // 交易产生的流水包含该交易的关联信息
+}
+
+type EttOrderResult struct {
+	BizWarmTips
+	OrderId   string `json:"order_id"`
+	ClientOid string `json:"client_oid"`
+	Result    bool   `json:"result"`
+}
+
+type EttCancelOrderResult struct {
+	BizWarmTips
+	OrderId string `json:"order_id"`
+	Result  bool   `json:"result"`
+}
+
+type EttOrder struct {
+	OrderId       string `json:"order_id"`
+	ClientOid     string `json:"client_oid"`
+	Price         string `json:"price"`
+	Type          int    `json:"type"`           // 订单类型
+	QuoteCurrency string `json:"quote_currency"` // 申购/赎回币种
+	Amount        string `json:"amount"`         // 申购/赎回币种总量
+	Size          string `json:"size"`           // ett数量
+	Ett           string `json:"ett"`
+	CreatedAt     string `json:"created_at"`
+	Status        string `json:"status"`
+}
+
+type EttConstituent struct {
+	Amount   string `json:"amount"` // 每份ett包含币种成分数量
+	Currency string `json:"currency"`
+}
+
+type EttConstituents struct {
+	NetValue     string           `json:"net_value"` // ett美元净值
+	Ett          string           `json:"ett"`
+	Constituents []EttConstituent `json:"constituents"`
+}
+
+type EttDefinePrice struct {
+	Date  string `json:"date"`  // 清算时间
+	Price string `json:"price"` // 清算时价格
+}
@@ -0,0 +1,67 @@
+package exporter
+
+import (
+	"bufio"
+	"encoding/csv"
+	"os"
+	"strconv"
+	"time"
+)
+
+type csvWriter struct {
+	file   *os.File
+	buffer *bufio.Writer
+	csv    *csv.Writer
+	schema *Schema
+	record []string
+}
+
+func newCsvWriter(file *os.File, schema *Schema) (*csvWriter, error) {
+	w := &csvWriter{file: file, buffer: bufio.NewWriter(file), schema: schema, record: make([]string, len(schema.Columns))}
+	w.csv = csv.NewWriter(w.buffer)
+	if err := w.csv.Write(schema.Header()); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case time.Time:
+		return v.UTC().Format("2006-01-02T15:04:05.000Z")
+	}
+	return ""
+}
+
+func (w *csvWriter) Write(row Row) error {
+	for i := range w.record {
+		w.record[i] = formatValue(row[i])
+	}
+	return w.csv.Write(w.record)
+}
+
+func (w *csvWriter) Flush() error {
+	w.csv.Flush()
+	if err := w.csv.Error(); err != nil {
+		return err
+	}
+	return w.buffer.Flush()
+}
+
+func (w *csvWriter) Close() error {
+	if err := w.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+	if err := w.file.Sync(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
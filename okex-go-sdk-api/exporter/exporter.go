@@ -0,0 +1,332 @@
+/*
+Package exporter archives market data for research. Tickers, trades, candles and book snapshots
+from the REST calls or the websocket callbacks are written to rotating CSV or Parquet files, one
+schema per data type, partitioned by instrument and UTC date:
+
+	<dir>/<schema>/<instrument_id>/<yyyy-mm-dd>/<schema>-<instrument_id>-<yyyy-mm-dd>-<seq>.<format>
+
+Files are written under a .part suffix and renamed when complete, on rotation or Close, so a file
+without the suffix is always whole. Close flushes and syncs every open file.
+
+	e, _ := exporter.New("/data/okex", exporter.FORMAT_PARQUET)
+	defer e.Close()
+	agent.Subscribe(okex.CHNL_SWAP_TRADE, "BTC-USD-SWAP", e.OnPush)
+*/
+package exporter
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/okcoin-okex/open-api-v3-sdk/okex-go-sdk-api"
+)
+
+const (
+	FORMAT_CSV     = "csv"
+	FORMAT_PARQUET = "parquet"
+
+	PART_SUFFIX = ".part"
+)
+
+var (
+	ERR_EXPORTER_FORMAT = errors.New(`exporter: format must be FORMAT_CSV or FORMAT_PARQUET`)
+	ERR_EXPORTER_CLOSED = errors.New(`exporter: write after close`)
+	ERR_EXPORTER_ROW    = errors.New(`exporter: row does not match the schema`)
+)
+
+type fileWriter interface {
+	Write(row Row) error
+	Flush() error
+	Close() error
+}
+
+type partitionFile struct {
+	path   string // final path, written under path + PART_SUFFIX
+	writer fileWriter
+	rows   int
+}
+
+type Exporter struct {
+	Dir    string
+	Format string
+	// Rows per file before rotating to the next file of the partition, 0 for no limit.
+	MaxRows int
+
+	lock   sync.Mutex
+	files  map[string]*partitionFile // by schema/instrument/date
+	latest map[string]string         // newest date by schema/instrument
+	closed bool
+}
+
+func New(dir, format string) (*Exporter, error) {
+	if format != FORMAT_CSV && format != FORMAT_PARQUET {
+		return nil, ERR_EXPORTER_FORMAT
+	}
+	return &Exporter{
+		Dir:     dir,
+		Format:  format,
+		MaxRows: 100000,
+		files:   map[string]*partitionFile{},
+		latest:  map[string]string{},
+	}, nil
+}
+
+/*
+Write rows of a schema, each row goes to the partition of its instrument and date.
+*/
+func (e *Exporter) Write(schema *Schema, rows ...Row) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.closed {
+		return ERR_EXPORTER_CLOSED
+	}
+	for _, row := range rows {
+		if !schema.Valid(row) {
+			return ERR_EXPORTER_ROW
+		}
+		if err := e.write(schema, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Exporter) write(schema *Schema, row Row) error {
+	instrumentId := row.InstrumentId()
+	date := row.Time().UTC().Format("2006-01-02")
+	series := schema.Name + "/" + instrumentId
+	key := series + "/" + date
+
+	// a new date rotates the files of the older dates
+	if latest := e.latest[series]; date > latest {
+		e.latest[series] = date
+		for k, f := range e.files {
+			if strings.HasPrefix(k, series+"/") && k != key {
+				delete(e.files, k)
+				if err := e.complete(f); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	f, ok := e.files[key]
+	if !ok {
+		var err error
+		if f, err = e.open(schema, instrumentId, date); err != nil {
+			return err
+		}
+		e.files[key] = f
+	}
+	if err := f.writer.Write(row); err != nil {
+		return err
+	}
+	f.rows++
+	if e.MaxRows > 0 && f.rows >= e.MaxRows {
+		delete(e.files, key)
+		return e.complete(f)
+	}
+	return nil
+}
+
+func (e *Exporter) open(schema *Schema, instrumentId, date string) (*partitionFile, error) {
+	dir := filepath.Join(e.Dir, schema.Name, instrumentId, date)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	// never overwrite the files of an earlier run
+	var path string
+	for seq := 0; ; seq++ {
+		path = filepath.Join(dir, fmt.Sprintf("%s-%s-%s-%04d.%s", schema.Name, instrumentId, date, seq, e.Format))
+		if !exists(path) && !exists(path+PART_SUFFIX) {
+			break
+		}
+	}
+
+	file, err := os.Create(path + PART_SUFFIX)
+	if err != nil {
+		return nil, err
+	}
+	var w fileWriter
+	if e.Format == FORMAT_PARQUET {
+		w, err = newParquetWriter(file, schema)
+	} else {
+		w, err = newCsvWriter(file, schema)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &partitionFile{path: path, writer: w}, nil
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func (e *Exporter) complete(f *partitionFile) error {
+	if err := f.writer.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.path+PART_SUFFIX, f.path)
+}
+
+func (e *Exporter) WriteTickers(tickers ...Ticker) error {
+	rows := make([]Row, len(tickers))
+	for i, t := range tickers {
+		rows[i] = t.Row()
+	}
+	return e.Write(TickerSchema, rows...)
+}
+
+func (e *Exporter) WriteTrades(trades ...okex.Trade) error {
+	rows := make([]Row, len(trades))
+	for i, t := range trades {
+		rows[i] = TradeRow(t)
+	}
+	return e.Write(TradeSchema, rows...)
+}
+
+/*
+Write candles of CandleFetcher or of the candle channels, granularity in seconds.
+*/
+func (e *Exporter) WriteCandles(instrumentId string, granularity int, candles ...okex.Candle) error {
+	rows := make([]Row, len(candles))
+	for i, c := range candles {
+		rows[i] = CandleRow(instrumentId, granularity, c)
+	}
+	return e.Write(CandleSchema, rows...)
+}
+
+func (e *Exporter) WriteBook(book *okex.WSDepthItem) error {
+	if book == nil {
+		return nil
+	}
+	return e.Write(BookSchema, BookRows(book)...)
+}
+
+/*
+Callback of the ticker, trade, candle and depth5 channels of spot, futures and swap.
+The incremental depth channels are not snapshots, export OKWSAgent.GetOrderBook by WriteBook instead.
+*/
+func (e *Exporter) OnPush(obj interface{}) error {
+	tb, ok := obj.(*okex.WSTableResponse)
+	if !ok {
+		return nil
+	}
+	market, channel := tb.Table, ""
+	if i := strings.Index(tb.Table, "/"); i >= 0 {
+		market, channel = tb.Table[:i], tb.Table[i+1:]
+	}
+
+	for _, d := range tb.Data {
+		m, ok := d.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		var err error
+		switch {
+		case channel == "ticker":
+			err = e.WriteTickers(TickerOf(m))
+		case channel == "trade":
+			size := m["size"]
+			if size == nil {
+				size = m["qty"]
+			}
+			err = e.WriteTrades(okex.Trade{
+				Market:       market,
+				InstrumentId: str(m["instrument_id"]),
+				TradeId:      str(m["trade_id"]),
+				Side:         str(m["side"]),
+				Price:        num(m["price"]),
+				Size:         num(size),
+				Time:         timeOf(str(m["timestamp"])),
+			})
+		case strings.HasPrefix(channel, "candle"):
+			granularity, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(channel, "candle"), "s"))
+			values, _ := m["candle"].([]interface{})
+			if c, ok := candleOf(values); ok {
+				err = e.WriteCandles(str(m["instrument_id"]), granularity, c)
+			}
+		case channel == "depth5":
+			book := &okex.WSDepthItem{InstrumentId: str(m["instrument_id"]), Timestamp: str(m["timestamp"])}
+			book.Bids = levelsOf(m["bids"])
+			book.Asks = levelsOf(m["asks"])
+			err = e.WriteBook(book)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func candleOf(values []interface{}) (okex.Candle, bool) {
+	if len(values) < 6 {
+		return okex.Candle{}, false
+	}
+	c := okex.Candle{
+		Time:   timeOf(str(values[0])),
+		Open:   okex.Decimal(str(values[1])),
+		High:   okex.Decimal(str(values[2])),
+		Low:    okex.Decimal(str(values[3])),
+		Close:  okex.Decimal(str(values[4])),
+		Volume: okex.Decimal(str(values[5])),
+	}
+	if len(values) > 6 {
+		c.CurrencyVolume = okex.Decimal(str(values[6]))
+	}
+	return c, true
+}
+
+func levelsOf(v interface{}) [][4]interface{} {
+	list, _ := v.([]interface{})
+	levels := make([][4]interface{}, 0, len(list))
+	for _, l := range list {
+		values, _ := l.([]interface{})
+		var level [4]interface{}
+		copy(level[:], values)
+		levels = append(levels, level)
+	}
+	return levels
+}
+
+/*
+Flush the buffered rows of the csv files and write those of the parquet files as a row group.
+*/
+func (e *Exporter) Flush() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for _, f := range e.files {
+		if err := f.writer.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+Flush, sync and complete every open file. The first error is returned, the other files are still closed.
+*/
+func (e *Exporter) Close() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	var first error
+	for k, f := range e.files {
+		delete(e.files, k)
+		if err := e.complete(f); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
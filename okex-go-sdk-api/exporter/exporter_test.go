@@ -0,0 +1,129 @@
+package exporter
+
+import (
+	"encoding/csv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/okcoin-okex/open-api-v3-sdk/okex-go-sdk-api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func listFiles(t *testing.T, dir string) []string {
+	files := []string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(dir, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	require.True(t, err == nil, err)
+	sort.Strings(files)
+	return files
+}
+
+func readCsv(t *testing.T, path string) [][]string {
+	f, err := os.Open(path)
+	require.True(t, err == nil, err)
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	require.True(t, err == nil, err)
+	return records
+}
+
+func TestExporter_CsvPartitions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exporter")
+	require.True(t, err == nil, err)
+	defer os.RemoveAll(dir)
+	e, err := New(dir, FORMAT_CSV)
+	require.True(t, err == nil, err)
+	e.MaxRows = 2
+
+	day := time.Date(2019, 4, 16, 23, 59, 0, 0, time.UTC)
+	trade := func(id string, at time.Time) okex.Trade {
+		return okex.Trade{InstrumentId: "BTC-USD-SWAP", TradeId: id, Side: "buy", Price: 9000.5, Size: 2, Time: at}
+	}
+	require.True(t, e.WriteTrades(trade("1", day), trade("2", day)) == nil)
+	require.True(t, e.WriteTrades(trade("3", day)) == nil)
+	// still open, under the part suffix
+	assert.Equal(t, []string{
+		"trade/BTC-USD-SWAP/2019-04-16/trade-BTC-USD-SWAP-2019-04-16-0000.csv",
+		"trade/BTC-USD-SWAP/2019-04-16/trade-BTC-USD-SWAP-2019-04-16-0001.csv.part",
+	}, listFiles(t, dir))
+
+	// the next day rotates the file of the day before
+	require.True(t, e.WriteTrades(trade("4", day.Add(time.Minute))) == nil)
+	require.True(t, e.WriteCandles("BTC-USDT", okex.CANDLES_1MIN, okex.Candle{Time: day, Open: "1.5", Close: "2"}) == nil)
+	assert.Equal(t, 4, len(listFiles(t, dir)))
+	assert.True(t, exists(filepath.Join(dir, "trade/BTC-USD-SWAP/2019-04-16/trade-BTC-USD-SWAP-2019-04-16-0001.csv")))
+
+	require.True(t, e.Close() == nil)
+	assert.Equal(t, ERR_EXPORTER_CLOSED, e.WriteTrades(trade("5", day)))
+	assert.Equal(t, []string{
+		"candle/BTC-USDT/2019-04-16/candle-BTC-USDT-2019-04-16-0000.csv",
+		"trade/BTC-USD-SWAP/2019-04-16/trade-BTC-USD-SWAP-2019-04-16-0000.csv",
+		"trade/BTC-USD-SWAP/2019-04-16/trade-BTC-USD-SWAP-2019-04-16-0001.csv",
+		"trade/BTC-USD-SWAP/2019-04-17/trade-BTC-USD-SWAP-2019-04-17-0000.csv",
+	}, listFiles(t, dir))
+
+	records := readCsv(t, filepath.Join(dir, "trade/BTC-USD-SWAP/2019-04-16/trade-BTC-USD-SWAP-2019-04-16-0000.csv"))
+	assert.Equal(t, [][]string{
+		{"time", "instrument_id", "trade_id", "side", "price", "size"},
+		{"2019-04-16T23:59:00.000Z", "BTC-USD-SWAP", "1", "buy", "9000.5", "2"},
+		{"2019-04-16T23:59:00.000Z", "BTC-USD-SWAP", "2", "buy", "9000.5", "2"},
+	}, records)
+	candles := readCsv(t, filepath.Join(dir, "candle/BTC-USDT/2019-04-16/candle-BTC-USDT-2019-04-16-0000.csv"))
+	assert.Equal(t, []string{"2019-04-16T23:59:00.000Z", "BTC-USDT", "60", "1.5", "0", "0", "2", "0", "0"}, candles[1])
+
+	// a second run does not overwrite the files
+	e, _ = New(dir, FORMAT_CSV)
+	require.True(t, e.WriteTrades(trade("6", day)) == nil)
+	require.True(t, e.Close() == nil)
+	assert.True(t, exists(filepath.Join(dir, "trade/BTC-USD-SWAP/2019-04-16/trade-BTC-USD-SWAP-2019-04-16-0002.csv")))
+
+	_, err = New(dir, "xls")
+	assert.Equal(t, ERR_EXPORTER_FORMAT, err)
+}
+
+func TestExporter_OnPush(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exporter")
+	require.True(t, err == nil, err)
+	defer os.RemoveAll(dir)
+	e, _ := New(dir, FORMAT_CSV)
+	pushes := []*okex.WSTableResponse{
+		{Table: okex.CHNL_SPOT_TICKER, Data: []interface{}{map[string]interface{}{"instrument_id": "ETH-USDT",
+			"last": "160.1", "best_bid": "160", "best_ask": "160.2", "timestamp": "2019-04-16T10:00:00.000Z"}}},
+		{Table: okex.CHNL_FUTURES_TRADE, Data: []interface{}{map[string]interface{}{"instrument_id": "BTC-USD-190628",
+			"trade_id": "7", "side": "sell", "price": "5000", "qty": "3", "timestamp": "2019-04-16T10:00:00.000Z"}}},
+		{Table: okex.CHNL_SWAP_CANDLE60S, Data: []interface{}{map[string]interface{}{"instrument_id": "BTC-USD-SWAP",
+			"candle": []interface{}{"2019-04-16T10:00:00.000Z", "1", "2", "0.5", "1.5", "10", "0.1"}}}},
+		{Table: okex.CHNL_SWAP_DEPTH5, Data: []interface{}{map[string]interface{}{"instrument_id": "BTC-USD-SWAP",
+			"timestamp": "2019-04-16T10:00:00.000Z",
+			"bids":      []interface{}{[]interface{}{"99", "5", "0", "2"}, []interface{}{"98", "1", "0", "1"}},
+			"asks":      []interface{}{[]interface{}{"101", "4", "0", "3"}}}}},
+	}
+	for _, push := range pushes {
+		require.True(t, e.OnPush(push) == nil)
+	}
+	require.True(t, e.Close() == nil)
+
+	ticker := readCsv(t, filepath.Join(dir, "ticker/ETH-USDT/2019-04-16/ticker-ETH-USDT-2019-04-16-0000.csv"))
+	assert.Equal(t, []string{"2019-04-16T10:00:00.000Z", "ETH-USDT", "160.1", "160", "160.2", "0", "0", "0"}, ticker[1])
+	trade := readCsv(t, filepath.Join(dir, "trade/BTC-USD-190628/2019-04-16/trade-BTC-USD-190628-2019-04-16-0000.csv"))
+	assert.Equal(t, []string{"2019-04-16T10:00:00.000Z", "BTC-USD-190628", "7", "sell", "5000", "3"}, trade[1])
+	candle := readCsv(t, filepath.Join(dir, "candle/BTC-USD-SWAP/2019-04-16/candle-BTC-USD-SWAP-2019-04-16-0000.csv"))
+	assert.Equal(t, []string{"2019-04-16T10:00:00.000Z", "BTC-USD-SWAP", "60", "1", "2", "0.5", "1.5", "10", "0.1"}, candle[1])
+	book := readCsv(t, filepath.Join(dir, "book/BTC-USD-SWAP/2019-04-16/book-BTC-USD-SWAP-2019-04-16-0000.csv"))
+	assert.Equal(t, [][]string{
+		{"time", "instrument_id", "side", "level", "price", "size", "orders"},
+		{"2019-04-16T10:00:00.000Z", "BTC-USD-SWAP", "bid", "0", "99", "5", "2"},
+		{"2019-04-16T10:00:00.000Z", "BTC-USD-SWAP", "bid", "1", "98", "1", "1"},
+		{"2019-04-16T10:00:00.000Z", "BTC-USD-SWAP", "ask", "0", "101", "4", "3"},
+	}, book)
+}
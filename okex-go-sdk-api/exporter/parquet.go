@@ -0,0 +1,335 @@
+package exporter
+
+/*
+ A minimal parquet writer: one uncompressed PLAIN encoded data page per column and row group,
+ required columns only. The buffered rows are written as a row group on Flush and every
+ PARQUET_ROW_GROUP_ROWS rows, the footer describing the row groups on Close.
+*/
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"time"
+)
+
+const (
+	PARQUET_MAGIC          = "PAR1"
+	PARQUET_ROW_GROUP_ROWS = 10000
+)
+
+// parquet.thrift enums
+const (
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetRequired = 0
+
+	parquetConvertedUtf8            = 0
+	parquetConvertedTimestampMillis = 9
+
+	parquetEncodingPlain = 0
+	parquetEncodingRle   = 3
+
+	parquetUncompressed = 0
+	parquetDataPage     = 0
+)
+
+// thrift compact protocol types
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+/*
+A row group written, its column chunks are encoded into the footer.
+*/
+type parquetRowGroup struct {
+	rows    int64
+	size    int64
+	columns []parquetColumnChunk
+}
+
+type parquetColumnChunk struct {
+	offset int64
+	size   int64
+}
+
+type parquetWriter struct {
+	file   *os.File
+	schema *Schema
+	offset int64
+	rows   []Row
+	groups []parquetRowGroup
+}
+
+func newParquetWriter(file *os.File, schema *Schema) (*parquetWriter, error) {
+	if _, err := file.WriteString(PARQUET_MAGIC); err != nil {
+		return nil, err
+	}
+	return &parquetWriter{file: file, schema: schema, offset: int64(len(PARQUET_MAGIC))}, nil
+}
+
+func (w *parquetWriter) Write(row Row) error {
+	if !w.schema.Valid(row) {
+		return ERR_EXPORTER_ROW
+	}
+	w.rows = append(w.rows, row)
+	if len(w.rows) >= PARQUET_ROW_GROUP_ROWS {
+		return w.Flush()
+	}
+	return nil
+}
+
+/*
+Write the buffered rows as a row group.
+*/
+func (w *parquetWriter) Flush() error {
+	if len(w.rows) == 0 {
+		return nil
+	}
+	data, group := encodeParquetRowGroup(w.schema, w.rows, w.offset)
+	if _, err := w.file.Write(data); err != nil {
+		return err
+	}
+	w.offset += int64(len(data))
+	w.groups = append(w.groups, group)
+	w.rows = nil
+	return nil
+}
+
+func (w *parquetWriter) Close() error {
+	if err := w.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+	if _, err := w.file.Write(encodeParquetFooter(w.schema, w.groups)); err != nil {
+		w.file.Close()
+		return err
+	}
+	if err := w.file.Sync(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+func parquetPhysicalType(t ColumnType) int32 {
+	switch t {
+	case COLUMN_DOUBLE:
+		return parquetDouble
+	case COLUMN_INT64, COLUMN_TIMESTAMP:
+		return parquetInt64
+	}
+	return parquetByteArray
+}
+
+/*
+PLAIN encoding of a column: little endian numbers, byte arrays prefixed by their length.
+The rows were checked against the schema by Write.
+*/
+func parquetColumnValues(c Column, index int, rows []Row) []byte {
+	var buf bytes.Buffer
+	var b [8]byte
+	for _, row := range rows {
+		switch c.Type {
+		case COLUMN_DOUBLE:
+			f := row[index].(float64)
+			binary.LittleEndian.PutUint64(b[:], math.Float64bits(f))
+			buf.Write(b[:])
+		case COLUMN_INT64:
+			i := row[index].(int64)
+			binary.LittleEndian.PutUint64(b[:], uint64(i))
+			buf.Write(b[:])
+		case COLUMN_TIMESTAMP:
+			t := row[index].(time.Time)
+			binary.LittleEndian.PutUint64(b[:], uint64(t.UnixNano()/int64(time.Millisecond)))
+			buf.Write(b[:])
+		default:
+			s := row[index].(string)
+			binary.LittleEndian.PutUint32(b[:4], uint32(len(s)))
+			buf.Write(b[:4])
+			buf.WriteString(s)
+		}
+	}
+	return buf.Bytes()
+}
+
+/*
+Data pages of the rows, one per column, written at offset of the file.
+*/
+func encodeParquetRowGroup(schema *Schema, rows []Row, offset int64) ([]byte, parquetRowGroup) {
+	var out bytes.Buffer
+	group := parquetRowGroup{rows: int64(len(rows))}
+	for i, c := range schema.Columns {
+		values := parquetColumnValues(c, i, rows)
+
+		var header thriftWriter
+		header.structBegin()
+		header.i32(1, parquetDataPage)
+		header.i32(2, int32(len(values)))
+		header.i32(3, int32(len(values)))
+		header.fieldStruct(5)
+		header.i32(1, int32(len(rows)))
+		header.i32(2, parquetEncodingPlain)
+		header.i32(3, parquetEncodingRle)
+		header.i32(4, parquetEncodingRle)
+		header.structEnd()
+		header.structEnd()
+
+		chunk := parquetColumnChunk{offset: offset + int64(out.Len()), size: int64(header.buf.Len() + len(values))}
+		out.Write(header.buf.Bytes())
+		out.Write(values)
+		group.columns = append(group.columns, chunk)
+		group.size += chunk.size
+	}
+	return out.Bytes(), group
+}
+
+/*
+File metadata of the row groups, its length and the closing magic.
+*/
+func encodeParquetFooter(schema *Schema, groups []parquetRowGroup) []byte {
+	var rows int64
+	for _, g := range groups {
+		rows += g.rows
+	}
+
+	var meta thriftWriter
+	meta.structBegin()
+	meta.i32(1, 1)
+	meta.listBegin(2, thriftStruct, len(schema.Columns)+1)
+	meta.structBegin()
+	meta.fieldBinary(4, schema.Name)
+	meta.i32(5, int32(len(schema.Columns)))
+	meta.structEnd()
+	for _, c := range schema.Columns {
+		meta.structBegin()
+		meta.i32(1, parquetPhysicalType(c.Type))
+		meta.i32(3, parquetRequired)
+		meta.fieldBinary(4, c.Name)
+		switch c.Type {
+		case COLUMN_STRING:
+			meta.i32(6, parquetConvertedUtf8)
+		case COLUMN_TIMESTAMP:
+			meta.i32(6, parquetConvertedTimestampMillis)
+		}
+		meta.structEnd()
+	}
+	meta.i64(3, rows)
+	meta.listBegin(4, thriftStruct, len(groups))
+	for _, g := range groups {
+		meta.structBegin()
+		meta.listBegin(1, thriftStruct, len(g.columns))
+		for i, chunk := range g.columns {
+			meta.structBegin()
+			meta.i64(2, chunk.offset)
+			meta.fieldStruct(3)
+			meta.i32(1, parquetPhysicalType(schema.Columns[i].Type))
+			meta.listBegin(2, thriftI32, 1)
+			meta.zigzag(parquetEncodingPlain)
+			meta.listBegin(3, thriftBinary, 1)
+			meta.binary(schema.Columns[i].Name)
+			meta.i32(4, parquetUncompressed)
+			meta.i64(5, g.rows)
+			meta.i64(6, chunk.size)
+			meta.i64(7, chunk.size)
+			meta.i64(9, chunk.offset)
+			meta.structEnd()
+			meta.structEnd()
+		}
+		meta.i64(2, g.size)
+		meta.i64(3, g.rows)
+		meta.structEnd()
+	}
+	meta.fieldBinary(6, "okex-go-sdk-api exporter")
+	meta.structEnd()
+
+	var out bytes.Buffer
+	out.Write(meta.buf.Bytes())
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(meta.buf.Len()))
+	out.Write(length[:])
+	out.WriteString(PARQUET_MAGIC)
+	return out.Bytes()
+}
+
+/*
+Encoder of the thrift compact protocol used by the parquet headers and footer.
+*/
+type thriftWriter struct {
+	buf  bytes.Buffer
+	last []int16 // last field id of every open struct
+}
+
+func (t *thriftWriter) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	t.buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func (t *thriftWriter) zigzag(v int64) {
+	t.varint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	last := &t.last[len(t.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.zigzag(int64(id))
+	}
+	*last = id
+}
+
+func (t *thriftWriter) structBegin() {
+	t.last = append(t.last, 0)
+}
+
+func (t *thriftWriter) structEnd() {
+	t.buf.WriteByte(0)
+	t.last = t.last[:len(t.last)-1]
+}
+
+func (t *thriftWriter) fieldStruct(id int16) {
+	t.field(id, thriftStruct)
+	t.structBegin()
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.zigzag(int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.zigzag(v)
+}
+
+func (t *thriftWriter) binary(s string) {
+	t.varint(uint64(len(s)))
+	t.buf.WriteString(s)
+}
+
+func (t *thriftWriter) fieldBinary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.binary(s)
+}
+
+/*
+Write the header of a list field, the elements follow: varint for i32, binary, or structs.
+*/
+func (t *thriftWriter) listBegin(id int16, elemType byte, size int) {
+	t.field(id, thriftList)
+	if size < 15 {
+		t.buf.WriteByte(byte(size)<<4 | elemType)
+	} else {
+		t.buf.WriteByte(0xf0 | elemType)
+		t.varint(uint64(size))
+	}
+}
@@ -0,0 +1,207 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/okcoin-okex/open-api-v3-sdk/okex-go-sdk-api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+/*
+Decoder of the thrift compact protocol, structs are decoded into maps by field id.
+*/
+type thriftReader struct {
+	r *bytes.Reader
+}
+
+func (t *thriftReader) zigzag() int64 {
+	v, _ := binary.ReadUvarint(t.r)
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (t *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case thriftI32, thriftI64:
+		return t.zigzag()
+	case thriftBinary:
+		n, _ := binary.ReadUvarint(t.r)
+		b := make([]byte, n)
+		t.r.Read(b)
+		return string(b)
+	case thriftList:
+		header, _ := t.r.ReadByte()
+		size := int(header >> 4)
+		if size == 15 {
+			n, _ := binary.ReadUvarint(t.r)
+			size = int(n)
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			list[i] = t.value(header & 0x0f)
+		}
+		return list
+	case thriftStruct:
+		fields := map[int16]interface{}{}
+		var last int16
+		for {
+			header, _ := t.r.ReadByte()
+			if header == 0 {
+				return fields
+			}
+			id := last + int16(header>>4)
+			if header>>4 == 0 {
+				id = int16(t.zigzag())
+			}
+			fields[id] = t.value(header & 0x0f)
+			last = id
+		}
+	}
+	panic("unexpected thrift type")
+}
+
+func parquetFooter(data []byte) map[int16]interface{} {
+	length := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := &thriftReader{bytes.NewReader(data[len(data)-8-length : len(data)-8])}
+	return footer.value(thriftStruct).(map[int16]interface{})
+}
+
+func TestExporter_Parquet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exporter")
+	require.True(t, err == nil, err)
+	defer os.RemoveAll(dir)
+	e, _ := New(dir, FORMAT_PARQUET)
+	at := time.Date(2019, 4, 16, 10, 0, 0, 0, time.UTC)
+	require.True(t, e.WriteTrades(
+		okex.Trade{InstrumentId: "BTC-USDT", TradeId: "1", Side: "buy", Price: 9000.5, Size: 0.1, Time: at},
+		okex.Trade{InstrumentId: "BTC-USDT", TradeId: "22", Side: "sell", Price: 9001, Size: 2, Time: at.Add(time.Second)}) == nil)
+	path := filepath.Join(dir, "trade/BTC-USDT/2019-04-16/trade-BTC-USDT-2019-04-16-0000.parquet")
+	assert.True(t, exists(path+PART_SUFFIX))
+	require.True(t, e.Close() == nil)
+
+	data, err := ioutil.ReadFile(path)
+	require.True(t, err == nil, err)
+	assert.Equal(t, PARQUET_MAGIC, string(data[:4]))
+	assert.Equal(t, PARQUET_MAGIC, string(data[len(data)-4:]))
+	meta := parquetFooter(data)
+
+	assert.Equal(t, int64(2), meta[3])
+	schema := meta[2].([]interface{})
+	require.Equal(t, 7, len(schema))
+	assert.Equal(t, "trade", schema[0].(map[int16]interface{})[4])
+	assert.Equal(t, int64(6), schema[0].(map[int16]interface{})[5])
+	assert.Equal(t, int64(parquetConvertedTimestampMillis), schema[1].(map[int16]interface{})[6])
+	assert.Equal(t, int64(parquetDouble), schema[5].(map[int16]interface{})[1])
+
+	rowGroup := meta[4].([]interface{})[0].(map[int16]interface{})
+	columns := rowGroup[1].([]interface{})
+	require.Equal(t, 6, len(columns))
+	values := func(i int) []byte {
+		chunk := columns[i].(map[int16]interface{})[3].(map[int16]interface{})
+		assert.Equal(t, []interface{}{schema[i+1].(map[int16]interface{})[4]}, chunk[3])
+		page := &thriftReader{bytes.NewReader(data[chunk[9].(int64):])}
+		header := page.value(thriftStruct).(map[int16]interface{})
+		assert.Equal(t, int64(2), header[5].(map[int16]interface{})[1])
+		start := chunk[9].(int64) + chunk[6].(int64) - header[2].(int64)
+		return data[start : start+header[2].(int64)]
+	}
+
+	times := values(0)
+	assert.Equal(t, uint64(at.UnixNano()/1e6), binary.LittleEndian.Uint64(times[:8]))
+	assert.Equal(t, uint64(at.UnixNano()/1e6+1000), binary.LittleEndian.Uint64(times[8:]))
+	assert.Equal(t, append([]byte{1, 0, 0, 0, '1', 2, 0, 0, 0}, "22"...), values(2))
+	prices := values(4)
+	assert.Equal(t, 9000.5, math.Float64frombits(binary.LittleEndian.Uint64(prices[:8])))
+	assert.Equal(t, 9001.0, math.Float64frombits(binary.LittleEndian.Uint64(prices[8:])))
+}
+
+func TestExporter_ParquetRowGroups(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exporter")
+	require.True(t, err == nil, err)
+	defer os.RemoveAll(dir)
+	e, _ := New(dir, FORMAT_PARQUET)
+	at := time.Date(2019, 4, 16, 10, 0, 0, 0, time.UTC)
+	path := filepath.Join(dir, "trade/BTC-USDT/2019-04-16/trade-BTC-USDT-2019-04-16-0000.parquet")
+
+	require.True(t, e.WriteTrades(
+		okex.Trade{InstrumentId: "BTC-USDT", TradeId: "1", Side: "buy", Price: 9000.5, Size: 0.1, Time: at},
+		okex.Trade{InstrumentId: "BTC-USDT", TradeId: "2", Side: "sell", Price: 9001, Size: 2, Time: at}) == nil)
+	require.True(t, e.Flush() == nil)
+	info, err := os.Stat(path + PART_SUFFIX)
+	require.True(t, err == nil, err)
+	assert.True(t, info.Size() > int64(len(PARQUET_MAGIC)))
+
+	require.True(t, e.WriteTrades(okex.Trade{InstrumentId: "BTC-USDT", TradeId: "3", Side: "buy", Price: 9002, Size: 1, Time: at}) == nil)
+	assert.Equal(t, ERR_EXPORTER_ROW, e.Write(TradeSchema, Row{at, "BTC-USDT", "4", "buy", "9003", 1.0}))
+	assert.Equal(t, ERR_EXPORTER_ROW, e.Write(CandleSchema, Row{at, "BTC-USDT", 60, 1.0, 1.0, 1.0, 1.0, 1.0, 1.0}))
+	require.True(t, e.Close() == nil)
+
+	data, err := ioutil.ReadFile(path)
+	require.True(t, err == nil, err)
+	meta := parquetFooter(data)
+	assert.Equal(t, int64(3), meta[3])
+	groups := meta[4].([]interface{})
+	require.Equal(t, 2, len(groups))
+	second := groups[1].(map[int16]interface{})
+	assert.Equal(t, int64(1), second[3])
+	chunk := second[1].([]interface{})[2].(map[int16]interface{})[3].(map[int16]interface{})
+	page := &thriftReader{bytes.NewReader(data[chunk[9].(int64):])}
+	header := page.value(thriftStruct).(map[int16]interface{})
+	start := chunk[9].(int64) + chunk[6].(int64) - header[2].(int64)
+	assert.Equal(t, []byte{1, 0, 0, 0, '3'}, data[start:start+header[2].(int64)])
+}
+
+/*
+Read the file back with pyarrow, the test is skipped where it is not installed.
+*/
+const pyarrowRead = `
+import json, sys
+import pyarrow.parquet as pq
+f = pq.ParquetFile(sys.argv[1])
+t = f.read()
+print(json.dumps({
+    "row_groups": f.num_row_groups,
+    "time": [v.isoformat() for v in t.column("time").to_pylist()],
+    "trade_id": t.column("trade_id").to_pylist(),
+    "price": t.column("price").to_pylist(),
+}))
+`
+
+func TestExporter_ParquetPyarrow(t *testing.T) {
+	if exec.Command("python3", "-c", "import pyarrow.parquet").Run() != nil {
+		t.Skip("pyarrow is not installed")
+	}
+	dir, err := ioutil.TempDir("", "exporter")
+	require.True(t, err == nil, err)
+	defer os.RemoveAll(dir)
+	e, _ := New(dir, FORMAT_PARQUET)
+	at := time.Date(2019, 4, 16, 10, 0, 0, 0, time.UTC)
+	require.True(t, e.WriteTrades(okex.Trade{InstrumentId: "BTC-USDT", TradeId: "1", Side: "buy", Price: 9000.5, Size: 0.1, Time: at}) == nil)
+	require.True(t, e.Flush() == nil)
+	require.True(t, e.WriteTrades(okex.Trade{InstrumentId: "BTC-USDT", TradeId: "22", Side: "sell", Price: 9001, Size: 2, Time: at.Add(time.Second)}) == nil)
+	require.True(t, e.Close() == nil)
+
+	path := filepath.Join(dir, "trade/BTC-USDT/2019-04-16/trade-BTC-USDT-2019-04-16-0000.parquet")
+	out, err := exec.Command("python3", "-c", pyarrowRead, path).CombinedOutput()
+	require.True(t, err == nil, string(out))
+	var read struct {
+		RowGroups int       `json:"row_groups"`
+		Time      []string  `json:"time"`
+		TradeId   []string  `json:"trade_id"`
+		Price     []float64 `json:"price"`
+	}
+	require.True(t, json.Unmarshal(out, &read) == nil, string(out))
+	assert.Equal(t, 2, read.RowGroups)
+	assert.Equal(t, []string{"2019-04-16T10:00:00", "2019-04-16T10:00:01"}, read.Time)
+	assert.Equal(t, []string{"1", "22"}, read.TradeId)
+	assert.Equal(t, []float64{9000.5, 9001}, read.Price)
+}
@@ -0,0 +1,206 @@
+package exporter
+
+/*
+ Schemas of the exported market data. Every data type is written with a fixed schema, the time
+ and instrument_id columns come first and decide the partition of a row.
+*/
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/okcoin-okex/open-api-v3-sdk/okex-go-sdk-api"
+)
+
+type ColumnType int
+
+const (
+	COLUMN_STRING ColumnType = iota
+	COLUMN_DOUBLE
+	COLUMN_INT64
+	COLUMN_TIMESTAMP // milliseconds since epoch in parquet, RFC3339 in csv
+)
+
+type Column struct {
+	Name string
+	Type ColumnType
+}
+
+type Schema struct {
+	Name    string
+	Columns []Column
+}
+
+var (
+	TickerSchema = &Schema{Name: "ticker", Columns: []Column{
+		{"time", COLUMN_TIMESTAMP},
+		{"instrument_id", COLUMN_STRING},
+		{"last", COLUMN_DOUBLE},
+		{"best_bid", COLUMN_DOUBLE},
+		{"best_ask", COLUMN_DOUBLE},
+		{"high_24h", COLUMN_DOUBLE},
+		{"low_24h", COLUMN_DOUBLE},
+		{"volume_24h", COLUMN_DOUBLE},
+	}}
+	TradeSchema = &Schema{Name: "trade", Columns: []Column{
+		{"time", COLUMN_TIMESTAMP},
+		{"instrument_id", COLUMN_STRING},
+		{"trade_id", COLUMN_STRING},
+		{"side", COLUMN_STRING},
+		{"price", COLUMN_DOUBLE},
+		{"size", COLUMN_DOUBLE},
+	}}
+	CandleSchema = &Schema{Name: "candle", Columns: []Column{
+		{"time", COLUMN_TIMESTAMP},
+		{"instrument_id", COLUMN_STRING},
+		{"granularity", COLUMN_INT64},
+		{"open", COLUMN_DOUBLE},
+		{"high", COLUMN_DOUBLE},
+		{"low", COLUMN_DOUBLE},
+		{"close", COLUMN_DOUBLE},
+		{"volume", COLUMN_DOUBLE},
+		{"currency_volume", COLUMN_DOUBLE},
+	}}
+	// one row per price level of a snapshot, level 0 is the best price
+	BookSchema = &Schema{Name: "book", Columns: []Column{
+		{"time", COLUMN_TIMESTAMP},
+		{"instrument_id", COLUMN_STRING},
+		{"side", COLUMN_STRING},
+		{"level", COLUMN_INT64},
+		{"price", COLUMN_DOUBLE},
+		{"size", COLUMN_DOUBLE},
+		{"orders", COLUMN_INT64},
+	}}
+)
+
+func (s *Schema) Header() []string {
+	header := make([]string, len(s.Columns))
+	for i, c := range s.Columns {
+		header[i] = c.Name
+	}
+	return header
+}
+
+/*
+Whether the values of a row have the types of the columns.
+*/
+func (s *Schema) Valid(row Row) bool {
+	if len(row) != len(s.Columns) {
+		return false
+	}
+	for i, c := range s.Columns {
+		var ok bool
+		switch c.Type {
+		case COLUMN_STRING:
+			_, ok = row[i].(string)
+		case COLUMN_DOUBLE:
+			_, ok = row[i].(float64)
+		case COLUMN_INT64:
+			_, ok = row[i].(int64)
+		case COLUMN_TIMESTAMP:
+			_, ok = row[i].(time.Time)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+A row of a schema, the values are string, float64, int64 or time.Time following the column types.
+*/
+type Row []interface{}
+
+func (r Row) Time() time.Time {
+	t, _ := r[0].(time.Time)
+	return t
+}
+
+func (r Row) InstrumentId() string {
+	s, _ := r[1].(string)
+	return s
+}
+
+type Ticker struct {
+	InstrumentId string
+	Time         time.Time
+	Last         float64
+	BestBid      float64
+	BestAsk      float64
+	High24h      float64
+	Low24h       float64
+	Volume24h    float64
+}
+
+/*
+Ticker of a spot ticker result or of a spot/ticker, futures/ticker or swap/ticker push.
+*/
+func TickerOf(m map[string]interface{}) Ticker {
+	return Ticker{
+		InstrumentId: str(m["instrument_id"]),
+		Time:         timeOf(str(m["timestamp"])),
+		Last:         num(m["last"]),
+		BestBid:      num(m["best_bid"]),
+		BestAsk:      num(m["best_ask"]),
+		High24h:      num(m["high_24h"]),
+		Low24h:       num(m["low_24h"]),
+		Volume24h:    num(m["volume_24h"]),
+	}
+}
+
+func (t Ticker) Row() Row {
+	return Row{t.Time, t.InstrumentId, t.Last, t.BestBid, t.BestAsk, t.High24h, t.Low24h, t.Volume24h}
+}
+
+func TradeRow(t okex.Trade) Row {
+	return Row{t.Time, t.InstrumentId, t.TradeId, t.Side, t.Price, t.Size}
+}
+
+func CandleRow(instrumentId string, granularity int, c okex.Candle) Row {
+	return Row{c.Time, instrumentId, int64(granularity), c.Open.Float64(), c.High.Float64(), c.Low.Float64(),
+		c.Close.Float64(), c.Volume.Float64(), c.CurrencyVolume.Float64()}
+}
+
+/*
+Rows of an order book snapshot, as kept by OKWSAgent.GetOrderBook or pushed on the depth5 channels.
+*/
+func BookRows(book *okex.WSDepthItem) []Row {
+	t := timeOf(book.Timestamp)
+	rows := []Row{}
+	add := func(side string, levels [][4]interface{}) {
+		for i, l := range levels {
+			rows = append(rows, Row{t, book.InstrumentId, side, int64(i), num(l[0]), num(l[1]), int64(num(l[3]))})
+		}
+	}
+	add("bid", book.Bids)
+	add("ask", book.Asks)
+	return rows
+}
+
+func str(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+func num(v interface{}) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case string:
+		f, _ := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f
+	}
+	return 0
+}
+
+func timeOf(timestamp string) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, timestamp)
+	return t
+}
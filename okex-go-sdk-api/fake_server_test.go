@@ -0,0 +1,106 @@
+package okex
+
+/*
+ A local fake of the OKEX REST api for the tests which must not reach the
+ real exchange. Responses are registered per "METHOD path", every received
+ request is recorded.
+*/
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+type fakeRequest struct {
+	Method   string
+	Path     string
+	RawQuery string
+	Header   http.Header
+	Body     string
+}
+
+type fakeServer struct {
+	*httptest.Server
+	lock      sync.Mutex
+	responses map[string]func(r fakeRequest) string
+	requests  []fakeRequest
+}
+
+func newFakeServer() *fakeServer {
+	s := &fakeServer{responses: map[string]func(r fakeRequest) string{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+func (s *fakeServer) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	req := fakeRequest{
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		RawQuery: r.URL.RawQuery,
+		Header:   r.Header,
+		Body:     string(body),
+	}
+	s.lock.Lock()
+	s.requests = append(s.requests, req)
+	handler, ok := s.responses[r.Method+" "+r.URL.Path]
+	s.lock.Unlock()
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"code":30000,"message":"not found"}`))
+		return
+	}
+	w.Write([]byte(handler(req)))
+}
+
+func (s *fakeServer) handle(method, path, response string) {
+	s.handleFunc(method, path, func(r fakeRequest) string {
+		return response
+	})
+}
+
+func (s *fakeServer) handleFunc(method, path string, handler func(r fakeRequest) string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.responses[method+" "+path] = handler
+}
+
+func (s *fakeServer) config() *Config {
+	var config Config
+	config.Endpoint = s.URL + "/"
+	config.ApiKey = "fake-api-key"
+	config.SecretKey = "fake-secret-key"
+	config.Passphrase = "fake-passphrase"
+	config.TimeoutSecond = 5
+	config.I18n = ENGLISH
+	return &config
+}
+
+func (s *fakeServer) client() *Client {
+	return NewClient(*s.config())
+}
+
+func (s *fakeServer) lastRequest() fakeRequest {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.requests) == 0 {
+		return fakeRequest{}
+	}
+	return s.requests[len(s.requests)-1]
+}
+
+func (s *fakeServer) requestsTo(method, path string) []fakeRequest {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var rs []fakeRequest
+	for _, r := range s.requests {
+		if r.Method == method && r.Path == path {
+			rs = append(rs, r)
+		}
+	}
+	return rs
+}
@@ -0,0 +1,585 @@
+package okex
+
+/*
+ FundingMonitor tracks the funding of every swap: the rate of the next settlement and the
+ estimated rate of the one after, from the funding_time endpoint and the swap/funding_rate channel.
+ A rate beyond Threshold raises an alert, once per instrument, settlement and kind of rate.
+
+ Lead before a settlement the expected payments of the open positions are computed from the rate,
+ the mark price and the contract value, and passed to the OnExpected callbacks. After the
+ settlement Reconcile matches them with the funding entries of GetSwapAccountLedger.
+
+ Poll loads the funding of every swap on its first call and again once a settlement passed, the
+ rates in between come from the pushes of the channel.
+
+	monitor := NewFundingMonitor(client)
+	monitor.Threshold = 0.001
+	monitor.OnAlert(func(alert FundingAlert) { ... })
+	monitor.OnExpected(func(payment ExpectedFunding) { ... })
+	monitor.Start(time.Minute)
+	agent.Subscribe(CHNL_SWAP_FUNDING_RATE, "BTC-USD-SWAP", monitor.OnPush)
+*/
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// type of the funding entries of the swap ledger
+	SWAP_LEDGER_FUNDING = "funding"
+
+	FUNDING_ALERT_CURRENT   = "current"
+	FUNDING_ALERT_PREDICTED = "predicted"
+
+	// entries of a ledger page, the most the endpoint returns
+	FUNDING_LEDGER_PAGE = 100
+)
+
+/*
+Funding of a swap, Rate is settled at FundingTime and EstimatedRate is the prediction of the
+settlement after.
+*/
+type SwapFunding struct {
+	InstrumentId   string
+	Rate           float64
+	EstimatedRate  float64
+	InterestRate   float64
+	FundingTime    time.Time
+	SettlementTime time.Time
+	UpdatedAt      time.Time
+}
+
+/*
+A rate beyond the threshold, Kind tells whether Value is the current or the predicted rate.
+*/
+type FundingAlert struct {
+	SwapFunding
+	Kind      string // FUNDING_ALERT_*
+	Value     float64
+	Threshold float64
+}
+
+/*
+Funding expected for a position at the next settlement, Amount is credited in Currency and
+negative when paid: the longs pay a positive rate to the shorts.
+*/
+type ExpectedFunding struct {
+	InstrumentId string
+	Direction    string // DIRECTION_LONG or DIRECTION_SHORT
+	Position     float64
+	MarkPrice    float64
+	Rate         float64
+	FundingTime  time.Time
+	Amount       float64
+	Currency     string
+}
+
+/*
+Funding expected and booked for a settlement. Entries of the ledger without an expectation are
+reported at their own time with Expected 0.
+*/
+type FundingReconciliation struct {
+	InstrumentId string
+	FundingTime  time.Time
+	Expected     float64
+	Actual       float64
+	Difference   float64 // Actual - Expected
+	LedgerIds    []string
+	Matched      bool
+}
+
+type FundingMonitor struct {
+	// Absolute rate raising an alert, 0 disables the alerts.
+	Threshold float64
+	// How long before a settlement the expected payments are announced.
+	Lead time.Duration
+	// A ledger entry within Window of a settlement belongs to it.
+	Window time.Duration
+	// Relative difference between the expected and the booked funding still matched, the mark
+	// price moves between the announcement and the settlement.
+	Tolerance float64
+	// Types of the ledger entries of the funding.
+	LedgerTypes []string
+	// How long the expected payments of a settlement are kept for Reconcile after it.
+	Keep time.Duration
+	// Clock, time.Now by default.
+	Now func() time.Time
+
+	client *Client
+
+	lock         sync.Mutex
+	rates        map[string]SwapFunding
+	contractVals map[string]float64
+	alerted      map[settlementKey]bool
+	announced    map[settlementKey]bool
+	expected     map[string]map[time.Time][]ExpectedFunding // instrument -> funding time
+	alertCbs     []func(FundingAlert)
+	expectedCbs  []func(ExpectedFunding)
+
+	poller poller
+}
+
+// settlement of an instrument, kind is a FUNDING_ALERT_* for the alerts
+type settlementKey struct {
+	instrumentId string
+	kind         string
+	fundingTime  time.Time
+}
+
+func NewFundingMonitor(client *Client) *FundingMonitor {
+	return &FundingMonitor{
+		Lead:         10 * time.Minute,
+		Window:       5 * time.Minute,
+		Tolerance:    0.05,
+		LedgerTypes:  []string{SWAP_LEDGER_FUNDING},
+		Keep:         24 * time.Hour,
+		Now:          time.Now,
+		client:       client,
+		rates:        map[string]SwapFunding{},
+		contractVals: map[string]float64{},
+		alerted:      map[settlementKey]bool{},
+		announced:    map[settlementKey]bool{},
+		expected:     map[string]map[time.Time][]ExpectedFunding{},
+	}
+}
+
+/*
+Register a callback for the rates beyond Threshold, callbacks run outside the monitor lock.
+*/
+func (m *FundingMonitor) OnAlert(cb func(FundingAlert)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.alertCbs = append(m.alertCbs, cb)
+}
+
+/*
+Register a callback for the expected payments announced Lead before a settlement by Poll.
+*/
+func (m *FundingMonitor) OnExpected(cb func(ExpectedFunding)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.expectedCbs = append(m.expectedCbs, cb)
+}
+
+/*
+The last funding known of an instrument.
+*/
+func (m *FundingMonitor) Rate(instrumentId string) (SwapFunding, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	f, ok := m.rates[instrumentId]
+	return f, ok
+}
+
+/*
+The last funding known of every swap, by instrument id.
+*/
+func (m *FundingMonitor) Rates() []SwapFunding {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	rates := make([]SwapFunding, 0, len(m.rates))
+	for _, f := range m.rates {
+		rates = append(rates, f)
+	}
+	sort.Slice(rates, func(i, j int) bool { return rates[i].InstrumentId < rates[j].InstrumentId })
+	return rates
+}
+
+func parseFundingTime(s string) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, s)
+	return t
+}
+
+func (m *FundingMonitor) fundingOf(r *SwapFundingTime) SwapFunding {
+	return SwapFunding{
+		InstrumentId:   r.InstrumentId,
+		Rate:           toFloat(r.FundingRate),
+		EstimatedRate:  toFloat(r.EstimatedRate),
+		InterestRate:   toFloat(r.InterestRate),
+		FundingTime:    parseFundingTime(r.FundingTime),
+		SettlementTime: parseFundingTime(r.SettlementTime),
+		UpdatedAt:      m.Now(),
+	}
+}
+
+/*
+Store the rates and raise the alerts not raised yet for their settlement.
+*/
+func (m *FundingMonitor) update(rates ...SwapFunding) {
+	var alerts []FundingAlert
+	m.lock.Lock()
+	for _, f := range rates {
+		if f.InstrumentId == "" {
+			continue
+		}
+		m.rates[f.InstrumentId] = f
+		if m.Threshold <= 0 {
+			continue
+		}
+		for _, a := range []FundingAlert{
+			{SwapFunding: f, Kind: FUNDING_ALERT_CURRENT, Value: f.Rate, Threshold: m.Threshold},
+			{SwapFunding: f, Kind: FUNDING_ALERT_PREDICTED, Value: f.EstimatedRate, Threshold: m.Threshold},
+		} {
+			key := settlementKey{f.InstrumentId, a.Kind, f.FundingTime}
+			if math.Abs(a.Value) >= m.Threshold && !m.alerted[key] {
+				m.alerted[key] = true
+				alerts = append(alerts, a)
+			}
+		}
+	}
+	cbs := m.alertCbs
+	m.lock.Unlock()
+
+	for _, a := range alerts {
+		for _, cb := range cbs {
+			cb(a)
+		}
+	}
+}
+
+/*
+Load the instruments and the funding of every swap, one request per instrument. The rates of the
+swaps no longer listed are dropped; an instrument whose funding fails to load keeps its last rate,
+the others are loaded anyway and the first error is returned.
+*/
+func (m *FundingMonitor) Refresh() error {
+	contractVals, err := loadContractVals(m.client, MARKET_SWAP)
+	if err != nil {
+		return err
+	}
+	m.lock.Lock()
+	for k, v := range contractVals {
+		m.contractVals[k] = v
+	}
+	for instrumentId := range m.rates {
+		if _, ok := contractVals[instrumentId]; !ok {
+			delete(m.rates, instrumentId)
+		}
+	}
+	m.lock.Unlock()
+
+	instrumentIds := make([]string, 0, len(contractVals))
+	for instrumentId := range contractVals {
+		instrumentIds = append(instrumentIds, instrumentId)
+	}
+	sort.Strings(instrumentIds)
+	rates := []SwapFunding{}
+	var firstErr error
+	for _, instrumentId := range instrumentIds {
+		r, err := m.client.GetSwapFundingTimeByInstrument(instrumentId)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if r.InstrumentId == "" {
+			r.InstrumentId = instrumentId
+		}
+		rates = append(rates, m.fundingOf(r))
+	}
+	m.update(rates...)
+	return firstErr
+}
+
+/*
+Callback of the swap/funding_rate channel.
+*/
+func (m *FundingMonitor) OnPush(obj interface{}) error {
+	tb, ok := obj.(*WSTableResponse)
+	if !ok || tb.Table != CHNL_SWAP_FUNDING_RATE {
+		return nil
+	}
+	pushes := []SwapFundingTime{}
+	if err := decodeTableData(tb.Data, &pushes); err != nil {
+		return err
+	}
+	rates := make([]SwapFunding, 0, len(pushes))
+	for i := range pushes {
+		rates = append(rates, m.fundingOf(&pushes[i]))
+	}
+	m.update(rates...)
+	return nil
+}
+
+/*
+The funding expected at the next settlement for the open swap positions, valued at the mark
+price. The result is kept for Reconcile.
+*/
+func (m *FundingMonitor) ExpectedPayments() ([]ExpectedFunding, error) {
+	m.lock.Lock()
+	needInstruments := len(m.contractVals) == 0
+	m.lock.Unlock()
+	if needInstruments {
+		contractVals, err := loadContractVals(m.client, MARKET_SWAP)
+		if err != nil {
+			return nil, err
+		}
+		m.lock.Lock()
+		mergeContractVals(m.contractVals, contractVals)
+		m.lock.Unlock()
+	}
+
+	positions, err := m.client.GetSwapPositions()
+	if err != nil {
+		return nil, err
+	}
+	marks := map[string]float64{}
+	payments := []ExpectedFunding{}
+	for _, p := range *positions {
+		for _, h := range p.Holding {
+			if h.Position <= 0 {
+				continue
+			}
+			f, ok := m.Rate(h.InstrumentId)
+			if !ok {
+				r, err := m.client.GetSwapFundingTimeByInstrument(h.InstrumentId)
+				if err != nil {
+					return nil, err
+				}
+				f = m.fundingOf(r)
+				f.InstrumentId = h.InstrumentId
+				m.update(f)
+			}
+			mark, ok := marks[h.InstrumentId]
+			if !ok {
+				r, err := m.client.GetSwapMarkPriceByInstrument(h.InstrumentId)
+				if err != nil {
+					return nil, err
+				}
+				mark = toFloat(r.MarkPrice)
+				marks[h.InstrumentId] = mark
+			}
+			m.lock.Lock()
+			contractVal := m.contractVals[h.InstrumentId]
+			m.lock.Unlock()
+
+			amount := -f.Rate * contractValue(h.InstrumentId, h.Position, contractVal, mark)
+			if h.Side == DIRECTION_SHORT {
+				amount = -amount
+			}
+			payments = append(payments, ExpectedFunding{InstrumentId: h.InstrumentId, Direction: h.Side,
+				Position: h.Position, MarkPrice: mark, Rate: f.Rate, FundingTime: f.FundingTime,
+				Amount: amount, Currency: swapSettleCurrency(h.InstrumentId)})
+		}
+	}
+	sort.SliceStable(payments, func(i, j int) bool { return payments[i].InstrumentId < payments[j].InstrumentId })
+
+	// the last computation replaces the expectations of a settlement
+	m.lock.Lock()
+	byInstrument := map[string][]ExpectedFunding{}
+	for _, e := range payments {
+		byInstrument[e.InstrumentId] = append(byInstrument[e.InstrumentId], e)
+	}
+	for instrumentId, f := range m.rates {
+		if m.expected[instrumentId] == nil {
+			m.expected[instrumentId] = map[time.Time][]ExpectedFunding{}
+		}
+		if es, ok := byInstrument[instrumentId]; ok {
+			m.expected[instrumentId][f.FundingTime] = es
+		} else {
+			delete(m.expected[instrumentId], f.FundingTime)
+		}
+	}
+	m.lock.Unlock()
+	return payments, nil
+}
+
+/*
+Whether the rates must be loaded: none is known yet or the settlement of one passed.
+*/
+func (m *FundingMonitor) stale(now time.Time) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if len(m.rates) == 0 {
+		return true
+	}
+	for _, f := range m.rates {
+		if !f.FundingTime.After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Forget the alerts and announcements of the settlements passed, and the expected payments older
+than Keep.
+*/
+func (m *FundingMonitor) prune(now time.Time) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for key := range m.alerted {
+		if !key.fundingTime.After(now) {
+			delete(m.alerted, key)
+		}
+	}
+	for key := range m.announced {
+		if !key.fundingTime.After(now) {
+			delete(m.announced, key)
+		}
+	}
+	for instrumentId, byTime := range m.expected {
+		for fundingTime := range byTime {
+			if fundingTime.Add(m.Keep).Before(now) {
+				delete(byTime, fundingTime)
+			}
+		}
+		if len(byTime) == 0 {
+			delete(m.expected, instrumentId)
+		}
+	}
+}
+
+/*
+Load the rates when a settlement passed and announce the expected payments of the settlements due
+within Lead.
+*/
+func (m *FundingMonitor) Poll() error {
+	if m.stale(m.Now()) {
+		if err := m.Refresh(); err != nil {
+			return err
+		}
+	}
+	now := m.Now()
+	m.prune(now)
+	due := false
+	m.lock.Lock()
+	for instrumentId, f := range m.rates {
+		key := settlementKey{instrumentId: instrumentId, fundingTime: f.FundingTime}
+		if !m.announced[key] && f.FundingTime.After(now) && !f.FundingTime.After(now.Add(m.Lead)) {
+			due = true
+		}
+	}
+	m.lock.Unlock()
+	if !due {
+		return nil
+	}
+
+	payments, err := m.ExpectedPayments()
+	if err != nil {
+		return err
+	}
+	var announced []ExpectedFunding
+	m.lock.Lock()
+	for _, e := range payments {
+		key := settlementKey{instrumentId: e.InstrumentId, fundingTime: e.FundingTime}
+		if e.FundingTime.After(now) && !e.FundingTime.After(now.Add(m.Lead)) && !m.announced[key] {
+			announced = append(announced, e)
+		}
+	}
+	for _, e := range announced {
+		m.announced[settlementKey{instrumentId: e.InstrumentId, fundingTime: e.FundingTime}] = true
+	}
+	cbs := m.expectedCbs
+	m.lock.Unlock()
+
+	for _, e := range announced {
+		for _, cb := range cbs {
+			cb(e)
+		}
+	}
+	return nil
+}
+
+/*
+The ledger of an instrument back to since, newest first: the pages are requested after the last
+entry of the previous one.
+*/
+func (m *FundingMonitor) ledgerSince(instrumentId string, since time.Time) ([]BaseLedgerInfo, error) {
+	entries := []BaseLedgerInfo{}
+	params := map[string]string{"limit": strconv.Itoa(FUNDING_LEDGER_PAGE)}
+	for {
+		page, err := m.client.GetSwapAccountLedger(instrumentId, params)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *page...)
+		if len(*page) < FUNDING_LEDGER_PAGE {
+			break
+		}
+		last := (*page)[len(*page)-1]
+		if last.LedgerId == "" || parseFundingTime(last.Timestamp).Before(since) {
+			break
+		}
+		params["after"] = last.LedgerId
+	}
+	return entries, nil
+}
+
+/*
+Match the funding entries of the ledger of an instrument since a time with the payments expected
+for the settlements since then.
+*/
+func (m *FundingMonitor) Reconcile(instrumentId string, since time.Time) ([]FundingReconciliation, error) {
+	ledger, err := m.ledgerSince(instrumentId, since)
+	if err != nil {
+		return nil, err
+	}
+	now := m.Now()
+
+	recs := []*FundingReconciliation{}
+	m.lock.Lock()
+	for fundingTime, es := range m.expected[instrumentId] {
+		if fundingTime.Before(since) || fundingTime.After(now) {
+			continue
+		}
+		r := &FundingReconciliation{InstrumentId: instrumentId, FundingTime: fundingTime}
+		for _, e := range es {
+			r.Expected += e.Amount
+		}
+		recs = append(recs, r)
+	}
+	m.lock.Unlock()
+
+	for _, entry := range ledger {
+		at := parseFundingTime(entry.Timestamp)
+		if !containsString(m.LedgerTypes, entry.Type) || at.Before(since) {
+			continue
+		}
+		var closest *FundingReconciliation
+		for _, r := range recs {
+			d := absDuration(at.Sub(r.FundingTime))
+			if d <= m.Window && (closest == nil || d < absDuration(at.Sub(closest.FundingTime))) {
+				closest = r
+			}
+		}
+		if closest == nil {
+			closest = &FundingReconciliation{InstrumentId: instrumentId, FundingTime: at}
+			recs = append(recs, closest)
+		}
+		closest.Actual += toFloat(entry.Amount)
+		closest.LedgerIds = append(closest.LedgerIds, entry.LedgerId)
+	}
+
+	result := make([]FundingReconciliation, 0, len(recs))
+	for _, r := range recs {
+		r.Difference = r.Actual - r.Expected
+		r.Matched = math.Abs(r.Difference) <= m.Tolerance*math.Abs(r.Expected)+1e-12
+		result = append(result, *r)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].FundingTime.Before(result[j].FundingTime) })
+	return result, nil
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+/*
+Poll the rates and announce the payments due, now and then every interval until Stop is called.
+*/
+func (m *FundingMonitor) Start(interval time.Duration) {
+	m.poller.start("funding monitor: poll", interval, true, m.Poll)
+}
+
+func (m *FundingMonitor) Stop() {
+	m.poller.stop()
+}
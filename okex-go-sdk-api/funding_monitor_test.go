@@ -0,0 +1,172 @@
+package okex
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFundingMonitor_PollAndReconcile(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handle(GET, SWAP_INSTRUMENTS, `[{"instrument_id":"BTC-USD-SWAP","contract_val":"100"},{"instrument_id":"ETH-USDT-SWAP","contract_val":"0.1"}]`)
+	s.handle(GET, "/api/swap/v3/instruments/BTC-USD-SWAP/funding_time", `{"instrument_id":"BTC-USD-SWAP",
+		"funding_time":"2019-04-16T16:00:00.000Z","funding_rate":"0.0004","estimated_rate":"0.0012","interest_rate":"0",
+		"settlement_time":"2019-04-17T00:00:00.000Z"}`)
+	s.handle(GET, "/api/swap/v3/instruments/ETH-USDT-SWAP/funding_time", `{"instrument_id":"ETH-USDT-SWAP",
+		"funding_time":"2019-04-16T16:00:00.000Z","funding_rate":"-0.0015","estimated_rate":"-0.0002","interest_rate":"0"}`)
+	s.handle(GET, SWAP_POSITION, `[{"margin_mode":"crossed","holding":[
+		{"instrument_id":"BTC-USD-SWAP","position":"10","avail_position":"10","avg_cost":"7900","side":"long","timestamp":"2019-04-16T06:14:27.000Z"}]},
+		{"margin_mode":"crossed","holding":[
+		{"instrument_id":"ETH-USDT-SWAP","position":"5","avail_position":"5","avg_cost":"190","side":"short","timestamp":"2019-04-16T06:14:27.000Z"}]}]`)
+	s.handle(GET, "/api/swap/v3/instruments/BTC-USD-SWAP/mark_price", `{"instrument_id":"BTC-USD-SWAP","mark_price":"8000"}`)
+	s.handle(GET, "/api/swap/v3/instruments/ETH-USDT-SWAP/mark_price", `{"instrument_id":"ETH-USDT-SWAP","mark_price":"200"}`)
+	s.handle(GET, "/api/swap/v3/accounts/BTC-USD-SWAP/ledger", `[
+		{"ledger_id":"3","amount":"-0.0000502","type":"funding","timestamp":"2019-04-16T16:00:02.000Z","instrument_id":"BTC-USD-SWAP"},
+		{"ledger_id":"2","amount":"-0.0001","type":"fee","timestamp":"2019-04-16T10:00:00.000Z","instrument_id":"BTC-USD-SWAP"},
+		{"ledger_id":"1","amount":"0.00002","type":"funding","timestamp":"2019-04-16T08:00:01.000Z","instrument_id":"BTC-USD-SWAP"}]`)
+
+	now := time.Date(2019, 4, 16, 15, 40, 0, 0, time.UTC)
+	m := NewFundingMonitor(s.client())
+	m.Now = func() time.Time { return now }
+	m.Threshold = 0.001
+	alerts := []FundingAlert{}
+	m.OnAlert(func(a FundingAlert) { alerts = append(alerts, a) })
+	expected := []ExpectedFunding{}
+	m.OnExpected(func(e ExpectedFunding) { expected = append(expected, e) })
+
+	// not due yet, rates only
+	require.True(t, m.Poll() == nil)
+	assert.Equal(t, 0, len(expected))
+	assert.Equal(t, 0, len(s.requestsTo(GET, SWAP_POSITION)))
+	require.Equal(t, 2, len(alerts))
+	assert.Equal(t, "BTC-USD-SWAP", alerts[0].InstrumentId)
+	assert.Equal(t, FUNDING_ALERT_PREDICTED, alerts[0].Kind)
+	assert.Equal(t, 0.0012, alerts[0].Value)
+	assert.Equal(t, FUNDING_ALERT_CURRENT, alerts[1].Kind)
+	assert.Equal(t, -0.0015, alerts[1].Value)
+	rates := m.Rates()
+	require.Equal(t, 2, len(rates))
+	assert.True(t, rates[0].FundingTime.Equal(time.Date(2019, 4, 16, 16, 0, 0, 0, time.UTC)))
+	assert.Equal(t, 0.0004, rates[0].Rate)
+
+	now = now.Add(15 * time.Minute)
+	require.True(t, m.Poll() == nil)
+	require.True(t, m.Poll() == nil)
+	// the rates are loaded once before the settlement
+	assert.Equal(t, 1, len(s.requestsTo(GET, "/api/swap/v3/instruments/BTC-USD-SWAP/funding_time")))
+	assert.Equal(t, 2, len(alerts))
+	require.Equal(t, 2, len(expected))
+	near(t, -0.0004*10*100/8000, expected[0].Amount)
+	assert.Equal(t, "BTC", expected[0].Currency)
+	near(t, -0.15, expected[1].Amount)
+	assert.Equal(t, DIRECTION_SHORT, expected[1].Direction)
+	assert.Equal(t, "USDT", expected[1].Currency)
+
+	// a push changes the current rate of the settlement
+	require.True(t, m.OnPush(tradePushTable(CHNL_SWAP_FUNDING_RATE, map[string]interface{}{"instrument_id": "BTC-USD-SWAP",
+		"funding_rate": "0.002", "estimated_rate": "0.0012", "funding_time": "2019-04-16T16:00:00.000Z"})) == nil)
+	require.Equal(t, 3, len(alerts))
+	assert.Equal(t, FUNDING_ALERT_CURRENT, alerts[2].Kind)
+	f, ok := m.Rate("BTC-USD-SWAP")
+	require.True(t, ok)
+	assert.Equal(t, 0.002, f.Rate)
+
+	now = now.Add(10 * time.Minute)
+	recs, err := m.Reconcile("BTC-USD-SWAP", time.Date(2019, 4, 16, 0, 0, 0, 0, time.UTC))
+	require.True(t, err == nil, err)
+	require.Equal(t, 2, len(recs))
+	assert.Equal(t, []string{"1"}, recs[0].LedgerIds)
+	assert.Equal(t, 0.0, recs[0].Expected)
+	assert.False(t, recs[0].Matched)
+	assert.Equal(t, []string{"3"}, recs[1].LedgerIds)
+	near(t, -0.00005, recs[1].Expected)
+	near(t, -0.0000002, recs[1].Difference)
+	assert.True(t, recs[1].Matched)
+
+	// the settlement passed, the rates are loaded again and its keys forgotten
+	require.True(t, m.Poll() == nil)
+	assert.Equal(t, 2, len(s.requestsTo(GET, "/api/swap/v3/instruments/BTC-USD-SWAP/funding_time")))
+	m.lock.Lock()
+	assert.Equal(t, 0, len(m.alerted))
+	assert.Equal(t, 0, len(m.announced))
+	assert.Equal(t, 2, len(m.expected))
+	m.lock.Unlock()
+	now = now.Add(25 * time.Hour)
+	require.True(t, m.Poll() == nil)
+	m.lock.Lock()
+	assert.Equal(t, 0, len(m.expected))
+	m.lock.Unlock()
+}
+
+func TestFundingMonitor_RefreshDelisted(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handle(GET, SWAP_INSTRUMENTS, `[{"instrument_id":"BTC-USD-SWAP","contract_val":"100"},{"instrument_id":"ETH-USD-SWAP","contract_val":"10"}]`)
+	s.handle(GET, "/api/swap/v3/instruments/BTC-USD-SWAP/funding_time", `{"instrument_id":"BTC-USD-SWAP",
+		"funding_time":"2019-04-16T16:00:00.000Z","funding_rate":"0.0001","estimated_rate":"0.0001"}`)
+
+	now := time.Date(2019, 4, 16, 10, 0, 0, 0, time.UTC)
+	m := NewFundingMonitor(s.client())
+	m.Now = func() time.Time { return now }
+
+	// the funding of ETH fails to load, BTC is loaded anyway
+	assert.True(t, m.Refresh() != nil)
+	_, ok := m.Rate("BTC-USD-SWAP")
+	assert.True(t, ok)
+	s.handle(GET, "/api/swap/v3/instruments/ETH-USD-SWAP/funding_time", `{"instrument_id":"ETH-USD-SWAP",
+		"funding_time":"2019-04-16T16:00:00.000Z","funding_rate":"0.0001","estimated_rate":"0.0001"}`)
+	require.True(t, m.Refresh() == nil)
+	assert.Equal(t, 2, len(m.Rates()))
+
+	// ETH is delisted after the settlement, its rate is dropped and no longer makes the rates stale
+	s.handle(GET, SWAP_INSTRUMENTS, `[{"instrument_id":"BTC-USD-SWAP","contract_val":"100"}]`)
+	s.handle(GET, "/api/swap/v3/instruments/BTC-USD-SWAP/funding_time", `{"instrument_id":"BTC-USD-SWAP",
+		"funding_time":"2019-04-17T00:00:00.000Z","funding_rate":"0.0001","estimated_rate":"0.0001"}`)
+	now = time.Date(2019, 4, 16, 16, 30, 0, 0, time.UTC)
+	require.True(t, m.Poll() == nil)
+	require.True(t, m.Poll() == nil)
+	_, ok = m.Rate("ETH-USD-SWAP")
+	assert.False(t, ok)
+	assert.Equal(t, 1, len(m.Rates()))
+	assert.Equal(t, 3, len(s.requestsTo(GET, SWAP_INSTRUMENTS)))
+}
+
+func TestFundingMonitor_ReconcilePages(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	// one funding entry an hour, newest first, pages of FUNDING_LEDGER_PAGE after a ledger id
+	start := time.Date(2019, 4, 1, 0, 0, 0, 0, time.UTC)
+	s.handleFunc(GET, "/api/swap/v3/accounts/BTC-USD-SWAP/ledger", func(r fakeRequest) string {
+		query, _ := url.ParseQuery(r.RawQuery)
+		id := 250
+		if after := query.Get("after"); after != "" {
+			id, _ = strconv.Atoi(after)
+			id--
+		}
+		entries := []string{}
+		for ; id > 0 && len(entries) < FUNDING_LEDGER_PAGE; id-- {
+			entries = append(entries, fmt.Sprintf(`{"ledger_id":"%d","amount":"0.1","type":"funding","timestamp":"%s"}`,
+				id, start.Add(time.Duration(id)*time.Hour).Format(time.RFC3339)))
+		}
+		return "[" + strings.Join(entries, ",") + "]"
+	})
+
+	m := NewFundingMonitor(s.client())
+	m.Now = func() time.Time { return start.Add(300 * time.Hour) }
+	recs, err := m.Reconcile("BTC-USD-SWAP", start.Add(120*time.Hour))
+	require.True(t, err == nil, err)
+	assert.Equal(t, 131, len(recs))
+	assert.Equal(t, 2, len(s.requestsTo(GET, "/api/swap/v3/accounts/BTC-USD-SWAP/ledger")))
+	assert.Equal(t, "after=151&limit=100", s.lastRequest().RawQuery)
+
+	recs, err = m.Reconcile("BTC-USD-SWAP", start)
+	require.True(t, err == nil, err)
+	assert.Equal(t, 250, len(recs))
+}
@@ -0,0 +1,317 @@
+package okex
+
+/*
+ FundingWatcher polls the deposit and withdrawal history of the wallet and emits an event
+ every time a deposit (by txid) or a withdrawal (by withdrawal_id) changes its status.
+ The last seen status of every record is kept in a FundingCursor, persisted after each poll
+ so that a restarted watcher only reports what changed while it was down.
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	FUNDING_DEPOSIT    = "deposit"
+	FUNDING_WITHDRAWAL = "withdrawal"
+
+	/*
+	 funding state: a deposit is credited to the wallet, a withdrawal is sent out
+	*/
+	FUNDING_STATE_PENDING    = "pending"
+	FUNDING_STATE_CONFIRMING = "confirming"
+	FUNDING_STATE_CREDITED   = "credited"
+	FUNDING_STATE_FAILED     = "failed"
+)
+
+var ERR_FUNDING_RECORD_ID = errors.New(`funding watcher: txid or withdrawal_id is required`)
+
+/*
+Status of the records:
+
+	deposit:    0: waiting for confirmation 1: confirmed 2: credited
+	withdrawal: -3: canceling -2: canceled -1: failed 0: pending 1: sending 2: sent
+	            3: email confirmation 4: manual confirmation 5: identity confirmation
+*/
+var depositStates = map[string]string{
+	"0": FUNDING_STATE_PENDING,
+	"1": FUNDING_STATE_CONFIRMING,
+	"2": FUNDING_STATE_CREDITED,
+}
+
+var withdrawalStates = map[string]string{
+	"-3": FUNDING_STATE_PENDING,
+	"-2": FUNDING_STATE_FAILED,
+	"-1": FUNDING_STATE_FAILED,
+	"0":  FUNDING_STATE_PENDING,
+	"1":  FUNDING_STATE_CONFIRMING,
+	"2":  FUNDING_STATE_CREDITED,
+	"3":  FUNDING_STATE_PENDING,
+	"4":  FUNDING_STATE_PENDING,
+	"5":  FUNDING_STATE_PENDING,
+}
+
+type FundingRecord struct {
+	Kind      string `json:"kind"` // FUNDING_DEPOSIT or FUNDING_WITHDRAWAL
+	Id        string `json:"id"`   // txid of a deposit, withdrawal_id of a withdrawal
+	TxId      string `json:"txid"`
+	Currency  string `json:"currency"`
+	Amount    string `json:"amount"`
+	Status    string `json:"status"` // status as returned by the history endpoint
+	State     string `json:"state"`  // FUNDING_STATE_*
+	Timestamp string `json:"timestamp"`
+}
+
+func (r *FundingRecord) IsFinal() bool {
+	return r.State == FUNDING_STATE_CREDITED || r.State == FUNDING_STATE_FAILED
+}
+
+/*
+PreviousStatus and PreviousState are empty for a record seen for the first time.
+*/
+type FundingEvent struct {
+	FundingRecord
+	PreviousStatus string
+	PreviousState  string
+}
+
+type FundingCursor struct {
+	Records map[string]FundingRecord `json:"records"` // kind:id -> last seen record
+}
+
+type FundingCursorStore interface {
+	Load() (*FundingCursor, error)
+	Save(cursor *FundingCursor) error
+}
+
+/*
+Keep the cursor in a json file, written through a temporary file so that a crash never leaves it half written.
+*/
+type FileCursorStore struct {
+	Path string
+}
+
+func NewFileCursorStore(path string) *FileCursorStore {
+	return &FileCursorStore{Path: path}
+}
+
+func (s *FileCursorStore) Load() (*FundingCursor, error) {
+	cursor := FundingCursor{}
+	data, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return &cursor, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+func (s *FileCursorStore) Save(cursor *FundingCursor) error {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return err
+	}
+	tmp := s.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.Path)
+}
+
+type FundingWatcher struct {
+	client *Client
+	store  FundingCursorStore
+
+	lock      sync.Mutex
+	records   map[string]FundingRecord
+	callbacks []func(FundingEvent)
+	polled    chan struct{} // closed after every poll
+
+	poller poller
+}
+
+/*
+Create a watcher resuming from the cursor of the store, a nil store keeps the cursor in memory only.
+A watcher without a cursor reports every record of the history as new on its first poll.
+*/
+func NewFundingWatcher(client *Client, store FundingCursorStore) (*FundingWatcher, error) {
+	w := &FundingWatcher{
+		client:  client,
+		store:   store,
+		records: map[string]FundingRecord{},
+		polled:  make(chan struct{}),
+	}
+	if store != nil {
+		cursor, err := store.Load()
+		if err != nil {
+			return nil, err
+		}
+		for k, r := range cursor.Records {
+			w.records[k] = r
+		}
+	}
+	return w, nil
+}
+
+/*
+Register a callback invoked for every status change, callbacks run outside the watcher lock.
+*/
+func (w *FundingWatcher) OnEvent(cb func(FundingEvent)) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.callbacks = append(w.callbacks, cb)
+}
+
+func fundingKey(kind, id string) string {
+	return kind + ":" + id
+}
+
+func fundingRecordOf(kind string, h map[string]interface{}) FundingRecord {
+	r := FundingRecord{
+		Kind:      kind,
+		TxId:      anyToString(h["txid"]),
+		Currency:  anyToString(h["currency"]),
+		Amount:    anyToString(h["amount"]),
+		Status:    anyToString(h["status"]),
+		Timestamp: anyToString(h["timestamp"]),
+	}
+	if kind == FUNDING_DEPOSIT {
+		r.Id = r.TxId
+		r.State = depositStates[r.Status]
+	} else {
+		r.Id = anyToString(h["withdrawal_id"])
+		r.State = withdrawalStates[r.Status]
+	}
+	return r
+}
+
+/*
+Fetch the deposit and withdrawal history once, emit the changes and persist the cursor.
+*/
+func (w *FundingWatcher) Poll() error {
+	deposits, err := w.client.GetAccountDepositHistory()
+	if err != nil {
+		return err
+	}
+	withdrawals, err := w.client.GetAccountWithdrawalHistory()
+	if err != nil {
+		return err
+	}
+
+	seen := map[string]bool{}
+	var events []FundingEvent
+	w.lock.Lock()
+	histories := []struct {
+		kind    string
+		history []map[string]interface{}
+	}{{FUNDING_DEPOSIT, *deposits}, {FUNDING_WITHDRAWAL, *withdrawals}}
+	for _, hs := range histories {
+		kind := hs.kind
+		for _, h := range hs.history {
+			r := fundingRecordOf(kind, h)
+			if r.Id == "" {
+				continue
+			}
+			key := fundingKey(kind, r.Id)
+			seen[key] = true
+			old, ok := w.records[key]
+			if ok && old.Status == r.Status {
+				continue
+			}
+			w.records[key] = r
+			events = append(events, FundingEvent{FundingRecord: r, PreviousStatus: old.Status, PreviousState: old.State})
+		}
+	}
+	// the history only holds the latest records, final ones which fell out of it will not change anymore
+	for key, r := range w.records {
+		if !seen[key] && r.IsFinal() {
+			delete(w.records, key)
+		}
+	}
+	cursor := FundingCursor{Records: map[string]FundingRecord{}}
+	for key, r := range w.records {
+		cursor.Records[key] = r
+	}
+	callbacks := w.callbacks
+	polled := w.polled
+	w.polled = make(chan struct{})
+	w.lock.Unlock()
+
+	var saveErr error
+	if w.store != nil {
+		saveErr = w.store.Save(&cursor)
+	}
+	for _, e := range events {
+		for _, cb := range callbacks {
+			cb(e)
+		}
+	}
+	close(polled)
+	return saveErr
+}
+
+/*
+The last seen record of a deposit (by txid) or a withdrawal (by withdrawal_id).
+*/
+func (w *FundingWatcher) Record(kind, id string) (FundingRecord, bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	r, ok := w.records[fundingKey(kind, id)]
+	return r, ok
+}
+
+/*
+Block until the deposit of txid is credited or ctx is done. The watcher must be started,
+or polled by the caller, for the wait to make progress.
+*/
+func (w *FundingWatcher) WaitDeposit(ctx context.Context, txid string) (FundingRecord, error) {
+	return w.wait(ctx, FUNDING_DEPOSIT, txid)
+}
+
+/*
+Block until the withdrawal is sent or failed, or ctx is done.
+*/
+func (w *FundingWatcher) WaitWithdrawal(ctx context.Context, withdrawalId string) (FundingRecord, error) {
+	return w.wait(ctx, FUNDING_WITHDRAWAL, withdrawalId)
+}
+
+func (w *FundingWatcher) wait(ctx context.Context, kind, id string) (FundingRecord, error) {
+	if id == "" {
+		return FundingRecord{}, ERR_FUNDING_RECORD_ID
+	}
+	for {
+		w.lock.Lock()
+		r, ok := w.records[fundingKey(kind, id)]
+		polled := w.polled
+		w.lock.Unlock()
+		if ok && r.IsFinal() {
+			return r, nil
+		}
+		select {
+		case <-ctx.Done():
+			return r, ctx.Err()
+		case <-polled:
+		}
+	}
+}
+
+/*
+Poll now and then every interval in background, until Stop is called.
+*/
+func (w *FundingWatcher) Start(interval time.Duration) {
+	w.poller.start("funding watcher: poll", interval, true, w.Poll)
+}
+
+func (w *FundingWatcher) Stop() {
+	w.poller.stop()
+}
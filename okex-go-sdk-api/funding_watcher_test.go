@@ -0,0 +1,124 @@
+package okex
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeFundingHistory struct {
+	lock        sync.Mutex
+	deposits    string
+	withdrawals string
+}
+
+func (h *fakeFundingHistory) set(deposits, withdrawals string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.deposits, h.withdrawals = deposits, withdrawals
+}
+
+func newFakeFundingServer(h *fakeFundingHistory) *fakeServer {
+	s := newFakeServer()
+	s.handleFunc(GET, ACCOUNT_DEPOSIT_HISTORY, func(r fakeRequest) string {
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		return h.deposits
+	})
+	s.handleFunc(GET, ACCOUNT_WITHRAWAL_HISTORY, func(r fakeRequest) string {
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		return h.withdrawals
+	})
+	return s
+}
+
+func TestFundingWatcher_EventsAndRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "funding")
+	require.True(t, err == nil, err)
+	defer os.RemoveAll(dir)
+	store := NewFileCursorStore(filepath.Join(dir, "cursor.json"))
+
+	h := &fakeFundingHistory{}
+	h.set(`[{"amount":"0.1","txid":"tx1","currency":"BTC","status":"0","timestamp":"2019-04-16T02:00:00.000Z"}]`,
+		`[{"amount":"1","withdrawal_id":"67485","txid":"","currency":"ETH","status":"0","timestamp":"2019-04-16T02:00:00.000Z"}]`)
+	s := newFakeFundingServer(h)
+	defer s.Close()
+
+	w, err := NewFundingWatcher(s.client(), store)
+	require.True(t, err == nil, err)
+	var events []FundingEvent
+	w.OnEvent(func(e FundingEvent) { events = append(events, e) })
+	require.True(t, w.Poll() == nil)
+	require.Equal(t, 2, len(events))
+	assert.Equal(t, FUNDING_DEPOSIT, events[0].Kind)
+	assert.Equal(t, "tx1", events[0].Id)
+	assert.Equal(t, FUNDING_STATE_PENDING, events[0].State)
+	assert.Equal(t, "", events[0].PreviousState)
+	assert.Equal(t, "67485", events[1].Id)
+
+	events = nil
+	h.set(`[{"amount":"0.1","txid":"tx1","currency":"BTC","status":"1","timestamp":"2019-04-16T02:00:00.000Z"}]`,
+		`[{"amount":"1","withdrawal_id":"67485","txid":"","currency":"ETH","status":0,"timestamp":"2019-04-16T02:00:00.000Z"}]`)
+	require.True(t, w.Poll() == nil)
+	require.Equal(t, 1, len(events))
+	assert.Equal(t, FUNDING_STATE_CONFIRMING, events[0].State)
+	assert.Equal(t, FUNDING_STATE_PENDING, events[0].PreviousState)
+
+	// changes made while the watcher is down are reported once after the restart
+	h.set(`[{"amount":"0.1","txid":"tx1","currency":"BTC","status":"2","timestamp":"2019-04-16T02:00:00.000Z"}]`,
+		`[{"amount":"1","withdrawal_id":"67485","txid":"","currency":"ETH","status":"-2","timestamp":"2019-04-16T02:00:00.000Z"}]`)
+	restarted, err := NewFundingWatcher(s.client(), store)
+	require.True(t, err == nil, err)
+	events = nil
+	restarted.OnEvent(func(e FundingEvent) { events = append(events, e) })
+	require.True(t, restarted.Poll() == nil)
+	require.Equal(t, 2, len(events))
+	assert.Equal(t, FUNDING_STATE_CREDITED, events[0].State)
+	assert.Equal(t, "1", events[0].PreviousStatus)
+	assert.Equal(t, FUNDING_STATE_FAILED, events[1].State)
+
+	// final records which fell out of the history are dropped from the cursor
+	h.set(`[]`, `[]`)
+	require.True(t, restarted.Poll() == nil)
+	_, ok := restarted.Record(FUNDING_DEPOSIT, "tx1")
+	assert.False(t, ok)
+	cursor, err := store.Load()
+	require.True(t, err == nil, err)
+	assert.Equal(t, 0, len(cursor.Records))
+}
+
+func TestFundingWatcher_WaitDeposit(t *testing.T) {
+	h := &fakeFundingHistory{}
+	h.set(`[{"amount":"0.1","txid":"tx1","currency":"BTC","status":"0","timestamp":"2019-04-16T02:00:00.000Z"}]`, `[]`)
+	s := newFakeFundingServer(h)
+	defer s.Close()
+	w, err := NewFundingWatcher(s.client(), nil)
+	require.True(t, err == nil, err)
+	w.Start(10 * time.Millisecond)
+	defer w.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	r, err := w.WaitDeposit(ctx, "tx1")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, FUNDING_STATE_PENDING, r.State)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		h.set(`[{"amount":"0.1","txid":"tx1","currency":"BTC","status":"2","timestamp":"2019-04-16T02:00:00.000Z"}]`, `[]`)
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	r, err = w.WaitDeposit(ctx, "tx1")
+	require.True(t, err == nil, err)
+	assert.Equal(t, FUNDING_STATE_CREDITED, r.State)
+	assert.Equal(t, "0.1", r.Amount)
+}
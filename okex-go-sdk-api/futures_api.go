@@ -1,6 +1,8 @@
 package okex
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 )
@@ -228,8 +230,13 @@ func (client *Client) PostFuturesOrder(instrumentId, oType, price, size string,
 			params[k] = v
 		}
 	}
+	if err := client.Risk.CheckOrders(riskOrderOf(MARKET_FUTURES, instrumentId, params)); err != nil {
+		return nil, err
+	}
 
+	order := client.Orders.posting(MARKET_FUTURES, instrumentId, params)
 	_, err := client.Request(POST, FUTURES_ORDER, params, &r)
+	client.Orders.posted(r, err, order)
 	return &r, err
 }
 
@@ -588,6 +595,15 @@ POST/api/futures/v3/orders
 }
 */
 func (client *Client) PostFuturesOrders(instrumentId string, orderData []map[string]string, leverage string, optionalParams map[string]string) (*map[string]interface{}, error) {
+	riskOrders := []RiskOrder{}
+	for _, order := range orderData {
+		riskOrders = append(riskOrders, riskOrderOf(MARKET_FUTURES, instrumentId, order))
+	}
+	if err := client.Risk.CheckOrders(riskOrders...); err != nil {
+		return nil, err
+	}
+
+	orderData, orders := client.Orders.postingAll(MARKET_FUTURES, instrumentId, orderData)
 	var batchNewOrderResult map[string]interface{}
 	params := map[string]interface{}{}
 	params["orders_data"] = orderData
@@ -603,6 +619,7 @@ func (client *Client) PostFuturesOrders(instrumentId string, orderData []map[str
 	}
 
 	_, err := client.Request(POST, FUTURES_ORDERS, params, &batchNewOrderResult)
+	client.Orders.posted(batchNewOrderResult, err, orders...)
 	return &batchNewOrderResult, err
 }
 
@@ -719,3 +736,281 @@ func (client *Client) GetFuturesOrders(InstrumentId, state string, optionalParam
 	_, err := client.Request(GET, requestPath, nil, &ordersResult)
 	return ordersResult, err
 }
+
+/*
+委托策略下单
+提供止盈止损、跟踪委托、冰山委托和时间加权委托策略。
+
+限速规则：40次/2s
+HTTP请求
+POST /api/futures/v3/order_algo
+
+请求示例
+POST /api/futures/v3/order_algo{"instrument_id":"BTC-USD-190628","type":"1","order_type":"1","size":"1","trigger_price":"9000","algo_price":"9001","algo_type":"1"}
+*/
+func (client *Client) PostFuturesAlgoOrder(params *AlgoOrderParams) (*FuturesAlgoOrderResult, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	if err := client.Risk.CheckOrders(algoRiskOrder(MARKET_FUTURES, params)); err != nil {
+		return nil, err
+	}
+	r := FuturesAlgoOrderResult{}
+	if _, err := client.Request(POST, FUTURES_ORDER_ALGO, params, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+/*
+委托策略撤单
+根据指定的algo_id撤销某个合约的未完成策略委托，每次最多可撤10个。
+
+限速规则：20次/2s
+HTTP请求
+POST /api/futures/v3/cancel_algos
+
+请求示例
+POST /api/futures/v3/cancel_algos{"instrument_id":"BTC-USD-190628","algo_ids":["1600593327162368","1600593327162369"],"order_type":"1"}
+*/
+func (client *Client) CancelFuturesAlgoOrders(instrumentId string, orderType int, algoIds []string) (*FuturesCancelAlgoOrdersResult, error) {
+	params := CancelAlgoOrdersParams{InstrumentId: instrumentId, AlgoIds: algoIds, OrderType: Int2String(orderType)}
+	r := FuturesCancelAlgoOrdersResult{}
+	if _, err := client.Request(POST, FUTURES_CANCEL_ALGOS, params, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+/*
+获取委托单列表
+列出您当前所有的策略委托单，status和algo_id必填其一。
+
+限速规则：20次/2s
+HTTP请求
+GET /api/futures/v3/order_algo/<instrument_id>
+
+请求示例
+GET /api/futures/v3/order_algo/BTC-USD-190628?order_type=1&status=1&limit=20
+*/
+func (client *Client) GetFuturesAlgoOrders(instrumentId string, orderType int, optionalParams map[string]string) (*AlgoOrderList, error) {
+	params := NewParams()
+	params["order_type"] = Int2String(orderType)
+	for k, v := range optionalParams {
+		if len(v) > 0 {
+			params[k] = v
+		}
+	}
+	if params["status"] == "" && params["algo_id"] == "" {
+		return nil, errors.New("Request Parameter's not correct, status or algo_id is required.")
+	}
+
+	uri := BuildParams(GetInstrumentIdUri(FUTURES_INSTRUMENT_ORDER_ALGO_LIST, instrumentId), params)
+	r := AlgoOrderList{}
+	if _, err := client.Request(GET, uri, nil, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+/*
+市价全平
+按市价平掉某个合约一个方向的全部持仓。
+
+限速规则：2次/2s
+HTTP请求
+POST /api/futures/v3/close_position
+
+请求示例
+POST /api/futures/v3/close_position{"instrument_id":"BTC-USD-190628","direction":"long"}
+*/
+func (client *Client) PostFuturesClosePosition(instrumentId, direction string) (*FuturesClosePositionResult, error) {
+	params := FuturesClosePositionParams{}
+	params.ClosePositionData = []ClosePositionData{{InstrumentId: instrumentId, Direction: direction}}
+	return client.PostFuturesClosePositions(&params)
+}
+
+/*
+ Close all the positions given by params, one request per instrument and direction.
+ Every direction is checked before the first request, a bad entry closes nothing.
+ The result of every position is returned in ClosePositionInfo, Result.Result is false if any of them failed.
+*/
+func (client *Client) PostFuturesClosePositions(params *FuturesClosePositionParams) (*FuturesClosePositionResult, error) {
+	r := FuturesClosePositionResult{}
+	r.Result.Result = true
+	for _, data := range params.ClosePositionData {
+		if data.Direction != DIRECTION_LONG && data.Direction != DIRECTION_SHORT {
+			return &r, errors.New("Request Parameter's not correct, direction must be long or short.")
+		}
+	}
+	for _, data := range params.ClosePositionData {
+		closeData := ClosePositionData{InstrumentId: data.InstrumentId, Direction: data.Direction}
+		var info struct {
+			InstrumentId string      `json:"instrument_id"`
+			Direction    string      `json:"direction"`
+			Result       bool        `json:"result"`
+			ErrorCode    interface{} `json:"error_code"`
+			ErrorMessage string      `json:"error_message"`
+		}
+		if _, err := client.Request(POST, FUTURES_CLOSE_POSITION, closeData, &info); err != nil {
+			return &r, err
+		}
+		closeInfo := ClosePositionInfo{InstrumentId: data.InstrumentId, Direction: data.Direction, Result: info.Result}
+		if info.ErrorCode != nil {
+			closeInfo.ErrorCode = StringToInt64(fmt.Sprintf("%v", info.ErrorCode))
+		}
+		closeInfo.ErrorMessage = info.ErrorMessage
+		r.ClosePositionInfo = append(r.ClosePositionInfo, closeInfo)
+		r.Result.Result = r.Result.Result && info.Result
+	}
+	return &r, nil
+}
+
+/*
+ Close all the positions of an underlying at market price, eg: underlying = BTC-USD
+*/
+func (client *Client) PostFuturesClosePositionsByUnderlying(underlying string) (*FuturesClosePositionResult, error) {
+	var positions struct {
+		Holding [][]FuturesPositionBase `json:"holding"`
+	}
+	if _, err := client.Request(GET, FUTURES_POSITION, nil, &positions); err != nil {
+		return nil, err
+	}
+
+	params := FuturesClosePositionParams{}
+	for _, holdings := range positions.Holding {
+		for _, holding := range holdings {
+			if !strings.HasPrefix(holding.InstrumentId, underlying+"-") {
+				continue
+			}
+			if holding.LongQty > 0 {
+				params.ClosePositionData = append(params.ClosePositionData,
+					ClosePositionData{InstrumentId: holding.InstrumentId, Direction: DIRECTION_LONG})
+			}
+			if holding.ShortQty > 0 {
+				params.ClosePositionData = append(params.ClosePositionData,
+					ClosePositionData{InstrumentId: holding.InstrumentId, Direction: DIRECTION_SHORT})
+			}
+		}
+	}
+	return client.PostFuturesClosePositions(&params)
+}
+
+/*
+ Cancel all the unfinished orders of an instrument.
+ The orders are paged through GetFuturesOrders and cancelled by BatchCancelFuturesInstrumentOrders, 10 orders per request.
+*/
+func (client *Client) CancelAllFuturesInstrumentOrders(InstrumentId string) ([]FuturesBatchCancelInstrumentOrdersResult, error) {
+	var orderIds []string
+	optionalParams := NewParams()
+	optionalParams["limit"] = "100"
+	for {
+		orders, err := client.GetFuturesOrders(InstrumentId, Int2String(ORDER_STATE_UNFINISHED), optionalParams)
+		if err != nil {
+			return nil, err
+		}
+		orderInfo, _ := orders["order_info"].([]interface{})
+		for _, o := range orderInfo {
+			order, _ := o.(map[string]interface{})
+			if orderId, ok := order["order_id"].(string); ok && orderId != "" {
+				orderIds = append(orderIds, orderId)
+			}
+		}
+		if len(orderInfo) < 100 || len(orderIds) == 0 {
+			break
+		}
+		optionalParams["after"] = orderIds[len(orderIds)-1]
+	}
+
+	var results []FuturesBatchCancelInstrumentOrdersResult
+	for i := 0; i < len(orderIds); i += 10 {
+		upper := i + 10
+		if upper > len(orderIds) {
+			upper = len(orderIds)
+		}
+		ids, err := Struct2JsonString(orderIds[i:upper])
+		if err != nil {
+			return results, err
+		}
+		result, err := client.BatchCancelFuturesInstrumentOrders(InstrumentId, ids)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+/*
+修改订单
+修改未完成订单的价格或数量，通过order_id或client_oid指定订单。
+
+限速规则：40次/2s
+HTTP请求
+POST /api/futures/v3/amend_order/<instrument_id>
+
+请求示例
+POST /api/futures/v3/amend_order/BTC-USD-190628{"order_id":"2510789768709120","new_size":"2","request_id":"15627278964280001"}
+*/
+func (client *Client) PostFuturesAmendOrder(InstrumentId string, params *AmendOrderParams) (*AmendOrderResult, error) {
+	if err := params.prepare(); err != nil {
+		return nil, err
+	}
+	if err := client.Risk.CheckOrders(amendRiskOrder(MARKET_FUTURES, InstrumentId, params)); err != nil {
+		return nil, err
+	}
+	body := *params
+	body.InstrumentId = ""
+
+	r := AmendOrderResult{}
+	uri := GetInstrumentIdUri(FUTURES_AMEND_ORDER, InstrumentId)
+	if _, err := client.Request(POST, uri, body, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+/*
+批量修改订单
+修改某个合约的多个未完成订单，每次最多10个。
+
+限速规则：20次/2s
+HTTP请求
+POST /api/futures/v3/amend_batch_orders/<instrument_id>
+*/
+func (client *Client) PostFuturesAmendBatchOrders(InstrumentId string, orders []*AmendOrderParams) (*AmendBatchOrdersResult, error) {
+	params, err := newAmendBatchOrdersParams(orders)
+	if err != nil {
+		return nil, err
+	}
+	riskOrders := []RiskOrder{}
+	for _, order := range orders {
+		riskOrders = append(riskOrders, amendRiskOrder(MARKET_FUTURES, InstrumentId, order))
+	}
+	if err := client.Risk.CheckOrders(riskOrders...); err != nil {
+		return nil, err
+	}
+
+	r := AmendBatchOrdersResult{}
+	uri := GetInstrumentIdUri(FUTURES_AMEND_BATCH_ORDERS, InstrumentId)
+	if _, err := client.Request(POST, uri, params, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func newAmendBatchOrdersParams(orders []*AmendOrderParams) (*AmendBatchOrdersParams, error) {
+	if len(orders) == 0 || len(orders) > 10 {
+		return nil, errors.New("amend order: 1 to 10 orders are allowed per request")
+	}
+	params := AmendBatchOrdersParams{}
+	for _, order := range orders {
+		if err := order.prepare(); err != nil {
+			return nil, err
+		}
+		amendData := *order
+		amendData.InstrumentId = ""
+		params.AmendData = append(params.AmendData, &amendData)
+	}
+	return &params, nil
+}
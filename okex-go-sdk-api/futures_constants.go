@@ -27,6 +27,57 @@ const (
 	CLOSE_LONG  = 3
 	CLOSE_SHORT = 4
 
+	/*
+	 position direction
+	*/
+	DIRECTION_LONG  = "long"
+	DIRECTION_SHORT = "short"
+
+	/*
+	 contract alias, by delivery: the coming friday, the friday after, the end of the quarter and of the next one
+	*/
+	FUTURES_ALIAS_THIS_WEEK  = "this_week"
+	FUTURES_ALIAS_NEXT_WEEK  = "next_week"
+	FUTURES_ALIAS_QUARTER    = "quarter"
+	FUTURES_ALIAS_BI_QUARTER = "bi_quarter"
+
+	/*
+	 order state
+	*/
+	ORDER_STATE_FAILED           = -2
+	ORDER_STATE_CANCELED         = -1
+	ORDER_STATE_OPEN             = 0
+	ORDER_STATE_PARTIALLY_FILLED = 1
+	ORDER_STATE_FILLED           = 2
+	ORDER_STATE_ORDERING         = 3
+	ORDER_STATE_CANCELING        = 4
+	ORDER_STATE_UNFINISHED       = 6
+	ORDER_STATE_COMPLETED        = 7
+
+	/*
+	 algo order type
+	*/
+	ALGO_ORDER_TRIGGER = 1
+	ALGO_ORDER_TRAIL   = 2
+	ALGO_ORDER_ICEBERG = 3
+	ALGO_ORDER_TWAP    = 4
+
+	/*
+	 trigger order algo type: 1: limit 2: market
+	*/
+	ALGO_TYPE_LIMIT  = 1
+	ALGO_TYPE_MARKET = 2
+
+	/*
+	 algo order status
+	*/
+	ALGO_STATUS_PENDING   = 1
+	ALGO_STATUS_EFFECTIVE = 2
+	ALGO_STATUS_CANCELLED = 3
+	ALGO_STATUS_PARTIAL   = 4
+	ALGO_STATUS_PAUSED    = 5
+	ALGO_STATUS_FAILED    = 6
+
 	/*
 	 margin mode
 	*/
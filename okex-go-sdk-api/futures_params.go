@@ -1,5 +1,10 @@
 package okex
 
+import (
+	"errors"
+	"fmt"
+)
+
 /*
  OKEX futures contract api request params
  @author Tony Tian
@@ -45,10 +50,14 @@ type FuturesClosePositionParams struct {
 	ClosePositionData []ClosePositionData
 }
 
+/*
+ Direction: long or short, the whole position of the direction is closed at market price.
+*/
 type ClosePositionData struct {
 	InstrumentId string `json:"instrument_id"`
-	Type         string `json:"type"`
-	LeverRate    string `json:"lever_rate"`
+	Direction    string `json:"direction"`
+	Type         string `json:"type,omitempty"`
+	LeverRate    string `json:"lever_rate,omitempty"`
 }
 
 /*
@@ -64,3 +73,205 @@ type FuturesFillsParams struct {
 	OrderId      string `json:"order_id"`
 	InstrumentId string `json:"instrument_id"`
 }
+
+/*
+ Algo order of futures and swap, POST /api/futures/v3/order_algo or /api/swap/v3/order_algo.
+ Type: 1: open long 2: open short 3: close long 4: close short
+ OrderType: 1: trigger 2: trail 3: iceberg 4: time-weighted @see file: futures_constants.go
+ Only the fields of the given OrderType are sent, use the NewXxxAlgoOrder functions to fill them.
+*/
+type AlgoOrderParams struct {
+	InstrumentId string `json:"instrument_id"`
+	Type         string `json:"type"`
+	OrderType    string `json:"order_type"`
+	Size         string `json:"size"`
+
+	// trigger: trigger_price, algo_price, algo_type. trail: callback_rate, trigger_price
+	TriggerPrice string `json:"trigger_price,omitempty"`
+	AlgoPrice    string `json:"algo_price,omitempty"`
+	AlgoType     string `json:"algo_type,omitempty"`
+	CallbackRate string `json:"callback_rate,omitempty"`
+
+	// iceberg: algo_variance, avg_amount, price_limit
+	AlgoVariance string `json:"algo_variance,omitempty"`
+	AvgAmount    string `json:"avg_amount,omitempty"`
+	PriceLimit   string `json:"price_limit,omitempty"`
+
+	// time-weighted: sweep_range, sweep_ratio, single_limit, price_limit, time_interval
+	SweepRange   string `json:"sweep_range,omitempty"`
+	SweepRatio   string `json:"sweep_ratio,omitempty"`
+	SingleLimit  string `json:"single_limit,omitempty"`
+	TimeInterval string `json:"time_interval,omitempty"`
+}
+
+func newAlgoOrderParams(instrumentId string, oType, orderType int, size string) *AlgoOrderParams {
+	return &AlgoOrderParams{
+		InstrumentId: instrumentId,
+		Type:         Int2String(oType),
+		OrderType:    Int2String(orderType),
+		Size:         size,
+	}
+}
+
+/*
+ Trigger order, the order of algoPrice is placed once the last price reaches triggerPrice.
+ algoType: ALGO_TYPE_LIMIT or ALGO_TYPE_MARKET, algoPrice is ignored by market orders.
+*/
+func NewTriggerAlgoOrder(instrumentId string, oType int, size, triggerPrice, algoPrice string, algoType int) *AlgoOrderParams {
+	p := newAlgoOrderParams(instrumentId, oType, ALGO_ORDER_TRIGGER, size)
+	p.TriggerPrice = triggerPrice
+	p.AlgoPrice = algoPrice
+	p.AlgoType = Int2String(algoType)
+	return p
+}
+
+/*
+ Trailing stop order, callbackRate is the retracement ratio, eg: 0.01 for 1%.
+*/
+func NewTrailAlgoOrder(instrumentId string, oType int, size, callbackRate, triggerPrice string) *AlgoOrderParams {
+	p := newAlgoOrderParams(instrumentId, oType, ALGO_ORDER_TRAIL, size)
+	p.CallbackRate = callbackRate
+	p.TriggerPrice = triggerPrice
+	return p
+}
+
+/*
+ Iceberg order, avgAmount is the size of every single order.
+*/
+func NewIcebergAlgoOrder(instrumentId string, oType int, size, algoVariance, avgAmount, priceLimit string) *AlgoOrderParams {
+	p := newAlgoOrderParams(instrumentId, oType, ALGO_ORDER_ICEBERG, size)
+	p.AlgoVariance = algoVariance
+	p.AvgAmount = avgAmount
+	p.PriceLimit = priceLimit
+	return p
+}
+
+/*
+ Time-weighted order, a single order of at most singleLimit is placed every timeInterval seconds.
+*/
+func NewTwapAlgoOrder(instrumentId string, oType int, size, sweepRange, sweepRatio, singleLimit, priceLimit, timeInterval string) *AlgoOrderParams {
+	p := newAlgoOrderParams(instrumentId, oType, ALGO_ORDER_TWAP, size)
+	p.SweepRange = sweepRange
+	p.SweepRatio = sweepRatio
+	p.SingleLimit = singleLimit
+	p.PriceLimit = priceLimit
+	p.TimeInterval = timeInterval
+	return p
+}
+
+/*
+ Check the fields required by the OrderType.
+*/
+func (p *AlgoOrderParams) Validate() error {
+	if p == nil {
+		return errors.New("algo order: params is nil")
+	}
+	if p.InstrumentId == "" || p.Type == "" || p.Size == "" {
+		return errors.New("algo order: instrument_id, type and size are required")
+	}
+	var required map[string]string
+	switch p.OrderType {
+	case Int2String(ALGO_ORDER_TRIGGER):
+		required = map[string]string{"trigger_price": p.TriggerPrice, "algo_type": p.AlgoType}
+		if p.AlgoType == Int2String(ALGO_TYPE_LIMIT) {
+			required["algo_price"] = p.AlgoPrice
+		}
+	case Int2String(ALGO_ORDER_TRAIL):
+		required = map[string]string{"callback_rate": p.CallbackRate, "trigger_price": p.TriggerPrice}
+	case Int2String(ALGO_ORDER_ICEBERG):
+		required = map[string]string{"algo_variance": p.AlgoVariance, "avg_amount": p.AvgAmount, "price_limit": p.PriceLimit}
+	case Int2String(ALGO_ORDER_TWAP):
+		required = map[string]string{"sweep_range": p.SweepRange, "sweep_ratio": p.SweepRatio,
+			"single_limit": p.SingleLimit, "price_limit": p.PriceLimit, "time_interval": p.TimeInterval}
+	default:
+		return fmt.Errorf("algo order: illegal order_type %s", p.OrderType)
+	}
+	for k, v := range required {
+		if v == "" {
+			return fmt.Errorf("algo order: %s is required by order_type %s", k, p.OrderType)
+		}
+	}
+	return nil
+}
+
+/*
+ Cancel algo orders of an instrument, at most 10 algo ids per request.
+*/
+type CancelAlgoOrdersParams struct {
+	InstrumentId string   `json:"instrument_id"`
+	AlgoIds      []string `json:"algo_ids"`
+	OrderType    string   `json:"order_type"`
+}
+
+/*
+ Amend an unfinished order of spot, futures or swap, identified by OrderId or ClientOid.
+ At least one of NewPrice and NewSize is required. CancelOnFail: 0: keep the order 1: cancel the order if the amendment failed.
+ RequestId is generated on the first request and kept, so the same params can be resent without amending twice.
+  eg: NewAmendOrderById("2510789768709120").WithPrice("9000").WithCancelOnFail(true)
+*/
+type AmendOrderParams struct {
+	InstrumentId string `json:"instrument_id,omitempty"`
+	OrderId      string `json:"order_id,omitempty"`
+	ClientOid    string `json:"client_oid,omitempty"`
+	NewPrice     string `json:"new_price,omitempty"`
+	NewSize      string `json:"new_size,omitempty"`
+	CancelOnFail string `json:"cancel_on_fail,omitempty"`
+	RequestId    string `json:"request_id,omitempty"`
+}
+
+func NewAmendOrderById(orderId string) *AmendOrderParams {
+	return &AmendOrderParams{OrderId: orderId}
+}
+
+func NewAmendOrderByClientOid(clientOid string) *AmendOrderParams {
+	return &AmendOrderParams{ClientOid: clientOid}
+}
+
+func (p *AmendOrderParams) WithPrice(newPrice string) *AmendOrderParams {
+	p.NewPrice = newPrice
+	return p
+}
+
+func (p *AmendOrderParams) WithSize(newSize string) *AmendOrderParams {
+	p.NewSize = newSize
+	return p
+}
+
+func (p *AmendOrderParams) WithCancelOnFail(cancelOnFail bool) *AmendOrderParams {
+	p.CancelOnFail = T3O(cancelOnFail, "1", "0").(string)
+	return p
+}
+
+func (p *AmendOrderParams) WithRequestId(requestId string) *AmendOrderParams {
+	p.RequestId = requestId
+	return p
+}
+
+/*
+ Check the params and set a new RequestId if not set.
+*/
+func (p *AmendOrderParams) prepare() error {
+	if p == nil {
+		return errors.New("amend order: params is nil")
+	}
+	if (p.OrderId == "") == (p.ClientOid == "") {
+		return errors.New("amend order: one of order_id and client_oid is required")
+	}
+	if p.NewPrice == "" && p.NewSize == "" {
+		return errors.New("amend order: new_price or new_size is required")
+	}
+	if p.CancelOnFail != "" && p.CancelOnFail != "0" && p.CancelOnFail != "1" {
+		return fmt.Errorf("amend order: illegal cancel_on_fail %s", p.CancelOnFail)
+	}
+	if p.RequestId == "" {
+		p.RequestId = NewRequestId()
+	}
+	return nil
+}
+
+/*
+ AmendData: at most 10 orders per request.
+*/
+type AmendBatchOrdersParams struct {
+	AmendData []*AmendOrderParams `json:"amend_data"`
+}
@@ -7,6 +7,8 @@ package okex
  @version 1.0.0
 */
 
+import "encoding/json"
+
 type ServerTime struct {
 	Iso   string `json:"iso"`
 	Epoch string `json:"epoch"`
@@ -214,6 +216,8 @@ type FuturesClosePositionResult struct {
 
 type ClosePositionInfo struct {
 	InstrumentId string `json:"instrument_id"`
+	Direction    string `json:"direction"`
+	Result       bool   `json:"result"`
 	CodeMessage
 }
 
@@ -270,6 +274,7 @@ type FuturesInstrumentsResult struct {
 	Listing         string  `json:"listing"`
 	Delivery        string  `json:"delivery"`
 	TradeIncrement  float64 `json:"trade_increment,string"`
+	Alias           string  `json:"alias"`
 }
 
 type FuturesInstrumentCurrenciesResult struct {
@@ -340,3 +345,109 @@ type FuturesInstrumentLiquidationResult struct {
 	Loss         float64 `json:"loss"`
 	CreatedAt    string  `json:"created_at"`
 }
+
+type FuturesAlgoOrderResult struct {
+	BizWarmTips
+	Result
+	AlgoId       string `json:"algo_id"`
+	InstrumentId string `json:"instrument_id"`
+	OrderType    string `json:"order_type"`
+	ErrorCode    string `json:"error_code"`
+	ErrorMessage string `json:"error_message"`
+}
+
+type FuturesCancelAlgoOrdersResult struct {
+	BizWarmTips
+	Result
+	AlgoIds      []string `json:"algo_ids"`
+	InstrumentId string   `json:"instrument_id"`
+	ErrorCode    string   `json:"error_code"`
+	ErrorMessage string   `json:"error_message"`
+}
+
+/*
+ Algo order of futures and swap, returned by the order_algo list api and pushed by the order_algo channels.
+ Status: @see ALGO_STATUS_* in file: futures_constants.go
+*/
+type AlgoOrderInfo struct {
+	AlgoId       string `json:"algo_id"`
+	InstrumentId string `json:"instrument_id"`
+	OrderType    string `json:"order_type"`
+	Type         string `json:"type"`
+	Size         string `json:"size"`
+	Status       string `json:"status"`
+	Leverage     string `json:"leverage"`
+	Timestamp    string `json:"timestamp"`
+	CreatedAt    string `json:"created_at"`
+	OrderId      string `json:"order_id"`
+	RealAmount   string `json:"real_amount"`
+	RealPrice    string `json:"real_price"`
+	TriggerPrice string `json:"trigger_price"`
+	AlgoPrice    string `json:"algo_price"`
+	AlgoType     string `json:"algo_type"`
+	CallbackRate string `json:"callback_rate"`
+	AlgoVariance string `json:"algo_variance"`
+	AvgAmount    string `json:"avg_amount"`
+	PriceLimit   string `json:"price_limit"`
+	SweepRange   string `json:"sweep_range"`
+	SweepRatio   string `json:"sweep_ratio"`
+	SingleLimit  string `json:"single_limit"`
+	TimeInterval string `json:"time_interval"`
+	DealValue    string `json:"deal_value"`
+}
+
+type AlgoOrderList struct {
+	BizWarmTips
+	Orders []AlgoOrderInfo `json:"orderStrategyVOS"`
+}
+
+/*
+Result of the amend endpoints of spot, futures and swap. The swap api returns result as a string,
+eg: "result":"true", the others as a boolean.
+*/
+type AmendOrderResult struct {
+	BizWarmTips
+	OrderId      string `json:"order_id"`
+	ClientOid    string `json:"client_oid"`
+	RequestId    string `json:"request_id"`
+	Result       bool   `json:"result"`
+	ErrorCode    string `json:"error_code"`
+	ErrorMessage string `json:"error_message"`
+}
+
+func (r *AmendOrderResult) UnmarshalJSON(data []byte) error {
+	type plain AmendOrderResult
+	raw := struct {
+		*plain
+		Result interface{} `json:"result"`
+	}{plain: (*plain)(r)}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	r.Result = resultFlag(raw.Result)
+	return nil
+}
+
+type AmendBatchOrdersResult struct {
+	BizWarmTips
+	Result    bool               `json:"result"`
+	AmendInfo []AmendOrderResult `json:"amend_info"`
+}
+
+func (r *AmendBatchOrdersResult) UnmarshalJSON(data []byte) error {
+	type plain AmendBatchOrdersResult
+	raw := struct {
+		*plain
+		Result interface{} `json:"result"`
+	}{plain: (*plain)(r)}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	r.Result = resultFlag(raw.Result)
+	return nil
+}
+
+// result of a response, true or "true"
+func resultFlag(v interface{}) bool {
+	return v == true || v == "true"
+}
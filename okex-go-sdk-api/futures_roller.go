@@ -0,0 +1,465 @@
+package okex
+
+/*
+ FuturesRoller resolves the aliases of the futures (this_week, next_week, quarter, bi_quarter) to
+ the instrument ids listed by GetFuturesInstruments, so that a config names BTC-USD-quarter instead
+ of BTC-USD-190628 and survives the deliveries.
+
+ Poll reloads the contracts and passes a DeliveryEvent to the OnDelivery callbacks every time a
+ contract reaches one of Leads before its delivery. With AutoRoll the positions of a contract are
+ rolled RollBefore its delivery: closed at the best price and, once the close order filled, opened
+ again in the contract delivered next, or in the RollInto contract. A close order not filled in
+ time is canceled and the part filled is opened again. A roll failed is tried again by the next
+ Poll, the open orders failed first.
+
+	roller := NewFuturesRoller(client)
+	roller.OnDelivery(func(event DeliveryEvent) { ... })
+	roller.AutoRoll = true
+	roller.Start(time.Minute)
+	instrumentId, err := roller.ResolveInstrumentId("BTC-USD-quarter")
+*/
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ERR_FUTURES_ALIAS       = errors.New(`futures roller: no contract of the alias`)
+	ERR_FUTURES_CONTRACT    = errors.New(`futures roller: unknown contract`)
+	ERR_FUTURES_ROLL_TARGET = errors.New(`futures roller: no later contract to roll into`)
+	ERR_FUTURES_NOT_FILLED  = errors.New(`futures roller: close order not filled`)
+)
+
+/*
+A contract reaching Lead before its delivery, Next is the contract its positions are rolled into,
+empty when the underlying has no later contract.
+*/
+type DeliveryEvent struct {
+	FuturesContract
+	Next           FuturesContract
+	Lead           time.Duration
+	TimeToDelivery time.Duration
+}
+
+/*
+A position rolled from a contract into another, the size of the close order filled is opened
+again. Err is the error of the first order failed or of the close order not filled. A retried open
+order has no CloseOrderId.
+*/
+type FuturesRoll struct {
+	From         string
+	To           string
+	Direction    string // DIRECTION_LONG or DIRECTION_SHORT
+	Size         float64
+	Closed       float64 // size of the close order filled, opened again
+	CloseOrderId string
+	OpenOrderId  string
+	Err          error
+}
+
+type FuturesRoller struct {
+	// Time before the delivery a DeliveryEvent is passed, for each lead.
+	Leads []time.Duration
+	// Roll the positions of a contract RollBefore its delivery in Poll.
+	AutoRoll   bool
+	RollBefore time.Duration
+	// Alias of the contract rolled into, the contract delivered next when empty.
+	RollInto string
+	// Leverage of the orders, the leverage of the account when empty.
+	Leverage string
+	// How long a close order is waited for to fill, and the delay between its checks.
+	FillTimeout time.Duration
+	FillCheck   time.Duration
+	// Clock, time.Now by default.
+	Now func() time.Time
+
+	client *Client
+
+	lock        sync.Mutex
+	contracts   map[string]FuturesContract // instrument id ->
+	announced   map[string]bool            // instrument id:lead
+	rolled      map[string]bool            // instrument id
+	rolling     map[string]bool            // instrument id
+	reopens     map[string][]FuturesRoll   // instrument id -> the rolls closed but not opened again
+	deliveryCbs []func(DeliveryEvent)
+	rollCbs     []func(FuturesRoll)
+
+	poller poller
+}
+
+func NewFuturesRoller(client *Client) *FuturesRoller {
+	return &FuturesRoller{
+		Leads:       []time.Duration{24 * time.Hour, time.Hour},
+		RollBefore:  30 * time.Minute,
+		FillTimeout: time.Minute,
+		FillCheck:   time.Second,
+		Now:         time.Now,
+		client:      client,
+		contracts:   map[string]FuturesContract{},
+		announced:   map[string]bool{},
+		rolled:      map[string]bool{},
+		rolling:     map[string]bool{},
+		reopens:     map[string][]FuturesRoll{},
+	}
+}
+
+/*
+Register a callback for the deliveries coming, callbacks run outside the roller lock.
+*/
+func (r *FuturesRoller) OnDelivery(cb func(DeliveryEvent)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.deliveryCbs = append(r.deliveryCbs, cb)
+}
+
+/*
+Register a callback for the positions rolled, by Roll or by Poll with AutoRoll.
+*/
+func (r *FuturesRoller) OnRoll(cb func(FuturesRoll)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.rollCbs = append(r.rollCbs, cb)
+}
+
+/*
+Load the futures contracts and their alias, replacing the delivered ones.
+*/
+func (r *FuturesRoller) Refresh() error {
+	instruments, err := r.client.GetFuturesInstruments()
+	if err != nil {
+		return err
+	}
+	contracts := futuresContracts(instruments)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.contracts = contracts
+	return nil
+}
+
+func (r *FuturesRoller) loaded() error {
+	r.lock.Lock()
+	empty := len(r.contracts) == 0
+	r.lock.Unlock()
+	if empty {
+		return r.Refresh()
+	}
+	return nil
+}
+
+/*
+The contracts of an underlying by delivery, eg: underlying = BTC-USD
+*/
+func (r *FuturesRoller) Contracts(underlying string) []FuturesContract {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.contractsOf(underlying)
+}
+
+func (r *FuturesRoller) contractsOf(underlying string) []FuturesContract {
+	cs := []FuturesContract{}
+	for _, c := range r.contracts {
+		if c.Underlying == underlying {
+			cs = append(cs, c)
+		}
+	}
+	sort.Slice(cs, func(i, j int) bool { return cs[i].Delivery.Before(cs[j].Delivery) })
+	return cs
+}
+
+/*
+Instrument id of the contract of an underlying by alias, the contracts are loaded on first use.
+
+	eg: Resolve("BTC-USD", FUTURES_ALIAS_QUARTER) = "BTC-USD-190628"
+*/
+func (r *FuturesRoller) Resolve(underlying, alias string) (string, error) {
+	if err := r.loaded(); err != nil {
+		return "", err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, c := range r.contracts {
+		if c.Underlying == underlying && c.Alias == alias {
+			return c.InstrumentId, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s %s", ERR_FUTURES_ALIAS, underlying, alias)
+}
+
+/*
+Instrument id of an id ending with an alias, other ids are returned unchanged.
+
+	eg: ResolveInstrumentId("BTC-USD-this_week") = "BTC-USD-190419"
+	    ResolveInstrumentId("BTC-USD-190628") = "BTC-USD-190628"
+*/
+func (r *FuturesRoller) ResolveInstrumentId(instrumentId string) (string, error) {
+	for _, alias := range futuresAliases {
+		if strings.HasSuffix(instrumentId, "-"+alias) {
+			return r.Resolve(strings.TrimSuffix(instrumentId, "-"+alias), alias)
+		}
+	}
+	return instrumentId, nil
+}
+
+/*
+Contract the positions of a contract are rolled into: the RollInto contract when it is delivered
+later, the contract delivered next otherwise.
+*/
+func (r *FuturesRoller) rollTarget(c FuturesContract) (FuturesContract, bool) {
+	var next FuturesContract
+	for _, n := range r.contractsOf(c.Underlying) {
+		if !n.Delivery.After(c.Delivery) {
+			continue
+		}
+		if r.RollInto != "" && n.Alias == r.RollInto {
+			return n, true
+		}
+		if next.InstrumentId == "" {
+			next = n
+		}
+	}
+	return next, next.InstrumentId != ""
+}
+
+/*
+Reload the contracts, pass the deliveries reaching a lead and, with AutoRoll, roll the positions of
+the contracts delivered within RollBefore. A contract is rolled once, when a roll fails it is tried
+again by the next Poll.
+*/
+func (r *FuturesRoller) Poll() error {
+	if err := r.Refresh(); err != nil {
+		return err
+	}
+	now := r.Now()
+
+	var events []DeliveryEvent
+	var rolls []string
+	r.lock.Lock()
+	ids := make([]string, 0, len(r.contracts))
+	for id := range r.contracts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		c := r.contracts[id]
+		left := c.Delivery.Sub(now)
+		if left <= 0 {
+			continue
+		}
+		next, _ := r.rollTarget(c)
+		for _, lead := range r.Leads {
+			key := fmt.Sprintf("%s:%v", id, lead)
+			if left <= lead && !r.announced[key] {
+				r.announced[key] = true
+				events = append(events, DeliveryEvent{FuturesContract: c, Next: next, Lead: lead, TimeToDelivery: left})
+			}
+		}
+		if r.AutoRoll && left <= r.RollBefore && !r.rolled[id] && !r.rolling[id] {
+			r.rolling[id] = true
+			rolls = append(rolls, id)
+		}
+	}
+	cbs := r.deliveryCbs
+	r.lock.Unlock()
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Lead > events[j].Lead })
+	for _, e := range events {
+		for _, cb := range cbs {
+			cb(e)
+		}
+	}
+
+	var failed error
+	for _, id := range rolls {
+		_, err := r.Roll(id)
+		r.lock.Lock()
+		delete(r.rolling, id)
+		r.rolled[id] = err == nil
+		r.lock.Unlock()
+		if err != nil && failed == nil {
+			failed = err
+		}
+	}
+	return failed
+}
+
+/*
+Roll the available positions of a contract into the contract delivered next, or the RollInto
+contract: each side is closed at the best price and, once the close order filled, opened again
+with the size filled. The open orders failed by an earlier roll of the contract are placed first.
+*/
+func (r *FuturesRoller) Roll(instrumentId string) ([]FuturesRoll, error) {
+	if err := r.loaded(); err != nil {
+		return nil, err
+	}
+	r.lock.Lock()
+	c, ok := r.contracts[instrumentId]
+	var to FuturesContract
+	if ok {
+		to, ok = r.rollTarget(c)
+		if !ok {
+			r.lock.Unlock()
+			return nil, ERR_FUTURES_ROLL_TARGET
+		}
+	}
+	cbs := r.rollCbs
+	r.lock.Unlock()
+	if !ok {
+		return nil, ERR_FUTURES_CONTRACT
+	}
+
+	var position struct {
+		Holding []FuturesPositionBase `json:"holding"`
+	}
+	if _, err := r.client.Request(GET, GetInstrumentIdUri(FUTURES_INSTRUMENT_POSITION, instrumentId), nil, &position); err != nil {
+		return nil, err
+	}
+
+	rolls := []FuturesRoll{}
+	var failed error
+	// the positions closed by a roll failed are not in the contract any more, their open orders
+	// are retried as they were
+	r.lock.Lock()
+	reopens := r.reopens[instrumentId]
+	delete(r.reopens, instrumentId)
+	r.lock.Unlock()
+	for _, roll := range reopens {
+		open := OPEN_LONG
+		if roll.Direction == DIRECTION_SHORT {
+			open = OPEN_SHORT
+		}
+		roll.CloseOrderId = ""
+		roll.OpenOrderId, roll.Err = r.order(roll.To, open, roll.Closed)
+		if roll.Err != nil {
+			r.pending(roll)
+			if failed == nil {
+				failed = roll.Err
+			}
+		}
+		rolls = append(rolls, roll)
+	}
+
+	for _, h := range position.Holding {
+		if h.InstrumentId != "" && h.InstrumentId != instrumentId {
+			continue
+		}
+		for _, side := range []struct {
+			direction   string
+			size        float64
+			close, open int
+		}{
+			{DIRECTION_LONG, h.LongAvailQty, CLOSE_LONG, OPEN_LONG},
+			{DIRECTION_SHORT, h.ShortAvailQty, CLOSE_SHORT, OPEN_SHORT},
+		} {
+			if side.size <= 0 {
+				continue
+			}
+			roll := FuturesRoll{From: instrumentId, To: to.InstrumentId, Direction: side.direction, Size: side.size}
+			roll.CloseOrderId, roll.Err = r.order(instrumentId, side.close, side.size)
+			if roll.Err == nil {
+				roll.Closed, roll.Err = r.waitFilled(instrumentId, roll.CloseOrderId)
+			}
+			if roll.Closed > 0 {
+				var err error
+				if roll.OpenOrderId, err = r.order(to.InstrumentId, side.open, roll.Closed); err != nil {
+					roll.Err = err
+					r.pending(roll)
+				}
+			}
+			if roll.Err != nil && failed == nil {
+				failed = roll.Err
+			}
+			rolls = append(rolls, roll)
+		}
+	}
+
+	for _, roll := range rolls {
+		for _, cb := range cbs {
+			cb(roll)
+		}
+	}
+	return rolls, failed
+}
+
+/*
+Place an order at the best price, returns its order id.
+*/
+func (r *FuturesRoller) order(instrumentId string, oType int, size float64) (string, error) {
+	optionalParams := map[string]string{"match_price": "1"}
+	if r.Leverage != "" {
+		optionalParams["leverage"] = r.Leverage
+	}
+	result, err := r.client.PostFuturesOrder(instrumentId, Int2String(oType), "", strconv.FormatFloat(size, 'f', -1, 64), optionalParams)
+	if err != nil {
+		return "", err
+	}
+	orderId, _ := (*result)["order_id"].(string)
+	if orderId == "" || orderId == "-1" {
+		return "", fmt.Errorf("futures roller: order of %s failed: %v", instrumentId, (*result)["error_message"])
+	}
+	return orderId, nil
+}
+
+// keep a roll closed but not opened again for the next roll of its contract
+func (r *FuturesRoller) pending(roll FuturesRoll) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.reopens[roll.From] = append(r.reopens[roll.From], roll)
+}
+
+/*
+Wait for an order to fill, checking its state every FillCheck for FillTimeout at most, returns the
+size filled. An order still open after FillTimeout is canceled, the size filled is read after the
+cancel.
+*/
+func (r *FuturesRoller) waitFilled(instrumentId, orderId string) (float64, error) {
+	deadline := time.Now().Add(r.FillTimeout)
+	for {
+		order, err := r.client.GetFuturesOrder(instrumentId, orderId)
+		if err != nil {
+			return 0, err
+		}
+		switch StringToInt(order["state"]) {
+		case ORDER_STATE_FILLED:
+			return toFloat(order["filled_qty"]), nil
+		case ORDER_STATE_CANCELED, ORDER_STATE_FAILED:
+			return toFloat(order["filled_qty"]), fmt.Errorf("%w: %s %s is %s", ERR_FUTURES_NOT_FILLED, instrumentId, orderId, order["state"])
+		}
+		if !time.Now().Add(r.FillCheck).Before(deadline) {
+			break
+		}
+		time.Sleep(r.FillCheck)
+	}
+
+	// the cancel fails when the order filled meanwhile, its state tells
+	_, cancelErr := r.client.CancelFuturesInstrumentOrder(instrumentId, orderId)
+	order, err := r.client.GetFuturesOrder(instrumentId, orderId)
+	if err != nil {
+		return 0, err
+	}
+	filled := toFloat(order["filled_qty"])
+	if StringToInt(order["state"]) == ORDER_STATE_FILLED {
+		return filled, nil
+	}
+	if cancelErr != nil {
+		return filled, fmt.Errorf("%w: %s %s after %v, cancel failed: %v", ERR_FUTURES_NOT_FILLED, instrumentId, orderId, r.FillTimeout, cancelErr)
+	}
+	return filled, fmt.Errorf("%w: %s %s after %v", ERR_FUTURES_NOT_FILLED, instrumentId, orderId, r.FillTimeout)
+}
+
+/*
+Poll now and then every interval until Stop is called, the failed polls are logged.
+*/
+func (r *FuturesRoller) Start(interval time.Duration) {
+	r.poller.start("futures roller: poll", interval, true, r.Poll)
+}
+
+func (r *FuturesRoller) Stop() {
+	r.poller.stop()
+}
@@ -0,0 +1,165 @@
+package okex
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const rollerInstruments = `[
+	{"instrument_id":"BTC-USD-190419","underlying_index":"BTC","quote_currency":"USD","contract_val":"100","delivery":"2019-04-19","alias":"this_week"},
+	{"instrument_id":"BTC-USD-190426","underlying_index":"BTC","quote_currency":"USD","contract_val":"100","delivery":"2019-04-26","alias":"next_week"},
+	{"instrument_id":"BTC-USD-190628","underlying_index":"BTC","quote_currency":"USD","contract_val":"100","delivery":"2019-06-28","alias":"quarter"},
+	{"instrument_id":"BTC-USD-190927","underlying_index":"BTC","quote_currency":"USD","contract_val":"100","delivery":"2019-09-27","alias":"bi_quarter"}]`
+
+func TestFuturesRoller_Resolve(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handle(GET, FUTURES_INSTRUMENTS, rollerInstruments)
+	r := NewFuturesRoller(s.client())
+
+	id, err := r.ResolveInstrumentId("BTC-USD-quarter")
+	require.True(t, err == nil, err)
+	assert.Equal(t, "BTC-USD-190628", id)
+	id, err = r.ResolveInstrumentId("BTC-USD-190426")
+	require.True(t, err == nil, err)
+	assert.Equal(t, "BTC-USD-190426", id)
+	id, err = r.Resolve("BTC-USD", FUTURES_ALIAS_BI_QUARTER)
+	require.True(t, err == nil, err)
+	assert.Equal(t, "BTC-USD-190927", id)
+	_, err = r.ResolveInstrumentId("ETH-USD-this_week")
+	assert.True(t, errors.Is(err, ERR_FUTURES_ALIAS), err)
+	assert.Equal(t, 1, len(s.requestsTo(GET, FUTURES_INSTRUMENTS)))
+	assert.Equal(t, 4, len(r.Contracts("BTC-USD")))
+}
+
+func TestFuturesRoller_DeliveryAndRoll(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handle(GET, FUTURES_INSTRUMENTS, rollerInstruments)
+	s.handle(GET, "/api/futures/v3/BTC-USD-190419/position", `{"result":true,"margin_mode":"crossed","holding":[
+		{"instrument_id":"BTC-USD-190419","long_qty":"3","long_avail_qty":"2","short_qty":"1","short_avail_qty":"1"}]}`)
+	s.handle(GET, "/api/futures/v3/BTC-USD-190426/position", `{"result":true,"margin_mode":"crossed","holding":[]}`)
+	s.handle(GET, "/api/futures/v3/orders/BTC-USD-190419/BTC-USD-190419:3", `{"order_id":"BTC-USD-190419:3","state":"2","filled_qty":"2"}`)
+	s.handle(GET, "/api/futures/v3/orders/BTC-USD-190419/BTC-USD-190419:4", `{"order_id":"BTC-USD-190419:4","state":"2","filled_qty":"1"}`)
+	failShort := true
+	s.handleFunc(POST, FUTURES_ORDER, func(req fakeRequest) string {
+		params := map[string]string{}
+		JsonString2Struct(req.Body, &params)
+		if failShort && params["instrument_id"] == "BTC-USD-190426" && params["type"] == "2" {
+			return `{"order_id":"-1","result":false,"error_code":"32015","error_message":"margin ratio is lower than 100%"}`
+		}
+		return `{"order_id":"` + params["instrument_id"] + `:` + params["type"] + `","result":true}`
+	})
+
+	now := time.Date(2019, 4, 18, 9, 0, 0, 0, time.UTC)
+	r := NewFuturesRoller(s.client())
+	r.Now = func() time.Time { return now }
+	r.AutoRoll = true
+	r.Leverage = "10"
+	events := []DeliveryEvent{}
+	r.OnDelivery(func(e DeliveryEvent) { events = append(events, e) })
+	rolls := []FuturesRoll{}
+	r.OnRoll(func(roll FuturesRoll) { rolls = append(rolls, roll) })
+
+	require.True(t, r.Poll() == nil)
+	require.Equal(t, 1, len(events))
+	assert.Equal(t, "BTC-USD-190419", events[0].InstrumentId)
+	assert.Equal(t, "BTC-USD-190426", events[0].Next.InstrumentId)
+	assert.Equal(t, 24*time.Hour, events[0].Lead)
+	assert.Equal(t, 23*time.Hour, events[0].TimeToDelivery)
+	assert.Equal(t, 0, len(s.requestsTo(POST, FUTURES_ORDER)))
+
+	now = time.Date(2019, 4, 19, 7, 40, 0, 0, time.UTC)
+	err := r.Poll()
+	require.True(t, err != nil)
+	require.Equal(t, 2, len(events))
+	assert.Equal(t, time.Hour, events[1].Lead)
+
+	require.Equal(t, 2, len(rolls))
+	assert.Equal(t, FuturesRoll{From: "BTC-USD-190419", To: "BTC-USD-190426", Direction: DIRECTION_LONG, Size: 2, Closed: 2,
+		CloseOrderId: "BTC-USD-190419:3", OpenOrderId: "BTC-USD-190426:1"}, rolls[0])
+	assert.Equal(t, "BTC-USD-190419:4", rolls[1].CloseOrderId)
+	assert.Equal(t, "", rolls[1].OpenOrderId)
+	assert.True(t, rolls[1].Err != nil)
+	orders := s.requestsTo(POST, FUTURES_ORDER)
+	require.Equal(t, 4, len(orders))
+	assert.Contains(t, orders[0].Body, `"match_price":"1"`)
+	assert.Contains(t, orders[0].Body, `"leverage":"10"`)
+	assert.Contains(t, orders[0].Body, `"size":"2"`)
+
+	// each close order filled before its new leg was opened
+	assert.Equal(t, 1, len(s.requestsTo(GET, "/api/futures/v3/orders/BTC-USD-190419/BTC-USD-190419:3")))
+	// the short was closed, only its open order is tried again
+	s.handle(GET, "/api/futures/v3/BTC-USD-190419/position", `{"result":true,"margin_mode":"crossed","holding":[
+		{"instrument_id":"BTC-USD-190419","long_qty":"1","long_avail_qty":"0","short_qty":"0","short_avail_qty":"0"}]}`)
+	failShort = false
+	require.True(t, r.Poll() == nil)
+	require.Equal(t, 3, len(rolls))
+	assert.Equal(t, FuturesRoll{From: "BTC-USD-190419", To: "BTC-USD-190426", Direction: DIRECTION_SHORT, Size: 1, Closed: 1,
+		OpenOrderId: "BTC-USD-190426:2"}, rolls[2])
+	orders = s.requestsTo(POST, FUTURES_ORDER)
+	require.Equal(t, 5, len(orders))
+	assert.Contains(t, orders[4].Body, `"size":"1"`)
+
+	// rolled once, announced once
+	require.True(t, r.Poll() == nil)
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, 5, len(s.requestsTo(POST, FUTURES_ORDER)))
+
+	r.RollInto = FUTURES_ALIAS_QUARTER
+	rs, err := r.Roll("BTC-USD-190426")
+	require.True(t, err == nil, err)
+	assert.Equal(t, 0, len(rs))
+	_, err = r.Roll("BTC-USD-190927")
+	assert.Equal(t, ERR_FUTURES_ROLL_TARGET, err)
+	_, err = r.Roll("BTC-USD-180101")
+	assert.Equal(t, ERR_FUTURES_CONTRACT, err)
+}
+
+func TestFuturesRoller_CloseNotFilled(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handle(GET, FUTURES_INSTRUMENTS, rollerInstruments)
+	s.handle(GET, "/api/futures/v3/BTC-USD-190419/position", `{"result":true,"margin_mode":"crossed","holding":[
+		{"instrument_id":"BTC-USD-190419","long_qty":"2","long_avail_qty":"2","short_qty":"3","short_avail_qty":"3"}]}`)
+	s.handleFunc(POST, FUTURES_ORDER, func(req fakeRequest) string {
+		params := map[string]string{}
+		JsonString2Struct(req.Body, &params)
+		return `{"order_id":"` + params["type"] + `","result":true}`
+	})
+	// the long close is canceled by the exchange unfilled, the short close fills 1 of 3 and stays
+	// open until canceled
+	s.handle(GET, "/api/futures/v3/orders/BTC-USD-190419/3", `{"order_id":"3","state":"-1","filled_qty":"0"}`)
+	s.handle(GET, "/api/futures/v3/orders/BTC-USD-190419/4", `{"order_id":"4","state":"1","filled_qty":"1"}`)
+	s.handleFunc(POST, "/api/futures/v3/cancel_order/BTC-USD-190419/4", func(req fakeRequest) string {
+		s.handle(GET, "/api/futures/v3/orders/BTC-USD-190419/4", `{"order_id":"4","state":"-1","filled_qty":"1"}`)
+		return `{"result":true,"order_id":"4","instrument_id":"BTC-USD-190419"}`
+	})
+
+	r := NewFuturesRoller(s.client())
+	r.FillTimeout = 30 * time.Millisecond
+	r.FillCheck = 10 * time.Millisecond
+	rolls, err := r.Roll("BTC-USD-190419")
+	assert.True(t, errors.Is(err, ERR_FUTURES_NOT_FILLED), err)
+	require.Equal(t, 2, len(rolls))
+	for _, roll := range rolls {
+		assert.True(t, errors.Is(roll.Err, ERR_FUTURES_NOT_FILLED), roll.Err)
+	}
+	assert.Equal(t, 0.0, rolls[0].Closed)
+	assert.Equal(t, "", rolls[0].OpenOrderId)
+	assert.Equal(t, 1, len(s.requestsTo(GET, "/api/futures/v3/orders/BTC-USD-190419/3")))
+
+	// the short close was canceled after the timeout and its filled part opened again
+	assert.Equal(t, 1, len(s.requestsTo(POST, "/api/futures/v3/cancel_order/BTC-USD-190419/4")))
+	assert.Equal(t, 1.0, rolls[1].Closed)
+	assert.Equal(t, "2", rolls[1].OpenOrderId)
+	orders := s.requestsTo(POST, FUTURES_ORDER)
+	require.Equal(t, 3, len(orders))
+	assert.Contains(t, orders[2].Body, `"instrument_id":"BTC-USD-190426"`)
+	assert.Contains(t, orders[2].Body, `"type":"2"`)
+	assert.Contains(t, orders[2].Body, `"size":"1"`)
+}
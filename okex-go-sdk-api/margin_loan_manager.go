@@ -0,0 +1,347 @@
+package okex
+
+/*
+ MarginLoanManager keeps track of the outstanding margin loans. Interest is accrued locally from
+ the daily rate of every loan, hour by hour on the principal outstanding at the start of the hour,
+ repayments go by borrow_id or oldest loan first,
+ borrows are sized against the account availability and free balance can be repaid automatically.
+*/
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	/*
+	 borrow record status: 0: outstanding 1: repaid
+	*/
+	MARGIN_LOAN_STATUS_OUTSTANDING = "0"
+	MARGIN_LOAN_STATUS_REPAID      = "1"
+)
+
+var (
+	ERR_MARGIN_LOAN_NOT_FOUND    = errors.New(`margin loan: borrow_id not found among the outstanding loans`)
+	ERR_MARGIN_LOAN_AMOUNT       = errors.New(`margin loan: amount must be greater than 0`)
+	ERR_MARGIN_LOAN_AVAILABILITY = errors.New(`margin loan: amount exceeds the available borrowing limit`)
+)
+
+type MarginLoan struct {
+	BorrowId     string
+	InstrumentId string
+	Currency     string
+	Amount       float64 // borrowed principal
+	Returned     float64 // principal repaid so far
+	Rate         float64 // daily interest rate
+	PaidInterest float64
+	CreatedAt    time.Time
+	// Interest charged by the exchange and not paid yet, until InterestTime.
+	ChargedInterest float64
+	InterestTime    time.Time
+	// Interest not paid yet: the charged interest and every started hour since InterestTime,
+	// or since created_at when the exchange does not return last_interest_time.
+	AccruedInterest float64
+}
+
+func (l *MarginLoan) Outstanding() float64 {
+	return l.Amount - l.Returned
+}
+
+/*
+Principal and accrued interest needed to close the loan.
+*/
+func (l *MarginLoan) Due() float64 {
+	return l.Outstanding() + l.AccruedInterest
+}
+
+/*
+Principal repaid through the manager at a time, a repayment pays the accrued interest first.
+*/
+type marginRepaid struct {
+	at        time.Time
+	principal float64
+}
+
+/*
+Interest of every started hour until now, on the principal outstanding at the start of the hour:
+the principal repaid later through the manager is still counted. The repayments made elsewhere
+are unknown, without InterestTime their principal is left out from created_at.
+*/
+func (l *MarginLoan) accrue(now time.Time, repaid []marginRepaid) {
+	start, interest := l.CreatedAt, -l.PaidInterest
+	if !l.InterestTime.IsZero() {
+		start, interest = l.InterestTime, l.ChargedInterest
+	}
+	hours := int(math.Ceil(now.Sub(start).Hours()))
+	if hours < 1 {
+		hours = 1
+	}
+	for h := 0; h < hours; h++ {
+		at := start.Add(time.Duration(h) * time.Hour)
+		principal := l.Outstanding()
+		for _, r := range repaid {
+			if r.at.After(at) {
+				principal += r.principal
+			}
+		}
+		interest += principal * l.Rate / 24
+	}
+	l.AccruedInterest = math.Max(interest, 0)
+}
+
+type MarginRepayment struct {
+	BorrowId string
+	Amount   float64
+	Result   map[string]interface{}
+}
+
+type autoRepayRule struct {
+	instrumentId string
+	currency     string
+	threshold    float64
+}
+
+type MarginLoanManager struct {
+	client *Client
+
+	lock   sync.Mutex
+	rules  []autoRepayRule
+	repaid map[string][]marginRepaid // borrow id ->
+
+	poller poller
+
+	now func() time.Time
+}
+
+func NewMarginLoanManager(client *Client) *MarginLoanManager {
+	return &MarginLoanManager{client: client, repaid: map[string][]marginRepaid{}, now: time.Now}
+}
+
+func formatMarginAmount(f float64) string {
+	return strconv.FormatFloat(math.Floor(f*1e8+0.5)/1e8, 'f', -1, 64)
+}
+
+func marginLoanOf(m map[string]interface{}) MarginLoan {
+	l := MarginLoan{
+		BorrowId:     anyToString(m["borrow_id"]),
+		InstrumentId: anyToString(m["instrument_id"]),
+		Currency:     strings.ToUpper(anyToString(m["currency"])),
+		Amount:       anyToFloat(m["amount"]),
+		Returned:     anyToFloat(m["returned_amount"]),
+		Rate:         anyToFloat(m["rate"]),
+		PaidInterest: anyToFloat(m["paid_interest"]),
+
+		ChargedInterest: anyToFloat(m["interest"]),
+	}
+	if created, err := IsoToTime(anyToString(m["created_at"])); err == nil {
+		l.CreatedAt = created
+	}
+	if charged, err := IsoToTime(anyToString(m["last_interest_time"])); err == nil {
+		l.InterestTime = charged
+	}
+	return l
+}
+
+/*
+Outstanding loans, oldest first. An empty instrumentId lists the loans of every pair,
+an empty currency those of both currencies of the pair.
+*/
+func (m *MarginLoanManager) Loans(instrumentId, currency string) ([]MarginLoan, error) {
+	params := NewParams()
+	params["status"] = MARGIN_LOAN_STATUS_OUTSTANDING
+	var records *[]map[string]interface{}
+	var err error
+	if instrumentId == "" {
+		records, err = m.client.GetMarginAccountsBorrowed(&params)
+	} else {
+		records, err = m.client.GetMarginAccountsBorrowedByInstrumentId(instrumentId, &params)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := m.now()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	loans := []MarginLoan{}
+	for _, r := range *records {
+		l := marginLoanOf(r)
+		if currency != "" && !strings.EqualFold(l.Currency, currency) {
+			continue
+		}
+		if l.Outstanding() <= 0 {
+			continue
+		}
+		l.accrue(now, m.repaid[l.BorrowId])
+		loans = append(loans, l)
+	}
+	sort.SliceStable(loans, func(i, j int) bool {
+		return loans[i].CreatedAt.Before(loans[j].CreatedAt)
+	})
+	return loans, nil
+}
+
+/*
+Repay one loan, an amount of 0 repays its principal and accrued interest in full.
+*/
+func (m *MarginLoanManager) Repay(instrumentId, borrowId string, amount float64) (*MarginRepayment, error) {
+	loans, err := m.Loans(instrumentId, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range loans {
+		if l.BorrowId != borrowId {
+			continue
+		}
+		if amount <= 0 || amount > l.Due() {
+			amount = l.Due()
+		}
+		return m.repay(l, amount)
+	}
+	return nil, ERR_MARGIN_LOAN_NOT_FOUND
+}
+
+func (m *MarginLoanManager) repay(l MarginLoan, amount float64) (*MarginRepayment, error) {
+	borrowId := l.BorrowId
+	r, err := m.client.PostMarginAccountsRepayment(l.InstrumentId, strings.ToLower(l.Currency), formatMarginAmount(amount), &borrowId)
+	if err != nil {
+		return nil, err
+	}
+	m.lock.Lock()
+	if amount >= l.Due() {
+		delete(m.repaid, l.BorrowId)
+	} else if principal := amount - l.AccruedInterest; principal > 0 {
+		m.repaid[l.BorrowId] = append(m.repaid[l.BorrowId], marginRepaid{m.now(), principal})
+	}
+	m.lock.Unlock()
+	return &MarginRepayment{BorrowId: l.BorrowId, Amount: amount, Result: *r}, nil
+}
+
+/*
+Spread amount over the outstanding loans of a currency, oldest loan first.
+*/
+func (m *MarginLoanManager) RepayOldestFirst(instrumentId, currency string, amount float64) ([]MarginRepayment, error) {
+	if amount <= 0 {
+		return nil, ERR_MARGIN_LOAN_AMOUNT
+	}
+	loans, err := m.Loans(instrumentId, currency)
+	if err != nil {
+		return nil, err
+	}
+	repayments := []MarginRepayment{}
+	for _, l := range loans {
+		if amount <= 0 {
+			break
+		}
+		pay := math.Min(amount, l.Due())
+		r, err := m.repay(l, pay)
+		if err != nil {
+			return repayments, err
+		}
+		repayments = append(repayments, *r)
+		amount -= pay
+	}
+	return repayments, nil
+}
+
+/*
+Amount of currency which can still be borrowed on the pair, from GetMarginAccountsAvailabilityByInstrumentId.
+*/
+func (m *MarginLoanManager) Available(instrumentId, currency string) (float64, error) {
+	availability, err := m.client.GetMarginAccountsAvailabilityByInstrumentId(instrumentId)
+	if err != nil {
+		return 0, err
+	}
+	for _, a := range *availability {
+		for k, v := range a {
+			if !strings.EqualFold(k, "currency:"+currency) {
+				continue
+			}
+			if c, ok := v.(map[string]interface{}); ok {
+				return anyToFloat(c["available"]), nil
+			}
+		}
+	}
+	return 0, nil
+}
+
+/*
+Borrow after checking the amount against the availability of the pair, returns the borrow_id.
+*/
+func (m *MarginLoanManager) Borrow(instrumentId, currency string, amount float64) (string, error) {
+	if amount <= 0 {
+		return "", ERR_MARGIN_LOAN_AMOUNT
+	}
+	available, err := m.Available(instrumentId, currency)
+	if err != nil {
+		return "", err
+	}
+	if amount > available {
+		return "", ERR_MARGIN_LOAN_AVAILABILITY
+	}
+	r, err := m.client.PostMarginAccountsBorrow(instrumentId, strings.ToLower(currency), formatMarginAmount(amount))
+	if err != nil {
+		return "", err
+	}
+	return anyToString((*r)["borrow_id"]), nil
+}
+
+/*
+Repay the loans of currency on the pair whenever its available balance exceeds threshold,
+only the part above the threshold is used. The rules run on CheckAutoRepay and after Start.
+*/
+func (m *MarginLoanManager) SetAutoRepay(instrumentId, currency string, threshold float64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for i, r := range m.rules {
+		if r.instrumentId == instrumentId && strings.EqualFold(r.currency, currency) {
+			m.rules[i].threshold = threshold
+			return
+		}
+	}
+	m.rules = append(m.rules, autoRepayRule{instrumentId, strings.ToUpper(currency), threshold})
+}
+
+func (m *MarginLoanManager) CheckAutoRepay() ([]MarginRepayment, error) {
+	m.lock.Lock()
+	rules := append([]autoRepayRule{}, m.rules...)
+	m.lock.Unlock()
+
+	repayments := []MarginRepayment{}
+	for _, rule := range rules {
+		account, err := m.client.GetMarginAccountsByInstrument(rule.instrumentId)
+		if err != nil {
+			return repayments, err
+		}
+		balance, _ := (*account)["currency:"+rule.currency].(map[string]interface{})
+		free := anyToFloat(balance["available"]) - rule.threshold
+		if free <= 0 || anyToFloat(balance["borrowed"]) <= 0 {
+			continue
+		}
+		r, err := m.RepayOldestFirst(rule.instrumentId, rule.currency, free)
+		repayments = append(repayments, r...)
+		if err != nil {
+			return repayments, err
+		}
+	}
+	return repayments, nil
+}
+
+/*
+Check the auto repayments every interval in background until Stop is called.
+*/
+func (m *MarginLoanManager) Start(interval time.Duration) {
+	m.poller.start("margin loan manager: auto repay", interval, false, func() error {
+		_, err := m.CheckAutoRepay()
+		return err
+	})
+}
+
+func (m *MarginLoanManager) Stop() {
+	m.poller.stop()
+}
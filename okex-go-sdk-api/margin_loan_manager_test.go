@@ -0,0 +1,121 @@
+package okex
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFakeMarginLoanServer() *fakeServer {
+	s := newFakeServer()
+	s.handle(GET, "/api/margin/v3/accounts/BTC-USDT/borrowed", `[
+		{"amount":"100","borrow_id":"2","created_at":"2019-04-16T10:30:00.000Z","currency":"USDT","instrument_id":"BTC-USDT","rate":"0.00024","returned_amount":"0","paid_interest":"0"},
+		{"amount":"1","borrow_id":"1","created_at":"2019-04-15T12:00:00.000Z","currency":"BTC","instrument_id":"BTC-USDT","rate":"0.0002","returned_amount":"0.5","paid_interest":"0.00001","interest":"0.00004","last_interest_time":"2019-04-16T06:00:00.000Z"},
+		{"amount":"50","borrow_id":"3","created_at":"2019-04-16T11:00:00.000Z","currency":"USDT","instrument_id":"BTC-USDT","rate":"0.00024","returned_amount":"0","paid_interest":"0"}]`)
+	s.handle(POST, MARGIN_ACCOUNTS_REPAYMENT, `{"repayment_id":"123","result":true}`)
+	s.handle(GET, "/api/margin/v3/accounts/BTC-USDT/availability", `[{"instrument_id":"BTC-USDT",
+		"currency:BTC":{"available":"0.5","leverage":"3","leverage_ratio":"3","rate":"0.0002"},
+		"currency:USDT":{"available":"1000","leverage":"3","leverage_ratio":"3","rate":"0.00024"}}]`)
+	s.handle(POST, MARGIN_ACCOUNTS_BORROW, `{"borrow_id":"4","client_oid":"","result":true}`)
+	s.handle(GET, "/api/margin/v3/accounts/BTC-USDT", `{"currency:BTC":{"available":"0","balance":"0","borrowed":"0.5"},
+		"currency:USDT":{"available":"130","balance":"130","borrowed":"150"}}`)
+	return s
+}
+
+func newTestMarginLoanManager(s *fakeServer) *MarginLoanManager {
+	m := NewMarginLoanManager(s.client())
+	m.now = func() time.Time { return time.Date(2019, 4, 16, 12, 0, 0, 0, time.UTC) }
+	return m
+}
+
+func TestMarginLoanManager_Loans(t *testing.T) {
+	s := newFakeMarginLoanServer()
+	defer s.Close()
+	m := newTestMarginLoanManager(s)
+
+	loans, err := m.Loans("BTC-USDT", "")
+	require.True(t, err == nil, err)
+	require.Equal(t, 3, len(loans))
+	assert.Equal(t, []string{"1", "2", "3"}, []string{loans[0].BorrowId, loans[1].BorrowId, loans[2].BorrowId})
+	assert.True(t, strings.Contains(s.lastRequest().RawQuery, "status=0"))
+
+	// 0.00004 charged until 06:00, then 0.5 outstanding for 6 hours at 0.0002 a day
+	assert.True(t, math.Abs(loans[0].AccruedInterest-0.000065) < 1e-12)
+	// 1.5 hours count as 2
+	assert.True(t, math.Abs(loans[1].AccruedInterest-100*0.00024*2/24) < 1e-12)
+	assert.True(t, math.Abs(loans[2].Due()-(50+50*0.00024/24)) < 1e-12)
+
+	usdt, err := m.Loans("BTC-USDT", "usdt")
+	require.True(t, err == nil, err)
+	assert.Equal(t, 2, len(usdt))
+}
+
+func TestMarginLoanManager_Repay(t *testing.T) {
+	s := newFakeMarginLoanServer()
+	defer s.Close()
+	m := newTestMarginLoanManager(s)
+
+	r, err := m.Repay("BTC-USDT", "1", 0)
+	require.True(t, err == nil, err)
+	assert.Equal(t, 0.500065, r.Amount)
+	assert.JSONEq(t, `{"instrument_id":"BTC-USDT","currency":"btc","amount":"0.500065","borrow_id":"1"}`, s.lastRequest().Body)
+	_, err = m.Repay("BTC-USDT", "9", 0)
+	assert.Equal(t, ERR_MARGIN_LOAN_NOT_FOUND, err)
+
+	repayments, err := m.RepayOldestFirst("BTC-USDT", "USDT", 120)
+	require.True(t, err == nil, err)
+	require.Equal(t, 2, len(repayments))
+	assert.Equal(t, "2", repayments[0].BorrowId)
+	assert.Equal(t, 100.002, repayments[0].Amount)
+	assert.True(t, math.Abs(repayments[1].Amount-19.998) < 1e-9)
+}
+
+func TestMarginLoanManager_AccruePerPeriod(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	loan := `[{"amount":"100","borrow_id":"5","created_at":"2019-04-16T00:00:00.000Z","currency":"USDT","instrument_id":"BTC-USDT","rate":"0.0024","returned_amount":"0","paid_interest":"0"}]`
+	s.handleFunc(GET, "/api/margin/v3/accounts/BTC-USDT/borrowed", func(r fakeRequest) string { return loan })
+	s.handle(POST, MARGIN_ACCOUNTS_REPAYMENT, `{"repayment_id":"124","result":true}`)
+	m := NewMarginLoanManager(s.client())
+	now := time.Date(2019, 4, 16, 6, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+
+	// 100 for 6 hours at 0.0001 an hour, then 60 of principal
+	r, err := m.Repay("BTC-USDT", "5", 60.06)
+	require.True(t, err == nil, err)
+	assert.Equal(t, 60.06, r.Amount)
+	loan = `[{"amount":"100","borrow_id":"5","created_at":"2019-04-16T00:00:00.000Z","currency":"USDT","instrument_id":"BTC-USDT","rate":"0.0024","returned_amount":"60","paid_interest":"0.06"}]`
+
+	// 40 for the 6 hours since the repayment
+	now = now.Add(6 * time.Hour)
+	loans, err := m.Loans("BTC-USDT", "USDT")
+	require.True(t, err == nil, err)
+	require.Equal(t, 1, len(loans))
+	assert.True(t, math.Abs(loans[0].AccruedInterest-0.024) < 1e-12)
+}
+
+func TestMarginLoanManager_BorrowAndAutoRepay(t *testing.T) {
+	s := newFakeMarginLoanServer()
+	defer s.Close()
+	m := newTestMarginLoanManager(s)
+
+	_, err := m.Borrow("BTC-USDT", "BTC", 0.6)
+	assert.Equal(t, ERR_MARGIN_LOAN_AVAILABILITY, err)
+	id, err := m.Borrow("BTC-USDT", "BTC", 0.4)
+	require.True(t, err == nil, err)
+	assert.Equal(t, "4", id)
+	assert.JSONEq(t, `{"instrument_id":"BTC-USDT","currency":"btc","amount":"0.4"}`, s.lastRequest().Body)
+
+	m.SetAutoRepay("BTC-USDT", "usdt", 100)
+	m.SetAutoRepay("BTC-USDT", "BTC", 0)
+	repayments, err := m.CheckAutoRepay()
+	require.True(t, err == nil, err)
+	require.Equal(t, 1, len(repayments))
+	assert.Equal(t, "2", repayments[0].BorrowId)
+	assert.Equal(t, 30.0, repayments[0].Amount)
+	assert.Equal(t, 1, len(s.requestsTo(POST, MARGIN_ACCOUNTS_REPAYMENT)))
+}
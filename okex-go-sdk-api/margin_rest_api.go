@@ -205,7 +205,9 @@ func (client *Client) GetMarginOrdersPending(instrumentId string, optionalParams
 	r := []map[string]interface{}{}
 
 	fullParams := NewParams()
-	fullParams["instrument_id"] = instrumentId
+	if instrumentId != "" {
+		fullParams["instrument_id"] = instrumentId
+	}
 
 	if optionalParams != nil && len(*optionalParams) > 0 {
 		for k, v := range *optionalParams {
@@ -320,7 +322,9 @@ func (client *Client) PostMarginOrders(side, instrument_id, margin_trading strin
 	postParams["margin_trading"] = margin_trading
 
 	if optionalOrderInfo != nil && len(*optionalOrderInfo) > 0 {
-		postParams["client_oid"] = (*optionalOrderInfo)["client_oid"]
+		if val, ok := (*optionalOrderInfo)["client_oid"]; ok {
+			postParams["client_oid"] = val
+		}
 		postParams["type"] = (*optionalOrderInfo)["type"]
 		postParams["order_type"] = (*optionalOrderInfo)["order_type"]
 
@@ -329,18 +333,47 @@ func (client *Client) PostMarginOrders(side, instrument_id, margin_trading strin
 			postParams["size"] = (*optionalOrderInfo)["size"]
 
 		} else if postParams["type"] == "market" {
-			postParams["size"] = (*optionalOrderInfo)["size"]
-			postParams["notional"] = (*optionalOrderInfo)["notional"]
-
+			if val, ok := (*optionalOrderInfo)["size"]; ok {
+				postParams["size"] = val
+			}
+			if val, ok := (*optionalOrderInfo)["notional"]; ok {
+				postParams["notional"] = val
+			}
 		}
 	}
 
-	if _, err := client.Request(POST, MARGIN_ORDERS, postParams, &r); err != nil {
+	if err := client.Risk.CheckOrders(riskOrderOf(MARKET_MARGIN, instrument_id, postParams)); err != nil {
+		return nil, err
+	}
+	order := client.Orders.posting(MARKET_MARGIN, instrument_id, postParams)
+	_, err := client.Request(POST, MARGIN_ORDERS, postParams, &r)
+	client.Orders.posted(r, err, order)
+	if err != nil {
 		return nil, err
 	}
 	return &r, nil
 }
 
+/*
+下单
+使用MarginOrder下单，必填字段在发送前校验。
+
+	eg: client.PostMarginOrder(NewMarginOrder(NewSpotMarketBuy("BTC-USDT", "100")))
+
+HTTP请求
+POST /api/margin/v3/orders
+*/
+func (client *Client) PostMarginOrder(order *MarginOrder) (*map[string]interface{}, error) {
+	if order == nil {
+		return nil, ERR_SPOT_ORDER_NIL
+	}
+	orderInfo, err := order.Build()
+	if err != nil {
+		return nil, err
+	}
+	return client.PostMarginOrders(orderInfo["side"], orderInfo["instrument_id"], orderInfo["margin_trading"], &orderInfo)
+}
+
 /*
 批量下单
 下指定币对的多个订单（每次只能下最多4个币对且每个币对可批量下10个单）。
@@ -350,13 +383,52 @@ HTTP请求
 POST /api/spot/v3/batch_orders
 */
 func (client *Client) PostMarginBatchOrders(orderInfos *[]map[string]string) (*map[string]interface{}, error) {
+	if orderInfos != nil {
+		riskOrders := []RiskOrder{}
+		for _, order := range *orderInfos {
+			riskOrders = append(riskOrders, riskOrderOf(MARKET_MARGIN, order["instrument_id"], order))
+		}
+		if err := client.Risk.CheckOrders(riskOrders...); err != nil {
+			return nil, err
+		}
+	}
+	var orders []*ManagedOrder
+	if orderInfos != nil {
+		var infos []map[string]string
+		infos, orders = client.Orders.postingAll(MARKET_MARGIN, "", *orderInfos)
+		orderInfos = &infos
+	}
 	r := map[string]interface{}{}
-	if _, err := client.Request(POST, MARGIN_BATCH_ORDERS, orderInfos, &r); err != nil {
+	_, err := client.Request(POST, MARGIN_BATCH_ORDERS, orderInfos, &r)
+	client.Orders.posted(r, err, orders...)
+	if err != nil {
 		return nil, err
 	}
 	return &r, nil
 }
 
+/*
+批量下单
+使用MarginOrder批量下单。
+
+HTTP请求
+POST /api/margin/v3/batch_orders
+*/
+func (client *Client) PostMarginBatchOrdersBy(orders ...*MarginOrder) (*map[string]interface{}, error) {
+	builders := []SpotOrderBuilder{}
+	for _, order := range orders {
+		if order == nil {
+			return nil, ERR_SPOT_ORDER_NIL
+		}
+		builders = append(builders, order)
+	}
+	orderInfos, err := BuildSpotBatchOrders(builders...)
+	if err != nil {
+		return nil, err
+	}
+	return client.PostMarginBatchOrders(&orderInfos)
+}
+
 /*
 撤销指定订单
 撤销之前下的未完成订单。
@@ -0,0 +1,929 @@
+package okex
+
+/*
+ OrderManager keeps a local book of spot, margin, futures and swap orders.
+ Orders placed through the manager, or through a Client whose Orders is the manager, are
+ recorded before they are sent, their state is then driven by the spot/order, futures/order
+ and swap/order pushes and by periodic reconciliation against the orders_pending REST endpoints.
+
+	manager := NewOrderManager(client)
+	client.Orders = manager
+*/
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	MARKET_SPOT    = "spot"
+	MARKET_MARGIN  = "margin"
+	MARKET_FUTURES = "futures"
+	MARKET_SWAP    = "swap"
+
+	/*
+	 local state of an order which was recorded but not yet acknowledged by the exchange
+	*/
+	ORDER_STATE_PENDING_NEW = -3
+
+	/*
+	 pending spot and margin orders are read in pages of this size, each after the last order of the previous one
+	*/
+	PENDING_ORDERS_PAGE = 100
+)
+
+var (
+	ERR_ORDER_MANAGER_MARKET    = errors.New(`order manager: unknown market`)
+	ERR_ORDER_MANAGER_NOT_FOUND = errors.New(`order manager: order not found`)
+)
+
+type ManagedOrder struct {
+	Market       string
+	InstrumentId string
+	OrderId      string
+	ClientOid    string
+	Side         string // spot/margin: buy or sell, futures/swap: type 1..4
+	Price        string
+	Size         string
+	FilledSize   string
+	PriceAvg     string
+	State        int // ORDER_STATE_*
+	ErrorCode    string
+	ErrorMessage string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func (o *ManagedOrder) IsFinal() bool {
+	return o.State == ORDER_STATE_FILLED || o.State == ORDER_STATE_CANCELED || o.State == ORDER_STATE_FAILED
+}
+
+func (o *ManagedOrder) IsOpen() bool {
+	return !o.IsFinal()
+}
+
+/*
+OrderChangeCallback receives a copy of the order before and after a state or fill change.
+old.State is ORDER_STATE_PENDING_NEW and old.OrderId is empty for newly seen orders.
+*/
+type OrderChangeCallback func(old, new ManagedOrder)
+
+/*
+An order as pushed by the order channels or returned by the order REST endpoints,
+spot reports status names while futures and swap report numeric states.
+*/
+type orderUpdate struct {
+	InstrumentId string `json:"instrument_id"`
+	OrderId      string `json:"order_id"`
+	ClientOid    string `json:"client_oid"`
+	Price        string `json:"price"`
+	PriceAvg     string `json:"price_avg"`
+	Size         string `json:"size"`
+	FilledSize   string `json:"filled_size"`
+	FilledQty    string `json:"filled_qty"`
+	Status       string `json:"status"`
+	State        string `json:"state"`
+	Side         string `json:"side"`
+	Type         string `json:"type"`
+	MarginTrade  string `json:"margin_trading"`
+	ErrorCode    string `json:"error_code"`
+	ErrorMessage string `json:"error_message"`
+}
+
+var spotOrderStatus = map[string]int{
+	"open":        ORDER_STATE_OPEN,
+	"part_filled": ORDER_STATE_PARTIALLY_FILLED,
+	"canceling":   ORDER_STATE_CANCELING,
+	"filled":      ORDER_STATE_FILLED,
+	"cancelled":   ORDER_STATE_CANCELED,
+	"ordering":    ORDER_STATE_ORDERING,
+	"failure":     ORDER_STATE_FAILED,
+}
+
+func (u *orderUpdate) state() (int, bool) {
+	if u.State != "" {
+		state, err := strconv.Atoi(u.State)
+		return state, err == nil
+	}
+	state, ok := spotOrderStatus[u.Status]
+	return state, ok
+}
+
+func (u *orderUpdate) filled() string {
+	if u.FilledQty != "" {
+		return u.FilledQty
+	}
+	return u.FilledSize
+}
+
+/*
+progress of a non final state, a push never moves an order back to a lower rank
+unless more of it was filled
+*/
+func orderStateRank(state int) int {
+	switch state {
+	case ORDER_STATE_PENDING_NEW, ORDER_STATE_ORDERING:
+		return 0
+	case ORDER_STATE_OPEN:
+		return 1
+	case ORDER_STATE_PARTIALLY_FILLED:
+		return 2
+	case ORDER_STATE_CANCELING:
+		return 3
+	default:
+		return 4
+	}
+}
+
+type OrderManager struct {
+	// How long filled, canceled and failed orders are kept after their last update.
+	Keep time.Duration
+
+	client *Client
+
+	lock        sync.RWMutex
+	orders      []*ManagedOrder
+	byOrderId   map[string]*ManagedOrder // market + order_id
+	byClientOid map[string]*ManagedOrder // market + client_oid
+	callbacks   []OrderChangeCallback
+
+	poller poller
+}
+
+func NewOrderManager(client *Client) *OrderManager {
+	return &OrderManager{
+		Keep:        24 * time.Hour,
+		client:      client,
+		byOrderId:   map[string]*ManagedOrder{},
+		byClientOid: map[string]*ManagedOrder{},
+	}
+}
+
+/*
+Register a callback invoked on every change of any order, callbacks run outside the manager lock.
+*/
+func (m *OrderManager) OnChange(cb OrderChangeCallback) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.callbacks = append(m.callbacks, cb)
+}
+
+func orderKey(market, id string) string {
+	return market + "|" + id
+}
+
+func newClientOid() string {
+	return "om" + NewRequestId()
+}
+
+/*
+Record an order which is about to be sent, the returned order is owned by the manager.
+An order already recorded under the client_oid and not acknowledged yet is returned as is.
+*/
+func (m *OrderManager) track(market, instrumentId, clientOid, side, price, size string) *ManagedOrder {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if o, ok := m.byClientOid[orderKey(market, clientOid)]; ok && clientOid != "" && o.State == ORDER_STATE_PENDING_NEW {
+		return o
+	}
+	now := time.Now()
+	o := &ManagedOrder{
+		Market:       market,
+		InstrumentId: instrumentId,
+		ClientOid:    clientOid,
+		Side:         side,
+		Price:        price,
+		Size:         size,
+		State:        ORDER_STATE_PENDING_NEW,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	m.orders = append(m.orders, o)
+	m.byClientOid[orderKey(market, clientOid)] = o
+	return o
+}
+
+/*
+Hook of Client.Orders called with the params of an order about to be posted, a client_oid is
+added when the params have none. A nil manager records nothing.
+*/
+func (m *OrderManager) posting(market, instrumentId string, params map[string]string) *ManagedOrder {
+	if m == nil {
+		return nil
+	}
+	if market == MARKET_SPOT && params["margin_trading"] == MARGIN_TRADING_MARGIN {
+		market = MARKET_MARGIN
+	}
+	if instrumentId == "" {
+		instrumentId = params["instrument_id"]
+	}
+	if params["client_oid"] == "" {
+		params["client_oid"] = newClientOid()
+	}
+	side, size := params["side"], params["size"]
+	if market == MARKET_FUTURES || market == MARKET_SWAP {
+		side = params["type"]
+	}
+	if size == "" {
+		size = params["notional"]
+	}
+	return m.track(market, instrumentId, params["client_oid"], side, params["price"], size)
+}
+
+/*
+Hook of Client.Orders for a batch, the orders are copied before a client_oid is added.
+*/
+func (m *OrderManager) postingAll(market, instrumentId string, orders []map[string]string) ([]map[string]string, []*ManagedOrder) {
+	if m == nil {
+		return orders, nil
+	}
+	copies := make([]map[string]string, 0, len(orders))
+	var tracked []*ManagedOrder
+	for _, order := range orders {
+		params := map[string]string{}
+		for k, v := range order {
+			params[k] = v
+		}
+		tracked = append(tracked, m.posting(market, instrumentId, params))
+		copies = append(copies, params)
+	}
+	return copies, tracked
+}
+
+/*
+Hook of Client.Orders for swap orders, the orders are copied before a client_oid is added.
+*/
+func (m *OrderManager) postingSwap(instrumentId string, orders []*BasePlaceOrderInfo) ([]*BasePlaceOrderInfo, []*ManagedOrder) {
+	if m == nil {
+		return orders, nil
+	}
+	copies := make([]*BasePlaceOrderInfo, 0, len(orders))
+	var tracked []*ManagedOrder
+	for _, order := range orders {
+		info := *order
+		if info.ClientOid == "" {
+			info.ClientOid = newClientOid()
+		}
+		tracked = append(tracked, m.track(MARKET_SWAP, instrumentId, info.ClientOid, info.Type, info.Price, info.Size))
+		copies = append(copies, &info)
+	}
+	return copies, tracked
+}
+
+/*
+Hook of Client.Orders called with the response of an order post, the results are matched to the
+orders by client_oid.
+*/
+func (m *OrderManager) posted(response interface{}, err error, orders ...*ManagedOrder) {
+	if m == nil {
+		return
+	}
+	results := placeResults(response)
+	for _, o := range orders {
+		if o == nil {
+			continue
+		}
+		var result map[string]interface{}
+		for _, r := range results {
+			if (len(orders) == 1 && len(results) == 1) || fmt.Sprint(r["client_oid"]) == o.ClientOid {
+				result = r
+				break
+			}
+		}
+		m.acknowledge(o, result, err)
+	}
+}
+
+/*
+Results of a place order response: a single result, {"order_info":[...]} of the futures and swap
+batches or {"btc-usdt":[...]} of the spot batches. A result without its own result flag takes
+the flag of the response.
+*/
+func placeResults(response interface{}) []map[string]interface{} {
+	var generic map[string]interface{}
+	if response == nil || convertStruct(response, &generic) != nil || generic == nil {
+		return nil
+	}
+	if _, ok := generic["order_id"]; ok {
+		return []map[string]interface{}{generic}
+	}
+	var results []map[string]interface{}
+	for _, value := range generic {
+		items, ok := value.([]interface{})
+		if !ok {
+			continue
+		}
+		for _, item := range items {
+			if r, ok := item.(map[string]interface{}); ok {
+				if _, ok := r["result"]; !ok {
+					r["result"] = generic["result"]
+				}
+				results = append(results, r)
+			}
+		}
+	}
+	return results
+}
+
+/*
+The answer of a place order request, error_code is a number in some responses.
+*/
+func placeResultOf(result map[string]interface{}) orderUpdate {
+	field := func(key string) string {
+		if v, ok := result[key]; ok && v != nil {
+			return fmt.Sprint(v)
+		}
+		return ""
+	}
+	return orderUpdate{
+		OrderId:      field("order_id"),
+		ClientOid:    field("client_oid"),
+		ErrorCode:    field("error_code"),
+		ErrorMessage: field("error_message"),
+	}
+}
+
+/*
+Apply the exchange answer of a place order request.
+*/
+func (m *OrderManager) acknowledge(o *ManagedOrder, result map[string]interface{}, err error) (ManagedOrder, error) {
+	u := placeResultOf(result)
+
+	m.lock.Lock()
+	old := *o
+	resultOk := fmt.Sprint(result["result"]) == "true"
+	if err != nil || !resultOk || u.OrderId == "" || u.OrderId == "-1" {
+		if o.State == ORDER_STATE_PENDING_NEW {
+			o.State = ORDER_STATE_FAILED
+			o.ErrorCode = u.ErrorCode
+			o.ErrorMessage = u.ErrorMessage
+			if err != nil && o.ErrorMessage == "" {
+				o.ErrorMessage = err.Error()
+			}
+		}
+	} else {
+		if o.OrderId == "" {
+			o.OrderId = u.OrderId
+			m.byOrderId[orderKey(o.Market, o.OrderId)] = o
+		}
+		if o.State == ORDER_STATE_PENDING_NEW {
+			o.State = ORDER_STATE_OPEN
+		}
+	}
+	o.UpdatedAt = time.Now()
+	current := *o
+	callbacks := m.callbacks
+	m.lock.Unlock()
+
+	m.notify(callbacks, old, current)
+	if err == nil && current.State == ORDER_STATE_FAILED {
+		err = fmt.Errorf("order manager: place order failed, error_code=%s, error_message=%s", current.ErrorCode, current.ErrorMessage)
+	}
+	return current, err
+}
+
+func (m *OrderManager) notify(callbacks []OrderChangeCallback, old, current ManagedOrder) {
+	if old.State == current.State && old.FilledSize == current.FilledSize && old.OrderId == current.OrderId {
+		return
+	}
+	for _, cb := range callbacks {
+		cb(old, current)
+	}
+}
+
+/*
+Place a spot or margin order. A client_oid is generated when the builder has none so that
+pushes arriving before the REST response can be matched to the order.
+*/
+func (m *OrderManager) PlaceSpotOrder(order SpotOrderBuilder) (ManagedOrder, error) {
+	if order == nil {
+		return ManagedOrder{}, ERR_SPOT_ORDER_NIL
+	}
+	params, err := order.Build()
+	if err != nil {
+		return ManagedOrder{}, err
+	}
+	if params["client_oid"] == "" {
+		params["client_oid"] = newClientOid()
+	}
+
+	market := MARKET_SPOT
+	if params["margin_trading"] == MARGIN_TRADING_MARGIN {
+		market = MARKET_MARGIN
+	}
+	size := params["size"]
+	if size == "" {
+		size = params["notional"]
+	}
+	o := m.track(market, params["instrument_id"], params["client_oid"], params["side"], params["price"], size)
+
+	var result *map[string]interface{}
+	if market == MARKET_MARGIN {
+		result, err = m.client.PostMarginOrders(params["side"], params["instrument_id"], MARGIN_TRADING_MARGIN, &params)
+	} else {
+		result, err = m.client.PostSpotOrders(params["side"], params["instrument_id"], &params)
+	}
+	return m.acknowledge(o, derefResult(result), err)
+}
+
+/*
+Place a futures order, see Client.PostFuturesOrder.
+*/
+func (m *OrderManager) PlaceFuturesOrder(instrumentId, oType, price, size string, optionalParams map[string]string) (ManagedOrder, error) {
+	params := NewParams()
+	for k, v := range optionalParams {
+		params[k] = v
+	}
+	if params["client_oid"] == "" {
+		params["client_oid"] = newClientOid()
+	}
+
+	o := m.track(MARKET_FUTURES, instrumentId, params["client_oid"], oType, price, size)
+	result, err := m.client.PostFuturesOrder(instrumentId, oType, price, size, params)
+	return m.acknowledge(o, derefResult(result), err)
+}
+
+/*
+Place a swap order, see Client.PostSwapOrder.
+*/
+func (m *OrderManager) PlaceSwapOrder(instrumentId string, order *BasePlaceOrderInfo) (ManagedOrder, error) {
+	if order == nil {
+		return ManagedOrder{}, errors.New("order manager: swap order is nil")
+	}
+	info := *order
+	if info.ClientOid == "" {
+		info.ClientOid = newClientOid()
+	}
+
+	o := m.track(MARKET_SWAP, instrumentId, info.ClientOid, info.Type, info.Price, info.Size)
+	r, err := m.client.PostSwapOrder(instrumentId, &info)
+	var result map[string]interface{}
+	if r != nil {
+		result = map[string]interface{}{
+			"order_id":      r.OrderId,
+			"client_oid":    r.ClientOid,
+			"result":        r.Result,
+			"error_code":    r.ErrorCode,
+			"error_message": r.ErrorMessage,
+		}
+	}
+	return m.acknowledge(o, result, err)
+}
+
+func derefResult(result *map[string]interface{}) map[string]interface{} {
+	if result == nil {
+		return nil
+	}
+	return *result
+}
+
+/*
+Cancel an open order by order_id or client_oid, the order is marked canceling until
+a push or reconciliation reports its final state.
+*/
+func (m *OrderManager) CancelOrder(market, orderOrClientOid string) error {
+	m.lock.RLock()
+	o := m.lookup(market, orderOrClientOid, orderOrClientOid)
+	var order ManagedOrder
+	if o != nil {
+		order = *o
+	}
+	m.lock.RUnlock()
+	if o == nil {
+		return ERR_ORDER_MANAGER_NOT_FOUND
+	}
+	if order.IsFinal() {
+		return nil
+	}
+
+	id := order.OrderId
+	if id == "" {
+		id = order.ClientOid
+	}
+	var err error
+	switch market {
+	case MARKET_SPOT:
+		_, err = m.client.PostSpotCancelOrders(order.InstrumentId, id)
+	case MARKET_MARGIN:
+		_, err = m.client.PostMarginCancelOrdersById(order.InstrumentId, id)
+	case MARKET_FUTURES:
+		_, err = m.client.CancelFuturesInstrumentOrder(order.InstrumentId, id)
+	case MARKET_SWAP:
+		_, err = m.client.PostSwapCancelOrder(order.InstrumentId, id)
+	default:
+		return ERR_ORDER_MANAGER_MARKET
+	}
+	if err != nil {
+		return err
+	}
+
+	state := strconv.Itoa(ORDER_STATE_CANCELING)
+	m.apply(market, &orderUpdate{InstrumentId: order.InstrumentId, OrderId: order.OrderId, ClientOid: order.ClientOid, State: state, FilledQty: order.FilledSize})
+	return nil
+}
+
+/*
+Cancel all open orders of an instrument, "" cancels the open orders of every instrument.
+The first error is returned after trying all orders.
+*/
+func (m *OrderManager) CancelAll(instrumentId string) error {
+	var firstErr error
+	for _, o := range m.OpenOrders(instrumentId) {
+		id := o.OrderId
+		if id == "" {
+			id = o.ClientOid
+		}
+		if err := m.CancelOrder(o.Market, id); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (m *OrderManager) lookup(market, orderId, clientOid string) *ManagedOrder {
+	if orderId != "" {
+		if o, ok := m.byOrderId[orderKey(market, orderId)]; ok {
+			return o
+		}
+	}
+	if clientOid != "" {
+		if o, ok := m.byClientOid[orderKey(market, clientOid)]; ok {
+			return o
+		}
+	}
+	return nil
+}
+
+/*
+Apply an order push or REST order info, unknown orders are adopted.
+*/
+func (m *OrderManager) apply(market string, u *orderUpdate) {
+	state, ok := u.state()
+	if !ok || (u.OrderId == "" && u.ClientOid == "") {
+		return
+	}
+	if market == MARKET_SPOT && u.MarginTrade == MARGIN_TRADING_MARGIN {
+		market = MARKET_MARGIN
+	}
+
+	m.lock.Lock()
+	o := m.lookup(market, u.OrderId, u.ClientOid)
+	if o == nil && market == MARKET_SPOT && u.MarginTrade == "" {
+		// spot/order also pushes margin orders
+		o = m.lookup(MARKET_MARGIN, u.OrderId, u.ClientOid)
+	}
+	if o == nil {
+		o = &ManagedOrder{Market: market, State: ORDER_STATE_PENDING_NEW, CreatedAt: time.Now()}
+		m.orders = append(m.orders, o)
+	}
+	old := *o
+
+	filled := u.filled()
+	newFilled, oldFilled := toFloat(filled), toFloat(o.FilledSize)
+	// an order which failed locally without an order_id may still have reached the exchange
+	lostAck := o.State == ORDER_STATE_FAILED && o.OrderId == ""
+	stale := (o.IsFinal() && !lostAck) || newFilled < oldFilled ||
+		(newFilled == oldFilled && orderStateRank(state) < orderStateRank(o.State))
+	if o.OrderId == "" && u.OrderId != "" {
+		o.OrderId = u.OrderId
+		m.byOrderId[orderKey(o.Market, o.OrderId)] = o
+	}
+	if o.ClientOid == "" && u.ClientOid != "" {
+		o.ClientOid = u.ClientOid
+		m.byClientOid[orderKey(o.Market, o.ClientOid)] = o
+	}
+	if o.InstrumentId == "" {
+		o.InstrumentId = u.InstrumentId
+	}
+	if o.Side == "" {
+		o.Side = T3O(u.Side != "", u.Side, u.Type).(string)
+	}
+	if o.Price == "" {
+		o.Price = u.Price
+	}
+	if o.Size == "" {
+		o.Size = u.Size
+	}
+	if !stale {
+		o.State = state
+		if filled != "" {
+			o.FilledSize = filled
+		}
+		if u.PriceAvg != "" {
+			o.PriceAvg = u.PriceAvg
+		}
+		o.UpdatedAt = time.Now()
+	}
+	current := *o
+	callbacks := m.callbacks
+	m.lock.Unlock()
+
+	m.notify(callbacks, old, current)
+}
+
+func marketOfTable(table string) string {
+	switch {
+	case strings.HasPrefix(table, "spot/"):
+		return MARKET_SPOT
+	case strings.HasPrefix(table, "futures/"):
+		return MARKET_FUTURES
+	case strings.HasPrefix(table, "swap/"):
+		return MARKET_SWAP
+	}
+	return ""
+}
+
+/*
+	 Callback of the spot/order, futures/order and swap/order channels.
+
+		eg: agent.Subscribe(CHNL_SWAP_ORDER, "BTC-USD-SWAP", manager.OnOrderPush)
+*/
+func (m *OrderManager) OnOrderPush(obj interface{}) error {
+	tb, ok := obj.(*WSTableResponse)
+	if !ok {
+		return nil
+	}
+	market := marketOfTable(tb.Table)
+	if market == "" {
+		return nil
+	}
+	updates := []orderUpdate{}
+	if err := decodeTableData(tb.Data, &updates); err != nil {
+		return err
+	}
+	for i := range updates {
+		m.apply(market, &updates[i])
+	}
+	return nil
+}
+
+/*
+Forget the final orders not updated within Keep.
+*/
+func (m *OrderManager) prune(now time.Time) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	kept := m.orders[:0]
+	for _, o := range m.orders {
+		if o.IsOpen() || !o.UpdatedAt.Add(m.Keep).Before(now) {
+			kept = append(kept, o)
+			continue
+		}
+		if m.byOrderId[orderKey(o.Market, o.OrderId)] == o {
+			delete(m.byOrderId, orderKey(o.Market, o.OrderId))
+		}
+		if m.byClientOid[orderKey(o.Market, o.ClientOid)] == o {
+			delete(m.byClientOid, orderKey(o.Market, o.ClientOid))
+		}
+	}
+	for i := len(kept); i < len(m.orders); i++ {
+		m.orders[i] = nil
+	}
+	m.orders = kept
+}
+
+/*
+Reconcile the open orders of every instrument with the exchange: the pending orders are
+fetched per instrument and applied, local open orders which are no longer pending are
+fetched one by one to learn their final state. The final orders older than Keep are forgotten.
+*/
+func (m *OrderManager) Reconcile() error {
+	m.prune(time.Now())
+	type instrument struct{ market, instrumentId string }
+	open := map[instrument][]ManagedOrder{}
+	for _, o := range m.OpenOrders("") {
+		k := instrument{o.Market, o.InstrumentId}
+		open[k] = append(open[k], o)
+	}
+
+	var firstErr error
+	for k, orders := range open {
+		pending, err := fetchPendingOrders(m.client, k.market, k.instrumentId)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		pendingIds := map[string]bool{}
+		for i := range pending {
+			pendingIds[pending[i].OrderId] = true
+			pendingIds[pending[i].ClientOid] = true
+			m.apply(k.market, &pending[i])
+		}
+		for _, o := range orders {
+			if pendingIds[o.OrderId] || (o.ClientOid != "" && pendingIds[o.ClientOid]) {
+				continue
+			}
+			id := o.OrderId
+			if id == "" {
+				id = o.ClientOid
+			}
+			u, err := m.fetchOrder(o.Market, o.InstrumentId, id)
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			m.apply(o.Market, u)
+		}
+	}
+	return firstErr
+}
+
+func fetchPendingOrders(client *Client, market, instrumentId string) ([]orderUpdate, error) {
+	updates := []orderUpdate{}
+	switch market {
+	case MARKET_SPOT:
+		params := NewParams()
+		if instrumentId != "" {
+			params["instrument_id"] = instrumentId
+		}
+		params["limit"] = strconv.Itoa(PENDING_ORDERS_PAGE)
+		for {
+			orders, err := client.GetSpotOrdersPending(&params)
+			if err != nil {
+				return nil, err
+			}
+			for _, o := range orders {
+				updates = append(updates, orderUpdate{
+					InstrumentId: o.InstrumentID,
+					OrderId:      o.OrderID,
+					ClientOid:    o.ClientOid,
+					Price:        strconv.FormatFloat(o.Price, 'f', -1, 64),
+					Size:         strconv.FormatFloat(o.Size, 'f', -1, 64),
+					FilledSize:   strconv.FormatFloat(o.FilledSize, 'f', -1, 64),
+					Status:       o.Status,
+					Side:         o.Side,
+				})
+			}
+			if len(orders) < PENDING_ORDERS_PAGE || orders[len(orders)-1].OrderID == "" {
+				break
+			}
+			params["after"] = orders[len(orders)-1].OrderID
+		}
+	case MARKET_MARGIN:
+		params := map[string]string{"limit": strconv.Itoa(PENDING_ORDERS_PAGE)}
+		for {
+			orders, err := client.GetMarginOrdersPending(instrumentId, &params)
+			if err != nil {
+				return nil, err
+			}
+			page := []orderUpdate{}
+			if err := decodeTableData(mapsToData(*orders), &page); err != nil {
+				return nil, err
+			}
+			updates = append(updates, page...)
+			if len(page) < PENDING_ORDERS_PAGE || page[len(page)-1].OrderId == "" {
+				break
+			}
+			params["after"] = page[len(page)-1].OrderId
+		}
+	case MARKET_FUTURES:
+		result, err := client.GetFuturesOrders(instrumentId, Int2String(ORDER_STATE_UNFINISHED), nil)
+		if err != nil {
+			return nil, err
+		}
+		if info, ok := result["order_info"].([]interface{}); ok {
+			if err := decodeTableData(info, &updates); err != nil {
+				return nil, err
+			}
+		}
+	case MARKET_SWAP:
+		params := NewParams()
+		params["state"] = Int2String(ORDER_STATE_UNFINISHED)
+		result, err := client.GetSwapOrderByInstrumentId(instrumentId, params)
+		if err != nil {
+			return nil, err
+		}
+		for i := range result.OrderInfo {
+			updates = append(updates, *swapOrderUpdate(&result.OrderInfo[i]))
+		}
+	default:
+		return nil, ERR_ORDER_MANAGER_MARKET
+	}
+	return updates, nil
+}
+
+func (m *OrderManager) fetchOrder(market, instrumentId, orderOrClientOid string) (*orderUpdate, error) {
+	u := orderUpdate{}
+	var data interface{}
+	switch market {
+	case MARKET_SPOT:
+		r, err := m.client.GetSpotOrdersById(instrumentId, orderOrClientOid)
+		if err != nil {
+			return nil, err
+		}
+		data = *r
+	case MARKET_MARGIN:
+		r, err := m.client.GetMarginOrdersById(instrumentId, orderOrClientOid)
+		if err != nil {
+			return nil, err
+		}
+		data = *r
+	case MARKET_FUTURES:
+		r, err := m.client.GetFuturesOrder(instrumentId, orderOrClientOid)
+		if err != nil {
+			return nil, err
+		}
+		data = r
+	case MARKET_SWAP:
+		r, err := m.client.GetSwapOrderById(instrumentId, orderOrClientOid)
+		if err != nil {
+			return nil, err
+		}
+		return swapOrderUpdate(r), nil
+	default:
+		return nil, ERR_ORDER_MANAGER_MARKET
+	}
+	if err := convertStruct(data, &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func convertStruct(from, to interface{}) error {
+	jsonString, err := Struct2JsonString(from)
+	if err != nil {
+		return err
+	}
+	return JsonString2Struct(jsonString, to)
+}
+
+func mapsToData(maps []map[string]interface{}) []interface{} {
+	data := make([]interface{}, 0, len(maps))
+	for _, m := range maps {
+		data = append(data, m)
+	}
+	return data
+}
+
+func swapOrderUpdate(o *BaseOrderInfo) *orderUpdate {
+	return &orderUpdate{
+		InstrumentId: o.InstrumentId,
+		OrderId:      o.OrderId,
+		ClientOid:    o.ClientOid,
+		Price:        strconv.FormatFloat(o.Price, 'f', -1, 64),
+		PriceAvg:     strconv.FormatFloat(o.PriceAvg, 'f', -1, 64),
+		Size:         strconv.FormatFloat(o.Size, 'f', -1, 64),
+		FilledQty:    strconv.FormatFloat(o.FilledQty, 'f', -1, 64),
+		State:        o.State,
+		Type:         o.Type,
+	}
+}
+
+/*
+Reconcile the orders every interval in background until Stop is called.
+*/
+func (m *OrderManager) Start(interval time.Duration) {
+	m.poller.start("order manager: reconcile", interval, false, m.Reconcile)
+}
+
+func (m *OrderManager) Stop() {
+	m.poller.stop()
+}
+
+/*
+Find an order by order_id or client_oid.
+*/
+func (m *OrderManager) Order(market, orderOrClientOid string) (ManagedOrder, bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	if o := m.lookup(market, orderOrClientOid, orderOrClientOid); o != nil {
+		return *o, true
+	}
+	return ManagedOrder{}, false
+}
+
+/*
+Orders not yet filled, cancelled or failed, "" returns the open orders of every instrument.
+*/
+func (m *OrderManager) OpenOrders(instrumentId string) []ManagedOrder {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	var orders []ManagedOrder
+	for _, o := range m.orders {
+		if o.IsOpen() && (instrumentId == "" || o.InstrumentId == instrumentId) {
+			orders = append(orders, *o)
+		}
+	}
+	return orders
+}
+
+/*
+All recorded orders in the order they were first seen, final orders are kept for Keep.
+*/
+func (m *OrderManager) Orders() []ManagedOrder {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	orders := make([]ManagedOrder, 0, len(m.orders))
+	for _, o := range m.orders {
+		orders = append(orders, *o)
+	}
+	return orders
+}
@@ -0,0 +1,202 @@
+package okex
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pushOrders(t *testing.T, m *OrderManager, frame string) {
+	rsp, err := loadResponse([]byte(frame))
+	require.True(t, err == nil, err)
+	require.True(t, m.OnOrderPush(rsp) == nil)
+}
+
+func TestOrderManager_SwapLifecycle(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handle(POST, SWAP_ORDER, `{"order_id":"64-2a-1","client_oid":"","result":"true","error_code":"","error_message":""}`)
+	s.handle(POST, "/api/swap/v3/cancel_order/BTC-USD-SWAP/64-2a-1", `{"order_id":"64-2a-1","result":"true"}`)
+	m := NewOrderManager(s.client())
+
+	var changes []ManagedOrder
+	m.OnChange(func(old, new ManagedOrder) {
+		changes = append(changes, new)
+	})
+
+	o, err := m.PlaceSwapOrder("BTC-USD-SWAP", &BasePlaceOrderInfo{Type: "1", Price: "9000", Size: "10"})
+	require.True(t, err == nil, err)
+	assert.Equal(t, "64-2a-1", o.OrderId)
+	assert.Equal(t, ORDER_STATE_OPEN, o.State)
+	assert.True(t, strings.HasPrefix(o.ClientOid, "om"))
+	assert.True(t, strings.Contains(s.lastRequest().Body, `"client_oid":"`+o.ClientOid+`"`))
+
+	pushOrders(t, m, `{"table":"swap/order","data":[{"instrument_id":"BTC-USD-SWAP","order_id":"64-2a-1","client_oid":"`+o.ClientOid+`","state":"1","filled_qty":"4","price_avg":"9000"}]}`)
+	// a late open push must not undo the partial fill
+	pushOrders(t, m, `{"table":"swap/order","data":[{"instrument_id":"BTC-USD-SWAP","order_id":"64-2a-1","state":"0","filled_qty":"0"}]}`)
+	got, ok := m.Order(MARKET_SWAP, "64-2a-1")
+	require.True(t, ok)
+	assert.Equal(t, ORDER_STATE_PARTIALLY_FILLED, got.State)
+	assert.Equal(t, "4", got.FilledSize)
+
+	require.True(t, m.CancelOrder(MARKET_SWAP, o.ClientOid) == nil)
+	got, _ = m.Order(MARKET_SWAP, "64-2a-1")
+	assert.Equal(t, ORDER_STATE_CANCELING, got.State)
+
+	pushOrders(t, m, `{"table":"swap/order","data":[{"instrument_id":"BTC-USD-SWAP","order_id":"64-2a-1","state":"-1","filled_qty":"4"}]}`)
+	got, _ = m.Order(MARKET_SWAP, "64-2a-1")
+	assert.Equal(t, ORDER_STATE_CANCELED, got.State)
+	assert.Equal(t, 0, len(m.OpenOrders("")))
+
+	var states []int
+	for _, c := range changes {
+		states = append(states, c.State)
+	}
+	assert.Equal(t, []int{ORDER_STATE_OPEN, ORDER_STATE_PARTIALLY_FILLED, ORDER_STATE_CANCELING, ORDER_STATE_CANCELED}, states)
+}
+
+func TestOrderManager_SpotOrders(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handleFunc(POST, SPOT_ORDERS, func(r fakeRequest) string {
+		if strings.Contains(r.Body, `"side":"sell"`) {
+			return `{"order_id":"-1","client_oid":"","result":false,"error_code":"33017","error_message":"Insufficient balance"}`
+		}
+		return `{"order_id":"2510789768709120","client_oid":"","result":true,"error_code":"","error_message":""}`
+	})
+	s.handle(POST, MARGIN_ORDERS, `{"order_id":"2510789768709121","client_oid":"","result":true}`)
+	m := NewOrderManager(s.client())
+
+	_, err := m.PlaceSpotOrder(NewSpotLimitOrder("BTC-USDT", SPOT_SIDE_SELL, "9000", "1"))
+	assert.True(t, err != nil)
+	failed := m.Orders()[0]
+	assert.Equal(t, ORDER_STATE_FAILED, failed.State)
+	assert.Equal(t, "33017", failed.ErrorCode)
+
+	o, err := m.PlaceSpotOrder(NewSpotLimitOrder("BTC-USDT", SPOT_SIDE_BUY, "8000", "1").WithClientOid("mine1"))
+	require.True(t, err == nil, err)
+	assert.Equal(t, "mine1", o.ClientOid)
+
+	mo, err := m.PlaceSpotOrder(NewMarginOrder(NewSpotMarketSell("BTC-USDT", "0.5")))
+	require.True(t, err == nil, err)
+	assert.Equal(t, MARKET_MARGIN, mo.Market)
+
+	pushOrders(t, m, `{"table":"spot/order","data":[
+		{"instrument_id":"BTC-USDT","order_id":"2510789768709120","client_oid":"mine1","status":"filled","filled_size":"1","side":"buy"},
+		{"instrument_id":"BTC-USDT","order_id":"2510789768709121","status":"part_filled","filled_size":"0.2","side":"sell","margin_trading":"2"},
+		{"instrument_id":"ETH-USDT","order_id":"777","status":"open","filled_size":"0","side":"buy","price":"200","size":"3"}]}`)
+
+	got, _ := m.Order(MARKET_SPOT, "mine1")
+	assert.Equal(t, ORDER_STATE_FILLED, got.State)
+	got, _ = m.Order(MARKET_MARGIN, "2510789768709121")
+	assert.Equal(t, ORDER_STATE_PARTIALLY_FILLED, got.State)
+	adopted, ok := m.Order(MARKET_SPOT, "777")
+	require.True(t, ok)
+	assert.Equal(t, "ETH-USDT", adopted.InstrumentId)
+	assert.Equal(t, 4, len(m.Orders()))
+	assert.Equal(t, 2, len(m.OpenOrders("")))
+}
+
+func TestOrderManager_ClientOrders(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handle(POST, FUTURES_ORDER, `{"order_id":"-1","client_oid":"","result":false,"error_code":32015,"error_message":"Margin ratio is lower than 100%"}`)
+	s.handleFunc(POST, SWAP_ORDERS, func(r fakeRequest) string {
+		info := PlaceOrdersInfo{}
+		JsonString2Struct(r.Body, &info)
+		return `{"order_info":[
+			{"order_id":"64-2a-2","client_oid":"` + info.OrderData[1].ClientOid + `","result":"true","error_code":"0","error_message":""},
+			{"order_id":"64-2a-1","client_oid":"` + info.OrderData[0].ClientOid + `","result":"true","error_code":"0","error_message":""}]}`
+	})
+	s.handle(POST, SWAP_ORDER, `{"order_id":"64-2a-3","client_oid":"s3","result":"true","error_code":"","error_message":""}`)
+	s.handle(POST, SPOT_BATCH_ORDERS, `{"btc-usdt":[{"order_id":"11","client_oid":"b1","result":true},{"order_id":"-1","client_oid":"b2","result":false,"error_code":"33017","error_message":"Insufficient balance"}]}`)
+	c := s.client()
+	m := NewOrderManager(c)
+	c.Orders = m
+
+	_, err := c.PostFuturesOrder("BTC-USD-190628", "1", "9000", "1", nil)
+	require.True(t, err == nil, err)
+	failed := m.Orders()[0]
+	assert.Equal(t, MARKET_FUTURES, failed.Market)
+	assert.Equal(t, ORDER_STATE_FAILED, failed.State)
+	assert.Equal(t, "32015", failed.ErrorCode)
+	assert.Equal(t, "Margin ratio is lower than 100%", failed.ErrorMessage)
+	assert.True(t, strings.Contains(s.lastRequest().Body, `"client_oid":"`+failed.ClientOid+`"`))
+
+	orders := []*BasePlaceOrderInfo{{Type: "1", Price: "9000", Size: "1"}, {Type: "2", Price: "9100", Size: "2"}}
+	_, err = c.PostSwapOrders("BTC-USD-SWAP", orders)
+	require.True(t, err == nil, err)
+	assert.Equal(t, "", orders[0].ClientOid)
+	open := m.OpenOrders("BTC-USD-SWAP")
+	require.Equal(t, 2, len(open))
+	assert.Equal(t, "64-2a-1", open[0].OrderId)
+	assert.Equal(t, "1", open[0].Side)
+	assert.Equal(t, "64-2a-2", open[1].OrderId)
+
+	infos, err := BuildSpotBatchOrders(
+		NewSpotLimitOrder("BTC-USDT", SPOT_SIDE_BUY, "8000", "1").WithClientOid("b1"),
+		NewSpotLimitOrder("BTC-USDT", SPOT_SIDE_BUY, "7000", "1").WithClientOid("b2"))
+	require.True(t, err == nil, err)
+	_, err = c.PostSpotBatchOrders(&infos)
+	require.True(t, err == nil, err)
+	got, ok := m.Order(MARKET_SPOT, "b1")
+	require.True(t, ok)
+	assert.Equal(t, "11", got.OrderId)
+	got, _ = m.Order(MARKET_SPOT, "b2")
+	assert.Equal(t, ORDER_STATE_FAILED, got.State)
+
+	// placed through the manager, recorded once
+	_, err = m.PlaceSwapOrder("BTC-USD-SWAP", &BasePlaceOrderInfo{ClientOid: "s3", Type: "1", Price: "9000", Size: "1"})
+	require.True(t, err == nil, err)
+	assert.Equal(t, 6, len(m.Orders()))
+}
+
+func TestOrderManager_Reconcile(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handle(POST, FUTURES_ORDER, `{"order_id":"100","client_oid":"","result":true,"error_code":"0","error_message":""}`)
+	s.handle(POST, SWAP_ORDER, `{"order_id":"64-2a-9","result":"true"}`)
+	s.handle(GET, "/api/futures/v3/orders/BTC-USD-190628", `{"result":true,"order_info":[]}`)
+	s.handle(GET, "/api/futures/v3/orders/BTC-USD-190628/100", `{"instrument_id":"BTC-USD-190628","order_id":"100","state":"-1","filled_qty":"0"}`)
+	s.handle(GET, "/api/swap/v3/orders/BTC-USD-SWAP", `{"order_info":[
+		{"instrument_id":"BTC-USD-SWAP","order_id":"64-2a-9","state":"1","filled_qty":"3","size":"10","price":"9000","type":"1","timestamp":"2019-04-16T06:14:27.000Z"},
+		{"instrument_id":"BTC-USD-SWAP","order_id":"64-2a-10","state":"0","filled_qty":"0","size":"5","price":"8000","type":"2","timestamp":"2019-04-16T06:14:27.000Z"}]}`)
+	m := NewOrderManager(s.client())
+
+	_, err := m.PlaceFuturesOrder("BTC-USD-190628", "1", "9000", "1", nil)
+	require.True(t, err == nil, err)
+	_, err = m.PlaceSwapOrder("BTC-USD-SWAP", &BasePlaceOrderInfo{Type: "1", Price: "9000", Size: "10"})
+	require.True(t, err == nil, err)
+
+	require.True(t, m.Reconcile() == nil)
+
+	futures, _ := m.Order(MARKET_FUTURES, "100")
+	assert.Equal(t, ORDER_STATE_CANCELED, futures.State)
+	swap, _ := m.Order(MARKET_SWAP, "64-2a-9")
+	assert.Equal(t, ORDER_STATE_PARTIALLY_FILLED, swap.State)
+	assert.Equal(t, "3", swap.FilledSize)
+	adopted, ok := m.Order(MARKET_SWAP, "64-2a-10")
+	require.True(t, ok)
+	assert.Equal(t, "2", adopted.Side)
+	assert.Equal(t, 2, len(m.OpenOrders("BTC-USD-SWAP")))
+	assert.Equal(t, 0, len(m.OpenOrders("BTC-USD-190628")))
+
+	// the canceled futures order is forgotten after Keep, the open ones stay
+	m.Keep = time.Hour
+	require.True(t, m.Reconcile() == nil)
+	assert.Equal(t, 3, len(m.Orders()))
+	m.lock.Lock()
+	m.byOrderId[orderKey(MARKET_FUTURES, "100")].UpdatedAt = time.Now().Add(-2 * time.Hour)
+	m.lock.Unlock()
+	require.True(t, m.Reconcile() == nil)
+	_, ok = m.Order(MARKET_FUTURES, "100")
+	assert.False(t, ok)
+	assert.Equal(t, 2, len(m.Orders()))
+	assert.Equal(t, 2, len(m.OpenOrders("BTC-USD-SWAP")))
+	m.lock.Lock()
+	assert.Equal(t, 2, len(m.byOrderId))
+	m.lock.Unlock()
+}
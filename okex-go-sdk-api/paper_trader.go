@@ -0,0 +1,1358 @@
+package okex
+
+/*
+ PaperTrader executes spot and swap orders against live market data without sending them. It
+ implements the order placement, cancel and query methods of Client declared by SpotOrderApi and
+ SwapOrderApi, so a strategy written against these interfaces runs unchanged on paper.
+
+ An order reaches the simulated exchange Latency after it was placed. A marketable order then takes
+ the liquidity of the order book kept by OKWSAgent, the rest of a limit order rests at its price.
+ A resting buy fills as maker when a sell trade is pushed at or below its price or when the asks
+ cross it, and the same for sells. There is no queue position and the market data itself is never
+ changed by the simulated fills.
+
+ Fees are charged at the maker and taker rates of the market. Spot balances and the swap margin
+ accounts and positions are simulated, the swap account of an instrument is the one of its
+ settlement currency: the coin for the coin margined contracts, USDT for the others.
+
+	trader := NewPaperTrader(agent)
+	trader.Deposit(MARKET_SPOT, "USDT", 10000)
+	agent.Subscribe(CHNL_SPOT_DEPTH, "BTC-USDT", trader.OnPush)
+	agent.Subscribe(CHNL_SPOT_TRADE, "BTC-USDT", trader.OnPush)
+
+	var api SpotOrderApi = trader // client in production
+	api.PostSpotOrder(NewSpotLimitOrder("BTC-USDT", SPOT_SIDE_BUY, "9000", "0.01"))
+*/
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	PAPER_LIQUIDITY_MAKER = "M"
+	PAPER_LIQUIDITY_TAKER = "T"
+
+	// swap order_type of a market order, along with match_price 1
+	paperSwapMarket = 4
+	paperEpsilon    = 1e-9
+)
+
+var (
+	ERR_PAPER_ORDER        = errors.New(`paper trader: invalid order`)
+	ERR_PAPER_NOT_FOUND    = errors.New(`paper trader: order not found`)
+	ERR_PAPER_FINAL        = errors.New(`paper trader: order already filled or canceled`)
+	ERR_PAPER_BALANCE      = errors.New(`paper trader: insufficient balance`)
+	ERR_PAPER_POSITION     = errors.New(`paper trader: insufficient position to close`)
+	ERR_PAPER_NO_BOOK      = errors.New(`paper trader: no order book to price a market order`)
+	ERR_PAPER_CONTRACT_VAL = errors.New(`paper trader: unknown contract value, see SetContractVal`)
+	ERR_PAPER_MARKET       = errors.New(`paper trader: market not simulated, only spot and swap`)
+)
+
+/*
+The spot order methods of Client, implemented by PaperTrader too.
+*/
+type SpotOrderApi interface {
+	PostSpotOrders(side, instrument_id string, optionalOrderInfo *map[string]string) (*map[string]interface{}, error)
+	PostSpotOrder(order SpotOrderBuilder) (*map[string]interface{}, error)
+	PostSpotCancelOrders(instrumentId, orderOrClientId string) (*map[string]interface{}, error)
+	GetSpotOrdersById(instrumentId, orderOrClientId string) (*map[string]interface{}, error)
+	GetSpotOrdersPending(options *map[string]string) ([]SpotOrder, error)
+	GetSpotAccounts() ([]SpotAccount, error)
+}
+
+/*
+The swap order methods of Client, implemented by PaperTrader too.
+*/
+type SwapOrderApi interface {
+	PostSwapOrder(instrumentId string, order *BasePlaceOrderInfo) (*SwapOrderResult, error)
+	PostSwapOrders(instrumentId string, orders []*BasePlaceOrderInfo) (*SwapOrdersResult, error)
+	PostSwapCancelOrder(instrumentId string, orderId string) (*SwapCancelOrderResult, error)
+	GetSwapOrderById(instrumentId, orderOrClientId string) (*BaseOrderInfo, error)
+	GetSwapOrderByInstrumentId(instrumentId string, paramMap map[string]string) (*SwapOrdersInfo, error)
+	GetSwapPositionByInstrument(instrumentId string) (*SwapPosition, error)
+	GetSwapAccount(instrumentId string) (*SwapAccount, error)
+}
+
+var (
+	_ SpotOrderApi = (*Client)(nil)
+	_ SwapOrderApi = (*Client)(nil)
+	_ SpotOrderApi = (*PaperTrader)(nil)
+	_ SwapOrderApi = (*PaperTrader)(nil)
+)
+
+/*
+Where the order books are read from, OKWSAgent keeps the books of the depth channels subscribed.
+*/
+type BookSource interface {
+	GetOrderBook(channel, instrumentID string) *WSDepthItem
+}
+
+/*
+Fee rates of the notional, a negative rate is a rebate.
+*/
+type PaperFee struct {
+	Maker float64
+	Taker float64
+}
+
+/*
+A simulated fill. Size is in contracts for swap, Fee is paid in FeeCurrency, negative for a rebate.
+*/
+type PaperFill struct {
+	Market       string
+	InstrumentId string
+	OrderId      string
+	ClientOid    string
+	Side         string // buy or sell
+	Type         string // spot: limit or market, swap: type 1..4
+	Price        float64
+	Size         float64
+	Fee          float64
+	FeeCurrency  string
+	Liquidity    string // PAPER_LIQUIDITY_*
+	Time         time.Time
+}
+
+type paperOrder struct {
+	market       string
+	instrumentId string
+	orderId      string
+	clientOid    string
+	side         string
+	oType        string
+	orderType    int
+	isMarket     bool
+	price        float64
+	size         float64
+	notional     float64 // spot market buy: quote currency to spend
+	filled       float64
+	filledValue  float64 // sum of price * size
+	fee          float64
+	state        int
+	createdAt    time.Time
+	activeAt     time.Time
+	cancelAt     time.Time
+	live         bool    // reached the simulated exchange
+	frozen       float64 // balance held until the order is final
+	taken        map[float64]paperTaken
+}
+
+func (o *paperOrder) buy() bool {
+	return o.side == SPOT_SIDE_BUY
+}
+
+func (o *paperOrder) final() bool {
+	return o.state == ORDER_STATE_FILLED || o.state == ORDER_STATE_CANCELED || o.state == ORDER_STATE_FAILED
+}
+
+func (o *paperOrder) byNotional() bool {
+	return o.market == MARKET_SPOT && o.isMarket && o.buy()
+}
+
+func (o *paperOrder) done() bool {
+	if o.byNotional() {
+		return o.notional-o.filledValue <= paperEpsilon
+	}
+	return o.size-o.filled <= paperEpsilon
+}
+
+func (o *paperOrder) crosses(price float64) bool {
+	if o.isMarket {
+		return true
+	}
+	if o.buy() {
+		return price <= o.price
+	}
+	return price >= o.price
+}
+
+func (o *paperOrder) priceAvg() float64 {
+	if o.filled == 0 {
+		return 0
+	}
+	return o.filledValue / o.filled
+}
+
+type paperBalance struct {
+	balance float64
+	hold    float64
+}
+
+type paperHolding struct {
+	position float64
+	avgCost  float64
+	margin   float64
+	realized float64
+	closing  float64 // size of the open close orders
+}
+
+type paperLevel struct {
+	price  float64
+	size   float64
+	pushed float64 // size of the level in the book, before the pass took from it
+}
+
+/*
+Liquidity an order took from a price level, kept until the level pushed changes so that the
+same book pushed again does not fill the order twice.
+*/
+type paperTaken struct {
+	pushed float64
+	size   float64
+}
+
+// size left for o at level l, a level changed since o took from it is whole again
+func (o *paperOrder) available(l *paperLevel) (float64, paperTaken) {
+	taken, ok := o.taken[l.price]
+	if !ok || taken.pushed != l.pushed {
+		taken = paperTaken{pushed: l.pushed}
+	}
+	return l.size - taken.size, taken
+}
+
+/*
+Levels of a book for one matching pass, the liquidity taken by the simulated orders is removed so
+that two orders of the pass do not take the same size.
+*/
+type paperBook struct {
+	asks []paperLevel
+	bids []paperLevel
+}
+
+type PaperTrader struct {
+	// Delay between placing or canceling an order and its effect.
+	Latency time.Duration
+	SpotFee PaperFee
+	SwapFee PaperFee
+	// Leverage of the swap positions, the margin of a position is its value / Leverage.
+	Leverage float64
+	// Optional pre trade checks, as Client.Risk.
+	Risk *RiskGuard
+	// Clock of the simulation, time.Now by default.
+	Now func() time.Time
+
+	book BookSource
+
+	lock         sync.Mutex
+	seq          int64
+	orders       map[string]*paperOrder
+	clientOids   map[string]string
+	all          []*paperOrder // by placement
+	open         []*paperOrder
+	spot         map[string]*paperBalance
+	swap         map[string]*paperBalance
+	holdings     map[string]map[string]*paperHolding // instrument -> long/short
+	contractVals map[string]float64
+	marks        map[string]float64
+	bookChannels map[string]string
+	fills        []PaperFill
+	fillCbs      []func(PaperFill)
+}
+
+/*
+A paper trader matching against the books of book, usually an OKWSAgent. Only the books of the
+depth channels pushed to OnPush are read. book may be nil, the orders are then matched against the
+trade pushes only.
+*/
+func NewPaperTrader(book BookSource) *PaperTrader {
+	return &PaperTrader{
+		SpotFee:      PaperFee{Maker: 0.0008, Taker: 0.001},
+		SwapFee:      PaperFee{Maker: 0.0002, Taker: 0.0005},
+		Leverage:     10,
+		Now:          time.Now,
+		book:         book,
+		orders:       map[string]*paperOrder{},
+		clientOids:   map[string]string{},
+		spot:         map[string]*paperBalance{},
+		swap:         map[string]*paperBalance{},
+		holdings:     map[string]map[string]*paperHolding{},
+		contractVals: map[string]float64{},
+		marks:        map[string]float64{},
+		bookChannels: map[string]string{},
+	}
+}
+
+/*
+Credit a simulated spot balance or swap margin account, market is MARKET_SPOT or MARKET_SWAP.
+*/
+func (t *PaperTrader) Deposit(market, currency string, amount float64) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	balances, err := t.balances(market)
+	if err != nil {
+		return err
+	}
+	t.balance(balances, currency).balance += amount
+	return nil
+}
+
+/*
+Set the contract value of a swap instrument, in USD for the coin margined contracts.
+*/
+func (t *PaperTrader) SetContractVal(instrumentId string, contractVal float64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.contractVals[instrumentId] = contractVal
+}
+
+/*
+Register a callback for every simulated fill, it runs outside of the trader lock.
+*/
+func (t *PaperTrader) OnFill(cb func(PaperFill)) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.fillCbs = append(t.fillCbs, cb)
+}
+
+/*
+The simulated fills so far, oldest first.
+*/
+func (t *PaperTrader) Fills() []PaperFill {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return append([]PaperFill{}, t.fills...)
+}
+
+func (t *PaperTrader) balances(market string) (map[string]*paperBalance, error) {
+	switch market {
+	case MARKET_SPOT:
+		return t.spot, nil
+	case MARKET_SWAP:
+		return t.swap, nil
+	}
+	return nil, ERR_PAPER_MARKET
+}
+
+func (t *PaperTrader) balance(balances map[string]*paperBalance, currency string) *paperBalance {
+	currency = strings.ToUpper(currency)
+	b, ok := balances[currency]
+	if !ok {
+		b = &paperBalance{}
+		balances[currency] = b
+	}
+	return b
+}
+
+func (t *PaperTrader) holding(instrumentId, direction string) *paperHolding {
+	h, ok := t.holdings[instrumentId]
+	if !ok {
+		h = map[string]*paperHolding{DIRECTION_LONG: {}, DIRECTION_SHORT: {}}
+		t.holdings[instrumentId] = h
+	}
+	return h[direction]
+}
+
+// currencies of a spot pair, eg. BTC-USDT -> BTC, USDT
+func spotCurrencies(instrumentId string) (string, string) {
+	parts := strings.Split(instrumentId, "-")
+	if len(parts) < 2 {
+		return instrumentId, ""
+	}
+	return parts[0], parts[1]
+}
+
+func swapSettleCurrency(instrumentId string) string {
+	if isLinearContract(instrumentId) {
+		return "USDT"
+	}
+	base, _ := spotCurrencies(instrumentId)
+	return base
+}
+
+func (t *PaperTrader) swapValue(instrumentId string, size, price float64) float64 {
+	return contractValue(instrumentId, size, t.contractVals[instrumentId], price)
+}
+
+func (t *PaperTrader) swapPnl(instrumentId, direction string, size, avgCost, price float64) float64 {
+	return contractPnl(instrumentId, direction, size, t.contractVals[instrumentId], avgCost, price)
+}
+
+func formatPaper(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func paperDirection(oType int) string {
+	if oType == OPEN_LONG || oType == CLOSE_LONG {
+		return DIRECTION_LONG
+	}
+	return DIRECTION_SHORT
+}
+
+/*
+Snapshot of the book of an instrument, nil without a book source or before the first push of its
+depth channel: the books of the markets not subscribed are not asked for.
+*/
+func (t *PaperTrader) snapshot(instrumentId string) *paperBook {
+	channel := t.bookChannels[instrumentId]
+	if t.book == nil || channel == "" {
+		return nil
+	}
+	depth := t.book.GetOrderBook(channel, instrumentId)
+	if depth == nil {
+		return nil
+	}
+	levels := func(rows [][4]interface{}) []paperLevel {
+		ls := make([]paperLevel, 0, len(rows))
+		for _, row := range rows {
+			size := anyToFloat(row[1])
+			ls = append(ls, paperLevel{price: anyToFloat(row[0]), size: size, pushed: size})
+		}
+		return ls
+	}
+	b := &paperBook{asks: levels(depth.Asks), bids: levels(depth.Bids)}
+	sort.Slice(b.asks, func(i, j int) bool { return b.asks[i].price < b.asks[j].price })
+	sort.Slice(b.bids, func(i, j int) bool { return b.bids[i].price > b.bids[j].price })
+	return b
+}
+
+// the levels an order takes from
+func (b *paperBook) opposite(o *paperOrder) []paperLevel {
+	if b == nil {
+		return nil
+	}
+	if o.buy() {
+		return b.asks
+	}
+	return b.bids
+}
+
+func (t *PaperTrader) newOrder(market, instrumentId, clientOid string) (*paperOrder, error) {
+	if instrumentId == "" {
+		return nil, ERR_PAPER_ORDER
+	}
+	if clientOid != "" {
+		if _, ok := t.clientOids[clientOid]; ok {
+			return nil, ERR_PAPER_ORDER
+		}
+	}
+	now := t.Now()
+	return &paperOrder{
+		market:       market,
+		instrumentId: instrumentId,
+		clientOid:    clientOid,
+		state:        ORDER_STATE_OPEN,
+		createdAt:    now,
+		activeAt:     now.Add(t.Latency),
+	}, nil
+}
+
+// the order is accepted, refused orders do not take an order id
+func (t *PaperTrader) addOrder(o *paperOrder) {
+	t.seq++
+	o.orderId = strconv.FormatInt(t.seq, 10)
+	t.orders[o.orderId] = o
+	if o.clientOid != "" {
+		t.clientOids[o.clientOid] = o.orderId
+	}
+	t.all = append(t.all, o)
+	t.open = append(t.open, o)
+}
+
+func (t *PaperTrader) find(instrumentId, orderOrClientId string) (*paperOrder, error) {
+	o, ok := t.orders[orderOrClientId]
+	if !ok {
+		o, ok = t.orders[t.clientOids[orderOrClientId]]
+	}
+	if !ok || o.instrumentId != instrumentId {
+		return nil, ERR_PAPER_NOT_FOUND
+	}
+	return o, nil
+}
+
+/*
+Place a spot order with the params of Client.PostSpotOrders, margin orders are not simulated.
+*/
+func (t *PaperTrader) PostSpotOrders(side, instrument_id string, optionalOrderInfo *map[string]string) (*map[string]interface{}, error) {
+	params := map[string]string{}
+	if optionalOrderInfo != nil {
+		for k, v := range *optionalOrderInfo {
+			params[k] = v
+		}
+	}
+	params["side"] = side
+	if err := t.Risk.CheckOrders(riskOrderOf(MARKET_SPOT, instrument_id, params)); err != nil {
+		return nil, err
+	}
+
+	t.lock.Lock()
+	o, err := t.placeSpot(instrument_id, params)
+	var fills []PaperFill
+	if err == nil {
+		fills = t.process(t.Now(), nil, nil)
+	}
+	t.lock.Unlock()
+	t.notify(fills)
+	if err != nil {
+		return nil, err
+	}
+	return &map[string]interface{}{"order_id": o.orderId, "client_oid": o.clientOid, "result": true,
+		"error_code": "", "error_message": ""}, nil
+}
+
+func (t *PaperTrader) placeSpot(instrumentId string, params map[string]string) (*paperOrder, error) {
+	if params["margin_trading"] == MARGIN_TRADING_MARGIN {
+		return nil, ERR_PAPER_ORDER
+	}
+	o, err := t.newOrder(MARKET_SPOT, instrumentId, params["client_oid"])
+	if err != nil {
+		return nil, err
+	}
+	o.side, o.oType = params["side"], params["type"]
+	if o.oType == "" {
+		o.oType = SPOT_TYPE_LIMIT
+	}
+	o.orderType = StringToInt(params["order_type"])
+	o.isMarket = o.oType == SPOT_TYPE_MARKET
+	o.price, o.size, o.notional = toFloat(params["price"]), toFloat(params["size"]), toFloat(params["notional"])
+
+	if o.side != SPOT_SIDE_BUY && o.side != SPOT_SIDE_SELL || o.orderType < ORDER_TYPE_NORMAL || o.orderType > ORDER_TYPE_IOC {
+		return nil, ERR_PAPER_ORDER
+	}
+	switch {
+	case o.oType != SPOT_TYPE_LIMIT && o.oType != SPOT_TYPE_MARKET:
+		return nil, ERR_PAPER_ORDER
+	case o.oType == SPOT_TYPE_LIMIT && (o.price <= 0 || o.size <= 0):
+		return nil, ERR_PAPER_ORDER
+	case o.oType == SPOT_TYPE_MARKET && o.buy() && o.notional <= 0:
+		return nil, ERR_PAPER_ORDER
+	case o.oType == SPOT_TYPE_MARKET && !o.buy() && o.size <= 0:
+		return nil, ERR_PAPER_ORDER
+	}
+
+	base, quote := spotCurrencies(instrumentId)
+	currency, need := base, o.size
+	if o.buy() {
+		currency, need = quote, o.price*o.size
+		if o.isMarket {
+			need = o.notional
+		}
+	}
+	b := t.balance(t.spot, currency)
+	if b.balance-b.hold < need-paperEpsilon {
+		return nil, ERR_PAPER_BALANCE
+	}
+	b.hold += need
+	o.frozen = need
+	t.addOrder(o)
+	return o, nil
+}
+
+/*
+Place a spot order built by a SpotOrderBuilder.
+*/
+func (t *PaperTrader) PostSpotOrder(order SpotOrderBuilder) (*map[string]interface{}, error) {
+	if order == nil {
+		return nil, ERR_SPOT_ORDER_NIL
+	}
+	orderInfo, err := order.Build()
+	if err != nil {
+		return nil, err
+	}
+	return t.PostSpotOrders(orderInfo["side"], orderInfo["instrument_id"], &orderInfo)
+}
+
+/*
+Cancel a spot order by order id or client oid, the order is canceled Latency later.
+*/
+func (t *PaperTrader) PostSpotCancelOrders(instrumentId, orderOrClientId string) (*map[string]interface{}, error) {
+	o, fills, err := t.cancel(instrumentId, orderOrClientId)
+	t.notify(fills)
+	if err != nil {
+		return nil, err
+	}
+	return &map[string]interface{}{"order_id": o.orderId, "client_oid": o.clientOid, "result": true,
+		"error_code": "", "error_message": ""}, nil
+}
+
+func (t *PaperTrader) cancel(instrumentId, orderOrClientId string) (paperOrder, []PaperFill, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	o, err := t.find(instrumentId, orderOrClientId)
+	if err != nil {
+		return paperOrder{}, nil, err
+	}
+	if o.final() {
+		return paperOrder{}, nil, ERR_PAPER_FINAL
+	}
+	now := t.Now()
+	if o.cancelAt.IsZero() {
+		o.cancelAt = now.Add(t.Latency)
+		o.state = ORDER_STATE_CANCELING
+	}
+	fills := t.process(now, nil, nil)
+	return *o, fills, nil
+}
+
+var spotStatusNames = map[int]string{
+	ORDER_STATE_FAILED:           "failure",
+	ORDER_STATE_CANCELED:         "cancelled",
+	ORDER_STATE_OPEN:             "open",
+	ORDER_STATE_PARTIALLY_FILLED: "part_filled",
+	ORDER_STATE_FILLED:           "filled",
+	ORDER_STATE_ORDERING:         "ordering",
+	ORDER_STATE_CANCELING:        "canceling",
+}
+
+func (t *PaperTrader) spotOrder(o *paperOrder) SpotOrder {
+	created := candleTime(o.createdAt)
+	notional := ""
+	if o.byNotional() {
+		notional = formatPaper(o.notional)
+	}
+	return SpotOrder{
+		OrderID:        o.orderId,
+		InstrumentID:   o.instrumentId,
+		ProductID:      o.instrumentId,
+		ClientOid:      o.clientOid,
+		CreatedAt:      created,
+		Timestamp:      created,
+		Status:         spotStatusNames[o.state],
+		Type:           o.oType,
+		Side:           o.side,
+		NotionalStr:    notional,
+		FilledNotional: o.filledValue,
+		FilledSize:     o.filled,
+		OrderType:      float64(o.orderType),
+		Price:          o.price,
+		Size:           o.size,
+	}
+}
+
+/*
+A spot order by order id or client oid, with the fields of the exchange response.
+*/
+func (t *PaperTrader) GetSpotOrdersById(instrumentId, orderOrClientId string) (*map[string]interface{}, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	o, err := t.find(instrumentId, orderOrClientId)
+	if err != nil || o.market != MARKET_SPOT {
+		return nil, ERR_PAPER_NOT_FOUND
+	}
+	s := t.spotOrder(o)
+	r := map[string]interface{}{
+		"order_id":        s.OrderID,
+		"client_oid":      s.ClientOid,
+		"instrument_id":   s.InstrumentID,
+		"product_id":      s.ProductID,
+		"created_at":      s.CreatedAt,
+		"timestamp":       s.Timestamp,
+		"status":          s.Status,
+		"state":           strconv.Itoa(o.state),
+		"type":            s.Type,
+		"side":            s.Side,
+		"order_type":      strconv.Itoa(o.orderType),
+		"price":           formatPaper(o.price),
+		"size":            formatPaper(o.size),
+		"notional":        s.NotionalStr,
+		"filled_size":     formatPaper(o.filled),
+		"filled_notional": formatPaper(o.filledValue),
+		"price_avg":       formatPaper(o.priceAvg()),
+		"fee":             formatPaper(-o.fee),
+	}
+	return &r, nil
+}
+
+/*
+The open spot orders, newest first, options may filter by instrument_id.
+*/
+func (t *PaperTrader) GetSpotOrdersPending(options *map[string]string) ([]SpotOrder, error) {
+	instrumentId := ""
+	if options != nil {
+		instrumentId = (*options)["instrument_id"]
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	orders := []SpotOrder{}
+	for i := len(t.open) - 1; i >= 0; i-- {
+		o := t.open[i]
+		if o.market == MARKET_SPOT && (instrumentId == "" || o.instrumentId == instrumentId) {
+			orders = append(orders, t.spotOrder(o))
+		}
+	}
+	return orders, nil
+}
+
+/*
+The simulated spot balances, by currency.
+*/
+func (t *PaperTrader) GetSpotAccounts() ([]SpotAccount, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	accounts := []SpotAccount{}
+	for currency, b := range t.spot {
+		accounts = append(accounts, SpotAccount{Currency: currency, Balance: b.balance, Available: b.balance - b.hold, Hold: b.hold})
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].Currency < accounts[j].Currency })
+	return accounts, nil
+}
+
+/*
+Place a swap order with the params of Client.PostSwapOrder.
+*/
+func (t *PaperTrader) PostSwapOrder(instrumentId string, order *BasePlaceOrderInfo) (*SwapOrderResult, error) {
+	if order == nil {
+		return nil, ERR_PAPER_ORDER
+	}
+	if err := t.Risk.CheckOrders(swapRiskOrder(instrumentId, order)); err != nil {
+		return nil, err
+	}
+	t.lock.Lock()
+	o, err := t.placeSwap(instrumentId, order)
+	var fills []PaperFill
+	if err == nil {
+		fills = t.process(t.Now(), nil, nil)
+	}
+	t.lock.Unlock()
+	t.notify(fills)
+	if err != nil {
+		return nil, err
+	}
+	r := SwapOrderResult{}
+	r.OrderId, r.ClientOid, r.Result, r.ErrorCode = o.orderId, o.clientOid, "true", "0"
+	return &r, nil
+}
+
+/*
+Place several swap orders, the orders refused are reported by their error code and message.
+*/
+func (t *PaperTrader) PostSwapOrders(instrumentId string, orders []*BasePlaceOrderInfo) (*SwapOrdersResult, error) {
+	riskOrders := []RiskOrder{}
+	for _, order := range orders {
+		if order == nil {
+			return nil, ERR_PAPER_ORDER
+		}
+		riskOrders = append(riskOrders, swapRiskOrder(instrumentId, order))
+	}
+	if err := t.Risk.CheckOrders(riskOrders...); err != nil {
+		return nil, err
+	}
+	r := SwapOrdersResult{}
+	t.lock.Lock()
+	for _, order := range orders {
+		o, err := t.placeSwap(instrumentId, order)
+		if err != nil {
+			r.OrderInfo = append(r.OrderInfo, BaseSwapOrderResult{ClientOid: order.ClientOid, ErrorCode: "-1",
+				ErrorMessage: err.Error(), Result: "false"})
+			continue
+		}
+		r.OrderInfo = append(r.OrderInfo, BaseSwapOrderResult{OrderId: o.orderId, ClientOid: o.clientOid,
+			ErrorCode: "0", Result: "true"})
+	}
+	fills := t.process(t.Now(), nil, nil)
+	t.lock.Unlock()
+	t.notify(fills)
+	return &r, nil
+}
+
+func (t *PaperTrader) placeSwap(instrumentId string, order *BasePlaceOrderInfo) (*paperOrder, error) {
+	if _, ok := t.contractVals[instrumentId]; !ok {
+		return nil, ERR_PAPER_CONTRACT_VAL
+	}
+	o, err := t.newOrder(MARKET_SWAP, instrumentId, order.ClientOid)
+	if err != nil {
+		return nil, err
+	}
+	oType := StringToInt(order.Type)
+	o.oType = order.Type
+	o.orderType = StringToInt(order.OrderType)
+	o.isMarket = order.MatchPrice == "1" || o.orderType == paperSwapMarket
+	o.side = T3O(oType == OPEN_LONG || oType == CLOSE_SHORT, SPOT_SIDE_BUY, SPOT_SIDE_SELL).(string)
+	o.price, o.size = toFloat(order.Price), toFloat(order.Size)
+	if oType < OPEN_LONG || oType > CLOSE_SHORT || o.orderType < ORDER_TYPE_NORMAL || o.orderType > paperSwapMarket ||
+		o.size <= 0 || !o.isMarket && o.price <= 0 {
+		return nil, ERR_PAPER_ORDER
+	}
+
+	price := o.price
+	if o.isMarket {
+		levels := t.snapshot(instrumentId).opposite(o)
+		if len(levels) == 0 {
+			return nil, ERR_PAPER_NO_BOOK
+		}
+		price = levels[0].price
+	}
+	if oType == CLOSE_LONG || oType == CLOSE_SHORT {
+		h := t.holding(instrumentId, paperDirection(oType))
+		if h.position-h.closing < o.size-paperEpsilon {
+			return nil, ERR_PAPER_POSITION
+		}
+		h.closing += o.size
+	} else {
+		need := t.swapValue(instrumentId, o.size, price) / t.Leverage
+		currency := swapSettleCurrency(instrumentId)
+		if t.swapAvailable(currency) < need-paperEpsilon {
+			return nil, ERR_PAPER_BALANCE
+		}
+		t.balance(t.swap, currency).hold += need
+		o.frozen = need
+	}
+	t.addOrder(o)
+	return o, nil
+}
+
+/*
+Cancel a swap order by order id or client oid, the order is canceled Latency later.
+*/
+func (t *PaperTrader) PostSwapCancelOrder(instrumentId string, orderId string) (*SwapCancelOrderResult, error) {
+	o, fills, err := t.cancel(instrumentId, orderId)
+	t.notify(fills)
+	if err != nil {
+		return nil, err
+	}
+	return &SwapCancelOrderResult{OrderId: o.orderId, Result: "true", ErrorCode: "0"}, nil
+}
+
+func (t *PaperTrader) swapOrder(o *paperOrder) BaseOrderInfo {
+	return BaseOrderInfo{
+		InstrumentId: o.instrumentId,
+		State:        strconv.Itoa(o.state),
+		OrderId:      o.orderId,
+		Timestamp:    o.createdAt,
+		Price:        o.price,
+		PriceAvg:     o.priceAvg(),
+		Size:         o.size,
+		Fee:          -o.fee,
+		FilledQty:    o.filled,
+		ContractVal:  t.contractVals[o.instrumentId],
+		Type:         o.oType,
+		OrderType:    strconv.Itoa(o.orderType),
+		ClientOid:    o.clientOid,
+	}
+}
+
+/*
+A swap order by order id or client oid.
+*/
+func (t *PaperTrader) GetSwapOrderById(instrumentId, orderOrClientId string) (*BaseOrderInfo, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	o, err := t.find(instrumentId, orderOrClientId)
+	if err != nil || o.market != MARKET_SWAP {
+		return nil, ERR_PAPER_NOT_FOUND
+	}
+	info := t.swapOrder(o)
+	return &info, nil
+}
+
+/*
+The swap orders of an instrument newest first, paramMap["state"] is a state, 6 for the unfinished
+and 7 for the completed orders. paramMap["limit"] limits the number of orders.
+*/
+func (t *PaperTrader) GetSwapOrderByInstrumentId(instrumentId string, paramMap map[string]string) (*SwapOrdersInfo, error) {
+	if paramMap["state"] == "" || len(instrumentId) == 0 {
+		return nil, ERR_PAPER_ORDER
+	}
+	state, limit := StringToInt(paramMap["state"]), StringToInt(paramMap["limit"])
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	r := SwapOrdersInfo{OrderInfo: []BaseOrderInfo{}}
+	for i := len(t.all) - 1; i >= 0; i-- {
+		o := t.all[i]
+		if o.market != MARKET_SWAP || o.instrumentId != instrumentId {
+			continue
+		}
+		switch {
+		case state == ORDER_STATE_UNFINISHED && o.final(), state == ORDER_STATE_COMPLETED && !o.final():
+			continue
+		case state != ORDER_STATE_UNFINISHED && state != ORDER_STATE_COMPLETED && state != o.state:
+			continue
+		}
+		r.OrderInfo = append(r.OrderInfo, t.swapOrder(o))
+		if limit > 0 && len(r.OrderInfo) == limit {
+			break
+		}
+	}
+	return &r, nil
+}
+
+/*
+The simulated long and short holdings of a swap instrument.
+*/
+func (t *PaperTrader) GetSwapPositionByInstrument(instrumentId string) (*SwapPosition, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	p := SwapPosition{MarginMode: "crossed", Holding: []SwapPositionHolding{}}
+	for _, direction := range []string{DIRECTION_LONG, DIRECTION_SHORT} {
+		h := t.holdings[instrumentId][direction]
+		if h == nil || h.position <= 0 {
+			continue
+		}
+		p.Holding = append(p.Holding, SwapPositionHolding{
+			Position:        h.position,
+			AvailPosition:   h.position - h.closing,
+			AvgCost:         h.avgCost,
+			SettlementPrice: h.avgCost,
+			InstrumentId:    instrumentId,
+			Leverage:        t.Leverage,
+			RealizedPnl:     h.realized,
+			Side:            direction,
+			Timestamp:       t.Now(),
+			Margin:          formatPaper(h.margin),
+		})
+	}
+	return &p, nil
+}
+
+/*
+The simulated margin account of the settlement currency of a swap instrument.
+*/
+func (t *PaperTrader) GetSwapAccount(instrumentId string) (*SwapAccount, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	currency := swapSettleCurrency(instrumentId)
+	b := t.balance(t.swap, currency)
+	margin, unrealized, realized := t.swapTotals(currency)
+	info := SwapAccountInfo{
+		Equity:            b.balance + unrealized,
+		InstrumentId:      instrumentId,
+		Margin:            margin,
+		MarginFrozen:      b.hold,
+		MarginMode:        "crossed",
+		MaxWithdraw:       math.Max(0, t.swapAvailable(currency)),
+		RealizedPnl:       realized,
+		Timestamp:         t.Now(),
+		TotalAvailBalance: b.balance,
+		UnrealizedPnl:     unrealized,
+	}
+	if margin > 0 {
+		info.MarginRatio = info.Equity / margin / t.Leverage
+	}
+	return &SwapAccount{Info: info}, nil
+}
+
+// margin, unrealized and realized pnl of the positions settled in currency
+func (t *PaperTrader) swapTotals(currency string) (float64, float64, float64) {
+	var margin, unrealized, realized float64
+	for instrumentId, hs := range t.holdings {
+		if swapSettleCurrency(instrumentId) != currency {
+			continue
+		}
+		for direction, h := range hs {
+			margin += h.margin
+			realized += h.realized
+			if h.position > 0 {
+				unrealized += t.swapPnl(instrumentId, direction, h.position, h.avgCost, t.mark(instrumentId, h.avgCost))
+			}
+		}
+	}
+	return margin, unrealized, realized
+}
+
+func (t *PaperTrader) swapAvailable(currency string) float64 {
+	b := t.balance(t.swap, currency)
+	margin, unrealized, _ := t.swapTotals(currency)
+	return b.balance + unrealized - margin - b.hold
+}
+
+// last trade or fill price of an instrument
+func (t *PaperTrader) mark(instrumentId string, fallback float64) float64 {
+	if p, ok := t.marks[instrumentId]; ok {
+		return p
+	}
+	return fallback
+}
+
+/*
+Callback of the depth and trade channels of spot and swap: the books pushed are matched against
+the resting orders, and so are the trades.
+*/
+func (t *PaperTrader) OnPush(obj interface{}) error {
+	switch r := obj.(type) {
+	case *WSDepthTableResponse:
+		crossed := map[string]string{}
+		for _, d := range r.Data {
+			switch {
+			case strings.HasPrefix(r.Table, "spot/"):
+				crossed[d.InstrumentId] = MARKET_SPOT
+			case strings.HasPrefix(r.Table, "swap/"):
+				crossed[d.InstrumentId] = MARKET_SWAP
+			default:
+				continue
+			}
+		}
+		t.lock.Lock()
+		for instrumentId := range crossed {
+			t.bookChannels[instrumentId] = r.Table
+		}
+		fills := t.process(t.Now(), nil, crossed)
+		t.lock.Unlock()
+		t.notify(fills)
+	case *WSTableResponse:
+		var market string
+		switch r.Table {
+		case CHNL_SPOT_TRADE:
+			market = MARKET_SPOT
+		case CHNL_SWAP_TRADE:
+			market = MARKET_SWAP
+		default:
+			return nil
+		}
+		pushes := []tradePush{}
+		if err := decodeTableData(r.Data, &pushes); err != nil {
+			return err
+		}
+		trades := make([]Trade, 0, len(pushes))
+		for _, p := range pushes {
+			trades = append(trades, tradeOf(market, p.InstrumentId, p.TradeId, p.Side, toFloat(p.Price), toFloat(p.Size), p.Timestamp))
+		}
+		t.AddTrades(trades...)
+	}
+	return nil
+}
+
+/*
+Match trades against the resting orders. A sell trade fills the buys priced at or above it, up to
+the trade size, at the order price.
+*/
+func (t *PaperTrader) AddTrades(trades ...Trade) {
+	t.lock.Lock()
+	fills := t.process(t.Now(), trades, nil)
+	t.lock.Unlock()
+	t.notify(fills)
+}
+
+/*
+Run the orders and cancels which reached the simulated exchange by now, without market data.
+*/
+func (t *PaperTrader) Advance(now time.Time) {
+	t.lock.Lock()
+	fills := t.process(now, nil, nil)
+	t.lock.Unlock()
+	t.notify(fills)
+}
+
+/*
+One matching pass: orders reaching the exchange take the book, cancels are applied, then the
+trades and the crossed books of the instruments in crossed fill the resting orders.
+*/
+func (t *PaperTrader) process(now time.Time, trades []Trade, crossed map[string]string) []PaperFill {
+	var fills []PaperFill
+	books := map[string]*paperBook{}
+	bookOf := func(o *paperOrder) *paperBook {
+		b, ok := books[o.instrumentId]
+		if !ok {
+			b = t.snapshot(o.instrumentId)
+			books[o.instrumentId] = b
+		}
+		return b
+	}
+
+	for _, o := range t.open {
+		if !o.live && !o.activeAt.After(now) {
+			o.live = true
+			fills = append(fills, t.take(o, bookOf(o), now)...)
+		}
+		if o.live && !o.final() && !o.cancelAt.IsZero() && !o.cancelAt.After(now) {
+			t.finish(o, ORDER_STATE_CANCELED)
+		}
+	}
+
+	for _, trade := range trades {
+		if trade.Price > 0 {
+			t.marks[trade.InstrumentId] = trade.Price
+		}
+		left := trade.Size
+		for _, o := range t.open {
+			if left <= paperEpsilon {
+				break
+			}
+			if !o.live || o.final() || o.isMarket || o.market != trade.Market || o.instrumentId != trade.InstrumentId {
+				continue
+			}
+			// the taker of the trade sold into the bids or bought the asks
+			if o.buy() == (trade.Side == SPOT_SIDE_BUY) || !o.crosses(trade.Price) {
+				continue
+			}
+			size := math.Min(left, o.size-o.filled)
+			left -= size
+			fills = append(fills, t.fill(o, o.price, size, PAPER_LIQUIDITY_MAKER, now))
+		}
+	}
+
+	for _, o := range t.open {
+		if market, ok := crossed[o.instrumentId]; !ok || market != o.market || !o.live || o.final() || o.isMarket {
+			continue
+		}
+		levels := bookOf(o).opposite(o)
+		taken := map[float64]paperTaken{}
+		for i := range levels {
+			l := &levels[i]
+			if o.done() || !o.crosses(l.price) {
+				break
+			}
+			available, t0 := o.available(l)
+			taken[l.price] = t0
+			size := math.Min(available, o.size-o.filled)
+			if size <= paperEpsilon {
+				continue
+			}
+			l.size -= size
+			taken[l.price] = paperTaken{pushed: t0.pushed, size: t0.size + size}
+			fills = append(fills, t.fill(o, o.price, size, PAPER_LIQUIDITY_MAKER, now))
+		}
+		o.taken = taken
+	}
+
+	open := t.open[:0]
+	for _, o := range t.open {
+		if !o.final() {
+			open = append(open, o)
+		}
+	}
+	t.open = open
+	t.fills = append(t.fills, fills...)
+	return fills
+}
+
+/*
+An order reaching the exchange: post only orders crossing the book and fill or kill orders which
+cannot be filled are canceled, the others take the crossing levels. The rest of market and
+immediate or cancel orders is canceled.
+*/
+func (t *PaperTrader) take(o *paperOrder, book *paperBook, now time.Time) []PaperFill {
+	levels := book.opposite(o)
+	switch o.orderType {
+	case ORDER_TYPE_POST_ONLY:
+		if len(levels) > 0 && o.crosses(levels[0].price) {
+			t.finish(o, ORDER_STATE_CANCELED)
+		}
+		return nil
+	case ORDER_TYPE_FOK:
+		available := 0.0
+		for _, l := range levels {
+			if !o.crosses(l.price) {
+				break
+			}
+			available += l.size
+		}
+		if available < o.size-paperEpsilon {
+			t.finish(o, ORDER_STATE_CANCELED)
+			return nil
+		}
+	}
+
+	var fills []PaperFill
+	for i := range levels {
+		l := &levels[i]
+		if o.done() || !o.crosses(l.price) {
+			break
+		}
+		size := math.Min(l.size, o.size-o.filled)
+		if o.byNotional() {
+			size = math.Min(l.size, (o.notional-o.filledValue)/l.price)
+		}
+		if size <= paperEpsilon {
+			continue
+		}
+		l.size -= size
+		if o.taken == nil {
+			o.taken = map[float64]paperTaken{}
+		}
+		o.taken[l.price] = paperTaken{pushed: l.pushed, size: o.taken[l.price].size + size}
+		fills = append(fills, t.fill(o, l.price, size, PAPER_LIQUIDITY_TAKER, now))
+	}
+	if !o.final() && (o.isMarket || o.orderType == ORDER_TYPE_IOC) {
+		t.finish(o, ORDER_STATE_CANCELED)
+	}
+	return fills
+}
+
+/*
+Settle a fill of size at price: balances, positions, fees and the order state.
+*/
+func (t *PaperTrader) fill(o *paperOrder, price, size float64, liquidity string, now time.Time) PaperFill {
+	f := PaperFill{Market: o.market, InstrumentId: o.instrumentId, OrderId: o.orderId, ClientOid: o.clientOid,
+		Side: o.side, Type: o.oType, Price: price, Size: size, Liquidity: liquidity, Time: now}
+	if o.market == MARKET_SPOT {
+		t.settleSpot(o, &f)
+	} else {
+		t.settleSwap(o, &f)
+	}
+	o.filled += size
+	o.filledValue += price * size
+	o.fee += f.Fee
+	t.marks[o.instrumentId] = price
+
+	if o.done() {
+		t.finish(o, ORDER_STATE_FILLED)
+	} else if o.state == ORDER_STATE_OPEN {
+		o.state = ORDER_STATE_PARTIALLY_FILLED
+	}
+	return f
+}
+
+func (t *PaperTrader) rate(market, liquidity string) float64 {
+	fee := t.SpotFee
+	if market == MARKET_SWAP {
+		fee = t.SwapFee
+	}
+	if liquidity == PAPER_LIQUIDITY_MAKER {
+		return fee.Maker
+	}
+	return fee.Taker
+}
+
+// spot fees are paid in the currency received
+func (t *PaperTrader) settleSpot(o *paperOrder, f *PaperFill) {
+	base, quote := spotCurrencies(o.instrumentId)
+	rate := t.rate(o.market, f.Liquidity)
+	value := f.Price * f.Size
+	if o.buy() {
+		release := value
+		if !o.isMarket {
+			release = o.price * f.Size
+		}
+		t.release(o, quote, release)
+		t.balance(t.spot, quote).balance -= value
+		f.Fee, f.FeeCurrency = f.Size*rate, base
+		t.balance(t.spot, base).balance += f.Size - f.Fee
+	} else {
+		t.release(o, base, f.Size)
+		t.balance(t.spot, base).balance -= f.Size
+		f.Fee, f.FeeCurrency = value*rate, quote
+		t.balance(t.spot, quote).balance += value - f.Fee
+	}
+}
+
+func (t *PaperTrader) settleSwap(o *paperOrder, f *PaperFill) {
+	oType := StringToInt(o.oType)
+	currency := swapSettleCurrency(o.instrumentId)
+	account := t.balance(t.swap, currency)
+	h := t.holding(o.instrumentId, paperDirection(oType))
+	value := t.swapValue(o.instrumentId, f.Size, f.Price)
+	f.Fee, f.FeeCurrency = value*t.rate(o.market, f.Liquidity), currency
+
+	if oType == OPEN_LONG || oType == OPEN_SHORT {
+		t.release(o, currency, o.frozen*f.Size/(o.size-o.filled))
+		if h.position == 0 {
+			h.avgCost = f.Price
+		} else if isLinearContract(o.instrumentId) {
+			h.avgCost = (h.position*h.avgCost + f.Size*f.Price) / (h.position + f.Size)
+		} else {
+			// the average of the coin margined contracts is harmonic
+			h.avgCost = (h.position + f.Size) / (h.position/h.avgCost + f.Size/f.Price)
+		}
+		h.position += f.Size
+		h.margin += value / t.Leverage
+		account.balance -= f.Fee
+		return
+	}
+
+	pnl := t.swapPnl(o.instrumentId, paperDirection(oType), f.Size, h.avgCost, f.Price)
+	h.margin -= h.margin * f.Size / h.position
+	h.position -= f.Size
+	h.closing -= f.Size
+	h.realized += pnl
+	if h.position <= paperEpsilon {
+		h.position, h.avgCost, h.margin = 0, 0, 0
+	}
+	account.balance += pnl - f.Fee
+}
+
+func (t *PaperTrader) release(o *paperOrder, currency string, amount float64) {
+	amount = math.Min(amount, o.frozen)
+	o.frozen -= amount
+	balances, _ := t.balances(o.market)
+	t.balance(balances, currency).hold -= amount
+}
+
+/*
+Move an order to a final state, what it still holds is released.
+*/
+func (t *PaperTrader) finish(o *paperOrder, state int) {
+	o.state = state
+	if o.market == MARKET_SPOT {
+		base, quote := spotCurrencies(o.instrumentId)
+		t.release(o, T3O(o.buy(), quote, base).(string), o.frozen)
+		return
+	}
+	oType := StringToInt(o.oType)
+	if oType == CLOSE_LONG || oType == CLOSE_SHORT {
+		t.holding(o.instrumentId, paperDirection(oType)).closing -= o.size - o.filled
+		return
+	}
+	t.release(o, swapSettleCurrency(o.instrumentId), o.frozen)
+}
+
+func (t *PaperTrader) notify(fills []PaperFill) {
+	if len(fills) == 0 {
+		return
+	}
+	t.lock.Lock()
+	cbs := t.fillCbs
+	t.lock.Unlock()
+	for _, f := range fills {
+		for _, cb := range cbs {
+			cb(f)
+		}
+	}
+}
+
+/*
+A swap funding payment, Amount is credited to the account in Currency and negative when paid.
+*/
+type FundingPayment struct {
+	Time         time.Time
+	InstrumentId string
+	Direction    string // DIRECTION_LONG or DIRECTION_SHORT
+	Rate         float64
+	Position     float64
+	Amount       float64
+	Currency     string
+}
+
+/*
+Settle the funding of the positions of a swap instrument at rate, valued at the last price: the
+longs pay a positive rate to the shorts.
+*/
+func (t *PaperTrader) fund(instrumentId string, rate float64, at time.Time) []FundingPayment {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	var payments []FundingPayment
+	currency := swapSettleCurrency(instrumentId)
+	for _, direction := range []string{DIRECTION_LONG, DIRECTION_SHORT} {
+		h := t.holdings[instrumentId][direction]
+		if h == nil || h.position <= 0 {
+			continue
+		}
+		amount := -rate * t.swapValue(instrumentId, h.position, t.mark(instrumentId, h.avgCost))
+		if direction == DIRECTION_SHORT {
+			amount = -amount
+		}
+		t.balance(t.swap, currency).balance += amount
+		payments = append(payments, FundingPayment{Time: at, InstrumentId: instrumentId, Direction: direction,
+			Rate: rate, Position: h.position, Amount: amount, Currency: currency})
+	}
+	return payments
+}
+
+/*
+Equity by currency: the spot balances plus the swap accounts with their unrealized pnl.
+*/
+func (t *PaperTrader) equities() map[string]float64 {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	equities := map[string]float64{}
+	for currency, b := range t.spot {
+		equities[currency] += b.balance
+	}
+	for currency, b := range t.swap {
+		_, unrealized, _ := t.swapTotals(currency)
+		equities[currency] += b.balance + unrealized
+	}
+	return equities
+}
+
+// last trade or fill price of an instrument, if any
+func (t *PaperTrader) lastPrice(instrumentId string) (float64, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	p, ok := t.marks[instrumentId]
+	return p, ok
+}
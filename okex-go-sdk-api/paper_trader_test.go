@@ -0,0 +1,270 @@
+package okex
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeBooks map[string]*WSDepthItem
+
+func (b fakeBooks) GetOrderBook(channel, instrumentID string) *WSDepthItem {
+	return b[channel+":"+instrumentID]
+}
+
+// push every book once, as the first push of a subscribed depth channel
+func subscribeBooks(t *testing.T, trader *PaperTrader, books fakeBooks) {
+	for key, d := range books {
+		i := strings.LastIndex(key, ":")
+		require.True(t, trader.OnPush(&WSDepthTableResponse{Table: key[:i], Action: "partial",
+			Data: []WSDepthItem{{InstrumentId: d.InstrumentId}}}) == nil)
+	}
+}
+
+func depthOf(instrumentId string, asks, bids [][2]string) *WSDepthItem {
+	d := &WSDepthItem{InstrumentId: instrumentId}
+	for _, a := range asks {
+		d.Asks = append(d.Asks, [4]interface{}{a[0], a[1], "0", "1"})
+	}
+	for _, b := range bids {
+		d.Bids = append(d.Bids, [4]interface{}{b[0], b[1], "0", "1"})
+	}
+	return d
+}
+
+func near(t *testing.T, expected, actual float64) {
+	assert.True(t, math.Abs(expected-actual) < 1e-9, "expected %v, got %v", expected, actual)
+}
+
+func spotBalance(t *testing.T, api SpotOrderApi, currency string) SpotAccount {
+	accounts, err := api.GetSpotAccounts()
+	require.True(t, err == nil, err)
+	for _, a := range accounts {
+		if a.Currency == currency {
+			return a
+		}
+	}
+	return SpotAccount{Currency: currency}
+}
+
+func TestPaperTrader_Spot(t *testing.T) {
+	books := fakeBooks{CHNL_SPOT_DEPTH + ":BTC-USDT": depthOf("BTC-USDT",
+		[][2]string{{"9000", "0.5"}, {"9010", "1"}}, [][2]string{{"8990", "1"}})}
+	trader := NewPaperTrader(books)
+	subscribeBooks(t, trader, books)
+	require.True(t, trader.Deposit(MARKET_SPOT, "USDT", 10000) == nil)
+	assert.Equal(t, ERR_PAPER_MARKET, trader.Deposit(MARKET_FUTURES, "USDT", 10000))
+	var api SpotOrderApi = trader
+
+	_, err := api.PostSpotOrder(NewSpotLimitOrder("BTC-USDT", SPOT_SIDE_BUY, "9000", "2"))
+	assert.Equal(t, ERR_PAPER_BALANCE, err)
+
+	// half of the order takes the ask, the rest rests at 9005
+	r, err := api.PostSpotOrder(NewSpotLimitOrder("BTC-USDT", SPOT_SIDE_BUY, "9005", "1").WithClientOid("a1"))
+	require.True(t, err == nil, err)
+	assert.Equal(t, "1", (*r)["order_id"])
+	pending, _ := api.GetSpotOrdersPending(&map[string]string{"instrument_id": "BTC-USDT"})
+	require.Equal(t, 1, len(pending))
+	assert.Equal(t, "part_filled", pending[0].Status)
+	near(t, 0.5, pending[0].FilledSize)
+	usdt := spotBalance(t, api, "USDT")
+	near(t, 5500, usdt.Balance)
+	near(t, 4502.5, usdt.Hold)
+	near(t, 0.4995, spotBalance(t, api, "BTC").Balance)
+
+	// a sell trade at 9004 fills 0.2, the asks crossing 9005 fill the rest
+	require.True(t, trader.OnPush(tradePushTable(CHNL_SPOT_TRADE, map[string]interface{}{"instrument_id": "BTC-USDT",
+		"trade_id": "1", "side": "sell", "price": "9004", "size": "0.2", "timestamp": "2019-04-16T10:00:00.000Z"})) == nil)
+	books[CHNL_SPOT_DEPTH+":BTC-USDT"] = depthOf("BTC-USDT", [][2]string{{"9001", "1"}}, [][2]string{{"8990", "1"}})
+	require.True(t, trader.OnPush(&WSDepthTableResponse{Table: CHNL_SPOT_DEPTH, Action: "update",
+		Data: []WSDepthItem{{InstrumentId: "BTC-USDT"}}}) == nil)
+
+	order, err := api.GetSpotOrdersById("BTC-USDT", "a1")
+	require.True(t, err == nil, err)
+	assert.Equal(t, "filled", (*order)["status"])
+	assert.Equal(t, "1", (*order)["filled_size"])
+	fills := trader.Fills()
+	require.Equal(t, 3, len(fills))
+	assert.Equal(t, PAPER_LIQUIDITY_TAKER, fills[0].Liquidity)
+	assert.Equal(t, 9000.0, fills[0].Price)
+	assert.Equal(t, PAPER_LIQUIDITY_MAKER, fills[1].Liquidity)
+	assert.Equal(t, 9005.0, fills[2].Price)
+	usdt = spotBalance(t, api, "USDT")
+	near(t, 997.5, usdt.Balance)
+	near(t, 0, usdt.Hold)
+	near(t, 0.9991, spotBalance(t, api, "BTC").Balance)
+
+	// market sell against the bids
+	_, err = api.PostSpotOrder(NewSpotMarketSell("BTC-USDT", "0.5"))
+	require.True(t, err == nil, err)
+	near(t, 997.5+4495*0.999, spotBalance(t, api, "USDT").Balance)
+
+	// a resting order is canceled
+	r, err = api.PostSpotOrder(NewSpotLimitOrder("BTC-USDT", SPOT_SIDE_SELL, "9500", "0.4"))
+	require.True(t, err == nil, err)
+	near(t, 0.4, spotBalance(t, api, "BTC").Hold)
+	_, err = api.PostSpotCancelOrders("BTC-USDT", (*r)["order_id"].(string))
+	require.True(t, err == nil, err)
+	order, _ = api.GetSpotOrdersById("BTC-USDT", (*r)["order_id"].(string))
+	assert.Equal(t, "cancelled", (*order)["status"])
+	near(t, 0, spotBalance(t, api, "BTC").Hold)
+	_, err = api.PostSpotCancelOrders("BTC-USDT", (*r)["order_id"].(string))
+	assert.Equal(t, ERR_PAPER_FINAL, err)
+	_, err = api.GetSpotOrdersById("BTC-USDT", "nope")
+	assert.Equal(t, ERR_PAPER_NOT_FOUND, err)
+}
+
+func TestPaperTrader_SwapLatencyAndPositions(t *testing.T) {
+	books := fakeBooks{CHNL_SWAP_DEPTH + ":BTC-USD-SWAP": depthOf("BTC-USD-SWAP",
+		[][2]string{{"9000", "50"}}, [][2]string{{"8990", "50"}})}
+	trader := NewPaperTrader(books)
+	subscribeBooks(t, trader, books)
+	now := time.Date(2019, 4, 16, 10, 0, 0, 0, time.UTC)
+	trader.Now = func() time.Time { return now }
+	trader.Latency = 100 * time.Millisecond
+	require.True(t, trader.Deposit(MARKET_SWAP, "BTC", 1) == nil)
+	fills := []PaperFill{}
+	trader.OnFill(func(f PaperFill) { fills = append(fills, f) })
+	var api SwapOrderApi = trader
+
+	_, err := api.PostSwapOrder("BTC-USD-SWAP", &BasePlaceOrderInfo{Type: "1", Size: "10", MatchPrice: "1"})
+	assert.Equal(t, ERR_PAPER_CONTRACT_VAL, err)
+	trader.SetContractVal("BTC-USD-SWAP", 100)
+
+	r, err := api.PostSwapOrder("BTC-USD-SWAP", &BasePlaceOrderInfo{Type: "1", Size: "10", MatchPrice: "1"})
+	require.True(t, err == nil, err)
+	info, _ := api.GetSwapOrderById("BTC-USD-SWAP", r.OrderId)
+	assert.Equal(t, "0", info.State)
+	assert.Equal(t, 0, len(fills))
+
+	now = now.Add(100 * time.Millisecond)
+	trader.Advance(now)
+	require.Equal(t, 1, len(fills))
+	info, _ = api.GetSwapOrderById("BTC-USD-SWAP", r.OrderId)
+	assert.Equal(t, "2", info.State)
+	assert.Equal(t, 9000.0, info.PriceAvg)
+	position, _ := api.GetSwapPositionByInstrument("BTC-USD-SWAP")
+	require.Equal(t, 1, len(position.Holding))
+	assert.Equal(t, 10.0, position.Holding[0].Position)
+	assert.Equal(t, DIRECTION_LONG, position.Holding[0].Side)
+	openFee := 1000.0 / 9000 * 0.0005
+	near(t, openFee, fills[0].Fee)
+	assert.Equal(t, "BTC", fills[0].FeeCurrency)
+
+	_, err = api.PostSwapOrder("BTC-USD-SWAP", &BasePlaceOrderInfo{Type: "3", Size: "11", Price: "9900"})
+	assert.Equal(t, ERR_PAPER_POSITION, err)
+	r, err = api.PostSwapOrder("BTC-USD-SWAP", &BasePlaceOrderInfo{Type: "3", Size: "10", Price: "9900", ClientOid: "close1"})
+	require.True(t, err == nil, err)
+	now = now.Add(100 * time.Millisecond)
+	require.True(t, trader.OnPush(tradePushTable(CHNL_SWAP_TRADE,
+		swapTradePush("1", "9900", "4", "2019-04-16T10:00:00.200Z"))) == nil)
+	require.Equal(t, 2, len(fills))
+	assert.Equal(t, 4.0, fills[1].Size)
+
+	// the cancel takes effect after the latency
+	_, err = api.PostSwapCancelOrder("BTC-USD-SWAP", "close1")
+	require.True(t, err == nil, err)
+	info, _ = api.GetSwapOrderById("BTC-USD-SWAP", "close1")
+	assert.Equal(t, "4", info.State)
+	now = now.Add(100 * time.Millisecond)
+	trader.Advance(now)
+	info, _ = api.GetSwapOrderById("BTC-USD-SWAP", "close1")
+	assert.Equal(t, "-1", info.State)
+	assert.Equal(t, 4.0, info.FilledQty)
+
+	position, _ = api.GetSwapPositionByInstrument("BTC-USD-SWAP")
+	assert.Equal(t, 6.0, position.Holding[0].AvailPosition)
+	account, _ := api.GetSwapAccount("BTC-USD-SWAP")
+	pnl := 400 * (1/9000.0 - 1/9900.0)
+	closeFee := 400.0 / 9900 * 0.0002
+	near(t, pnl, account.Info.RealizedPnl)
+	near(t, 1-openFee+pnl-closeFee, account.Info.TotalAvailBalance)
+	near(t, 600.0/9000/10, account.Info.Margin)
+	// marked at the last trade
+	near(t, 600*(1/9000.0-1/9900.0), account.Info.UnrealizedPnl)
+
+	completed, err := api.GetSwapOrderByInstrumentId("BTC-USD-SWAP", map[string]string{"state": "7"})
+	require.True(t, err == nil, err)
+	assert.Equal(t, 2, len(completed.OrderInfo))
+	assert.Equal(t, "close1", completed.OrderInfo[0].ClientOid)
+}
+
+func TestPaperTrader_OrderTypes(t *testing.T) {
+	books := fakeBooks{CHNL_SWAP_DEPTH + ":BTC-USDT-SWAP": depthOf("BTC-USDT-SWAP",
+		[][2]string{{"9000", "5"}, {"9001", "5"}}, [][2]string{{"8990", "5"}})}
+	trader := NewPaperTrader(books)
+	subscribeBooks(t, trader, books)
+	trader.SetContractVal("BTC-USDT-SWAP", 0.01)
+	require.True(t, trader.Deposit(MARKET_SWAP, "USDT", 1000) == nil)
+
+	r, err := trader.PostSwapOrders("BTC-USDT-SWAP", []*BasePlaceOrderInfo{
+		{Type: "1", Size: "20", Price: "9001", OrderType: "2"},     // fill or kill, only 10 available
+		{Type: "1", Size: "1", Price: "9000", OrderType: "1"},      // post only crossing
+		{Type: "1", Size: "8", Price: "9001", OrderType: "3"},      // immediate or cancel
+		{Type: "2", Size: "100000", Price: "9100", OrderType: "0"}, // over the margin
+	})
+	require.True(t, err == nil, err)
+	require.Equal(t, 4, len(r.OrderInfo))
+	assert.Equal(t, "false", r.OrderInfo[3].Result)
+	assert.Equal(t, ERR_PAPER_BALANCE.Error(), r.OrderInfo[3].ErrorMessage)
+
+	fok, _ := trader.GetSwapOrderById("BTC-USDT-SWAP", r.OrderInfo[0].OrderId)
+	assert.Equal(t, "-1", fok.State)
+	assert.Equal(t, 0.0, fok.FilledQty)
+	postOnly, _ := trader.GetSwapOrderById("BTC-USDT-SWAP", r.OrderInfo[1].OrderId)
+	assert.Equal(t, "-1", postOnly.State)
+	ioc, _ := trader.GetSwapOrderById("BTC-USDT-SWAP", r.OrderInfo[2].OrderId)
+	assert.Equal(t, "2", ioc.State)
+	near(t, (5*9000+3*9001)/8.0, ioc.PriceAvg)
+
+	account, _ := trader.GetSwapAccount("BTC-USDT-SWAP")
+	near(t, 0, account.Info.MarginFrozen)
+	near(t, (5*9000+3*9001)*0.01/10, account.Info.Margin)
+	near(t, 1000-(5*9000+3*9001)*0.01*0.0005, account.Info.TotalAvailBalance)
+}
+
+type countingBooks struct {
+	fakeBooks
+	asked int
+}
+
+func (b *countingBooks) GetOrderBook(channel, instrumentID string) *WSDepthItem {
+	b.asked++
+	return b.fakeBooks.GetOrderBook(channel, instrumentID)
+}
+
+func TestPaperTrader_StaticBook(t *testing.T) {
+	books := &countingBooks{fakeBooks: fakeBooks{CHNL_SPOT_DEPTH + ":BTC-USDT": depthOf("BTC-USDT",
+		[][2]string{{"9010", "0.3"}}, [][2]string{{"8990", "1"}})}}
+	trader := NewPaperTrader(books)
+	require.True(t, trader.Deposit(MARKET_SPOT, "USDT", 10000) == nil)
+
+	// the book is not asked for before its channel is pushed
+	_, err := trader.PostSpotOrder(NewSpotLimitOrder("BTC-USDT", SPOT_SIDE_BUY, "9000", "1").WithClientOid("a1"))
+	require.True(t, err == nil, err)
+	assert.Equal(t, 0, books.asked)
+	assert.Equal(t, 0, len(trader.Fills()))
+
+	// the ask crossing the order fills it once, the same book pushed again does not
+	push := &WSDepthTableResponse{Table: CHNL_SPOT_DEPTH, Action: "update", Data: []WSDepthItem{{InstrumentId: "BTC-USDT"}}}
+	books.fakeBooks[CHNL_SPOT_DEPTH+":BTC-USDT"] = depthOf("BTC-USDT", [][2]string{{"8995", "0.3"}}, [][2]string{{"8990", "1"}})
+	require.True(t, trader.OnPush(push) == nil)
+	require.True(t, trader.OnPush(push) == nil)
+	require.True(t, trader.OnPush(push) == nil)
+	require.Equal(t, 1, len(trader.Fills()))
+	near(t, 0.3, trader.Fills()[0].Size)
+
+	// a changed level is liquidity again
+	books.fakeBooks[CHNL_SPOT_DEPTH+":BTC-USDT"] = depthOf("BTC-USDT", [][2]string{{"8995", "0.5"}}, [][2]string{{"8990", "1"}})
+	require.True(t, trader.OnPush(push) == nil)
+	require.True(t, trader.OnPush(push) == nil)
+	require.Equal(t, 2, len(trader.Fills()))
+	near(t, 0.5, trader.Fills()[1].Size)
+	order, err := trader.GetSpotOrdersById("BTC-USDT", "a1")
+	require.True(t, err == nil, err)
+	assert.Equal(t, "0.8", (*order)["filled_size"])
+}
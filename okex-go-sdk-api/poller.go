@@ -0,0 +1,70 @@
+package okex
+
+/*
+ Background loop behind the Start and Stop of the watchers and managers: a function is run every
+ interval until stopped, its errors are logged.
+*/
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+type poller struct {
+	lock sync.Mutex
+	quit chan struct{}
+	done chan struct{}
+}
+
+/*
+Run poll every interval, at once too when first is set. name prefixes the errors logged. A started
+poller is not started again.
+*/
+func (p *poller) start(name string, interval time.Duration, first bool, poll func() error) {
+	p.lock.Lock()
+	if p.quit != nil {
+		p.lock.Unlock()
+		return
+	}
+	p.quit = make(chan struct{})
+	p.done = make(chan struct{})
+	quit, done := p.quit, p.done
+	p.lock.Unlock()
+
+	run := func() {
+		if err := poll(); err != nil {
+			log.Printf("%s failed: %v", name, err)
+		}
+	}
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		if first {
+			run()
+		}
+		for {
+			select {
+			case <-quit:
+				return
+			case <-ticker.C:
+				run()
+			}
+		}
+	}()
+}
+
+/*
+End the loop and wait for a poll in progress, a no-op when not started.
+*/
+func (p *poller) stop() {
+	p.lock.Lock()
+	quit, done := p.quit, p.done
+	p.quit, p.done = nil, nil
+	p.lock.Unlock()
+	if quit != nil {
+		close(quit)
+		<-done
+	}
+}
@@ -0,0 +1,39 @@
+package okex
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoller_StartStop(t *testing.T) {
+	var polls int32
+	poll := func() error {
+		atomic.AddInt32(&polls, 1)
+		return errors.New("boom")
+	}
+	p := &poller{}
+	p.stop()
+	p.start("test: poll", time.Hour, true, poll)
+	// started once, the second start is ignored
+	p.start("test: poll", time.Hour, true, poll)
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&polls) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	p.stop()
+	p.stop()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&polls))
+
+	// restarted after stop, without the first poll
+	p.start("test: poll", 10*time.Millisecond, false, poll)
+	time.Sleep(50 * time.Millisecond)
+	p.stop()
+	n := atomic.LoadInt32(&polls)
+	assert.True(t, n > 1, n)
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, n, atomic.LoadInt32(&polls))
+}
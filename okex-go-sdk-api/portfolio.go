@@ -0,0 +1,354 @@
+package okex
+
+/*
+ Portfolio values the wallet, spot, margin, futures and swap accounts in a single quote currency.
+ Balances are priced with the spot tickers, through BTC when a currency has no direct USDT pair.
+ USD is taken at par with USDT and converted to CNY with GetFuturesExchangeRate, or GetSwapRate
+ when the former fails.
+
+	valuation, err := NewPortfolio(client, "USDT").Valuate()
+*/
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	QUOTE_USDT = "USDT"
+	QUOTE_USD  = "USD"
+	QUOTE_CNY  = "CNY"
+)
+
+/*
+Valuation of one account type. Equity and MarginUsed are in the quote currency,
+Balances holds the equity of every currency in that currency.
+*/
+type AccountValuation struct {
+	Account     AccountType
+	Equity      float64
+	MarginUsed  float64
+	MarginUsage float64 // MarginUsed / Equity
+	Balances    map[string]float64
+}
+
+/*
+Exposure to an underlying currency in the quote currency: holdings of the currency, collateral
+of coin margined contracts and the notional of futures/swap positions.
+*/
+type UnderlyingExposure struct {
+	Underlying string
+	Long       float64
+	Short      float64
+	Net        float64
+}
+
+type PortfolioValuation struct {
+	Quote           string
+	Accounts        []*AccountValuation
+	TotalEquity     float64
+	TotalMarginUsed float64
+	Exposures       map[string]*UnderlyingExposure
+	Unpriced        []string // currencies without a price, left out of the totals
+	Timestamp       time.Time
+}
+
+func (v *PortfolioValuation) Account(account AccountType) *AccountValuation {
+	for _, a := range v.Accounts {
+		if a.Account == account {
+			return a
+		}
+	}
+	return nil
+}
+
+type Portfolio struct {
+	client *Client
+	Quote  string
+	// Positions and spot/margin balances are read from the book when set, otherwise a book is seeded on every Valuate.
+	Book *PositionBook
+}
+
+func NewPortfolio(client *Client, quote string) *Portfolio {
+	return &Portfolio{client: client, Quote: strings.ToUpper(quote)}
+}
+
+func anyToFloat(v interface{}) float64 {
+	switch f := v.(type) {
+	case float64:
+		return f
+	case string:
+		return toFloat(f)
+	}
+	return 0
+}
+
+func anyToString(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+type portfolioPricer struct {
+	usdt     map[string]float64 // currency -> price in USDT
+	cnyRate  float64
+	quote    string
+	unpriced map[string]bool
+}
+
+/*
+Price of one unit of currency in USDT.
+*/
+func (p *portfolioPricer) usdtPrice(currency string) (float64, bool) {
+	currency = strings.ToUpper(currency)
+	switch currency {
+	case QUOTE_USDT, QUOTE_USD:
+		return 1, true
+	case QUOTE_CNY:
+		if p.cnyRate > 0 {
+			return 1 / p.cnyRate, true
+		}
+		return 0, false
+	}
+	price, ok := p.usdt[currency]
+	return price, ok
+}
+
+/*
+Convert an amount of currency into the quote currency, unpriced currencies are recorded and count as 0.
+*/
+func (p *portfolioPricer) value(currency string, amount float64) float64 {
+	if amount == 0 || strings.EqualFold(currency, p.quote) {
+		return amount
+	}
+	price, ok := p.usdtPrice(currency)
+	quote, quoteOk := p.usdtPrice(p.quote)
+	if !ok || !quoteOk || quote == 0 {
+		p.unpriced[strings.ToUpper(currency)] = true
+		return 0
+	}
+	return amount * price / quote
+}
+
+func (pf *Portfolio) pricer() (*portfolioPricer, error) {
+	p := &portfolioPricer{usdt: map[string]float64{}, quote: pf.Quote, unpriced: map[string]bool{}}
+	tickers, err := pf.client.GetSpotInstrumentsTicker()
+	if err != nil {
+		return nil, err
+	}
+	btc := map[string]float64{}
+	for _, t := range *tickers {
+		instrumentId, _ := t["instrument_id"].(string)
+		last := anyToFloat(t["last"])
+		pair := strings.Split(instrumentId, "-")
+		if len(pair) != 2 || last <= 0 {
+			continue
+		}
+		switch pair[1] {
+		case QUOTE_USDT:
+			p.usdt[pair[0]] = last
+		case "BTC":
+			btc[pair[0]] = last
+		}
+	}
+	for currency, price := range btc {
+		if _, ok := p.usdt[currency]; !ok && p.usdt["BTC"] > 0 {
+			p.usdt[currency] = price * p.usdt["BTC"]
+		}
+	}
+
+	if pf.Quote == QUOTE_CNY {
+		rate, err := pf.client.GetFuturesExchangeRate()
+		if err == nil && rate.Rate > 0 {
+			p.cnyRate = rate.Rate
+		} else {
+			swapRate, err := pf.client.GetSwapRate()
+			if err != nil {
+				return nil, err
+			}
+			p.cnyRate = toFloat(swapRate.Rate)
+		}
+	}
+	return p, nil
+}
+
+/*
+Margin currency of a futures account key, "btc" for coin margined and "btc-usdt" for USDT margined accounts.
+*/
+func futuresAccountCurrency(key string, account map[string]interface{}) string {
+	if currency, ok := account["currency"].(string); ok && currency != "" {
+		return strings.ToUpper(currency)
+	}
+	key = strings.ToUpper(key)
+	if strings.HasSuffix(key, "-"+QUOTE_USDT) {
+		return QUOTE_USDT
+	}
+	return strings.Split(key, "-")[0]
+}
+
+/*
+Margin currency of a swap instrument, the base currency for coin margined swaps.
+*/
+func swapMarginCurrency(instrumentId string) string {
+	if isLinearContract(instrumentId) {
+		return QUOTE_USDT
+	}
+	return strings.Split(instrumentId, "-")[0]
+}
+
+/*
+Fetch every account and position and value them in the quote currency.
+*/
+func (pf *Portfolio) Valuate() (*PortfolioValuation, error) {
+	book := pf.Book
+	if book == nil {
+		book = NewPositionBook(pf.client)
+		if err := book.Seed(); err != nil {
+			return nil, err
+		}
+	}
+	wallet, err := pf.client.GetAccountWallet()
+	if err != nil {
+		return nil, err
+	}
+	futures, err := pf.client.GetFuturesAccounts()
+	if err != nil {
+		return nil, err
+	}
+	swaps, err := pf.client.GetSwapAccounts()
+	if err != nil {
+		return nil, err
+	}
+	p, err := pf.pricer()
+	if err != nil {
+		return nil, err
+	}
+
+	v := &PortfolioValuation{Quote: pf.Quote, Exposures: map[string]*UnderlyingExposure{}, Timestamp: time.Now()}
+	account := func(t AccountType) *AccountValuation {
+		a := &AccountValuation{Account: t, Balances: map[string]float64{}}
+		v.Accounts = append(v.Accounts, a)
+		return a
+	}
+	add := func(a *AccountValuation, currency string, equity, marginUsed float64) {
+		currency = strings.ToUpper(currency)
+		a.Balances[currency] += equity
+		a.Equity += p.value(currency, equity)
+		a.MarginUsed += p.value(currency, marginUsed)
+		if currency != pf.Quote {
+			pf.expose(v, currency, p.value(currency, equity))
+		}
+	}
+
+	a := account(ACCOUNT_TYPE_WALLET)
+	for _, w := range *wallet {
+		currency, _ := w["currency"].(string)
+		add(a, currency, anyToFloat(w["balance"]), 0)
+	}
+
+	a = account(ACCOUNT_TYPE_SPOT)
+	for _, b := range book.Balances(MARKET_SPOT) {
+		add(a, b.Currency, b.Balance, 0)
+	}
+
+	a = account(ACCOUNT_TYPE_MARGIN)
+	for _, b := range book.Balances(MARKET_MARGIN) {
+		add(a, b.Currency, b.Balance-b.Borrowed, b.Borrowed)
+	}
+
+	a = account(ACCOUNT_TYPE_FUTURES)
+	if info, ok := (*futures)["info"].(map[string]interface{}); ok {
+		keys := make([]string, 0, len(info))
+		for key := range info {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			f, _ := info[key].(map[string]interface{})
+			marginUsed := anyToFloat(f["margin"]) + anyToFloat(f["margin_for_unfilled"])
+			if contracts, ok := f["contracts"].([]interface{}); ok {
+				// fixed margin
+				for _, c := range contracts {
+					contract, _ := c.(map[string]interface{})
+					marginUsed += anyToFloat(contract["fixed_balance"]) + anyToFloat(contract["margin_for_unfilled"])
+				}
+			}
+			add(a, futuresAccountCurrency(key, f), anyToFloat(f["equity"]), marginUsed)
+		}
+	}
+
+	a = account(ACCOUNT_TYPE_SWAP)
+	for _, s := range swaps.Info {
+		add(a, swapMarginCurrency(s.InstrumentId), s.Equity, s.Margin+s.MarginFrozen)
+	}
+
+	for _, position := range book.Positions("") {
+		pf.exposePosition(v, p, book, position)
+	}
+
+	for _, a := range v.Accounts {
+		if a.Equity > 0 {
+			a.MarginUsage = a.MarginUsed / a.Equity
+		}
+		v.TotalEquity += a.Equity
+		v.TotalMarginUsed += a.MarginUsed
+	}
+	for currency := range p.unpriced {
+		v.Unpriced = append(v.Unpriced, currency)
+	}
+	sort.Strings(v.Unpriced)
+	return v, nil
+}
+
+func (pf *Portfolio) expose(v *PortfolioValuation, underlying string, value float64) {
+	if value == 0 {
+		return
+	}
+	e, ok := v.Exposures[underlying]
+	if !ok {
+		e = &UnderlyingExposure{Underlying: underlying}
+		v.Exposures[underlying] = e
+	}
+	if value >= 0 {
+		e.Long += value
+	} else {
+		e.Short -= value
+	}
+	e.Net = e.Long - e.Short
+}
+
+/*
+Notional of a position: contracts * contract_val USD for coin margined contracts,
+contracts * contract_val * price for USDT margined ones.
+*/
+func (pf *Portfolio) exposePosition(v *PortfolioValuation, p *portfolioPricer, book *PositionBook, position BookPosition) {
+	underlying := strings.Split(position.InstrumentId, "-")[0]
+	contractVal := book.ContractVal(position.InstrumentId)
+	if contractVal == 0 {
+		p.unpriced[position.InstrumentId] = true
+		return
+	}
+
+	var notional float64
+	if isLinearContract(position.InstrumentId) {
+		notional = p.value(underlying, position.Qty*contractVal)
+	} else {
+		notional = p.value(QUOTE_USD, position.Qty*contractVal)
+	}
+	if position.Side == DIRECTION_SHORT {
+		notional = -notional
+	}
+	pf.expose(v, underlying, notional)
+}
+
+func (v *PortfolioValuation) String() string {
+	var b strings.Builder
+	for _, a := range v.Accounts {
+		fmt.Fprintf(&b, "%-11s equity=%.2f margin=%.2f usage=%.2f%%\n", a.Account, a.Equity, a.MarginUsed, a.MarginUsage*100)
+	}
+	fmt.Fprintf(&b, "%-11s equity=%.2f margin=%.2f %s\n", "total", v.TotalEquity, v.TotalMarginUsed, v.Quote)
+	return b.String()
+}
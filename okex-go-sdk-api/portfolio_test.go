@@ -0,0 +1,60 @@
+package okex
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFakePortfolioServer() *fakeServer {
+	s := newFakePositionServer()
+	s.handle(GET, ACCOUNT_WALLET, `[{"currency":"BTC","balance":"1","hold":"0","available":"1"},
+		{"currency":"ETH","balance":"10","hold":"0","available":"10"},
+		{"currency":"XYZ","balance":"5","hold":"0","available":"5"}]`)
+	s.handle(GET, FUTURES_ACCOUNTS, `{"info":{"btc":{"equity":"0.5","margin":"0.1","margin_for_unfilled":"0.05","margin_mode":"crossed"}}}`)
+	s.handle(GET, SWAP_ACCOUNTS, `{"info":[{"instrument_id":"BTC-USDT-SWAP","equity":"1000","margin":"100","margin_frozen":"50","margin_mode":"crossed"}]}`)
+	s.handle(GET, SPOT_INSTRUMENTS_TICKER, `[{"instrument_id":"BTC-USDT","last":"10000"},{"instrument_id":"ETH-BTC","last":"0.02"}]`)
+	s.handle(GET, FUTURES_RATE, `{"instrument_id":"USD_CNY","rate":"7","timestamp":"2019-04-16T06:14:27.000Z"}`)
+	return s
+}
+
+func TestPortfolio_Valuate(t *testing.T) {
+	s := newFakePortfolioServer()
+	defer s.Close()
+
+	v, err := NewPortfolio(s.client(), "usdt").Valuate()
+	require.True(t, err == nil, err)
+	near := func(expected, actual float64) {
+		assert.True(t, math.Abs(expected-actual) < 1e-6, "expected %v, got %v", expected, actual)
+	}
+
+	near(12000, v.Account(ACCOUNT_TYPE_WALLET).Equity)
+	near(100, v.Account(ACCOUNT_TYPE_SPOT).Equity)
+	margin := v.Account(ACCOUNT_TYPE_MARGIN)
+	near(3010, margin.Equity)
+	near(2000, margin.MarginUsed)
+	near(0.3, margin.Balances["BTC"])
+	futures := v.Account(ACCOUNT_TYPE_FUTURES)
+	near(5000, futures.Equity)
+	near(0.3, futures.MarginUsage)
+	near(150, v.Account(ACCOUNT_TYPE_SWAP).MarginUsed)
+	near(21110, v.TotalEquity)
+	near(3650, v.TotalMarginUsed)
+	assert.Equal(t, []string{"XYZ"}, v.Unpriced)
+
+	// holdings and collateral 1 + 0.3 + 0.5 BTC, 200 USD futures long, 0.1 BTC swap short
+	btc := v.Exposures["BTC"]
+	near(18200, btc.Long)
+	near(1000, btc.Short)
+	near(17200, btc.Net)
+	near(2000, v.Exposures["ETH"].Net)
+	_, ok := v.Exposures["USDT"]
+	assert.False(t, ok)
+
+	cny, err := NewPortfolio(s.client(), QUOTE_CNY).Valuate()
+	require.True(t, err == nil, err)
+	near(21110*7, cny.TotalEquity)
+	assert.Equal(t, 0, len(s.requestsTo(GET, SWAP_RATE)))
+}
@@ -0,0 +1,495 @@
+package okex
+
+/*
+ PositionBook keeps the futures and swap positions and the spot and margin balances of the
+ account. It is seeded from REST and kept current from the futures/position, swap/position,
+ spot/account and spot/margin_account pushes, unrealized PnL is recomputed on every
+ futures/mark_price and swap/mark_price push.
+*/
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type BookPosition struct {
+	Market        string // MARKET_FUTURES or MARKET_SWAP
+	InstrumentId  string
+	Side          string // DIRECTION_LONG or DIRECTION_SHORT
+	Qty           float64
+	AvailQty      float64
+	AvgCost       float64
+	MarkPrice     float64
+	UnrealizedPnl float64 // in the margin currency, 0 until both mark price and contract value are known
+	UpdatedAt     time.Time
+}
+
+type BookBalance struct {
+	Market       string // MARKET_SPOT or MARKET_MARGIN
+	InstrumentId string // margin only
+	Currency     string
+	Balance      float64
+	Available    float64
+	Hold         float64
+	Borrowed     float64 // margin only
+	UpdatedAt    time.Time
+}
+
+/*
+futures/position push and GET /api/futures/v3/position holding, both crossed and fixed margin
+*/
+type futuresHolding struct {
+	InstrumentId  string `json:"instrument_id"`
+	LongQty       string `json:"long_qty"`
+	LongAvailQty  string `json:"long_avail_qty"`
+	LongAvgCost   string `json:"long_avg_cost"`
+	ShortQty      string `json:"short_qty"`
+	ShortAvailQty string `json:"short_avail_qty"`
+	ShortAvgCost  string `json:"short_avg_cost"`
+}
+
+/*
+swap/position push, the instrument_id of a push is on the outer level
+*/
+type swapPositionPush struct {
+	InstrumentId string `json:"instrument_id"`
+	Holding      []struct {
+		InstrumentId  string `json:"instrument_id"`
+		Position      string `json:"position"`
+		AvailPosition string `json:"avail_position"`
+		AvgCost       string `json:"avg_cost"`
+		Side          string `json:"side"`
+	} `json:"holding"`
+}
+
+type spotAccountPush struct {
+	Currency  string `json:"currency"`
+	Balance   string `json:"balance"`
+	Available string `json:"available"`
+	Hold      string `json:"hold"`
+}
+
+type markPricePush struct {
+	InstrumentId string `json:"instrument_id"`
+	MarkPrice    string `json:"mark_price"`
+}
+
+func toFloat(s string) float64 {
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
+
+type PositionBook struct {
+	client *Client
+
+	lock         sync.RWMutex
+	positions    map[string]*BookPosition
+	balances     map[string]*BookBalance
+	marks        map[string]float64
+	contractVals map[string]float64
+	closed       map[string]time.Time // position key -> closed by a push
+
+	connects int
+	resyncs  int
+}
+
+func NewPositionBook(client *Client) *PositionBook {
+	return &PositionBook{
+		client:       client,
+		positions:    map[string]*BookPosition{},
+		balances:     map[string]*BookBalance{},
+		marks:        map[string]float64{},
+		contractVals: map[string]float64{},
+		closed:       map[string]time.Time{},
+	}
+}
+
+func positionKey(instrumentId, side string) string {
+	return instrumentId + "|" + side
+}
+
+func balanceKey(market, instrumentId, currency string) string {
+	return market + "|" + instrumentId + "|" + strings.ToUpper(currency)
+}
+
+/*
+Contract face value used by the PnL computation, loaded by Seed from the instruments
+*/
+func (b *PositionBook) SetContractVal(instrumentId string, contractVal float64) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.contractVals[instrumentId] = contractVal
+	for _, p := range b.positions {
+		if p.InstrumentId == instrumentId {
+			b.updatePnl(p)
+		}
+	}
+}
+
+func (b *PositionBook) ContractVal(instrumentId string) float64 {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.contractVals[instrumentId]
+}
+
+/*
+Merge the REST snapshot of positions and balances into the book. The pushes applied while the
+snapshot is read are newer than it: the entries they updated or closed are kept.
+*/
+func (b *PositionBook) Seed() error {
+	started := time.Now()
+	b.lock.RLock()
+	needInstruments := len(b.contractVals) == 0
+	b.lock.RUnlock()
+
+	contractVals := map[string]float64{}
+	if needInstruments {
+		for _, market := range []string{MARKET_FUTURES, MARKET_SWAP} {
+			loaded, err := loadContractVals(b.client, market)
+			if err != nil {
+				return err
+			}
+			mergeContractVals(contractVals, loaded)
+		}
+	}
+
+	var futures struct {
+		Holding [][]futuresHolding `json:"holding"`
+	}
+	if _, err := b.client.Request(GET, FUTURES_POSITION, nil, &futures); err != nil {
+		return err
+	}
+	swaps, err := b.client.GetSwapPositions()
+	if err != nil {
+		return err
+	}
+	spots, err := b.client.GetSpotAccounts()
+	if err != nil {
+		return err
+	}
+	margins, err := b.client.GetMarginAccounts()
+	if err != nil {
+		return err
+	}
+
+	snapshot := &PositionBook{
+		positions: map[string]*BookPosition{},
+		balances:  map[string]*BookBalance{},
+		closed:    map[string]time.Time{},
+	}
+	for _, holdings := range futures.Holding {
+		for i := range holdings {
+			snapshot.applyFuturesHolding(&holdings[i])
+		}
+	}
+	for _, position := range *swaps {
+		for _, h := range position.Holding {
+			snapshot.setPosition(MARKET_SWAP, h.InstrumentId, h.Side, h.Position, h.AvailPosition, h.AvgCost)
+		}
+	}
+	for _, a := range spots {
+		snapshot.setBalance(MARKET_SPOT, "", a.Currency, a.Balance, a.Available, a.Hold, 0)
+	}
+	for _, m := range *margins {
+		snapshot.applyMarginAccount(m)
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for k, v := range contractVals {
+		b.contractVals[k] = v
+	}
+	for k, p := range snapshot.positions {
+		if current, ok := b.positions[k]; ok && current.UpdatedAt.After(started) {
+			continue
+		}
+		if b.closed[k].After(started) {
+			continue
+		}
+		b.updatePnl(p)
+		b.positions[k] = p
+	}
+	for k, p := range b.positions {
+		if _, ok := snapshot.positions[k]; !ok && !p.UpdatedAt.After(started) {
+			delete(b.positions, k)
+		}
+	}
+	for k, a := range snapshot.balances {
+		if current, ok := b.balances[k]; ok && current.UpdatedAt.After(started) {
+			continue
+		}
+		b.balances[k] = a
+	}
+	for k, a := range b.balances {
+		if _, ok := snapshot.balances[k]; !ok && !a.UpdatedAt.After(started) {
+			delete(b.balances, k)
+		}
+	}
+	for k, t := range b.closed {
+		if !t.After(started) {
+			delete(b.closed, k)
+		}
+	}
+	return nil
+}
+
+/*
+Wrap the start hook of OKWSAgent.Start. The agent calls the hook after connecting and after
+every reconnect, pushes may have been missed in between so the book is re-seeded by REST
+before the channels are subscribed again by next.
+
+	eg: agent.Start(config, book.StartHook(func() error { ...login and subscribe... }))
+*/
+func (b *PositionBook) StartHook(next func() error) func() error {
+	return func() error {
+		b.lock.Lock()
+		b.connects++
+		if b.connects > 1 {
+			b.resyncs++
+		}
+		b.lock.Unlock()
+
+		if err := b.Seed(); err != nil {
+			return err
+		}
+		if next != nil {
+			return next()
+		}
+		return nil
+	}
+}
+
+/*
+Number of re-seeds caused by reconnects.
+*/
+func (b *PositionBook) Resyncs() int {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.resyncs
+}
+
+/*
+Callback of the futures/position, swap/position, spot/account, spot/margin_account,
+futures/mark_price and swap/mark_price channels.
+*/
+func (b *PositionBook) OnPush(obj interface{}) error {
+	tb, ok := obj.(*WSTableResponse)
+	if !ok {
+		return nil
+	}
+
+	switch tb.Table {
+	case CHNL_FUTURES_POSITION:
+		holdings := []futuresHolding{}
+		if err := decodeTableData(tb.Data, &holdings); err != nil {
+			return err
+		}
+		b.lock.Lock()
+		for i := range holdings {
+			b.applyFuturesHolding(&holdings[i])
+		}
+		b.lock.Unlock()
+	case CHNL_SWAP_POSITION:
+		pushes := []swapPositionPush{}
+		if err := decodeTableData(tb.Data, &pushes); err != nil {
+			return err
+		}
+		b.lock.Lock()
+		for _, push := range pushes {
+			// a push carries every side of the instrument, a missing side was closed
+			instrumentId := push.InstrumentId
+			seen := map[string]bool{}
+			for _, h := range push.Holding {
+				if h.InstrumentId != "" {
+					instrumentId = h.InstrumentId
+				}
+				b.setPosition(MARKET_SWAP, instrumentId, h.Side, toFloat(h.Position), toFloat(h.AvailPosition), toFloat(h.AvgCost))
+				seen[h.Side] = true
+			}
+			for _, side := range []string{DIRECTION_LONG, DIRECTION_SHORT} {
+				if !seen[side] {
+					b.closePosition(positionKey(instrumentId, side))
+				}
+			}
+		}
+		b.lock.Unlock()
+	case CHNL_SPOT_ACCOUNT:
+		accounts := []spotAccountPush{}
+		if err := decodeTableData(tb.Data, &accounts); err != nil {
+			return err
+		}
+		b.lock.Lock()
+		for _, a := range accounts {
+			b.setBalance(MARKET_SPOT, "", a.Currency, toFloat(a.Balance), toFloat(a.Available), toFloat(a.Hold), 0)
+		}
+		b.lock.Unlock()
+	case CHNL_SPOT_MARGIN_ACCOUNT:
+		accounts := []map[string]interface{}{}
+		if err := decodeTableData(tb.Data, &accounts); err != nil {
+			return err
+		}
+		b.lock.Lock()
+		for _, a := range accounts {
+			b.applyMarginAccount(a)
+		}
+		b.lock.Unlock()
+	case CHNL_FUTURES_MARK_PRICE, CHNL_SWAP_MARK_PRICE:
+		marks := []markPricePush{}
+		if err := decodeTableData(tb.Data, &marks); err != nil {
+			return err
+		}
+		b.lock.Lock()
+		for _, m := range marks {
+			b.marks[m.InstrumentId] = toFloat(m.MarkPrice)
+			for _, p := range b.positions {
+				if p.InstrumentId == m.InstrumentId {
+					b.updatePnl(p)
+				}
+			}
+		}
+		b.lock.Unlock()
+	}
+	return nil
+}
+
+func (b *PositionBook) applyFuturesHolding(h *futuresHolding) {
+	b.setPosition(MARKET_FUTURES, h.InstrumentId, DIRECTION_LONG, toFloat(h.LongQty), toFloat(h.LongAvailQty), toFloat(h.LongAvgCost))
+	b.setPosition(MARKET_FUTURES, h.InstrumentId, DIRECTION_SHORT, toFloat(h.ShortQty), toFloat(h.ShortAvailQty), toFloat(h.ShortAvgCost))
+}
+
+/*
+margin account: {"instrument_id":"BTC-USDT","currency:BTC":{"available":"0.1","balance":"0.1",...},"currency:USDT":{...}}
+*/
+func (b *PositionBook) applyMarginAccount(account map[string]interface{}) {
+	instrumentId, _ := account["instrument_id"].(string)
+	for k, v := range account {
+		if !strings.HasPrefix(k, "currency:") {
+			continue
+		}
+		info, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		value := func(field string) float64 {
+			s, _ := info[field].(string)
+			return toFloat(s)
+		}
+		b.setBalance(MARKET_MARGIN, instrumentId, strings.TrimPrefix(k, "currency:"),
+			value("balance"), value("available"), value("hold"), value("borrowed"))
+	}
+}
+
+func (b *PositionBook) setPosition(market, instrumentId, side string, qty, availQty, avgCost float64) {
+	key := positionKey(instrumentId, side)
+	if qty == 0 {
+		b.closePosition(key)
+		return
+	}
+	p := &BookPosition{
+		Market:       market,
+		InstrumentId: instrumentId,
+		Side:         side,
+		Qty:          qty,
+		AvailQty:     availQty,
+		AvgCost:      avgCost,
+		UpdatedAt:    time.Now(),
+	}
+	b.updatePnl(p)
+	b.positions[key] = p
+}
+
+func (b *PositionBook) closePosition(key string) {
+	if _, ok := b.positions[key]; ok {
+		delete(b.positions, key)
+		b.closed[key] = time.Now()
+	}
+}
+
+func (b *PositionBook) setBalance(market, instrumentId, currency string, balance, available, hold, borrowed float64) {
+	b.balances[balanceKey(market, instrumentId, currency)] = &BookBalance{
+		Market:       market,
+		InstrumentId: instrumentId,
+		Currency:     strings.ToUpper(currency),
+		Balance:      balance,
+		Available:    available,
+		Hold:         hold,
+		Borrowed:     borrowed,
+		UpdatedAt:    time.Now(),
+	}
+}
+
+/*
+PnL at the mark price in the settlement currency, 0 until the contract value is known.
+*/
+func (b *PositionBook) updatePnl(p *BookPosition) {
+	p.MarkPrice = b.marks[p.InstrumentId]
+	p.UnrealizedPnl = contractPnl(p.InstrumentId, p.Side, p.Qty, b.contractVals[p.InstrumentId], p.AvgCost, p.MarkPrice)
+}
+
+func (b *PositionBook) Position(instrumentId, side string) (BookPosition, bool) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if p, ok := b.positions[positionKey(instrumentId, side)]; ok {
+		return *p, true
+	}
+	return BookPosition{}, false
+}
+
+/*
+All open positions, market "" returns both futures and swap positions.
+*/
+func (b *PositionBook) Positions(market string) []BookPosition {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	var positions []BookPosition
+	for _, p := range b.positions {
+		if market == "" || p.Market == market {
+			positions = append(positions, *p)
+		}
+	}
+	return positions
+}
+
+/*
+Sum of the unrealized PnL of both sides of an instrument.
+*/
+func (b *PositionBook) UnrealizedPnl(instrumentId string) float64 {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	var pnl float64
+	for _, p := range b.positions {
+		if p.InstrumentId == instrumentId {
+			pnl += p.UnrealizedPnl
+		}
+	}
+	return pnl
+}
+
+/*
+instrumentId is empty for spot balances.
+*/
+func (b *PositionBook) Balance(market, instrumentId, currency string) (BookBalance, bool) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if a, ok := b.balances[balanceKey(market, instrumentId, currency)]; ok {
+		return *a, true
+	}
+	return BookBalance{}, false
+}
+
+/*
+All balances, market "" returns both spot and margin balances.
+*/
+func (b *PositionBook) Balances(market string) []BookBalance {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	var balances []BookBalance
+	for _, a := range b.balances {
+		if market == "" || a.Market == market {
+			balances = append(balances, *a)
+		}
+	}
+	return balances
+}
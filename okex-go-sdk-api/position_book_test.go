@@ -0,0 +1,141 @@
+package okex
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFakePositionServer() *fakeServer {
+	s := newFakeServer()
+	s.handle(GET, FUTURES_INSTRUMENTS, `[{"instrument_id":"BTC-USD-190628","contract_val":"100"}]`)
+	s.handle(GET, SWAP_INSTRUMENTS, `[{"instrument_id":"BTC-USD-SWAP","contract_val":"100"},{"instrument_id":"BTC-USDT-SWAP","contract_val":"0.01"}]`)
+	s.handle(GET, FUTURES_POSITION, `{"result":true,"holding":[[{"instrument_id":"BTC-USD-190628","long_qty":"2","long_avail_qty":"2","long_avg_cost":"8000","short_qty":"0","short_avail_qty":"0","short_avg_cost":"0"}]]}`)
+	s.handle(GET, SWAP_POSITION, `[{"margin_mode":"crossed","holding":[
+		{"instrument_id":"BTC-USDT-SWAP","position":"10","avail_position":"10","avg_cost":"9000","side":"short","timestamp":"2019-04-16T06:14:27.000Z"}]}]`)
+	s.handle(GET, SPOT_ACCOUNTS, `[{"currency":"USDT","id":"","balance":"100","available":"90","hold":"10"}]`)
+	s.handle(GET, MARGIN_ACCOUNTS, `[{"instrument_id":"BTC-USDT","currency:BTC":{"available":"0.5","balance":"0.5","borrowed":"0.2","hold":"0"},"currency:USDT":{"available":"10","balance":"10","borrowed":"0","hold":"0"}}]`)
+	return s
+}
+
+func pushBook(t *testing.T, b *PositionBook, frame string) {
+	rsp, err := loadResponse([]byte(frame))
+	require.True(t, err == nil, err)
+	require.True(t, b.OnPush(rsp) == nil)
+}
+
+func TestPositionBook_SeedAndPushes(t *testing.T) {
+	s := newFakePositionServer()
+	defer s.Close()
+	b := NewPositionBook(s.client())
+	require.True(t, b.Seed() == nil)
+
+	long, ok := b.Position("BTC-USD-190628", DIRECTION_LONG)
+	require.True(t, ok)
+	assert.Equal(t, 2.0, long.Qty)
+	_, ok = b.Position("BTC-USD-190628", DIRECTION_SHORT)
+	assert.False(t, ok)
+	assert.Equal(t, 2, len(b.Positions("")))
+
+	usdt, ok := b.Balance(MARKET_SPOT, "", "usdt")
+	require.True(t, ok)
+	assert.Equal(t, 90.0, usdt.Available)
+	btc, ok := b.Balance(MARKET_MARGIN, "BTC-USDT", "BTC")
+	require.True(t, ok)
+	assert.Equal(t, 0.2, btc.Borrowed)
+
+	// coin margined: 2 * 100 * (1/8000 - 1/10000)
+	pushBook(t, b, `{"table":"futures/mark_price","data":[{"instrument_id":"BTC-USD-190628","mark_price":"10000"}]}`)
+	assert.True(t, math.Abs(b.UnrealizedPnl("BTC-USD-190628")-0.005) < 1e-12)
+	// USDT margined short: -(10 * 0.01 * (9500 - 9000))
+	pushBook(t, b, `{"table":"swap/mark_price","data":[{"instrument_id":"BTC-USDT-SWAP","mark_price":"9500"}]}`)
+	assert.True(t, math.Abs(b.UnrealizedPnl("BTC-USDT-SWAP")+50) < 1e-9)
+
+	pushBook(t, b, `{"table":"futures/position","data":[{"instrument_id":"BTC-USD-190628","long_qty":"1","long_avail_qty":"1","long_avg_cost":"8000","short_qty":"3","short_avail_qty":"3","short_avg_cost":"10000"}]}`)
+	long, _ = b.Position("BTC-USD-190628", DIRECTION_LONG)
+	assert.Equal(t, 1.0, long.Qty)
+	short, ok := b.Position("BTC-USD-190628", DIRECTION_SHORT)
+	require.True(t, ok)
+	assert.Equal(t, 0.0, short.UnrealizedPnl)
+
+	pushBook(t, b, `{"table":"swap/position","data":[{"instrument_id":"BTC-USDT-SWAP","margin_mode":"crossed","holding":[{"position":"4","avail_position":"4","avg_cost":"9100","side":"long"}]}]}`)
+	_, ok = b.Position("BTC-USDT-SWAP", DIRECTION_SHORT)
+	assert.False(t, ok)
+	swapLong, ok := b.Position("BTC-USDT-SWAP", DIRECTION_LONG)
+	require.True(t, ok)
+	assert.True(t, math.Abs(swapLong.UnrealizedPnl-16) < 1e-9)
+
+	pushBook(t, b, `{"table":"spot/account","data":[{"currency":"USDT","balance":"80","available":"80","hold":"0","id":""}]}`)
+	usdt, _ = b.Balance(MARKET_SPOT, "", "USDT")
+	assert.Equal(t, 80.0, usdt.Balance)
+	pushBook(t, b, `{"table":"spot/margin_account","data":[{"instrument_id":"BTC-USDT","currency:BTC":{"available":"0.1","balance":"0.1","borrowed":"0","hold":"0"}}]}`)
+	btc, _ = b.Balance(MARKET_MARGIN, "BTC-USDT", "BTC")
+	assert.Equal(t, 0.1, btc.Balance)
+}
+
+func TestPositionBook_ReseedOnReconnect(t *testing.T) {
+	s := newFakePositionServer()
+	defer s.Close()
+	b := NewPositionBook(s.client())
+
+	subscribed := 0
+	hook := b.StartHook(func() error {
+		subscribed++
+		return nil
+	})
+	require.True(t, hook() == nil)
+	assert.Equal(t, 0, b.Resyncs())
+
+	// a push is missed while disconnected, the next connect restores the REST state
+	pushBook(t, b, `{"table":"futures/position","data":[{"instrument_id":"BTC-USD-190628","long_qty":"0","short_qty":"0"}]}`)
+	_, ok := b.Position("BTC-USD-190628", DIRECTION_LONG)
+	assert.False(t, ok)
+
+	require.True(t, hook() == nil)
+	assert.Equal(t, 1, b.Resyncs())
+	assert.Equal(t, 2, subscribed)
+	_, ok = b.Position("BTC-USD-190628", DIRECTION_LONG)
+	assert.True(t, ok)
+	assert.Equal(t, 2, len(s.requestsTo(GET, FUTURES_POSITION)))
+	assert.Equal(t, 1, len(s.requestsTo(GET, FUTURES_INSTRUMENTS)))
+}
+
+func TestPositionBook_SeedKeepsNewerPushes(t *testing.T) {
+	s := newFakePositionServer()
+	defer s.Close()
+	b := NewPositionBook(s.client())
+	require.True(t, b.Seed() == nil)
+
+	// pushes applied while the snapshot is read are newer than it
+	pushed := false
+	s.handleFunc(GET, SPOT_ACCOUNTS, func(r fakeRequest) string {
+		if pushed {
+			return `[{"currency":"USDT","id":"","balance":"50","available":"50","hold":"0"}]`
+		}
+		pushed = true
+		pushBook(t, b, `{"table":"futures/position","data":[{"instrument_id":"BTC-USD-190628","long_qty":"0","short_qty":"0"}]}`)
+		pushBook(t, b, `{"table":"swap/position","data":[{"instrument_id":"BTC-USDT-SWAP","holding":[{"position":"4","avail_position":"4","avg_cost":"9100","side":"short"}]}]}`)
+		pushBook(t, b, `{"table":"spot/account","data":[{"currency":"BTC","balance":"1","available":"1","hold":"0"}]}`)
+		return `[{"currency":"USDT","id":"","balance":"50","available":"50","hold":"0"}]`
+	})
+	require.True(t, b.Seed() == nil)
+
+	_, ok := b.Position("BTC-USD-190628", DIRECTION_LONG)
+	assert.False(t, ok)
+	p, ok := b.Position("BTC-USDT-SWAP", DIRECTION_SHORT)
+	require.True(t, ok)
+	assert.Equal(t, 4.0, p.Qty)
+	_, ok = b.Balance(MARKET_SPOT, "", "BTC")
+	assert.True(t, ok)
+	usdt, _ := b.Balance(MARKET_SPOT, "", "USDT")
+	assert.Equal(t, 50.0, usdt.Balance)
+
+	// the next snapshot wins again
+	require.True(t, b.Seed() == nil)
+	_, ok = b.Position("BTC-USD-190628", DIRECTION_LONG)
+	assert.True(t, ok)
+	p, _ = b.Position("BTC-USDT-SWAP", DIRECTION_SHORT)
+	assert.Equal(t, 10.0, p.Qty)
+}
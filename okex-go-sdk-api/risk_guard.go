@@ -0,0 +1,498 @@
+package okex
+
+/*
+ RiskGuard is an optional pre-trade risk layer. Once assigned to Client.Risk,
+ every order sent through PostSpotOrders, PostMarginOrders, PostFuturesOrder,
+ PostSwapOrder, their batch variants, the amendments and the algo orders of futures
+ and swap is checked before it leaves the process.
+
+	client.Risk = NewRiskGuard(client)
+	client.Risk.SetLimits("BTC-USD-SWAP", RiskLimits{MaxOrderSize: 100, MaxOpenOrders: 20, CheckPriceBand: true})
+*/
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ERR_RISK_KILLED      = errors.New(`risk: kill switch is engaged, new orders are blocked`)
+	ERR_RISK_DAILY_LOSS  = errors.New(`risk: daily loss limit reached`)
+	ERR_RISK_ORDER_SIZE  = errors.New(`risk: order size exceeds the instrument limit`)
+	ERR_RISK_NOTIONAL    = errors.New(`risk: order notional exceeds the instrument limit`)
+	ERR_RISK_OPEN_ORDERS = errors.New(`risk: too many open orders on the instrument`)
+	ERR_RISK_PRICE_BAND  = errors.New(`risk: order price is outside the price limit`)
+	ERR_RISK_PRICE       = errors.New(`risk: no price to compute the notional of the market order`)
+	ERR_RISK_CONTRACT    = errors.New(`risk: unknown contract value of the instrument`)
+)
+
+/*
+Limits of a single instrument, zero values are not checked.
+MaxOrderSize is in contracts for futures/swap and in base currency for spot/margin.
+MaxNotional is in quote currency, USD for coin margined contracts.
+*/
+type RiskLimits struct {
+	MaxOrderSize   float64
+	MaxNotional    float64
+	MaxOpenOrders  int
+	CheckPriceBand bool // futures/swap only, against the price_limit endpoints
+}
+
+/*
+An order as seen by the risk checks. Price is 0 for market orders,
+Notional is only set by spot market buy orders.
+An amendment is not counted against MaxOpenOrders, its Size is 0 when only the price is amended.
+*/
+type RiskOrder struct {
+	Market       string
+	InstrumentId string
+	Buy          bool
+	Price        float64
+	Size         float64
+	Notional     float64
+	Amend        bool
+}
+
+type priceLimit struct {
+	highest   float64
+	lowest    float64
+	fetchedAt time.Time
+}
+
+type RiskGuard struct {
+	client *Client
+	lock   sync.Mutex
+
+	defaults     RiskLimits
+	limits       map[string]RiskLimits
+	maxDailyLoss float64
+
+	killed      bool
+	day         string
+	realizedPnl float64
+
+	priceLimits  map[string]priceLimit
+	contractVals map[string]float64
+
+	// How long a fetched price limit is reused, 5 seconds by default.
+	PriceLimitTTL time.Duration
+	// Counts the open orders of an instrument, the orders_pending endpoints are queried when nil.
+	OpenOrders func(market, instrumentId string) int
+	// Unrealized PnL counted against the daily loss limit, in the same unit as RecordPnl.
+	UnrealizedPnl func() float64
+
+	now func() time.Time
+}
+
+func NewRiskGuard(client *Client) *RiskGuard {
+	return &RiskGuard{
+		client:        client,
+		limits:        map[string]RiskLimits{},
+		priceLimits:   map[string]priceLimit{},
+		contractVals:  map[string]float64{},
+		PriceLimitTTL: 5 * time.Second,
+		now:           time.Now,
+	}
+}
+
+/*
+Limits applied to instruments without their own limits.
+*/
+func (g *RiskGuard) SetDefaultLimits(limits RiskLimits) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.defaults = limits
+}
+
+func (g *RiskGuard) SetLimits(instrumentId string, limits RiskLimits) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.limits[instrumentId] = limits
+}
+
+func (g *RiskGuard) Limits(instrumentId string) RiskLimits {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if limits, ok := g.limits[instrumentId]; ok {
+		return limits
+	}
+	return g.defaults
+}
+
+/*
+Contract value used to compute the notional of futures/swap orders,
+loaded from GetFuturesInstruments and GetSwapInstruments when not set.
+*/
+func (g *RiskGuard) SetContractVal(instrumentId string, contractVal float64) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.contractVals[instrumentId] = contractVal
+}
+
+/*
+The maximum loss of a UTC day, 0 disables the check.
+Once the realized plus unrealized PnL of the day reaches -maxLoss new orders are rejected until the next day.
+*/
+func (g *RiskGuard) SetMaxDailyLoss(maxLoss float64) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.maxDailyLoss = maxLoss
+}
+
+/*
+Add a realized profit (positive) or loss (negative) to the PnL of the current UTC day.
+*/
+func (g *RiskGuard) RecordPnl(pnl float64) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.rollDay()
+	g.realizedPnl += pnl
+}
+
+/*
+Realized PnL of the current UTC day.
+*/
+func (g *RiskGuard) DailyPnl() float64 {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.rollDay()
+	return g.realizedPnl
+}
+
+func (g *RiskGuard) rollDay() {
+	day := g.now().UTC().Format("2006-01-02")
+	if day != g.day {
+		g.day = day
+		g.realizedPnl = 0
+	}
+}
+
+/*
+Count the open orders through an OrderManager instead of the REST endpoints.
+*/
+func (g *RiskGuard) UseOrderManager(m *OrderManager) {
+	g.OpenOrders = func(market, instrumentId string) int {
+		n := 0
+		for _, o := range m.OpenOrders(instrumentId) {
+			if o.Market == market {
+				n++
+			}
+		}
+		return n
+	}
+}
+
+/*
+Engage the kill switch: new orders are rejected with ERR_RISK_KILLED and the open orders of
+every market are listed through REST and cancelled, the futures and swap orders instrument by instrument.
+Closing positions through PostFuturesClosePosition or PostSwapClosePosition is still possible.
+*/
+func (g *RiskGuard) Kill() error {
+	g.lock.Lock()
+	g.killed = true
+	g.lock.Unlock()
+
+	var firstErr error
+	fail := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	fail(g.cancelPending(MARKET_SPOT))
+	fail(g.cancelPending(MARKET_MARGIN))
+
+	futures, err := g.client.GetFuturesInstruments()
+	fail(err)
+	for _, i := range futures {
+		_, err := g.client.CancelAllFuturesInstrumentOrders(i.InstrumentId)
+		fail(err)
+	}
+	swaps, err := g.client.GetSwapInstruments()
+	fail(err)
+	if swaps != nil {
+		for _, i := range *swaps {
+			_, err := g.client.CancelAllSwapInstrumentOrders(i.InstrumentId)
+			fail(err)
+		}
+	}
+	return firstErr
+}
+
+/*
+Release the kill switch.
+*/
+func (g *RiskGuard) Resume() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.killed = false
+}
+
+func (g *RiskGuard) Killed() bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.killed
+}
+
+/*
+Cancel the pending orders of every spot or margin instrument, all pages of them. A failed cancel,
+e.g. of an order which filled meanwhile, does not stop the others; the first error is returned.
+*/
+func (g *RiskGuard) cancelPending(market string) error {
+	pending, err := fetchPendingOrders(g.client, market, "")
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	for _, o := range pending {
+		if market == MARKET_SPOT {
+			_, err = g.client.PostSpotCancelOrders(o.InstrumentId, o.OrderId)
+		} else {
+			_, err = g.client.PostMarginCancelOrdersById(o.InstrumentId, o.OrderId)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+/*
+Check orders against the kill switch, the daily loss limit and the instrument limits.
+Orders of a batch are counted together against MaxOpenOrders. A nil guard accepts everything.
+*/
+func (g *RiskGuard) CheckOrders(orders ...RiskOrder) error {
+	if g == nil || len(orders) == 0 {
+		return nil
+	}
+
+	g.lock.Lock()
+	killed := g.killed
+	g.rollDay()
+	pnl := g.realizedPnl
+	maxLoss := g.maxDailyLoss
+	g.lock.Unlock()
+	if killed {
+		return ERR_RISK_KILLED
+	}
+	if maxLoss > 0 {
+		if g.UnrealizedPnl != nil {
+			pnl += g.UnrealizedPnl()
+		}
+		if pnl <= -maxLoss {
+			return ERR_RISK_DAILY_LOSS
+		}
+	}
+
+	batch := map[string]int{}
+	for _, o := range orders {
+		if err := g.checkOrder(o); err != nil {
+			return err
+		}
+		if !o.Amend {
+			batch[o.Market+"|"+o.InstrumentId]++
+		}
+	}
+	for _, o := range orders {
+		limits := g.Limits(o.InstrumentId)
+		key := o.Market + "|" + o.InstrumentId
+		if limits.MaxOpenOrders <= 0 || batch[key] == 0 {
+			continue
+		}
+		open, err := g.countOpenOrders(o.Market, o.InstrumentId)
+		if err != nil {
+			return err
+		}
+		if open+batch[key] > limits.MaxOpenOrders {
+			return ERR_RISK_OPEN_ORDERS
+		}
+		batch[key] = 0
+	}
+	return nil
+}
+
+func (g *RiskGuard) checkOrder(o RiskOrder) error {
+	limits := g.Limits(o.InstrumentId)
+	if limits.MaxOrderSize > 0 && o.Size > limits.MaxOrderSize {
+		return ERR_RISK_ORDER_SIZE
+	}
+
+	contract := o.Market == MARKET_FUTURES || o.Market == MARKET_SWAP
+	price := o.Price
+	if contract && limits.CheckPriceBand && price > 0 {
+		band, err := g.priceLimit(o.Market, o.InstrumentId)
+		if err != nil {
+			return err
+		}
+		if price > band.highest || price < band.lowest {
+			return ERR_RISK_PRICE_BAND
+		}
+	}
+
+	if limits.MaxNotional <= 0 {
+		return nil
+	}
+	if price == 0 && (contract && isLinearContract(o.InstrumentId) || !contract && o.Notional == 0) {
+		var err error
+		if price, err = g.marketPrice(o); err != nil {
+			return err
+		}
+		if price <= 0 {
+			return ERR_RISK_PRICE
+		}
+	}
+	notional := o.Notional
+	if contract {
+		contractVal, err := g.contractVal(o.InstrumentId)
+		if err != nil {
+			return err
+		}
+		if contractVal <= 0 {
+			return ERR_RISK_CONTRACT
+		}
+		notional = contractNotional(o.InstrumentId, o.Size, contractVal, price)
+	} else if notional == 0 {
+		notional = o.Size * price
+	}
+	if notional > limits.MaxNotional {
+		return ERR_RISK_NOTIONAL
+	}
+	return nil
+}
+
+/*
+Price a market order fills at: the best price of the spot ticker, the limit price for futures and swap.
+*/
+func (g *RiskGuard) marketPrice(o RiskOrder) (float64, error) {
+	if o.Market == MARKET_FUTURES || o.Market == MARKET_SWAP {
+		band, err := g.priceLimit(o.Market, o.InstrumentId)
+		if err != nil {
+			return 0, err
+		}
+		if o.Buy {
+			return band.highest, nil
+		}
+		return band.lowest, nil
+	}
+	ticker, err := g.client.GetSpotInstrumentTicker(o.InstrumentId)
+	if err != nil {
+		return 0, err
+	}
+	if o.Buy {
+		return anyToFloat((*ticker)["best_ask"]), nil
+	}
+	return anyToFloat((*ticker)["best_bid"]), nil
+}
+
+func (g *RiskGuard) countOpenOrders(market, instrumentId string) (int, error) {
+	if g.OpenOrders != nil {
+		return g.OpenOrders(market, instrumentId), nil
+	}
+	pending, err := fetchPendingOrders(g.client, market, instrumentId)
+	if err != nil {
+		return 0, err
+	}
+	return len(pending), nil
+}
+
+func (g *RiskGuard) priceLimit(market, instrumentId string) (priceLimit, error) {
+	g.lock.Lock()
+	cached, ok := g.priceLimits[instrumentId]
+	g.lock.Unlock()
+	if ok && g.now().Sub(cached.fetchedAt) < g.PriceLimitTTL {
+		return cached, nil
+	}
+
+	band := priceLimit{fetchedAt: g.now()}
+	if market == MARKET_FUTURES {
+		r, err := g.client.GetFuturesInstrumentPriceLimit(instrumentId)
+		if err != nil {
+			return band, err
+		}
+		band.highest, band.lowest = r.Highest, r.Lowest
+	} else {
+		r, err := g.client.GetSwapPriceLimitByInstrument(instrumentId)
+		if err != nil {
+			return band, err
+		}
+		band.highest, band.lowest = toFloat(r.Highest), toFloat(r.Lowest)
+	}
+
+	g.lock.Lock()
+	g.priceLimits[instrumentId] = band
+	g.lock.Unlock()
+	return band, nil
+}
+
+func (g *RiskGuard) contractVal(instrumentId string) (float64, error) {
+	g.lock.Lock()
+	contractVal, ok := g.contractVals[instrumentId]
+	g.lock.Unlock()
+	if ok {
+		return contractVal, nil
+	}
+
+	contractVals, err := loadContractVals(g.client, contractMarket(instrumentId))
+	if err != nil {
+		return 0, err
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	mergeContractVals(g.contractVals, contractVals)
+	return g.contractVals[instrumentId], nil
+}
+
+/*
+Build a RiskOrder from the request params of a spot, margin or futures order.
+*/
+func riskOrderOf(market, instrumentId string, params map[string]string) RiskOrder {
+	o := RiskOrder{Market: market, InstrumentId: instrumentId, Size: toFloat(params["size"])}
+	if market == MARKET_SPOT && params["margin_trading"] == MARGIN_TRADING_MARGIN {
+		o.Market = MARKET_MARGIN
+	}
+	switch o.Market {
+	case MARKET_SPOT, MARKET_MARGIN:
+		o.Buy = params["side"] == SPOT_SIDE_BUY
+		if params["type"] != SPOT_TYPE_MARKET {
+			o.Price = toFloat(params["price"])
+		}
+		o.Notional = toFloat(params["notional"])
+	default:
+		oType := StringToInt(params["type"])
+		o.Buy = oType == OPEN_LONG || oType == CLOSE_SHORT
+		if params["match_price"] != "1" && params["order_type"] != "4" {
+			o.Price = toFloat(params["price"])
+		}
+	}
+	return o
+}
+
+func swapRiskOrder(instrumentId string, order *BasePlaceOrderInfo) RiskOrder {
+	return riskOrderOf(MARKET_SWAP, instrumentId, map[string]string{
+		"type": order.Type, "price": order.Price, "size": order.Size,
+		"match_price": order.MatchPrice, "order_type": order.OrderType,
+	})
+}
+
+/*
+Build a RiskOrder from an amendment, the side of the order is unknown: a market price is the highest limit price.
+*/
+func amendRiskOrder(market, instrumentId string, params *AmendOrderParams) RiskOrder {
+	return RiskOrder{
+		Market: market, InstrumentId: instrumentId, Buy: true, Amend: true,
+		Price: toFloat(params.NewPrice), Size: toFloat(params.NewSize),
+	}
+}
+
+/*
+Build a RiskOrder from an algo order, trailing orders and market trigger orders have no price.
+*/
+func algoRiskOrder(market string, params *AlgoOrderParams) RiskOrder {
+	price := params.PriceLimit
+	if params.AlgoType != Int2String(ALGO_TYPE_MARKET) && params.AlgoPrice != "" {
+		price = params.AlgoPrice
+	}
+	return riskOrderOf(market, params.InstrumentId, map[string]string{
+		"type": params.Type, "price": price, "size": params.Size,
+	})
+}
@@ -0,0 +1,279 @@
+package okex
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRiskGuard_OrderLimits(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handle(POST, SWAP_ORDER, `{"order_id":"64-2a-1","result":"true"}`)
+	s.handle(POST, FUTURES_ORDER, `{"order_id":"100","result":true}`)
+	s.handle(POST, SPOT_ORDERS, `{"order_id":"200","result":true}`)
+	s.handle(GET, SWAP_INSTRUMENTS, `[{"instrument_id":"BTC-USDT-SWAP","contract_val":"0.01"}]`)
+	s.handle(GET, "/api/swap/v3/instruments/BTC-USDT-SWAP/price_limit", `{"instrument_id":"BTC-USDT-SWAP","highest":"10200","lowest":"9800"}`)
+	client := s.client()
+	client.Risk = NewRiskGuard(client)
+	client.Risk.SetLimits("BTC-USDT-SWAP", RiskLimits{MaxOrderSize: 100, MaxNotional: 5000, CheckPriceBand: true})
+	client.Risk.SetDefaultLimits(RiskLimits{MaxNotional: 1000})
+
+	_, err := client.PostSwapOrder("BTC-USDT-SWAP", &BasePlaceOrderInfo{Type: "1", Price: "10000", Size: "101"})
+	assert.Equal(t, ERR_RISK_ORDER_SIZE, err)
+	_, err = client.PostSwapOrder("BTC-USDT-SWAP", &BasePlaceOrderInfo{Type: "1", Price: "10300", Size: "1"})
+	assert.Equal(t, ERR_RISK_PRICE_BAND, err)
+	// market buy priced at the highest limit: 50 * 0.01 * 10200
+	_, err = client.PostSwapOrder("BTC-USDT-SWAP", &BasePlaceOrderInfo{Type: "1", MatchPrice: "1", Size: "50"})
+	assert.Equal(t, ERR_RISK_NOTIONAL, err)
+	assert.Equal(t, 0, len(s.requestsTo(POST, SWAP_ORDER)))
+
+	_, err = client.PostSwapOrder("BTC-USDT-SWAP", &BasePlaceOrderInfo{Type: "2", Price: "9900", Size: "40"})
+	require.True(t, err == nil, err)
+	assert.Equal(t, 1, len(s.requestsTo(POST, SWAP_ORDER)))
+	assert.Equal(t, 1, len(s.requestsTo(GET, "/api/swap/v3/instruments/BTC-USDT-SWAP/price_limit")))
+
+	// coin margined futures: 11 * 100 USD
+	client.Risk.SetContractVal("BTC-USD-190628", 100)
+	_, err = client.PostFuturesOrder("BTC-USD-190628", "1", "9000", "11", nil)
+	assert.Equal(t, ERR_RISK_NOTIONAL, err)
+	_, err = client.PostFuturesOrder("BTC-USD-190628", "1", "9000", "10", nil)
+	require.True(t, err == nil, err)
+
+	// listed without a contract value
+	_, err = client.PostSwapOrder("ETH-USDT-SWAP", &BasePlaceOrderInfo{Type: "1", Price: "200", Size: "1"})
+	assert.Equal(t, ERR_RISK_CONTRACT, err)
+
+	_, err = client.PostSpotOrder(NewSpotMarketBuy("BTC-USDT", "1500"))
+	assert.Equal(t, ERR_RISK_NOTIONAL, err)
+	_, err = client.PostSpotOrder(NewSpotLimitOrder("BTC-USDT", SPOT_SIDE_SELL, "9000", "0.1"))
+	require.True(t, err == nil, err)
+}
+
+func TestRiskGuard_OpenOrdersAndDailyLoss(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handle(POST, SWAP_ORDERS, `{"result":"true","order_info":[]}`)
+	s.handle(GET, "/api/swap/v3/orders/BTC-USD-SWAP", `{"order_info":[
+		{"instrument_id":"BTC-USD-SWAP","order_id":"1","state":"0"},
+		{"instrument_id":"BTC-USD-SWAP","order_id":"2","state":"1"}]}`)
+	client := s.client()
+	g := NewRiskGuard(client)
+	client.Risk = g
+	g.SetDefaultLimits(RiskLimits{MaxOpenOrders: 4})
+
+	two := []*BasePlaceOrderInfo{{Type: "1", Price: "9000", Size: "1"}, {Type: "1", Price: "8900", Size: "1"}}
+	_, err := client.PostSwapOrders("BTC-USD-SWAP", two)
+	require.True(t, err == nil, err)
+	three := append(two, &BasePlaceOrderInfo{Type: "1", Price: "8800", Size: "1"})
+	_, err = client.PostSwapOrders("BTC-USD-SWAP", three)
+	assert.Equal(t, ERR_RISK_OPEN_ORDERS, err)
+
+	g.OpenOrders = func(market, instrumentId string) int { return 0 }
+	_, err = client.PostSwapOrders("BTC-USD-SWAP", three)
+	require.True(t, err == nil, err)
+
+	now := time.Date(2019, 4, 16, 23, 0, 0, 0, time.UTC)
+	g.now = func() time.Time { return now }
+	g.SetMaxDailyLoss(100)
+	g.RecordPnl(-60)
+	unrealized := -50.0
+	g.UnrealizedPnl = func() float64 { return unrealized }
+	_, err = client.PostSwapOrders("BTC-USD-SWAP", two)
+	assert.Equal(t, ERR_RISK_DAILY_LOSS, err)
+	unrealized = 0
+	_, err = client.PostSwapOrders("BTC-USD-SWAP", two)
+	require.True(t, err == nil, err)
+
+	g.RecordPnl(-40)
+	_, err = client.PostSwapOrders("BTC-USD-SWAP", two)
+	assert.Equal(t, ERR_RISK_DAILY_LOSS, err)
+	now = now.Add(2 * time.Hour)
+	assert.Equal(t, 0.0, g.DailyPnl())
+	_, err = client.PostSwapOrders("BTC-USD-SWAP", two)
+	require.True(t, err == nil, err)
+}
+
+func TestRiskGuard_MarketOrderNotional(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handle(POST, SWAP_ORDER, `{"order_id":"64-2a-1","result":"true"}`)
+	s.handle(POST, SPOT_ORDERS, `{"order_id":"200","result":true}`)
+	s.handle(GET, "/api/swap/v3/instruments/BTC-USDT-SWAP/price_limit", `{"instrument_id":"BTC-USDT-SWAP","highest":"10200","lowest":"9800"}`)
+	s.handle(GET, "/api/spot/v3/instruments/BTC-USDT/ticker", `{"instrument_id":"BTC-USDT","best_bid":"9000","best_ask":"9010"}`)
+	s.handle(GET, "/api/spot/v3/instruments/ETH-USDT/ticker", `{"instrument_id":"ETH-USDT","best_bid":"","best_ask":""}`)
+	client := s.client()
+	client.Risk = NewRiskGuard(client)
+	client.Risk.SetDefaultLimits(RiskLimits{MaxNotional: 1000})
+	client.Risk.SetContractVal("BTC-USDT-SWAP", 0.01)
+
+	// market sell priced at the lowest limit without CheckPriceBand: 11 * 0.01 * 9800
+	_, err := client.PostSwapOrder("BTC-USDT-SWAP", &BasePlaceOrderInfo{Type: "2", MatchPrice: "1", Size: "11"})
+	assert.Equal(t, ERR_RISK_NOTIONAL, err)
+	_, err = client.PostSwapOrder("BTC-USDT-SWAP", &BasePlaceOrderInfo{Type: "2", OrderType: "4", Size: "10"})
+	require.True(t, err == nil, err)
+
+	// spot market sell priced at the best bid: 0.2 * 9000
+	_, err = client.PostSpotOrder(NewSpotMarketSell("BTC-USDT", "0.2"))
+	assert.Equal(t, ERR_RISK_NOTIONAL, err)
+	_, err = client.PostSpotOrder(NewSpotMarketSell("BTC-USDT", "0.1"))
+	require.True(t, err == nil, err)
+	_, err = client.PostSpotOrder(NewSpotMarketSell("ETH-USDT", "0.1"))
+	assert.Equal(t, ERR_RISK_PRICE, err)
+	assert.Equal(t, 1, len(s.requestsTo(POST, SPOT_ORDERS)))
+	assert.Equal(t, 1, len(s.requestsTo(POST, SWAP_ORDER)))
+}
+
+func TestRiskGuard_AmendAndAlgoOrders(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handle(POST, "/api/swap/v3/amend_order/BTC-USD-SWAP", `{"order_id":"1","result":"true"}`)
+	s.handle(POST, SWAP_ORDER_ALGO, `{"code":"0","data":{"algo_id":"11","instrument_id":"BTC-USD-SWAP","result":"success"}}`)
+	client := s.client()
+	client.Risk = NewRiskGuard(client)
+	client.Risk.SetDefaultLimits(RiskLimits{MaxOrderSize: 10, MaxOpenOrders: 1})
+	client.Risk.OpenOrders = func(market, instrumentId string) int { return 1 }
+
+	amend := NewAmendOrderById("1")
+	amend.NewSize = "11"
+	_, err := client.PostSwapAmendOrder("BTC-USD-SWAP", amend)
+	assert.Equal(t, ERR_RISK_ORDER_SIZE, err)
+	// an amendment does not open an order
+	amend.NewSize = "5"
+	_, err = client.PostSwapAmendOrder("BTC-USD-SWAP", amend)
+	require.True(t, err == nil, err)
+
+	algo := NewTriggerAlgoOrder("BTC-USD-SWAP", OPEN_LONG, "11", "9000", "9001", ALGO_TYPE_LIMIT)
+	_, err = client.PostSwapAlgoOrder(algo)
+	assert.Equal(t, ERR_RISK_ORDER_SIZE, err)
+	algo.Size = "1"
+	_, err = client.PostSwapAlgoOrder(algo)
+	assert.Equal(t, ERR_RISK_OPEN_ORDERS, err)
+	client.Risk.OpenOrders = nil
+	client.Risk.SetDefaultLimits(RiskLimits{})
+	_, err = client.PostSwapAlgoOrder(algo)
+	require.True(t, err == nil, err)
+
+	client.Risk.killed = true
+	_, err = client.PostSwapAmendOrder("BTC-USD-SWAP", amend)
+	assert.Equal(t, ERR_RISK_KILLED, err)
+	_, err = client.PostSwapAlgoOrder(algo)
+	assert.Equal(t, ERR_RISK_KILLED, err)
+	_, err = client.PostFuturesAmendBatchOrders("BTC-USD-190628", []*AmendOrderParams{amend})
+	assert.Equal(t, ERR_RISK_KILLED, err)
+	assert.Equal(t, 1, len(s.requestsTo(POST, "/api/swap/v3/amend_order/BTC-USD-SWAP")))
+	assert.Equal(t, 1, len(s.requestsTo(POST, SWAP_ORDER_ALGO)))
+}
+
+func TestRiskGuard_SpotAmendOrders(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handle(POST, "/api/spot/v3/amend_order/BTC-USDT", `{"order_id":"1","result":"true"}`)
+	s.handle(POST, SPOT_AMEND_BATCH_ORDERS, `{"btc_usdt":[{"order_id":"1","result":"true"}]}`)
+	client := s.client()
+	client.Risk = NewRiskGuard(client)
+	client.Risk.SetDefaultLimits(RiskLimits{MaxOrderSize: 10, MaxNotional: 5000, MaxOpenOrders: 1})
+	client.Risk.OpenOrders = func(market, instrumentId string) int { return 1 }
+
+	amend := NewAmendOrderById("1")
+	amend.NewSize = "11"
+	amend.NewPrice = "1000"
+	_, err := client.PostSpotAmendOrder("BTC-USDT", amend)
+	assert.Equal(t, ERR_RISK_ORDER_SIZE, err)
+	amend.NewSize = "6"
+	_, err = client.PostSpotAmendOrder("BTC-USDT", amend)
+	assert.Equal(t, ERR_RISK_NOTIONAL, err)
+	amend.InstrumentId = "BTC-USDT"
+	_, err = client.PostSpotAmendBatchOrders([]*AmendOrderParams{amend})
+	assert.Equal(t, ERR_RISK_NOTIONAL, err)
+	// an amendment does not open an order
+	amend.NewSize = "5"
+	_, err = client.PostSpotAmendOrder("BTC-USDT", amend)
+	require.True(t, err == nil, err)
+	_, err = client.PostSpotAmendBatchOrders([]*AmendOrderParams{amend})
+	require.True(t, err == nil, err)
+
+	client.Risk.killed = true
+	_, err = client.PostSpotAmendOrder("BTC-USDT", amend)
+	assert.Equal(t, ERR_RISK_KILLED, err)
+	_, err = client.PostSpotAmendBatchOrders([]*AmendOrderParams{amend})
+	assert.Equal(t, ERR_RISK_KILLED, err)
+	assert.Equal(t, 1, len(s.requestsTo(POST, "/api/spot/v3/amend_order/BTC-USDT")))
+	assert.Equal(t, 1, len(s.requestsTo(POST, SPOT_AMEND_BATCH_ORDERS)))
+}
+
+func TestRiskGuard_KillSwitch(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handle(POST, SWAP_ORDER, `{"order_id":"64-2a-1","result":"true"}`)
+	s.handle(GET, SWAP_INSTRUMENTS, `[{"instrument_id":"BTC-USD-SWAP"},{"instrument_id":"ETH-USD-SWAP"}]`)
+	s.handle(GET, "/api/swap/v3/orders/BTC-USD-SWAP", `{"order_info":[{"instrument_id":"BTC-USD-SWAP","order_id":"64-2a-1","state":"0"}]}`)
+	s.handle(GET, "/api/swap/v3/orders/ETH-USD-SWAP", `{"order_info":[]}`)
+	s.handle(POST, "/api/swap/v3/cancel_batch_orders/BTC-USD-SWAP", `{"result":"true","ids":["64-2a-1"]}`)
+	s.handle(GET, FUTURES_INSTRUMENTS, `[{"instrument_id":"BTC-USD-190628"}]`)
+	s.handle(GET, "/api/futures/v3/orders/BTC-USD-190628", `{"result":true,"order_info":[{"instrument_id":"BTC-USD-190628","order_id":"500","state":"0"}]}`)
+	s.handle(POST, "/api/futures/v3/cancel_batch_orders/BTC-USD-190628", `{"result":true,"order_ids":["500"],"instrument_id":"BTC-USD-190628"}`)
+	s.handle(GET, SPOT_ORDERS_PENDING, `[{"order_id":"300","instrument_id":"ETH-USDT","status":"open"}]`)
+	s.handle(POST, "/api/spot/v3/cancel_orders/300", `{"order_id":"300","result":true}`)
+	s.handle(GET, MARGIN_ORDERS_PENDING, `[{"order_id":"400","instrument_id":"BTC-USDT","state":"0"}]`)
+	s.handle(POST, "/api/margin/v3/cancel_orders/400", `{"order_id":"400","result":true}`)
+	client := s.client()
+	client.Risk = NewRiskGuard(client)
+
+	require.True(t, client.Risk.Kill() == nil)
+	assert.True(t, client.Risk.Killed())
+	assert.Equal(t, 1, len(s.requestsTo(POST, "/api/swap/v3/cancel_batch_orders/BTC-USD-SWAP")))
+	assert.Equal(t, 1, len(s.requestsTo(POST, "/api/futures/v3/cancel_batch_orders/BTC-USD-190628")))
+	assert.Equal(t, 1, len(s.requestsTo(POST, "/api/spot/v3/cancel_orders/300")))
+	assert.Equal(t, 1, len(s.requestsTo(POST, "/api/margin/v3/cancel_orders/400")))
+	assert.Equal(t, "limit=100", s.requestsTo(GET, SPOT_ORDERS_PENDING)[0].RawQuery)
+
+	_, err := client.PostSwapOrder("BTC-USD-SWAP", &BasePlaceOrderInfo{Type: "1", Price: "9000", Size: "1"})
+	assert.Equal(t, ERR_RISK_KILLED, err)
+	_, err = client.PostSpotOrder(NewSpotLimitOrder("ETH-USDT", SPOT_SIDE_BUY, "200", "1"))
+	assert.Equal(t, ERR_RISK_KILLED, err)
+	assert.Equal(t, 0, len(s.requestsTo(POST, SWAP_ORDER)))
+
+	client.Risk.Resume()
+	_, err = client.PostSwapOrder("BTC-USD-SWAP", &BasePlaceOrderInfo{Type: "1", Price: "9000", Size: "1"})
+	require.True(t, err == nil, err)
+}
+
+func TestRiskGuard_KillPendingPages(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handle(GET, SWAP_INSTRUMENTS, `[]`)
+	s.handle(GET, FUTURES_INSTRUMENTS, `[]`)
+	s.handle(GET, MARGIN_ORDERS_PENDING, `[]`)
+	// a full first page of spot orders 1100 down to 1001, the last one on the page after 1001
+	s.handleFunc(GET, SPOT_ORDERS_PENDING, func(req fakeRequest) string {
+		if strings.Contains(req.RawQuery, "after=1001") {
+			return `[{"order_id":"1000","instrument_id":"ETH-USDT","status":"open"}]`
+		}
+		orders := []string{}
+		for id := 1100; id > 1000; id-- {
+			orders = append(orders, `{"order_id":"`+strconv.Itoa(id)+`","instrument_id":"ETH-USDT","status":"open"}`)
+		}
+		return "[" + strings.Join(orders, ",") + "]"
+	})
+	for id := 1000; id <= 1100; id++ {
+		// order 1050 filled meanwhile, its cancel is rejected
+		if id != 1050 {
+			s.handle(POST, "/api/spot/v3/cancel_orders/"+strconv.Itoa(id), `{"order_id":"`+strconv.Itoa(id)+`","result":true}`)
+		}
+	}
+	client := s.client()
+	client.Risk = NewRiskGuard(client)
+
+	assert.True(t, client.Risk.Kill() != nil)
+	assert.True(t, client.Risk.Killed())
+	assert.Equal(t, 2, len(s.requestsTo(GET, SPOT_ORDERS_PENDING)))
+	assert.Equal(t, 1, len(s.requestsTo(POST, "/api/spot/v3/cancel_orders/1050")))
+	assert.Equal(t, 1, len(s.requestsTo(POST, "/api/spot/v3/cancel_orders/1001")))
+	assert.Equal(t, 1, len(s.requestsTo(POST, "/api/spot/v3/cancel_orders/1000")))
+	assert.Equal(t, 1, len(s.requestsTo(GET, MARGIN_ORDERS_PENDING)))
+}
@@ -0,0 +1,98 @@
+package okex
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_SimulatedEndpoints(t *testing.T) {
+	config := Config{Endpoint: DEFAULT_ENDPOINT, WSEndpoint: DEFAULT_WSENDPOINT}
+	assert.Equal(t, DEFAULT_WSENDPOINT, config.WebsocketEndpoint())
+
+	config.Simulated = true
+	assert.Equal(t, SIMULATED_WSENDPOINT, config.WebsocketEndpoint())
+
+	// an explicit endpoint is kept, eg. a local fake
+	config.WSEndpoint = "ws://127.0.0.1:10442/"
+	assert.Equal(t, "ws://127.0.0.1:10442/", config.WebsocketEndpoint())
+}
+
+func TestClient_SimulatedHeader(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handle(GET, OKEX_TIME_URI, `{"iso":"2019-04-16T10:00:00.000Z","epoch":"1555408800.000"}`)
+
+	_, err := s.client().GetServerTime()
+	require.True(t, err == nil, err)
+	assert.Equal(t, "", s.lastRequest().Header.Get(OK_SIMULATED_TRADING))
+
+	config := s.config()
+	config.Simulated = true
+	_, err = NewClient(*config).GetServerTime()
+	require.True(t, err == nil, err)
+	assert.Equal(t, "1", s.lastRequest().Header.Get(OK_SIMULATED_TRADING))
+	assert.Equal(t, "fake-api-key", s.lastRequest().Header.Get(OK_ACCESS_KEY))
+}
+
+func TestOKWSAgent_SimulatedLogin(t *testing.T) {
+	type handshake struct {
+		header http.Header
+		login  map[string]interface{}
+	}
+	handshakes := make(chan handshake, 1)
+	done := make(chan struct{})
+	upgrader := websocket.Upgrader{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		h := handshake{header: r.Header}
+		if _, message, err := conn.ReadMessage(); err == nil {
+			json.Unmarshal(message, &h.login)
+		}
+		select {
+		case handshakes <- h:
+		default:
+		}
+		// keep the connection open until the test ends, the agent reconnects otherwise
+		<-done
+	}))
+	defer s.Close()
+	defer close(done)
+
+	config := Config{
+		WSEndpoint: "ws" + strings.TrimPrefix(s.URL, "http") + "/ws/v3",
+		ApiKey:     "demo-key",
+		SecretKey:  "demo-secret",
+		Passphrase: "demo-pass",
+		Simulated:  true,
+	}
+	agent := &OKWSAgent{}
+	err := agent.Start(&config, func() error {
+		return agent.Login(config.ApiKey, config.Passphrase)
+	})
+	require.True(t, err == nil, err)
+	defer agent.Stop()
+
+	select {
+	case h := <-handshakes:
+		assert.Equal(t, "1", h.header.Get(OK_SIMULATED_TRADING))
+		assert.Equal(t, "login", h.login["op"])
+		args, _ := h.login["args"].([]interface{})
+		require.Equal(t, 4, len(args))
+		assert.Equal(t, "demo-key", args[0])
+		assert.Equal(t, "demo-pass", args[1])
+	case <-time.After(5 * time.Second):
+		t.Fatal("no websocket login")
+	}
+}
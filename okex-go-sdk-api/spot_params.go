@@ -0,0 +1,242 @@
+package okex
+
+/*
+ OKEX spot & margin api request params
+*/
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	/*
+	 order side
+	*/
+	SPOT_SIDE_BUY  = "buy"
+	SPOT_SIDE_SELL = "sell"
+
+	/*
+	 order type: limit or market
+	*/
+	SPOT_TYPE_LIMIT  = "limit"
+	SPOT_TYPE_MARKET = "market"
+
+	/*
+	 order_type: 0: normal 1: post only 2: fill or kill 3: immediate or cancel
+	*/
+	ORDER_TYPE_NORMAL    = 0
+	ORDER_TYPE_POST_ONLY = 1
+	ORDER_TYPE_FOK       = 2
+	ORDER_TYPE_IOC       = 3
+
+	/*
+	 margin_trading: 1: spot order 2: margin order
+	*/
+	MARGIN_TRADING_SPOT   = "1"
+	MARGIN_TRADING_MARGIN = "2"
+)
+
+var (
+	ERR_SPOT_ORDER_INSTRUMENT = errors.New(`spot order: instrument_id is required`)
+	ERR_SPOT_ORDER_SIDE       = errors.New(`spot order: side must be buy or sell`)
+	ERR_SPOT_ORDER_PRICE      = errors.New(`spot order: price is required for limit order`)
+	ERR_SPOT_ORDER_SIZE       = errors.New(`spot order: size is required`)
+	ERR_SPOT_ORDER_NOTIONAL   = errors.New(`spot order: notional is required for market buy order`)
+	ERR_SPOT_ORDER_NIL        = errors.New(`spot order: order is nil`)
+)
+
+/*
+SpotOrderBuilder builds the request body of POST /api/spot/v3/orders or
+POST /api/margin/v3/orders. Build returns an error when a field required
+by the order type is missing, so a typo never reaches the exchange.
+*/
+type SpotOrderBuilder interface {
+	Build() (map[string]string, error)
+}
+
+type spotOrderBase struct {
+	InstrumentId string
+	ClientOid    string
+	OrderType    int
+}
+
+func (b *spotOrderBase) params(side, oType string) (map[string]string, error) {
+	if b.InstrumentId == "" {
+		return nil, ERR_SPOT_ORDER_INSTRUMENT
+	}
+	if b.OrderType < ORDER_TYPE_NORMAL || b.OrderType > ORDER_TYPE_IOC {
+		return nil, fmt.Errorf("spot order: illegal order_type %d", b.OrderType)
+	}
+	params := NewParams()
+	params["instrument_id"] = b.InstrumentId
+	params["side"] = side
+	params["type"] = oType
+	params["order_type"] = Int2String(b.OrderType)
+	if b.ClientOid != "" {
+		params["client_oid"] = b.ClientOid
+	}
+	return params, nil
+}
+
+/*
+Limit order, both price and size are required.
+
+	eg: NewSpotLimitOrder("BTC-USDT", SPOT_SIDE_BUY, "3000", "0.1").WithOrderType(ORDER_TYPE_POST_ONLY)
+*/
+type SpotLimitOrder struct {
+	spotOrderBase
+	Side  string
+	Price string
+	Size  string
+}
+
+func NewSpotLimitOrder(instrumentId, side, price, size string) *SpotLimitOrder {
+	o := SpotLimitOrder{Side: side, Price: price, Size: size}
+	o.InstrumentId = instrumentId
+	return &o
+}
+
+func (o *SpotLimitOrder) WithClientOid(clientOid string) *SpotLimitOrder {
+	o.ClientOid = clientOid
+	return o
+}
+
+func (o *SpotLimitOrder) WithOrderType(orderType int) *SpotLimitOrder {
+	o.OrderType = orderType
+	return o
+}
+
+func (o *SpotLimitOrder) Build() (map[string]string, error) {
+	if o.Side != SPOT_SIDE_BUY && o.Side != SPOT_SIDE_SELL {
+		return nil, ERR_SPOT_ORDER_SIDE
+	}
+	if o.Price == "" {
+		return nil, ERR_SPOT_ORDER_PRICE
+	}
+	if o.Size == "" {
+		return nil, ERR_SPOT_ORDER_SIZE
+	}
+	params, err := o.params(o.Side, SPOT_TYPE_LIMIT)
+	if err != nil {
+		return nil, err
+	}
+	params["price"] = o.Price
+	params["size"] = o.Size
+	return params, nil
+}
+
+/*
+Market buy order, the amount to spend is given in quote currency by notional.
+*/
+type SpotMarketBuy struct {
+	spotOrderBase
+	Notional string
+}
+
+func NewSpotMarketBuy(instrumentId, notional string) *SpotMarketBuy {
+	o := SpotMarketBuy{Notional: notional}
+	o.InstrumentId = instrumentId
+	return &o
+}
+
+func (o *SpotMarketBuy) WithClientOid(clientOid string) *SpotMarketBuy {
+	o.ClientOid = clientOid
+	return o
+}
+
+func (o *SpotMarketBuy) WithOrderType(orderType int) *SpotMarketBuy {
+	o.OrderType = orderType
+	return o
+}
+
+func (o *SpotMarketBuy) Build() (map[string]string, error) {
+	if o.Notional == "" {
+		return nil, ERR_SPOT_ORDER_NOTIONAL
+	}
+	params, err := o.params(SPOT_SIDE_BUY, SPOT_TYPE_MARKET)
+	if err != nil {
+		return nil, err
+	}
+	params["notional"] = o.Notional
+	return params, nil
+}
+
+/*
+Market sell order, the amount to sell is given in base currency by size.
+*/
+type SpotMarketSell struct {
+	spotOrderBase
+	Size string
+}
+
+func NewSpotMarketSell(instrumentId, size string) *SpotMarketSell {
+	o := SpotMarketSell{Size: size}
+	o.InstrumentId = instrumentId
+	return &o
+}
+
+func (o *SpotMarketSell) WithClientOid(clientOid string) *SpotMarketSell {
+	o.ClientOid = clientOid
+	return o
+}
+
+func (o *SpotMarketSell) WithOrderType(orderType int) *SpotMarketSell {
+	o.OrderType = orderType
+	return o
+}
+
+func (o *SpotMarketSell) Build() (map[string]string, error) {
+	if o.Size == "" {
+		return nil, ERR_SPOT_ORDER_SIZE
+	}
+	params, err := o.params(SPOT_SIDE_SELL, SPOT_TYPE_MARKET)
+	if err != nil {
+		return nil, err
+	}
+	params["size"] = o.Size
+	return params, nil
+}
+
+/*
+Margin order, wraps any spot order and sets margin_trading=2.
+
+	eg: NewMarginOrder(NewSpotMarketSell("BTC-USDT", "0.1"))
+*/
+type MarginOrder struct {
+	Order SpotOrderBuilder
+}
+
+func NewMarginOrder(order SpotOrderBuilder) *MarginOrder {
+	return &MarginOrder{Order: order}
+}
+
+func (o *MarginOrder) Build() (map[string]string, error) {
+	if o.Order == nil {
+		return nil, ERR_SPOT_ORDER_NIL
+	}
+	params, err := o.Order.Build()
+	if err != nil {
+		return nil, err
+	}
+	params["margin_trading"] = MARGIN_TRADING_MARGIN
+	return params, nil
+}
+
+/*
+Build the request body of a batch order request from several builders.
+*/
+func BuildSpotBatchOrders(orders ...SpotOrderBuilder) ([]map[string]string, error) {
+	var orderInfos []map[string]string
+	for i, order := range orders {
+		if order == nil {
+			return nil, ERR_SPOT_ORDER_NIL
+		}
+		params, err := order.Build()
+		if err != nil {
+			return nil, fmt.Errorf("orders[%d]: %v", i, err)
+		}
+		orderInfos = append(orderInfos, params)
+	}
+	return orderInfos, nil
+}
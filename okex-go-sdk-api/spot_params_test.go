@@ -0,0 +1,75 @@
+package okex
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpotLimitOrder_Build(t *testing.T) {
+	params, err := NewSpotLimitOrder("BTC-USDT", SPOT_SIDE_BUY, "3000", "0.1").
+		WithClientOid("a20190704").WithOrderType(ORDER_TYPE_POST_ONLY).Build()
+	require.True(t, err == nil, err)
+	jstr, _ := Struct2JsonString(params)
+	assert.Equal(t, `{"client_oid":"a20190704","instrument_id":"BTC-USDT","order_type":"1","price":"3000","side":"buy","size":"0.1","type":"limit"}`, jstr)
+
+	_, err = NewSpotLimitOrder("BTC-USDT", "buyy", "3000", "0.1").Build()
+	assert.Equal(t, ERR_SPOT_ORDER_SIDE, err)
+	_, err = NewSpotLimitOrder("BTC-USDT", SPOT_SIDE_SELL, "", "0.1").Build()
+	assert.Equal(t, ERR_SPOT_ORDER_PRICE, err)
+	_, err = NewSpotLimitOrder("", SPOT_SIDE_SELL, "3000", "0.1").Build()
+	assert.Equal(t, ERR_SPOT_ORDER_INSTRUMENT, err)
+	_, err = NewSpotLimitOrder("BTC-USDT", SPOT_SIDE_SELL, "3000", "0.1").WithOrderType(4).Build()
+	assert.True(t, err != nil)
+}
+
+func TestSpotMarketOrder_Build(t *testing.T) {
+	params, err := NewSpotMarketBuy("BTC-USDT", "100").Build()
+	require.True(t, err == nil, err)
+	jstr, _ := Struct2JsonString(params)
+	assert.Equal(t, `{"instrument_id":"BTC-USDT","notional":"100","order_type":"0","side":"buy","type":"market"}`, jstr)
+
+	params, err = NewSpotMarketSell("BTC-USDT", "0.5").WithOrderType(ORDER_TYPE_IOC).Build()
+	require.True(t, err == nil, err)
+	jstr, _ = Struct2JsonString(params)
+	assert.Equal(t, `{"instrument_id":"BTC-USDT","order_type":"3","side":"sell","size":"0.5","type":"market"}`, jstr)
+
+	_, err = NewSpotMarketBuy("BTC-USDT", "").Build()
+	assert.Equal(t, ERR_SPOT_ORDER_NOTIONAL, err)
+	_, err = NewSpotMarketSell("BTC-USDT", "").Build()
+	assert.Equal(t, ERR_SPOT_ORDER_SIZE, err)
+}
+
+func TestMarginOrder_Build(t *testing.T) {
+	params, err := NewMarginOrder(NewSpotMarketSell("BTC-USDT", "0.5")).Build()
+	require.True(t, err == nil, err)
+	assert.Equal(t, MARGIN_TRADING_MARGIN, params["margin_trading"])
+
+	_, err = NewMarginOrder(nil).Build()
+	assert.Equal(t, ERR_SPOT_ORDER_NIL, err)
+
+	_, err = BuildSpotBatchOrders(NewSpotMarketBuy("BTC-USDT", "100"), NewSpotMarketSell("BTC-USDT", ""))
+	assert.True(t, err != nil)
+}
+
+func TestClient_PostSpotOrder(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+	s.handle(POST, SPOT_ORDERS, `{"client_oid":"","order_id":"2510789768709120","result":true}`)
+	s.handle(POST, MARGIN_ORDERS, `{"client_oid":"","order_id":"2510789768709121","result":true}`)
+
+	c := s.client()
+	r, err := c.PostSpotOrder(NewSpotMarketBuy("BTC-USDT", "100"))
+	require.True(t, r != nil && err == nil, err)
+	assert.Equal(t, "2510789768709120", (*r)["order_id"])
+	assert.Equal(t, `{"instrument_id":"BTC-USDT","notional":"100","order_type":"0","side":"buy","type":"market"}`, s.lastRequest().Body)
+
+	r, err = c.PostMarginOrder(NewMarginOrder(NewSpotLimitOrder("BTC-USDT", SPOT_SIDE_SELL, "10000", "0.01")))
+	require.True(t, r != nil && err == nil, err)
+	assert.Equal(t, `{"instrument_id":"BTC-USDT","margin_trading":"2","order_type":"0","price":"10000","side":"sell","size":"0.01","type":"limit"}`, s.lastRequest().Body)
+
+	_, err = c.PostSpotOrder(NewSpotLimitOrder("BTC-USDT", SPOT_SIDE_SELL, "", "0.01"))
+	assert.Equal(t, ERR_SPOT_ORDER_PRICE, err)
+	assert.Equal(t, 2, len(s.requests))
+}
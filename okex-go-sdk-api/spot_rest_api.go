@@ -1,6 +1,7 @@
 package okex
 
 import (
+	"errors"
 	"strings"
 )
 
@@ -131,12 +132,11 @@ func (client *Client) GetSpotOrdersPending(options *map[string]string) (orders [
 	fullOptions := NewParams()
 	uri := SPOT_ORDERS_PENDING
 	if options != nil && len(*options) > 0 {
-		if val, ok := (*options)["instrument_id"]; ok {
-			fullOptions["instrument_id"] = val
+		for _, k := range []string{"instrument_id", "after", "before", "limit"} {
+			if val, ok := (*options)[k]; ok {
+				fullOptions[k] = val
+			}
 		}
-		// fullOptions["from"] = (*options)["from"]
-		// fullOptions["to"] = (*options)["to"]
-		// fullOptions["limit"] = (*options)["limit"]
 		uri = BuildParams(SPOT_ORDERS_PENDING, fullOptions)
 	}
 
@@ -363,25 +363,57 @@ func (client *Client) PostSpotOrders(side, instrument_id string, optionalOrderIn
 		if val, ok := (*optionalOrderInfo)["margin_trading"]; ok {
 			postParams["margin_trading"] = val
 		}
+		if val, ok := (*optionalOrderInfo)["order_type"]; ok {
+			postParams["order_type"] = val
+		}
 
 		if postParams["type"] == "limit" {
 			postParams["price"] = (*optionalOrderInfo)["price"]
 			postParams["size"] = (*optionalOrderInfo)["size"]
 
 		} else if postParams["type"] == "market" {
-			postParams["size"] = (*optionalOrderInfo)["size"]
-			postParams["notional"] = (*optionalOrderInfo)["notional"]
-
+			if val, ok := (*optionalOrderInfo)["size"]; ok {
+				postParams["size"] = val
+			}
+			if val, ok := (*optionalOrderInfo)["notional"]; ok {
+				postParams["notional"] = val
+			}
 		}
 	}
 
-	if _, err := client.Request(POST, SPOT_ORDERS, postParams, &r); err != nil {
+	if err := client.Risk.CheckOrders(riskOrderOf(MARKET_SPOT, instrument_id, postParams)); err != nil {
+		return nil, err
+	}
+	order := client.Orders.posting(MARKET_SPOT, instrument_id, postParams)
+	_, err = client.Request(POST, SPOT_ORDERS, postParams, &r)
+	client.Orders.posted(r, err, order)
+	if err != nil {
 		return nil, err
 	}
 
 	return &r, nil
 }
 
+/*
+下单
+使用SpotOrderBuilder下单，必填字段在发送前校验。
+
+	eg: client.PostSpotOrder(NewSpotLimitOrder("BTC-USDT", SPOT_SIDE_SELL, "10000", "0.01"))
+
+HTTP请求
+POST /api/spot/v3/orders
+*/
+func (client *Client) PostSpotOrder(order SpotOrderBuilder) (*map[string]interface{}, error) {
+	if order == nil {
+		return nil, ERR_SPOT_ORDER_NIL
+	}
+	orderInfo, err := order.Build()
+	if err != nil {
+		return nil, err
+	}
+	return client.PostSpotOrders(orderInfo["side"], orderInfo["instrument_id"], &orderInfo)
+}
+
 /*
 批量下单
 下指定币对的多个订单（每次只能下最多4个币对且每个币对可批量下10个单）。
@@ -391,13 +423,45 @@ HTTP请求
 POST /api/spot/v3/batch_orders
 */
 func (client *Client) PostSpotBatchOrders(orderInfos *[]map[string]string) (*map[string]interface{}, error) {
+	if orderInfos != nil {
+		riskOrders := []RiskOrder{}
+		for _, order := range *orderInfos {
+			riskOrders = append(riskOrders, riskOrderOf(MARKET_SPOT, order["instrument_id"], order))
+		}
+		if err := client.Risk.CheckOrders(riskOrders...); err != nil {
+			return nil, err
+		}
+	}
+	var orders []*ManagedOrder
+	if orderInfos != nil {
+		var infos []map[string]string
+		infos, orders = client.Orders.postingAll(MARKET_SPOT, "", *orderInfos)
+		orderInfos = &infos
+	}
 	r := map[string]interface{}{}
-	if _, err := client.Request(POST, SPOT_BATCH_ORDERS, orderInfos, &r); err != nil {
+	_, err := client.Request(POST, SPOT_BATCH_ORDERS, orderInfos, &r)
+	client.Orders.posted(r, err, orders...)
+	if err != nil {
 		return nil, err
 	}
 	return &r, nil
 }
 
+/*
+批量下单
+使用SpotOrderBuilder批量下单。
+
+HTTP请求
+POST /api/spot/v3/batch_orders
+*/
+func (client *Client) PostSpotBatchOrdersBy(orders ...SpotOrderBuilder) (*map[string]interface{}, error) {
+	orderInfos, err := BuildSpotBatchOrders(orders...)
+	if err != nil {
+		return nil, err
+	}
+	return client.PostSpotBatchOrders(&orderInfos)
+}
+
 /*
 撤销指定订单
 撤销之前下的未完成订单。
@@ -437,3 +501,64 @@ func (client *Client) PostSpotCancelBatchOrders(orderInfos *[]map[string]interfa
 	}
 	return &r, nil
 }
+
+/*
+修改订单
+修改未完成订单的价格或数量，通过order_id或client_oid指定订单。
+
+限速规则：40次/2s
+HTTP请求
+POST /api/spot/v3/amend_order/<instrument_id>
+
+请求示例
+POST /api/spot/v3/amend_order/BTC-USDT{"order_id":"2510789768709120","new_price":"9000","cancel_on_fail":"1","request_id":"15627278964280001"}
+*/
+func (client *Client) PostSpotAmendOrder(instrumentId string, params *AmendOrderParams) (*AmendOrderResult, error) {
+	if err := params.prepare(); err != nil {
+		return nil, err
+	}
+	if err := client.Risk.CheckOrders(amendRiskOrder(MARKET_SPOT, instrumentId, params)); err != nil {
+		return nil, err
+	}
+	body := *params
+	body.InstrumentId = ""
+
+	r := AmendOrderResult{}
+	uri := GetInstrumentIdUri(SPOT_AMEND_ORDER, instrumentId)
+	if _, err := client.Request(POST, uri, body, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+/*
+批量修改订单
+修改指定币对的多个未完成订单，每个订单需设置instrument_id（每次最多4个币对且每个币对最多10个单）。
+
+限速规则：20次/2s
+HTTP请求
+POST /api/spot/v3/amend_batch_orders
+*/
+func (client *Client) PostSpotAmendBatchOrders(orders []*AmendOrderParams) (map[string][]AmendOrderResult, error) {
+	for _, order := range orders {
+		if err := order.prepare(); err != nil {
+			return nil, err
+		}
+		if order.InstrumentId == "" {
+			return nil, errors.New("amend order: instrument_id is required by batch orders")
+		}
+	}
+	riskOrders := []RiskOrder{}
+	for _, order := range orders {
+		riskOrders = append(riskOrders, amendRiskOrder(MARKET_SPOT, order.InstrumentId, order))
+	}
+	if err := client.Risk.CheckOrders(riskOrders...); err != nil {
+		return nil, err
+	}
+
+	r := map[string][]AmendOrderResult{}
+	if _, err := client.Request(POST, SPOT_AMEND_BATCH_ORDERS, orders, &r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
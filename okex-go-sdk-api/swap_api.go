@@ -130,9 +130,15 @@ HTTP请求
 POST /api/swap/v3/order
 */
 func (client *Client) PostSwapOrder(instrumentId string, order *BasePlaceOrderInfo) (*SwapOrderResult, error) {
+	if err := client.Risk.CheckOrders(swapRiskOrder(instrumentId, order)); err != nil {
+		return nil, err
+	}
+	placed, orders := client.Orders.postingSwap(instrumentId, []*BasePlaceOrderInfo{order})
 	or := SwapOrderResult{}
-	info := PlaceOrderInfo{*order, instrumentId}
-	if _, err := client.Request(POST, SWAP_ORDER, info, &or); err != nil {
+	info := PlaceOrderInfo{*placed[0], instrumentId}
+	_, err := client.Request(POST, SWAP_ORDER, info, &or)
+	client.Orders.posted(or, err, orders...)
+	if err != nil {
 		return nil, err
 	}
 	return &or, nil
@@ -145,9 +151,19 @@ HTTP请求
 POST /api/swap/v3/orders
 */
 func (client *Client) PostSwapOrders(instrumentId string, orders []*BasePlaceOrderInfo) (*SwapOrdersResult, error) {
+	riskOrders := []RiskOrder{}
+	for _, order := range orders {
+		riskOrders = append(riskOrders, swapRiskOrder(instrumentId, order))
+	}
+	if err := client.Risk.CheckOrders(riskOrders...); err != nil {
+		return nil, err
+	}
+	orders, tracked := client.Orders.postingSwap(instrumentId, orders)
 	sor := SwapOrdersResult{}
 	orderData := PlaceOrdersInfo{InstrumentId: instrumentId, OrderData: orders}
-	if _, err := client.Request(POST, SWAP_ORDERS, orderData, &sor); err != nil {
+	_, err := client.Request(POST, SWAP_ORDERS, orderData, &sor)
+	client.Orders.posted(sor, err, tracked...)
+	if err != nil {
 		return nil, err
 	}
 	return &sor, nil
@@ -539,3 +555,222 @@ func (client *Client) GetSwapRate() (*SwapRate, error) {
 	}
 	return &sr, nil
 }
+
+/*
+委托策略下单
+提供止盈止损、跟踪委托、冰山委托和时间加权委托策略。
+
+HTTP请求
+POST /api/swap/v3/order_algo
+*/
+func (client *Client) PostSwapAlgoOrder(params *AlgoOrderParams) (*SwapAlgoOrderResult, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	if err := client.Risk.CheckOrders(algoRiskOrder(MARKET_SWAP, params)); err != nil {
+		return nil, err
+	}
+	r := SwapAlgoOrderResult{}
+	if _, err := client.Request(POST, SWAP_ORDER_ALGO, params, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+/*
+委托策略撤单
+根据指定的algo_id撤销某个合约的未完成策略委托，每次最多可撤10个。
+
+HTTP请求
+POST /api/swap/v3/cancel_algos
+*/
+func (client *Client) PostSwapCancelAlgoOrders(instrumentId string, orderType int, algoIds []string) (*SwapCancelAlgoOrdersResult, error) {
+	params := CancelAlgoOrdersParams{InstrumentId: instrumentId, AlgoIds: algoIds, OrderType: Int2String(orderType)}
+	r := SwapCancelAlgoOrdersResult{}
+	if _, err := client.Request(POST, SWAP_CANCEL_ALGOS, params, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+/*
+获取委托单列表
+列出您当前所有的策略委托单，status和algo_id必填其一。
+
+HTTP请求
+GET /api/swap/v3/order_algo/<instrument_id>
+
+请求示例
+GET /api/swap/v3/order_algo/BTC-USD-SWAP?order_type=1&status=1&limit=20
+*/
+func (client *Client) GetSwapAlgoOrders(instrumentId string, orderType int, optionalParams map[string]string) (*AlgoOrderList, error) {
+	params := NewParams()
+	params["order_type"] = Int2String(orderType)
+	for k, v := range optionalParams {
+		if len(v) > 0 {
+			params[k] = v
+		}
+	}
+	if params["status"] == "" && params["algo_id"] == "" {
+		return nil, errors.New("Request Parameter's not correct, status or algo_id is required.")
+	}
+
+	uri := BuildParams(GetInstrumentIdUri(SWAP_INSTRUMENT_ORDER_ALGO_LIST, instrumentId), params)
+	r := AlgoOrderList{}
+	if _, err := client.Request(GET, uri, nil, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+/*
+市价全平
+按市价平掉某个合约一个方向的全部持仓。
+
+HTTP请求
+POST /api/swap/v3/close_position
+
+请求示例
+POST /api/swap/v3/close_position{"instrument_id":"BTC-USD-SWAP","direction":"long"}
+*/
+func (client *Client) PostSwapClosePosition(instrumentId, direction string) (*SwapClosePositionResult, error) {
+	if direction != DIRECTION_LONG && direction != DIRECTION_SHORT {
+		return nil, errors.New("Request Parameter's not correct, direction must be long or short.")
+	}
+	params := ClosePositionData{InstrumentId: instrumentId, Direction: direction}
+	r := SwapClosePositionResult{}
+	if _, err := client.Request(POST, SWAP_CLOSE_POSITION, params, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+/*
+Close all the positions of an underlying at market price, eg: underlying = BTC-USD
+The side of every position is checked before the first request.
+*/
+func (client *Client) PostSwapClosePositionsByUnderlying(underlying string) ([]SwapClosePositionResult, error) {
+	positions, err := client.GetSwapPositions()
+	if err != nil {
+		return nil, err
+	}
+
+	var closing []ClosePositionData
+	for _, position := range *positions {
+		for _, holding := range position.Holding {
+			if !strings.HasPrefix(holding.InstrumentId, underlying+"-") || holding.Position <= 0 {
+				continue
+			}
+			if holding.Side != DIRECTION_LONG && holding.Side != DIRECTION_SHORT {
+				return nil, errors.New("Request Parameter's not correct, direction must be long or short.")
+			}
+			closing = append(closing, ClosePositionData{InstrumentId: holding.InstrumentId, Direction: holding.Side})
+		}
+	}
+
+	var results []SwapClosePositionResult
+	for _, data := range closing {
+		r, err := client.PostSwapClosePosition(data.InstrumentId, data.Direction)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, *r)
+	}
+	return results, nil
+}
+
+/*
+Cancel all the unfinished orders of an instrument.
+The orders are paged through GetSwapOrderByInstrumentId and cancelled by PostSwapBatchCancelOrders, 10 orders per request.
+*/
+func (client *Client) CancelAllSwapInstrumentOrders(instrumentId string) ([]SwapCancelOrderResult, error) {
+	var orderIds []string
+	params := NewParams()
+	params["state"] = Int2String(ORDER_STATE_UNFINISHED)
+	params["limit"] = "100"
+	for {
+		orders, err := client.GetSwapOrderByInstrumentId(instrumentId, params)
+		if err != nil {
+			return nil, err
+		}
+		for _, order := range orders.OrderInfo {
+			if order.OrderId != "" {
+				orderIds = append(orderIds, order.OrderId)
+			}
+		}
+		if len(orders.OrderInfo) < 100 || len(orderIds) == 0 {
+			break
+		}
+		params["after"] = orderIds[len(orderIds)-1]
+	}
+
+	var results []SwapCancelOrderResult
+	for i := 0; i < len(orderIds); i += 10 {
+		upper := i + 10
+		if upper > len(orderIds) {
+			upper = len(orderIds)
+		}
+		r, err := client.PostSwapBatchCancelOrders(instrumentId, orderIds[i:upper])
+		if err != nil {
+			return results, err
+		}
+		results = append(results, *r)
+	}
+	return results, nil
+}
+
+/*
+修改订单
+修改未完成订单的价格或数量，通过order_id或client_oid指定订单。
+
+HTTP请求
+POST /api/swap/v3/amend_order/<instrument_id>
+
+请求示例
+POST /api/swap/v3/amend_order/BTC-USD-SWAP{"client_oid":"a20190704","new_price":"9000","request_id":"15627278964280001"}
+*/
+func (client *Client) PostSwapAmendOrder(instrumentId string, params *AmendOrderParams) (*AmendOrderResult, error) {
+	if err := params.prepare(); err != nil {
+		return nil, err
+	}
+	if err := client.Risk.CheckOrders(amendRiskOrder(MARKET_SWAP, instrumentId, params)); err != nil {
+		return nil, err
+	}
+	body := *params
+	body.InstrumentId = ""
+
+	r := AmendOrderResult{}
+	uri := GetInstrumentIdUri(SWAP_AMEND_ORDER, instrumentId)
+	if _, err := client.Request(POST, uri, body, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+/*
+批量修改订单
+修改某个合约的多个未完成订单，每次最多10个。
+
+HTTP请求
+POST /api/swap/v3/amend_batch_orders/<instrument_id>
+*/
+func (client *Client) PostSwapAmendBatchOrders(instrumentId string, orders []*AmendOrderParams) (*AmendBatchOrdersResult, error) {
+	params, err := newAmendBatchOrdersParams(orders)
+	if err != nil {
+		return nil, err
+	}
+	riskOrders := []RiskOrder{}
+	for _, order := range orders {
+		riskOrders = append(riskOrders, amendRiskOrder(MARKET_SWAP, instrumentId, order))
+	}
+	if err := client.Risk.CheckOrders(riskOrders...); err != nil {
+		return nil, err
+	}
+
+	r := AmendBatchOrdersResult{}
+	uri := GetInstrumentIdUri(SWAP_AMEND_BATCH_ORDERS, instrumentId)
+	if _, err := client.Request(POST, uri, params, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
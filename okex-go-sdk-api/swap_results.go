@@ -234,8 +234,12 @@ type SwapAccountHolds BaseInstrumentAmount
 
 type SwapFundingTime struct {
 	BizWarmTips
-	InstrumentId string `json:"instrument_id"`
-	FundingTime  string `json:"funding_time"`
+	InstrumentId   string `json:"instrument_id"`
+	FundingTime    string `json:"funding_time"`
+	FundingRate    string `json:"funding_rate"`
+	EstimatedRate  string `json:"estimated_rate"`
+	InterestRate   string `json:"interest_rate"`
+	SettlementTime string `json:"settlement_time"`
 }
 
 type SwapMarkPrice struct {
@@ -254,3 +258,35 @@ type BaseHistoricalFundingRate struct {
 }
 
 type SwapHistoricalFundingRateList []BaseHistoricalFundingRate
+
+type SwapAlgoOrderResult struct {
+	Code      string `json:"code"`
+	Msg       string `json:"msg"`
+	DetailMsg string `json:"detailMsg"`
+	Data      struct {
+		AlgoId       string `json:"algo_id"`
+		InstrumentId string `json:"instrument_id"`
+		OrderType    string `json:"order_type"`
+		Result       string `json:"result"`
+	} `json:"data"`
+}
+
+type SwapCancelAlgoOrdersResult struct {
+	Code      string `json:"code"`
+	Msg       string `json:"msg"`
+	DetailMsg string `json:"detailMsg"`
+	Data      struct {
+		AlgoIds      interface{} `json:"algo_ids"`
+		InstrumentId string      `json:"instrument_id"`
+		Result       string      `json:"result"`
+	} `json:"data"`
+}
+
+type SwapClosePositionResult struct {
+	BizWarmTips
+	InstrumentId string `json:"instrument_id"`
+	Direction    string `json:"direction"`
+	Result       string `json:"result"`
+	ErrorCode    string `json:"error_code"`
+	ErrorMessage string `json:"error_message"`
+}
@@ -22,6 +22,11 @@ const (
 	ACCOUNT_WITHRAWAL_HISTORY          = "/api/account/v3/withdrawal/history"
 	ACCOUNT_WITHRAWAL_HISTORY_CURRENCY = "/api/account/v3/withdrawal/history/{currency}"
 	ACCOUNT_TRANSFER                   = "/api/account/v3/transfer"
+	ACCOUNT_ONHOLD                     = "/api/account/v3/onhold"
+	ACCOUNT_LOCK                       = "/api/account/v3/lock"
+	ACCOUNT_UNLOCK                     = "/api/account/v3/unlock"
+	ACCOUNT_SUB_ACCOUNT                = "/api/account/v3/sub-account"
+	ACCOUNT_SUB_ACCOUNT_LIST           = "/api/account/v3/sub-account/list"
 
 	FUTURES_RATE                          = "/api/futures/v3/rate"
 	FUTURES_INSTRUMENTS                   = "/api/futures/v3/instruments"
@@ -53,6 +58,12 @@ const (
 	FUTURES_INSTRUMENT_ORDER_CANCEL       = "/api/futures/v3/cancel_order/{instrument_id}/{order_client_id}"
 	FUTURES_INSTRUMENT_ORDER_BATCH_CANCEL = "/api/futures/v3/cancel_batch_orders/{instrument_id}"
 	FUTURES_FILLS                         = "/api/futures/v3/fills"
+	FUTURES_CLOSE_POSITION                = "/api/futures/v3/close_position"
+	FUTURES_AMEND_ORDER                   = "/api/futures/v3/amend_order/{instrument_id}"
+	FUTURES_AMEND_BATCH_ORDERS            = "/api/futures/v3/amend_batch_orders/{instrument_id}"
+	FUTURES_ORDER_ALGO                    = "/api/futures/v3/order_algo"
+	FUTURES_CANCEL_ALGOS                  = "/api/futures/v3/cancel_algos"
+	FUTURES_INSTRUMENT_ORDER_ALGO_LIST    = "/api/futures/v3/order_algo/{instrument_id}"
 
 	MARGIN_ACCOUNTS                         = "/api/margin/v3/accounts"
 	MARGIN_ACCOUNTS_INSTRUMENT              = "/api/margin/v3/accounts/{instrument_id}"
@@ -87,6 +98,8 @@ const (
 	SPOT_INSTRUMENT_TICKER        = "/api/spot/v3/instruments/{instrument_id}/ticker"
 	SPOT_INSTRUMENT_TRADES        = "/api/spot/v3/instruments/{instrument_id}/trades"
 	SPOT_INSTRUMENT_CANDLES       = "/api/spot/v3/instruments/{instrument_id}/candles"
+	SPOT_AMEND_ORDER              = "/api/spot/v3/amend_order/{instrument_id}"
+	SPOT_AMEND_BATCH_ORDERS       = "/api/spot/v3/amend_batch_orders"
 
 	SWAP_INSTRUMENT_ACCOUNT                 = "/api/swap/v3/{instrument_id}/accounts"
 	SWAP_INSTRUMENT_POSITION                = "/api/swap/v3/{instrument_id}/position"
@@ -115,7 +128,21 @@ const (
 	SWAP_ORDER                              = "/api/swap/v3/order"
 	SWAP_ORDERS                             = "/api/swap/v3/orders"
 	SWAP_POSITION                           = "/api/swap/v3/position"
+	SWAP_CLOSE_POSITION                     = "/api/swap/v3/close_position"
+	SWAP_AMEND_ORDER                        = "/api/swap/v3/amend_order/{instrument_id}"
+	SWAP_AMEND_BATCH_ORDERS                 = "/api/swap/v3/amend_batch_orders/{instrument_id}"
 
-	SWAP_CANCEL_BATCH_ORDERS = "/api/swap/v3/cancel_batch_orders/{instrument_id}"
-	SWAP_CANCEL_ORDER        = "/api/swap/v3/cancel_order/{instrument_id}/{order_id}"
+	SWAP_CANCEL_BATCH_ORDERS        = "/api/swap/v3/cancel_batch_orders/{instrument_id}"
+	SWAP_CANCEL_ORDER               = "/api/swap/v3/cancel_order/{instrument_id}/{order_id}"
+	SWAP_ORDER_ALGO                 = "/api/swap/v3/order_algo"
+	SWAP_CANCEL_ALGOS               = "/api/swap/v3/cancel_algos"
+	SWAP_INSTRUMENT_ORDER_ALGO_LIST = "/api/swap/v3/order_algo/{instrument_id}"
+
+	ETT_ACCOUNTS                 = "/api/ett/v3/accounts"
+	ETT_ACCOUNTS_CURRENCY        = "/api/ett/v3/accounts/{currency}"
+	ETT_ACCOUNTS_CURRENCY_LEDGER = "/api/ett/v3/accounts/{currency}/ledger"
+	ETT_ORDERS                   = "/api/ett/v3/orders"
+	ETT_ORDERS_BY_ID             = "/api/ett/v3/orders/{order_id}"
+	ETT_CONSTITUENTS             = "/api/ett/v3/constituents/{ett}"
+	ETT_DEFINE_PRICE             = "/api/ett/v3/define-price/{ett}"
 )
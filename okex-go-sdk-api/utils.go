@@ -21,6 +21,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -129,6 +130,17 @@ func EpochTime() string {
 	return epoch
 }
 
+var requestIdSeq int64
+
+/*
+ Get a unique request id for the idempotent requests, eg: amend order
+  eg: 15627278964280001
+*/
+func NewRequestId() string {
+	seq := atomic.AddInt64(&requestIdSeq, 1) % 10000
+	return Int64ToString(time.Now().UnixNano()/1000000*10000 + seq)
+}
+
 /*
  Get a iso time
   eg: 2018-03-16T18:02:48.284Z
@@ -225,6 +237,7 @@ func ParseRequestParams(params interface{}) (string, *bytes.Reader, error) {
    OK-ACCESS-SIGN: (Use your setting, auto sign and add)
    OK-ACCESS-TIMESTAMP: (Auto add)
    OK-ACCESS-PASSPHRASE: Your setting
+   x-simulated-trading: 1      (Config.Simulated only)
 */
 func Headers(request *http.Request, config Config, timestamp string, sign string) {
 	request.Header.Add(ACCEPT, APPLICATION_JSON)
@@ -234,6 +247,9 @@ func Headers(request *http.Request, config Config, timestamp string, sign string
 	request.Header.Add(OK_ACCESS_SIGN, sign)
 	request.Header.Add(OK_ACCESS_TIMESTAMP, timestamp)
 	request.Header.Add(OK_ACCESS_PASSPHRASE, config.Passphrase)
+	if config.Simulated {
+		request.Header.Add(OK_SIMULATED_TRADING, "1")
+	}
 }
 
 /*
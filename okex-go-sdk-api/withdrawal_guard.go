@@ -0,0 +1,347 @@
+package okex
+
+/*
+ WithdrawalGuard wraps PostAccountWithdrawal with a two step flow. Prepare checks the
+ request against the address allowlist, the withdrawal fee range and the daily limit,
+ and hands out a one-off confirmation token; Withdraw only sends a request which was
+ prepared with the same parameters and confirmed with that token.
+
+	guard := NewWithdrawalGuard(client)
+	guard.Allow("BTC", "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2")
+	guard.SetDailyLimit("BTC", 0.5)
+	ticket, err := guard.Prepare(&WithdrawalRequest{Currency: "BTC", Amount: "0.1", ...})
+	result, err := guard.Withdraw(ticket.Request, ticket.Token)
+*/
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	/*
+	 withdrawal destination: 2: OKCoin 3: OKEx 4: digital currency address
+	*/
+	WITHDRAWAL_DESTINATION_OKCOIN  = "2"
+	WITHDRAWAL_DESTINATION_OKEX    = "3"
+	WITHDRAWAL_DESTINATION_ADDRESS = "4"
+
+	/*
+	 withdrawal status which do not move funds: -2: canceled -1: failed
+	*/
+	WITHDRAWAL_STATUS_CANCELED = "-2"
+	WITHDRAWAL_STATUS_FAILED   = "-1"
+)
+
+var (
+	ERR_WITHDRAWAL_PARAMS      = errors.New(`withdrawal: currency, amount, destination, to_address and trade_pwd are required`)
+	ERR_WITHDRAWAL_ADDRESS     = errors.New(`withdrawal: to_address is not in the allowlist of the currency`)
+	ERR_WITHDRAWAL_FEE         = errors.New(`withdrawal: fee is outside the range of GetAccountWithdrawalFeeByCurrency`)
+	ERR_WITHDRAWAL_DAILY_LIMIT = errors.New(`withdrawal: daily limit of the currency exceeded`)
+	ERR_WITHDRAWAL_TOKEN       = errors.New(`withdrawal: confirmation token is missing, expired or does not match the request`)
+)
+
+type WithdrawalRequest struct {
+	Currency    string `json:"currency"`
+	Amount      string `json:"amount"`
+	Destination string `json:"destination"`
+	ToAddress   string `json:"to_address"`
+	TradePwd    string `json:"trade_pwd"`
+	Fee         string `json:"fee"`
+}
+
+func (r *WithdrawalRequest) Validate() error {
+	if r.Currency == "" || toFloat(r.Amount) <= 0 || r.Destination == "" || r.ToAddress == "" || r.TradePwd == "" {
+		return ERR_WITHDRAWAL_PARAMS
+	}
+	return nil
+}
+
+func (r *WithdrawalRequest) params() map[string]interface{} {
+	return map[string]interface{}{
+		"currency":    r.Currency,
+		"amount":      r.Amount,
+		"destination": r.Destination,
+		"to_address":  r.ToAddress,
+		"trade_pwd":   r.TradePwd,
+		"fee":         r.Fee,
+	}
+}
+
+/*
+A prepared withdrawal, Request has its fee filled in and must be passed back unchanged with Token.
+*/
+type WithdrawalTicket struct {
+	Request   WithdrawalRequest
+	Token     string
+	ExpiresAt time.Time
+}
+
+/*
+Result of a guarded withdrawal. On a dry-run nothing is sent and Request is the would-be request
+body with the trade password masked.
+*/
+type GuardedWithdrawal struct {
+	DryRun  bool
+	Request map[string]interface{}
+	Result  map[string]interface{}
+}
+
+type WithdrawalGuard struct {
+	client *Client
+	lock   sync.Mutex
+
+	allowlist   map[string]map[string]bool
+	dailyLimits map[string]float64
+	tickets     map[string]WithdrawalRequest
+	expires     map[string]time.Time
+
+	day       string
+	withdrawn map[string]float64 // currency -> amount of the current UTC day, loaded from the history once a day
+
+	// Validity of a confirmation token, 1 minute by default.
+	TokenTTL time.Duration
+	// Return the would-be request instead of sending it.
+	DryRun bool
+
+	now func() time.Time
+}
+
+func NewWithdrawalGuard(client *Client) *WithdrawalGuard {
+	return &WithdrawalGuard{
+		client:      client,
+		allowlist:   map[string]map[string]bool{},
+		dailyLimits: map[string]float64{},
+		tickets:     map[string]WithdrawalRequest{},
+		expires:     map[string]time.Time{},
+		withdrawn:   map[string]float64{},
+		TokenTTL:    time.Minute,
+		now:         time.Now,
+	}
+}
+
+/*
+Add addresses, or OKCoin/OKEx accounts, a currency may be withdrawn to.
+A currency without addresses cannot be withdrawn.
+*/
+func (g *WithdrawalGuard) Allow(currency string, addresses ...string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	currency = strings.ToUpper(currency)
+	if g.allowlist[currency] == nil {
+		g.allowlist[currency] = map[string]bool{}
+	}
+	for _, address := range addresses {
+		g.allowlist[currency][address] = true
+	}
+}
+
+/*
+The maximum amount of a currency withdrawn in a UTC day, 0 removes the limit.
+Withdrawals made outside the guard are counted through GetAccountWithdrawalHistoryByCurrency.
+*/
+func (g *WithdrawalGuard) SetDailyLimit(currency string, amount float64) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.dailyLimits[strings.ToUpper(currency)] = amount
+}
+
+/*
+Check a withdrawal and return a ticket to confirm it with. An empty fee is set to the minimum fee.
+*/
+func (g *WithdrawalGuard) Prepare(request *WithdrawalRequest) (*WithdrawalTicket, error) {
+	if request == nil {
+		return nil, ERR_WITHDRAWAL_PARAMS
+	}
+	r := *request
+	if _, err := g.check(&r, false); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	ticket := WithdrawalTicket{Request: r, Token: hex.EncodeToString(b), ExpiresAt: g.now().Add(g.TokenTTL)}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	for token, expires := range g.expires {
+		if g.now().After(expires) {
+			delete(g.tickets, token)
+			delete(g.expires, token)
+		}
+	}
+	g.tickets[ticket.Token] = ticket.Request
+	g.expires[ticket.Token] = ticket.ExpiresAt
+	return &ticket, nil
+}
+
+/*
+Send a prepared withdrawal. The token is consumed, the checks are run again before sending and
+the amount is reserved against the daily limit until the request fails.
+*/
+func (g *WithdrawalGuard) Withdraw(request WithdrawalRequest, token string) (*GuardedWithdrawal, error) {
+	g.lock.Lock()
+	prepared, ok := g.tickets[token]
+	expires := g.expires[token]
+	delete(g.tickets, token)
+	delete(g.expires, token)
+	g.lock.Unlock()
+	if !ok || prepared != request || g.now().After(expires) {
+		return nil, ERR_WITHDRAWAL_TOKEN
+	}
+	reserved, err := g.check(&request, true)
+	if err != nil {
+		return nil, err
+	}
+	currency, amount := strings.ToUpper(request.Currency), toFloat(request.Amount)
+
+	if g.DryRun {
+		g.release(currency, reserved, amount)
+		params := request.params()
+		params["trade_pwd"] = "******"
+		return &GuardedWithdrawal{DryRun: true, Request: params}, nil
+	}
+
+	r := map[string]interface{}{}
+	if _, err := g.client.Request(POST, ACCOUNT_WITHRAWAL, request.params(), &r); err != nil {
+		g.release(currency, reserved, amount)
+		return nil, err
+	}
+	if reserved == "" {
+		g.lock.Lock()
+		if _, ok := g.withdrawn[currency]; ok {
+			g.withdrawn[currency] += amount
+		}
+		g.lock.Unlock()
+	}
+	return &GuardedWithdrawal{Result: r}, nil
+}
+
+/*
+Give back an amount reserved on a day, nothing is reserved when day is empty.
+*/
+func (g *WithdrawalGuard) release(currency, day string, amount float64) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if day != "" && g.day == day {
+		g.withdrawn[currency] -= amount
+	}
+}
+
+/*
+Run the checks, with reserve the amount is added to the amount withdrawn today under the same lock
+as the daily limit check. Returns the day of the reservation, empty when nothing was reserved.
+*/
+func (g *WithdrawalGuard) check(r *WithdrawalRequest, reserve bool) (string, error) {
+	if err := r.Validate(); err != nil {
+		return "", err
+	}
+	currency := strings.ToUpper(r.Currency)
+
+	g.lock.Lock()
+	allowed := g.allowlist[currency][r.ToAddress]
+	limit := g.dailyLimits[currency]
+	g.lock.Unlock()
+	if !allowed {
+		return "", ERR_WITHDRAWAL_ADDRESS
+	}
+
+	if r.Destination == WITHDRAWAL_DESTINATION_ADDRESS {
+		if err := g.checkFee(r); err != nil {
+			return "", err
+		}
+	} else if r.Fee == "" {
+		r.Fee = "0"
+	}
+
+	if limit <= 0 {
+		return "", nil
+	}
+	day, err := g.withdrawnToday(currency)
+	if err != nil {
+		return "", err
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.withdrawn[currency]+toFloat(r.Amount) > limit {
+		return "", ERR_WITHDRAWAL_DAILY_LIMIT
+	}
+	if !reserve || g.day != day {
+		return "", nil
+	}
+	g.withdrawn[currency] += toFloat(r.Amount)
+	return day, nil
+}
+
+func (g *WithdrawalGuard) checkFee(r *WithdrawalRequest) error {
+	fees, err := g.client.GetAccountWithdrawalFeeByCurrency(&r.Currency)
+	if err != nil {
+		return err
+	}
+	for _, fee := range *fees {
+		if currency, _ := fee["currency"].(string); !strings.EqualFold(currency, r.Currency) {
+			continue
+		}
+		minFee, _ := fee["min_fee"].(string)
+		maxFee, _ := fee["max_fee"].(string)
+		if r.Fee == "" {
+			r.Fee = minFee
+		}
+		if toFloat(r.Fee) < toFloat(minFee) || toFloat(r.Fee) > toFloat(maxFee) {
+			return ERR_WITHDRAWAL_FEE
+		}
+		return nil
+	}
+	return ERR_WITHDRAWAL_FEE
+}
+
+/*
+Load the amount of a currency withdrawn in the current UTC day from the history, once a day.
+Returns the day.
+*/
+func (g *WithdrawalGuard) withdrawnToday(currency string) (string, error) {
+	day := g.now().UTC().Format("2006-01-02")
+	g.lock.Lock()
+	if g.day != day {
+		g.day = day
+		g.withdrawn = map[string]float64{}
+	}
+	_, ok := g.withdrawn[currency]
+	g.lock.Unlock()
+	if ok {
+		return day, nil
+	}
+
+	history, err := g.client.GetAccountWithdrawalHistoryByCurrency(strings.ToLower(currency))
+	if err != nil {
+		return "", err
+	}
+	withdrawn := 0.0
+	for _, h := range *history {
+		status := fmt.Sprint(h["status"])
+		if status == WITHDRAWAL_STATUS_CANCELED || status == WITHDRAWAL_STATUS_FAILED {
+			continue
+		}
+		timestamp, _ := h["timestamp"].(string)
+		if !strings.HasPrefix(timestamp, day) {
+			continue
+		}
+		amount, _ := h["amount"].(string)
+		withdrawn += toFloat(amount)
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if _, ok := g.withdrawn[currency]; !ok && g.day == day {
+		// a concurrent load may have stored the same history first
+		g.withdrawn[currency] = withdrawn
+	}
+	return day, nil
+}
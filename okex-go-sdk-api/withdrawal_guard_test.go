@@ -0,0 +1,162 @@
+package okex
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFakeWithdrawalServer() *fakeServer {
+	s := newFakeServer()
+	s.handle(GET, ACCOUNT_WITHRAWAL_FEE, `[{"currency":"BTC","min_fee":"0.0005","max_fee":"0.01"}]`)
+	s.handle(GET, "/api/account/v3/withdrawal/history/btc", `[
+		{"amount":"0.3","currency":"BTC","status":"2","timestamp":"2019-04-16T02:00:00.000Z"},
+		{"amount":"5","currency":"BTC","status":"-2","timestamp":"2019-04-16T03:00:00.000Z"},
+		{"amount":"1","currency":"BTC","status":"2","timestamp":"2019-04-15T03:00:00.000Z"}]`)
+	s.handle(POST, ACCOUNT_WITHRAWAL, `{"amount":"0.1","withdrawal_id":"67485","currency":"btc","result":true}`)
+	return s
+}
+
+func newTestWithdrawalGuard(s *fakeServer) *WithdrawalGuard {
+	g := NewWithdrawalGuard(s.client())
+	g.now = func() time.Time { return time.Date(2019, 4, 16, 12, 0, 0, 0, time.UTC) }
+	g.Allow("btc", "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2")
+	g.SetDailyLimit("BTC", 0.5)
+	return g
+}
+
+func TestWithdrawalGuard_Checks(t *testing.T) {
+	s := newFakeWithdrawalServer()
+	defer s.Close()
+	g := newTestWithdrawalGuard(s)
+	request := WithdrawalRequest{Currency: "BTC", Amount: "0.1", Destination: WITHDRAWAL_DESTINATION_ADDRESS,
+		ToAddress: "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", TradePwd: "secret"}
+
+	_, err := g.Prepare(&WithdrawalRequest{Currency: "BTC", Amount: "0.1"})
+	assert.Equal(t, ERR_WITHDRAWAL_PARAMS, err)
+
+	other := request
+	other.ToAddress = "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy"
+	_, err = g.Prepare(&other)
+	assert.Equal(t, ERR_WITHDRAWAL_ADDRESS, err)
+
+	other = request
+	other.Fee = "0.02"
+	_, err = g.Prepare(&other)
+	assert.Equal(t, ERR_WITHDRAWAL_FEE, err)
+
+	// 0.3 withdrawn today already, the canceled and yesterday's withdrawals are not counted
+	other = request
+	other.Amount = "0.25"
+	_, err = g.Prepare(&other)
+	assert.Equal(t, ERR_WITHDRAWAL_DAILY_LIMIT, err)
+
+	ticket, err := g.Prepare(&request)
+	require.True(t, err == nil, err)
+	assert.Equal(t, "0.0005", ticket.Request.Fee)
+	assert.Equal(t, "", request.Fee)
+	assert.Equal(t, 0, len(s.requestsTo(POST, ACCOUNT_WITHRAWAL)))
+}
+
+func TestWithdrawalGuard_Confirmation(t *testing.T) {
+	s := newFakeWithdrawalServer()
+	defer s.Close()
+	g := newTestWithdrawalGuard(s)
+	request := WithdrawalRequest{Currency: "BTC", Amount: "0.1", Destination: WITHDRAWAL_DESTINATION_ADDRESS,
+		ToAddress: "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", TradePwd: "secret", Fee: "0.001"}
+
+	ticket, err := g.Prepare(&request)
+	require.True(t, err == nil, err)
+
+	_, err = g.Withdraw(ticket.Request, "guessed")
+	assert.Equal(t, ERR_WITHDRAWAL_TOKEN, err)
+	changed := ticket.Request
+	changed.Amount = "0.2"
+	ticket, _ = g.Prepare(&request)
+	_, err = g.Withdraw(changed, ticket.Token)
+	assert.Equal(t, ERR_WITHDRAWAL_TOKEN, err)
+
+	g.DryRun = true
+	ticket, _ = g.Prepare(&request)
+	dry, err := g.Withdraw(ticket.Request, ticket.Token)
+	require.True(t, err == nil, err)
+	assert.True(t, dry.DryRun)
+	assert.Equal(t, "0.1", dry.Request["amount"])
+	assert.Equal(t, "******", dry.Request["trade_pwd"])
+	assert.Equal(t, 0, len(s.requestsTo(POST, ACCOUNT_WITHRAWAL)))
+
+	g.DryRun = false
+	ticket, _ = g.Prepare(&request)
+	result, err := g.Withdraw(ticket.Request, ticket.Token)
+	require.True(t, err == nil, err)
+	assert.Equal(t, "67485", result.Result["withdrawal_id"])
+	require.Equal(t, 1, len(s.requestsTo(POST, ACCOUNT_WITHRAWAL)))
+	assert.True(t, strings.Contains(s.lastRequest().Body, `"trade_pwd":"secret"`))
+
+	// tokens are single use, and the withdrawn amount counts against the daily limit
+	_, err = g.Withdraw(ticket.Request, ticket.Token)
+	assert.Equal(t, ERR_WITHDRAWAL_TOKEN, err)
+	request.Amount = "0.15"
+	_, err = g.Prepare(&request)
+	assert.Equal(t, ERR_WITHDRAWAL_DAILY_LIMIT, err)
+	assert.Equal(t, 1, len(s.requestsTo(GET, "/api/account/v3/withdrawal/history/btc")))
+}
+
+func TestWithdrawalGuard_Reservation(t *testing.T) {
+	s := newFakeWithdrawalServer()
+	defer s.Close()
+	g := newTestWithdrawalGuard(s)
+	request := WithdrawalRequest{Currency: "BTC", Amount: "0.15", Destination: WITHDRAWAL_DESTINATION_ADDRESS,
+		ToAddress: "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", TradePwd: "secret", Fee: "0.001"}
+
+	// both fit the limit alone, the first one sent reserves its amount
+	first, err := g.Prepare(&request)
+	require.True(t, err == nil, err)
+	second, err := g.Prepare(&request)
+	require.True(t, err == nil, err)
+	release := make(chan struct{})
+	s.handleFunc(POST, ACCOUNT_WITHRAWAL, func(r fakeRequest) string {
+		<-release
+		return `{"amount":"0.15","withdrawal_id":"67486","currency":"btc","result":true}`
+	})
+	done := make(chan error)
+	go func() {
+		_, err := g.Withdraw(first.Request, first.Token)
+		done <- err
+	}()
+	for len(s.requestsTo(POST, ACCOUNT_WITHRAWAL)) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	_, err = g.Withdraw(second.Request, second.Token)
+	assert.Equal(t, ERR_WITHDRAWAL_DAILY_LIMIT, err)
+	close(release)
+	require.True(t, <-done == nil)
+
+	// a failed request gives its reservation back
+	g.SetDailyLimit("BTC", 0.6)
+	request.Amount = "0.1"
+	s.lock.Lock()
+	delete(s.responses, POST+" "+ACCOUNT_WITHRAWAL)
+	s.lock.Unlock()
+	ticket, _ := g.Prepare(&request)
+	_, err = g.Withdraw(ticket.Request, ticket.Token)
+	assert.True(t, err != nil)
+	s.handle(POST, ACCOUNT_WITHRAWAL, `{"amount":"0.1","withdrawal_id":"67487","currency":"btc","result":true}`)
+	ticket, _ = g.Prepare(&request)
+	_, err = g.Withdraw(ticket.Request, ticket.Token)
+	require.True(t, err == nil, err)
+	assert.Equal(t, 1, len(s.requestsTo(GET, "/api/account/v3/withdrawal/history/btc")))
+
+	// without a limit the history is not loaded, nor counted from the first withdrawal
+	g.Allow("ETH", "okex-account")
+	eth := WithdrawalRequest{Currency: "ETH", Amount: "2", Destination: WITHDRAWAL_DESTINATION_OKEX,
+		ToAddress: "okex-account", TradePwd: "secret"}
+	ticket, _ = g.Prepare(&eth)
+	_, err = g.Withdraw(ticket.Request, ticket.Token)
+	require.True(t, err == nil, err)
+	_, ok := g.withdrawn["ETH"]
+	assert.False(t, ok)
+}
@@ -44,11 +44,15 @@ type OKWSAgent struct {
 	hotLock        sync.RWMutex
 
 	processMut sync.Mutex
+
+	stop     chan struct{}
+	stopOnce sync.Once
 }
 
-func (a *OKWSAgent) Start(config *Config, startHook func() error) error { // 没有restart、stop的必要，删除stop和finize
+func (a *OKWSAgent) Start(config *Config, startHook func() error) error {
 	//a.baseUrl = config.WSEndpoint + "ws/v3?compress=true"
-	a.baseUrl = config.WSEndpoint + "?compress=true"
+	a.baseUrl = config.WebsocketEndpoint() + "?compress=true"
+	a.config = config
 	log.Printf("Connecting to %s", a.baseUrl)
 	//c, _, err := websocket.DefaultDialer.Dial(a.baseUrl, nil)
 	dialer := &websocket.Dialer{
@@ -58,7 +62,7 @@ func (a *OKWSAgent) Start(config *Config, startHook func() error) error { // 没
 	var c *websocket.Conn
 	var err error
 	for retry := 0; retry < 3; retry++ {
-		c, _, err = dialer.Dial(a.baseUrl, nil)
+		c, _, err = dialer.Dial(a.baseUrl, a.dialHeader())
 		if nil == err {
 			break
 		}
@@ -73,7 +77,6 @@ func (a *OKWSAgent) Start(config *Config, startHook func() error) error { // 没
 	log.Printf("Connected to %s", a.baseUrl)
 	a.lastPongTm = time.Now().Add(2 * maxPongInterval)
 	a.conn = c
-	a.config = config
 	a.startHook = startHook
 
 	a.wsEvtCh = make(chan interface{})
@@ -82,6 +85,8 @@ func (a *OKWSAgent) Start(config *Config, startHook func() error) error { // 没
 	a.activeChannels = make(map[string]bool)
 	a.subMap = make(map[string]ReceivedDataCallback)
 	a.hotDepthsMap = make(map[string]*WSHotDepths)
+	a.stop = make(chan struct{})
+	a.stopOnce = sync.Once{}
 
 	go a.work()
 	go a.receive()
@@ -91,6 +96,45 @@ func (a *OKWSAgent) Start(config *Config, startHook func() error) error { // 没
 	return nil
 }
 
+/*
+Stop closes the connection of a started agent and ends its goroutines, the connection is not
+redialed afterwards. Stopping twice is a no-op.
+*/
+func (a *OKWSAgent) Stop() error {
+	if a.stop == nil {
+		return nil
+	}
+	var err error
+	a.stopOnce.Do(func() {
+		close(a.stop)
+		a.connLock.Lock()
+		err = a.conn.Close()
+		a.connLock.Unlock()
+	})
+	return err
+}
+
+func (a *OKWSAgent) stopped() bool {
+	select {
+	case <-a.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+/*
+Handshake header of the connection, the demo environment of a simulated config is chosen by the
+simulated trading header like the REST requests.
+*/
+func (a *OKWSAgent) dialHeader() http.Header {
+	header := http.Header{}
+	if a.config != nil && a.config.Simulated {
+		header.Set(OK_SIMULATED_TRADING, "1")
+	}
+	return header
+}
+
 func (a *OKWSAgent) Subscribe(channel, filter string, cb ReceivedDataCallback) error {
 	a.processMut.Lock()
 	defer a.processMut.Unlock()
@@ -172,6 +216,10 @@ func (a *OKWSAgent) UnSubscribe(channel, filter string) error {
 	return nil
 }
 
+/*
+Login with the given api key and passphrase, signed by the secret key of the config the agent was
+started with. A simulated config logs in to the demo environment, so pass its demo credentials.
+*/
 func (a *OKWSAgent) Login(apiKey, passphrase string) error {
 	timestamp := EpochTime()
 	preHash := PreHashString(timestamp, GET, "/users/self/verify", "")
@@ -248,9 +296,13 @@ func (a *OKWSAgent) handleTableResponse(r interface{}) error {
 func (a *OKWSAgent) work() {
 	ticker := time.NewTicker(9 * time.Second)
 
+	defer ticker.Stop()
+
 	a.keepalive()
 	for {
 		select {
+		case <-a.stop:
+			return
 		case <-ticker.C:
 			if time.Now().Sub(a.lastPongTm) > maxPongInterval {
 				log.Printf("lastPongTm %s timeout, reset connection", a.lastPongTm.Local().Format(time.RFC3339))
@@ -272,8 +324,14 @@ func (a *OKWSAgent) work() {
 
 func (a *OKWSAgent) receive() {
 	for {
-		messageType, message, err := a.conn.ReadMessage()
+		a.connLock.Lock()
+		conn := a.conn
+		a.connLock.Unlock()
+		messageType, message, err := conn.ReadMessage()
 		if err != nil {
+			if a.stopped() {
+				return
+			}
 			log.Printf("a.conn.ReadMessage failed : %v", err)
 			a.connLock.Lock()
 			a.conn.Close()
@@ -281,7 +339,7 @@ func (a *OKWSAgent) receive() {
 			var conn *websocket.Conn
 			var err error
 			for retry := 0; retry < 3; retry++ {
-				conn, _, err = websocket.DefaultDialer.Dial(a.baseUrl, nil)
+				conn, _, err = websocket.DefaultDialer.Dial(a.baseUrl, a.dialHeader())
 				if nil == err {
 					break
 				}
@@ -293,6 +351,11 @@ func (a *OKWSAgent) receive() {
 				continue
 			}
 			a.connLock.Lock()
+			if a.stopped() {
+				conn.Close()
+				a.connLock.Unlock()
+				return
+			}
 			log.Printf("a.receive - conn changed from %p -> %p", a.conn.UnderlyingConn(), conn.UnderlyingConn())
 			a.conn = conn
 			a.connLock.Unlock()
@@ -328,10 +391,10 @@ func (a *OKWSAgent) receive() {
 
 		switch rsp.(type) {
 		case *WSErrorResponse:
-			a.wsErrCh <- rsp
+			a.deliver(a.wsErrCh, rsp)
 		case *WSEventResponse:
 			er := rsp.(*WSEventResponse)
-			a.wsEvtCh <- er
+			a.deliver(a.wsEvtCh, er)
 		case *WSDepthTableResponse:
 			dtr := rsp.(*WSDepthTableResponse)
 			a.hotLock.Lock()
@@ -348,17 +411,25 @@ func (a *OKWSAgent) receive() {
 			if nil != err {
 				dtr.Action = "corrupt"
 			}
-			a.wsTbCh <- dtr
+			a.deliver(a.wsTbCh, dtr)
 
 		case *WSTableResponse:
 			tb := rsp.(*WSTableResponse)
-			a.wsTbCh <- tb
+			a.deliver(a.wsTbCh, tb)
 		default:
 			log.Printf("LoadedRep: Warning - unknown response : %+v", string(txtMsg))
 		}
 	}
 }
 
+// deliver hands a response to work, unless the agent was stopped while it waits.
+func (a *OKWSAgent) deliver(ch chan interface{}, r interface{}) {
+	select {
+	case ch <- r:
+	case <-a.stop:
+	}
+}
+
 // GetOrderBook :
 func (a *OKWSAgent) GetOrderBook(channel, instrumentID string) *WSDepthItem {
 	a.hotLock.Lock()
@@ -360,6 +360,36 @@ func loadResponse(rspMsg []byte) (interface{}, error) {
 
 type ReceivedDataCallback func(interface{}) error
 
+/*
+Decode the data of a table response into a typed slice, eg: *[]AlgoOrderInfo
+*/
+func decodeTableData(data []interface{}, result interface{}) error {
+	jsonString, err := Struct2JsonString(data)
+	if err != nil {
+		return err
+	}
+	return JsonString2Struct(jsonString, result)
+}
+
+/*
+Callback of futures/order_algo and swap/order_algo channels, the pushed data is decoded into AlgoOrderInfo.
+
+	eg: agent.Subscribe(CHNL_SWAP_ORDER_ALGO, "BTC-USD-SWAP", NewAlgoOrderCallback(func(table string, orders []AlgoOrderInfo) error {...}))
+*/
+func NewAlgoOrderCallback(cb func(table string, orders []AlgoOrderInfo) error) ReceivedDataCallback {
+	return func(obj interface{}) error {
+		tb, ok := obj.(*WSTableResponse)
+		if !ok {
+			return nil
+		}
+		orders := []AlgoOrderInfo{}
+		if err := decodeTableData(tb.Data, &orders); err != nil {
+			return err
+		}
+		return cb(tb.Table, orders)
+	}
+}
+
 func defaultPrintData(obj interface{}) error {
 	switch obj.(type) {
 	case string:
@@ -33,9 +33,10 @@ const (
 	CHNL_FUTURES_DEPTH5          = "futures/depth5"          // 深度数据频道，每次返回前5档
 	CHNL_FUTURES_MARK_PRICE      = "futures/mark_price"      // 标记价格频道
 
-	CHNL_FUTURES_ACCOUNT  = "futures/account"  // 用户账户信息频道
-	CHNL_FUTURES_POSITION = "futures/position" // 用户持仓信息频道
-	CHNL_FUTURES_ORDER    = "futures/order"    // 用户交易数据频道
+	CHNL_FUTURES_ACCOUNT    = "futures/account"    // 用户账户信息频道
+	CHNL_FUTURES_POSITION   = "futures/position"   // 用户持仓信息频道
+	CHNL_FUTURES_ORDER      = "futures/order"      // 用户交易数据频道
+	CHNL_FUTURES_ORDER_ALGO = "futures/order_algo" // 用户策略委托数据频道
 
 	CHNL_SPOT_TICKER        = "spot/ticker"        // 行情数据频道
 	CHNL_SPOT_CANDLE60S     = "spot/candle60s"     // 1分钟k线数据频道
@@ -78,9 +79,12 @@ const (
 	CHNL_SWAP_DEPTH5        = "swap/depth5"        // 深度数据频道，每次返回前5档
 	CHNL_SWAP_MARK_PRICE    = "swap/mark_price"    // 标记价格频道
 
-	CHNL_SWAP_ACCOUNT  = "swap/account"  // 用户账户信息频道
-	CHNL_SWAP_POSITION = "swap/position" // 用户持仓信息频道
-	CHNL_SWAP_ORDER    = "swap/order"    // 用户交易数据频道
+	CHNL_SWAP_ACCOUNT    = "swap/account"    // 用户账户信息频道
+	CHNL_SWAP_POSITION   = "swap/position"   // 用户持仓信息频道
+	CHNL_SWAP_ORDER      = "swap/order"      // 用户交易数据频道
+	CHNL_SWAP_ORDER_ALGO = "swap/order_algo" // 用户策略委托数据频道
+
+	CHNL_INDEX_TICKER = "index/ticker" // 指数行情频道
 
 	CHNL_EVENT_SUBSCRIBE   = "subscribe"
 	CHNL_EVENT_UNSUBSCRIBE = "unsubscribe"